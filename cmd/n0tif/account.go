@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// defaultAccount names the account of the default profile
+const defaultAccount = "default"
+
+// Each account lives in its own profile, so "account add work" is the interactive
+// counterpart of "n0tif -profile work -server ... -save".
+
+// runAccountCommand handles "n0tif account add|update|remove|list|test <name>"
+func runAccountCommand(args []string) {
+	if len(args) == 0 {
+		printAccountUsage()
+		os.Exit(2)
+	}
+	action, args := args[0], args[1:]
+	if action == "list" {
+		listAccounts()
+		return
+	}
+	if len(args) != 1 {
+		printAccountUsage()
+		os.Exit(2)
+	}
+	if err := selectAccount(args[0]); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	switch action {
+	case "add":
+		addAccount(args[0])
+	case "update":
+		if err := updateAccount(args[0]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		restartForNewPassword()
+	case "remove":
+		removeAccount(args[0])
+	case "test":
+		if !storage.CredentialsExist() {
+			fmt.Printf("Error: account %s has no saved credentials\n", args[0])
+			os.Exit(1)
+		}
+		runTestConnectionCommand(nil)
+	default:
+		printAccountUsage()
+		os.Exit(2)
+	}
+}
+
+func printAccountUsage() {
+	fmt.Println("Usage: n0tif account list")
+	fmt.Println("       n0tif account add|update|remove|test <name>")
+	fmt.Printf("The account %q is the one used without -profile.\n", defaultAccount)
+}
+
+// selectAccount makes the profile of the named account the active one
+func selectAccount(name string) error {
+	if name == defaultAccount {
+		return storage.SetProfile("")
+	}
+	return storage.SetProfile(name)
+}
+
+// addAccount asks for the account details, verifies them with the server and saves them
+func addAccount(name string) {
+	if storage.CredentialsExist() && !promptYesNo(fmt.Sprintf("Account %s already exists. Replace it?", name)) {
+		return
+	}
+
+	cfg := config.GetDefaultConfig().Email
+	cfg.ImapServer = promptLine("IMAP server (e.g. imap.gmail.com)", "")
+	port := promptLine("IMAP port", strconv.Itoa(cfg.ImapPort))
+	cfg.Username = promptLine("Username or email address", "")
+	if cfg.ImapServer == "" || cfg.Username == "" {
+		fmt.Println("Error: server and username are required")
+		os.Exit(1)
+	}
+	var err error
+	if cfg.ImapPort, err = strconv.Atoi(port); err != nil {
+		fmt.Printf("Error: invalid port %q\n", port)
+		os.Exit(1)
+	}
+	if cfg.Password, err = promptSecret("Password: ", "", false); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if name != defaultAccount {
+		cfg.Name = promptLine("Display name shown in notifications", name)
+	}
+
+	fmt.Printf("Logging in to %s:%d as %s... ", cfg.ImapServer, cfg.ImapPort, cfg.Username)
+	c, err := email.Dial(cfg)
+	failed := func() { fmt.Println("FAILED") }
+	if errors.Is(err, email.ErrCertificateUntrusted) {
+		failed()
+		if offerPin(&cfg) {
+			fmt.Printf("Logging in to %s:%d as %s... ", cfg.ImapServer, cfg.ImapPort, cfg.Username)
+			c, err = email.Dial(cfg)
+		} else {
+			failed = func() {}
+		}
+	}
+	if errors.Is(err, email.ErrAppPasswordRequired) {
+		failed()
+		if err = guideAppPassword(&cfg); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			if !promptYesNo("Save the account anyway?") {
+				os.Exit(1)
+			}
+		}
+	} else if err != nil {
+		failed()
+		fmt.Printf("Error: %v\n", err)
+		fmt.Printf("Run 'n0tif -profile %s test-connection' after saving to see which step fails.\n", name)
+		if !promptYesNo("Save the account anyway?") {
+			os.Exit(1)
+		}
+	} else {
+		c.Logout()
+		fmt.Println("OK")
+	}
+
+	if err := saveCredentials(config.Config{Email: cfg}); err != nil {
+		fmt.Printf("Error: failed to save credentials: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Account %s saved.", name)
+	if name == defaultAccount {
+		fmt.Println(" Start it with 'n0tif start'.")
+	} else {
+		fmt.Printf(" Start it with 'n0tif -profile %s start'.\n", name)
+	}
+}
+
+// removeAccount deletes the saved credentials of an account and, for named accounts, all of its data
+func removeAccount(name string) {
+	if pid, err := storage.ReadPIDFile(); err == nil && processAlive(pid) {
+		fmt.Printf("Error: account %s is being checked (PID %d); stop it first\n", name, pid)
+		os.Exit(1)
+	}
+	if !storage.CredentialsExist() && name == defaultAccount {
+		fmt.Printf("Account %s has no saved credentials.\n", name)
+		return
+	}
+
+	question := fmt.Sprintf("Delete the saved credentials of account %s?", name)
+	if name != defaultAccount {
+		question = fmt.Sprintf("Delete account %s with its credentials, state, history and logs?", name)
+	}
+	if !promptYesNo(question) {
+		fmt.Println("Nothing was changed.")
+		return
+	}
+
+	if err := storage.DeleteCredentials(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if name != defaultAccount {
+		if err := storage.RemoveProfile(name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Account %s removed.\n", name)
+}
+
+// accountInfo is one line of "account list"
+type accountInfo struct {
+	Name       string `json:"name"`
+	Username   string `json:"username,omitempty"`
+	Server     string `json:"server,omitempty"`
+	Encryption string `json:"encryption,omitempty"`
+	Running    bool   `json:"running"`
+	Error      string `json:"error,omitempty"`
+}
+
+// listAccounts shows every account with saved credentials
+func listAccounts() {
+	profiles, err := storage.ListProfiles()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	accounts := []accountInfo{}
+	for _, p := range append([]string{""}, profiles...) {
+		if err := storage.SetProfile(p); err != nil {
+			continue
+		}
+		if !storage.CredentialsExist() {
+			continue
+		}
+		info := accountInfo{Name: p}
+		if p == "" {
+			info.Name = defaultAccount
+		}
+		if acc, err := storage.SavedAccount(); err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Username = acc.Username
+			info.Server = fmt.Sprintf("%s:%d", acc.ImapServer, acc.ImapPort)
+			info.Encryption, _ = storage.CredentialsEncryption()
+		}
+		if pid, err := storage.ReadPIDFile(); err == nil {
+			info.Running = processAlive(pid)
+		}
+		accounts = append(accounts, info)
+	}
+
+	if *jsonOutput {
+		printJSON(accounts)
+		return
+	}
+	if len(accounts) == 0 {
+		fmt.Println("No accounts yet. Add one with 'n0tif account add <name>'.")
+		return
+	}
+	fmt.Printf("%-16s %-32s %-30s %s\n", "Account", "Username", "Server", "State")
+	for _, a := range accounts {
+		state := "stopped"
+		if a.Running {
+			state = "running"
+		}
+		if a.Error != "" {
+			state = "unreadable: " + a.Error
+		}
+		fmt.Printf("%-16s %-32s %-30s %s\n", a.Name, truncate(a.Username, 32), truncate(a.Server, 30), state)
+	}
+}
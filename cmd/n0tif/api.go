@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/metrics"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// maxNotifyBody limits the JSON body of a /notify request
+const maxNotifyBody = 16 << 10
+
+// notifyRequest is the body of a /notify request
+type notifyRequest struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	config.ToastStyle
+}
+
+// apiError is the body of every failed API request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// startAPIServer serves the HTTP API on the address of cfg until the returned
+// function is called. Every request but /healthz must present the token of
+// "n0tif api-token", either as "Authorization: Bearer <token>" or as a token
+// query parameter for clients that can only open a URL, like browsers opening
+// the WebSocket of /ws. It returns nil if the API can't be started; the monitor
+// runs without it.
+func startAPIServer(cfg config.Config, hooks monitorHooks) (stop func()) {
+	address := cfg.API.Listen
+	token, err := storage.APIToken(false)
+	if err != nil {
+		logging.Warnf("HTTP API disabled, cannot read its token: %v", err)
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logging.Warnf("HTTP API disabled: %v", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, hooks.status())
+	})
+	mux.HandleFunc("POST /check", func(w http.ResponseWriter, r *http.Request) {
+		subjects, err := hooks.checkNow()
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, checkNowReport{NewEmails: subjects})
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		var d time.Duration
+		if text := r.URL.Query().Get("duration"); text != "" {
+			var err error
+			if d, err = time.ParseDuration(text); err != nil || d < 0 {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", text))
+				return
+			}
+		}
+		hooks.pause(d)
+		writeAPIJSON(w, http.StatusOK, hooks.status())
+	})
+	mux.HandleFunc("DELETE /pause", func(w http.ResponseWriter, r *http.Request) {
+		hooks.resume()
+		writeAPIJSON(w, http.StatusOK, hooks.status())
+	})
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		messages, ok := searchHistory(w, r, defaultRecentLimit)
+		if !ok {
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, messages)
+	})
+	mux.HandleFunc("GET /feed.atom", func(w http.ResponseWriter, r *http.Request) {
+		messages, ok := searchHistory(w, r, defaultFeedLimit)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		_ = writeAtomFeed(w, messages)
+	})
+	mux.HandleFunc("GET /feed.rss", func(w http.ResponseWriter, r *http.Request) {
+		messages, ok := searchHistory(w, r, defaultFeedLimit)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		_ = writeRSSFeed(w, "http://"+r.Host+"/history", messages)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WriteText(w)
+	})
+	// Shutdown doesn't wait for hijacked connections, so they are told to end
+	stopping := make(chan struct{})
+	webmail := browserWebmail(cfg)
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		serveBrowserEvents(w, r, hooks, webmail, stopping)
+	})
+	mux.HandleFunc("POST /notify", func(w http.ResponseWriter, r *http.Request) {
+		var req notifyRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxNotifyBody)).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err))
+			return
+		}
+		if strings.TrimSpace(req.Title) == "" {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("title is required"))
+			return
+		}
+		if err := req.ToastStyle.Check(); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := hooks.notify(req.Title, req.Message, toastStyle(req.ToastStyle)); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Answered without a token so monitoring tools need no secret; it reveals no more than account labels
+	healthz := func(w http.ResponseWriter, r *http.Request) {
+		var maxAge time.Duration
+		if text := r.URL.Query().Get("max_age"); text != "" {
+			var err error
+			if maxAge, err = time.ParseDuration(text); err != nil || maxAge <= 0 {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid max_age %q", text))
+				return
+			}
+		}
+		report := evaluateHealth(hooks.status(), maxAge, time.Now())
+		code := http.StatusOK
+		if !report.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeAPIJSON(w, code, report)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" && r.Method == http.MethodGet {
+				healthz(w, r)
+				return
+			}
+			presented := r.URL.Query().Get("token")
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				presented = strings.TrimPrefix(auth, "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				writeAPIError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong token"))
+				return
+			}
+			mux.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() { _ = server.Serve(listener) }()
+	logging.Infof("HTTP API listening on http://%s", listener.Addr())
+
+	return func() {
+		close(stopping)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}
+}
+
+// searchHistory returns the arrival history matching the q parameter, up to the
+// n parameter or limit messages. It answers the request itself when it fails.
+func searchHistory(w http.ResponseWriter, r *http.Request, limit int) ([]storage.MessageRecord, bool) {
+	if text := r.URL.Query().Get("n"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", text))
+			return nil, false
+		}
+		limit = n
+	}
+	messages, err := storage.SearchMessages(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return messages, true
+}
+
+// writeAPIJSON sends v as the JSON body of a response
+func writeAPIJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError sends err as the JSON body of a failed response
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeAPIJSON(w, code, apiError{Error: err.Error()})
+}
+
+// runAPITokenCommand handles "n0tif api-token [-rotate]"
+func runAPITokenCommand(args []string) {
+	fs := flag.NewFlagSet("api-token", flag.ExitOnError)
+	rotate := fs.Bool("rotate", false, "Replace the token; clients using the old one stop working")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif api-token [-rotate]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	token, err := storage.APIToken(*rotate)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(token)
+	if *rotate {
+		if pid, err := storage.ReadPIDFile(); err == nil && processAlive(pid) {
+			fmt.Fprintln(os.Stderr, "Restart n0tif for the new token to take effect.")
+		}
+	}
+}
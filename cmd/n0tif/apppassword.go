@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// appPasswordAttempts is how often the guide lets the user enter an app password
+const appPasswordAttempts = 3
+
+// runAppPasswordCommand handles "n0tif app-password": it walks through getting
+// an app password from the provider and saves it once the server accepts it
+func runAppPasswordCommand(args []string) {
+	if len(args) > 0 {
+		fmt.Println("Usage: n0tif [-profile name] app-password")
+		os.Exit(2)
+	}
+	cfg, err := storage.SavedAccount()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := unlockCredentials(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := guideAppPassword(cfg); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := storage.SaveCredentials(*cfg); err != nil {
+		fmt.Printf("Error: failed to save credentials: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("App password saved.")
+	fmt.Println("Restart any running n0tif instance of this profile to pick up the change.")
+}
+
+// guideAppPassword opens the provider's app password page, explains the steps
+// and asks for the new password until the server accepts it, which it then
+// puts into cfg
+func guideAppPassword(cfg *config.EmailConfig) error {
+	provider, known := email.AppPasswordGuide(cfg.ImapServer)
+	if known {
+		fmt.Printf("%s needs an app password for mail clients such as n0tif, not the account password.\n", provider.Name)
+		fmt.Printf("Opening %s\n", provider.URL)
+		if err := openURL(provider.URL); err != nil {
+			fmt.Printf("Couldn't open the browser (%v); open the address above yourself.\n", err)
+		}
+		for i, step := range provider.Steps {
+			fmt.Printf("  %d. %s\n", i+1, step)
+		}
+	} else {
+		fmt.Printf("%s needs an app password for mail clients. Create one in the security settings of\n", cfg.ImapServer)
+		fmt.Println("the account and enter it here.")
+	}
+
+	for attempt := 1; ; attempt++ {
+		password, err := promptSecret("App password: ", "", false)
+		if err != nil {
+			return err
+		}
+		try := *cfg
+		try.Password = password
+		fmt.Printf("Logging in to %s:%d as %s... ", cfg.ImapServer, cfg.ImapPort, cfg.Username)
+		c, err := email.Dial(try)
+		if err == nil {
+			c.Logout()
+			fmt.Println("OK")
+			cfg.Password = password
+			return nil
+		}
+		fmt.Println("FAILED")
+		if !errors.Is(err, email.ErrAuthFailed) || attempt == appPasswordAttempts {
+			return err
+		}
+		fmt.Println("The server refused the password; check that it was copied completely and try again.")
+	}
+}
+
+// openURL opens u in the default browser
+func openURL(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32.exe", "url.dll,FileProtocolHandler", u)
+	case "darwin":
+		cmd = exec.Command("open", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// Audit triggers: what asked the monitor to act
+const (
+	triggerControl = "control" // another n0tif command, the tray or the dashboard
+	triggerAPI     = "api"     // the HTTP API
+)
+
+// auditedHooks wraps the hooks that act on the mailbox or the monitor so that
+// each call is recorded in the audit log with trigger as its origin
+func auditedHooks(hooks monitorHooks, trigger string) monitorHooks {
+	audit := func(action, target string, err error) {
+		rec := storage.AuditRecord{
+			Time:    time.Now(),
+			Action:  action,
+			Trigger: trigger,
+			Target:  target,
+			Result:  storage.AuditOK,
+		}
+		if err != nil {
+			rec.Result = storage.AuditFailed
+			rec.Error = err.Error()
+		}
+		if err := storage.AppendAudit(rec); err != nil {
+			logging.Warnf("Failed to write audit log: %v", err)
+		}
+	}
+
+	audited := hooks
+	audited.markRead = func(mailbox string, uid uint32) error {
+		err := hooks.markRead(mailbox, uid)
+		audit("mark-read", fmt.Sprintf("%s/%d", mailbox, uid), err)
+		return err
+	}
+	audited.markAllRead = func() (int, error) {
+		n, err := hooks.markAllRead()
+		audit("mark-all-read", fmt.Sprintf("%d message(s)", n), err)
+		return n, err
+	}
+	audited.pause = func(d time.Duration) {
+		hooks.pause(d)
+		target := "until resumed"
+		if d > 0 {
+			target = d.String()
+		}
+		audit("pause", target, nil)
+	}
+	audited.resume = func() bool {
+		resumed := hooks.resume()
+		if resumed {
+			audit("resume", "", nil)
+		}
+		return resumed
+	}
+	audited.stop = func() {
+		audit("stop", "", nil)
+		hooks.stop()
+	}
+	if hooks.reload != nil {
+		audited.reload = func() error {
+			err := hooks.reload()
+			audit("reload", "", err)
+			return err
+		}
+	}
+	audited.reloadCredentials = func() error {
+		err := hooks.reloadCredentials()
+		audit("reload-credentials", "", err)
+		return err
+	}
+	audited.setLogLevel = func(level logging.Level, d time.Duration) {
+		hooks.setLogLevel(level, d)
+		target := level.String()
+		if d > 0 {
+			target += " for " + d.String()
+		}
+		audit("loglevel", target, nil)
+	}
+	audited.notify = func(title, message string, style notify.Style) error {
+		err := hooks.notify(title, message, style)
+		audit("notify", title, err)
+		return err
+	}
+	return audited
+}
+
+// runAuditCommand handles "n0tif audit [-n 20] [-action name]"
+func runAuditCommand(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Number of entries to show")
+	action := fs.String("action", "", "Only show this action, e.g. mark-read")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] [-json] audit [-n 20] [-action name]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	records, err := storage.ReadAudit(*action, *limit)
+	if err != nil {
+		fmt.Printf("Failed to read the audit log: %v\n", err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		if records == nil {
+			records = []storage.AuditRecord{}
+		}
+		printJSON(records)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("The audit log is empty.")
+		return
+	}
+	for _, r := range records {
+		line := fmt.Sprintf("%s  %-10s  %-8s  %-6s  %s", r.Time.Local().Format("2006-01-02 15:04:05"),
+			r.Action, r.Trigger, r.Result, r.Target)
+		if r.Error != "" {
+			line += "  (" + r.Error + ")"
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("\n%d action(s) shown, newest first.\n", len(records))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// runAutostartCommand handles "n0tif autostart enable|disable|status": starting n0tif
+// in the background at login for users who can't install a service
+func runAutostartCommand(args []string) {
+	action := ""
+	if len(args) == 1 {
+		action = args[0]
+	}
+	name := autostartName()
+
+	switch action {
+	case "enable":
+		command, err := autostartCommand()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !storage.CredentialsExist() {
+			fmt.Println("Warning: this profile has no saved credentials; save them with -save or 'n0tif account add' before you log in again.")
+		}
+		location, err := enableAutostart(name, command)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("n0tif will start in the background when you log in (%s).\n", location)
+	case "disable":
+		removed, err := disableAutostart(name)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !removed {
+			fmt.Println("Autostart was not enabled.")
+			return
+		}
+		fmt.Println("n0tif no longer starts when you log in.")
+	case "status":
+		command, err := autostartEntry(name)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if command == "" {
+			fmt.Println("Autostart is disabled.")
+			os.Exit(3)
+		}
+		fmt.Printf("Autostart is enabled: %s\n", command)
+	default:
+		fmt.Println("Usage: n0tif [-profile name] autostart enable|disable|status")
+		os.Exit(2)
+	}
+}
+
+// autostartName names the autostart entry of the active profile
+func autostartName() string {
+	if p := storage.Profile(); p != "" {
+		return "n0tif-" + p
+	}
+	return "n0tif"
+}
+
+// autostartCommand returns the executable and arguments that start the active profile in the background
+func autostartCommand() ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	command := []string{exe}
+	if storage.Portable() {
+		command = append(command, "-portable")
+	}
+	if p := storage.Profile(); p != "" {
+		command = append(command, "-profile", p)
+	}
+	if flagWasSet("log-level") {
+		command = append(command, "-log-level", *logLevel)
+	}
+	if flagWasSet("log-format") {
+		command = append(command, "-log-format", *logFormatFlag)
+	}
+	return append(command, "start"), nil
+}
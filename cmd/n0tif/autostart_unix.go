@@ -0,0 +1,89 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The freedesktop.org autostart spec is followed by GNOME, KDE, Xfce and most other
+// desktops: a .desktop file in ~/.config/autostart is run at login.
+
+// autostartPath returns the desktop entry file of the named autostart entry
+func autostartPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autostart", name+".desktop"), nil
+}
+
+// enableAutostart writes a desktop entry that runs command at login and returns its path
+func enableAutostart(name string, command []string) (string, error) {
+	path, err := autostartPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = desktopQuote(arg)
+	}
+	entry := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=n0tif\nComment=Email notifications\nExec=%s\nTerminal=false\nX-GNOME-Autostart-enabled=true\n",
+		strings.Join(quoted, " "))
+
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, []byte(entry), 0644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tempFile, path)
+}
+
+// desktopQuote quotes an argument for the Exec key of a desktop entry
+func desktopQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`%") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", "$", `\\$`, "%", "%%")
+	return `"` + r.Replace(arg) + `"`
+}
+
+// disableAutostart removes the desktop entry and reports whether there was one
+func disableAutostart(name string) (bool, error) {
+	path, err := autostartPath(name)
+	if err != nil {
+		return false, err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// autostartEntry returns the Exec line of the desktop entry, or "" when autostart is disabled
+func autostartEntry(name string) (string, error) {
+	path, err := autostartPath(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if exec, ok := strings.CutPrefix(line, "Exec="); ok {
+			return exec, nil
+		}
+	}
+	return path, nil
+}
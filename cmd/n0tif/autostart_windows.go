@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// runKeyPath is the per-user key of programs Windows starts at login
+const runKeyPath = `Software\Microsoft\Windows\CurrentVersion\Run`
+
+// enableAutostart registers command under the Run key of the current user, which
+// needs no administrator rights, and returns where it was registered
+func enableAutostart(name string, command []string) (string, error) {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, runKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = syscall.EscapeArg(arg)
+	}
+	if err := key.SetStringValue(name, strings.Join(quoted, " ")); err != nil {
+		return "", err
+	}
+	return `HKCU\` + runKeyPath + `\` + name, nil
+}
+
+// disableAutostart removes the Run entry and reports whether there was one
+func disableAutostart(name string) (bool, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, runKeyPath, registry.SET_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer key.Close()
+
+	err = key.DeleteValue(name)
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// autostartEntry returns the registered command, or "" when autostart is disabled
+func autostartEntry(name string) (string, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, runKeyPath, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+
+	command, _, err := key.GetStringValue(name)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", nil
+	}
+	return command, err
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/byigitt/n0tif/pkg/pipeline"
+)
+
+const (
+	// defaultAwaySummaryAt is when the daily summary goes out unless the settings say otherwise
+	defaultAwaySummaryAt = "18:00"
+	// awayCheckInterval is how often the away mode and the summary time are checked
+	awayCheckInterval = time.Minute
+	// maxAwayPending caps the email kept for one summary; the total counts the rest
+	maxAwayPending = 200
+	// awaySummaryLines is how many emails a summary names
+	awaySummaryLines = 5
+)
+
+// awayMode holds back the notifications of new email while you are away, as
+// set with "n0tif away" or planned in the settings, and sums the email up once
+// a day instead. The held email is kept in away.json, so "n0tif away" and a
+// restart see it too.
+type awayMode struct {
+	account config.EmailConfig
+	log     *logging.Logger
+	push    *pushChannels
+	// notify shows a toast: the summary without push channels and the one on your return
+	notify func(title, message string, emails []storage.MessageRecord) error
+
+	mu  sync.Mutex
+	cfg config.AwayConfig
+}
+
+// newAwayMode starts checking the away mode of cfg for account
+func newAwayMode(account config.EmailConfig, cfg config.AwayConfig, push *pushChannels, notify func(title, message string, emails []storage.MessageRecord) error) *awayMode {
+	a := &awayMode{
+		account: account,
+		log:     logging.For("away").With("account", account.Username),
+		push:    push,
+		notify:  notify,
+	}
+	a.update(cfg)
+	go a.run()
+	return a
+}
+
+// update applies changed away settings
+func (a *awayMode) update(cfg config.AwayConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cfg = cfg
+}
+
+func (a *awayMode) config() config.AwayConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg
+}
+
+// isAway reports whether you are away at now: as set by hand or, failing that, as planned
+func isAway(s *storage.AwayState, cfg config.AwayConfig, now time.Time) bool {
+	switch s.ManualMode(now) {
+	case storage.AwayOn:
+		return true
+	case storage.AwayOff:
+		return false
+	}
+	away, _ := cfg.Scheduled(now)
+	return away
+}
+
+// hold reports whether the notification of emails should wait for the
+// summary, keeping them for it if so. If away.json can't be written, the
+// emails are notified of as usual.
+func (a *awayMode) hold(emails []storage.MessageRecord) bool {
+	cfg := a.config()
+	now := time.Now()
+	held := false
+	err := storage.UpdateAway(func(s *storage.AwayState) {
+		if !isAway(s, cfg, now) {
+			return
+		}
+		held = true
+		if s.Since.IsZero() {
+			s.Since = now
+		}
+		s.Total += len(emails)
+		s.Pending = append(append([]storage.MessageRecord(nil), emails...), s.Pending...)
+		if len(s.Pending) > maxAwayPending {
+			s.Pending = s.Pending[:maxAwayPending]
+		}
+	})
+	if err != nil {
+		a.log.Warnf("Failed to keep %d email(s) for the away summary: %v", len(emails), err)
+		return false
+	}
+	if held {
+		a.log.Infof("Away, keeping %d email(s) for the summary.", len(emails))
+	}
+	return held
+}
+
+// run checks the away mode every awayCheckInterval
+func (a *awayMode) run() {
+	ticker := time.NewTicker(awayCheckInterval)
+	defer ticker.Stop()
+	for {
+		a.check(time.Now())
+		<-ticker.C
+	}
+}
+
+// check notices the beginning and the end of an absence and sends the summary when due
+func (a *awayMode) check(now time.Time) {
+	cfg := a.config()
+	var summary, back []storage.MessageRecord
+	var total int
+	var since time.Time
+	err := storage.UpdateAway(func(s *storage.AwayState) {
+		if s.Mode != "" && s.ManualMode(now) == "" {
+			s.Mode, s.Until = "", time.Time{}
+		}
+		if !isAway(s, cfg, now) {
+			if !s.Since.IsZero() {
+				back, total, since = s.Pending, s.Total, s.Since
+				s.Since, s.Total, s.Pending = time.Time{}, 0, nil
+			}
+			return
+		}
+		if s.Since.IsZero() {
+			s.Since = now
+			a.log.Infof("Away; notifications wait for the daily summary at %s.", awaySummaryAt(cfg))
+		}
+		due := awaySummaryDue(cfg, now)
+		if len(s.Pending) > 0 && !now.Before(due) && s.Since.Before(due) && s.Summarized.Before(due) {
+			summary = s.Pending
+			s.Pending = nil
+			s.Summarized = now
+		}
+	})
+	if err != nil {
+		a.log.Warnf("Failed to update the away state: %v", err)
+		return
+	}
+
+	if len(summary) > 0 {
+		a.summarize(cfg, summary)
+	}
+	if !since.IsZero() {
+		a.log.Infof("Back; %d email(s) arrived while away.", total)
+		if total > 0 {
+			message := fmt.Sprintf("%d email(s) arrived since %s.", total, since.Format("Mon 2 Jan 15:04"))
+			if len(back) > 0 {
+				message += fmt.Sprintf(" Not summed up yet: %d, the latest: %s", len(back), back[0].Subject)
+			}
+			if err := a.notify("While You Were Away", message, back); err != nil {
+				a.log.Warnf("Failed to show the away notification: %v", err)
+			}
+		}
+	}
+}
+
+// summarize sends the summary of emails to the push channels of cfg, or shows it without any
+func (a *awayMode) summarize(cfg config.AwayConfig, emails []storage.MessageRecord) {
+	title, message := awaySummary(emails)
+	if len(cfg.Channels) == 0 {
+		if err := a.notify(title, message, emails); err != nil {
+			a.log.Warnf("Failed to show the away summary: %v", err)
+		}
+		return
+	}
+	if a.account.Name != "" {
+		title = fmt.Sprintf("%s (%s)", title, a.account.Name)
+	}
+	a.push.send(cfg.Channels, pipeline.Event{
+		Time:    time.Now(),
+		Source:  "imap",
+		Account: a.account.Username,
+		Title:   title,
+		Message: message,
+		Emails:  pipelineEmails(emails),
+	}, "the away summary")
+}
+
+// awaySummaryAt returns the summary time of cfg, "HH:MM"
+func awaySummaryAt(cfg config.AwayConfig) string {
+	if cfg.SummaryAt != "" {
+		return cfg.SummaryAt
+	}
+	return defaultAwaySummaryAt
+}
+
+// awaySummaryDue returns the summary time of cfg on the day of now
+func awaySummaryDue(cfg config.AwayConfig, now time.Time) time.Time {
+	t, err := time.Parse("15:04", awaySummaryAt(cfg))
+	if err != nil {
+		t, _ = time.Parse("15:04", defaultAwaySummaryAt)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+}
+
+// awaySummary phrases emails, newest first, naming the first awaySummaryLines
+// senders and subjects a line each
+func awaySummary(emails []storage.MessageRecord) (title, message string) {
+	lines := make([]string, 0, awaySummaryLines+1)
+	for i, m := range emails {
+		if i == awaySummaryLines {
+			lines = append(lines, fmt.Sprintf("and %d more", len(emails)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", m.From, m.Subject))
+	}
+	return fmt.Sprintf("Away summary: %d new email(s)", len(emails)), strings.Join(lines, "\n")
+}
+
+// runAwayCommand handles "n0tif away": show the away mode, or set it by hand
+func runAwayCommand(args []string) {
+	usage := func() {
+		fmt.Println("Usage: n0tif [-profile name] away [on [-until YYYY-MM-DD] | off]")
+		os.Exit(2)
+	}
+	cfg := config.GetDefaultConfig()
+	if path, err := storage.GetConfigPath(); err == nil {
+		if settings, err := config.LoadSettings(path); err == nil {
+			settings.Apply(&cfg)
+		} else {
+			fmt.Printf("Warning: ignoring the planned absences, as the settings can't be read: %v\n", err)
+		}
+	}
+	now := time.Now()
+
+	if len(args) == 0 {
+		s, err := storage.LoadAway()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		printAwayState(s, cfg.Away, now)
+		return
+	}
+
+	var mode string
+	var until time.Time
+	switch args[0] {
+	case storage.AwayOn:
+		fs := flag.NewFlagSet("away", flag.ExitOnError)
+		last := fs.String("until", "", "Last day away, as YYYY-MM-DD; away until 'n0tif away off' if not set")
+		fs.Usage = usage
+		fs.Parse(args[1:])
+		if fs.NArg() > 0 {
+			usage()
+		}
+		if *last != "" {
+			day, err := time.ParseInLocation("2006-01-02", *last, time.Local)
+			if err != nil || !day.AddDate(0, 0, 1).After(now) {
+				fmt.Printf("Error: -until %q is not a date from today on, as YYYY-MM-DD\n", *last)
+				os.Exit(2)
+			}
+			until = day.AddDate(0, 0, 1)
+		}
+		mode = storage.AwayOn
+	case storage.AwayOff:
+		if len(args) > 1 {
+			usage()
+		}
+		// Coming back early from a planned absence overrides the rest of it
+		if scheduled, end := cfg.Away.Scheduled(now); scheduled {
+			mode, until = storage.AwayOff, end
+		}
+	default:
+		usage()
+	}
+
+	var s *storage.AwayState
+	err := storage.UpdateAway(func(state *storage.AwayState) {
+		state.Mode, state.Until = mode, until
+		s = state
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	printAwayState(s, cfg.Away, now)
+}
+
+// printAwayState shows whether you are away and why, and the email kept meanwhile
+func printAwayState(s *storage.AwayState, cfg config.AwayConfig, now time.Time) {
+	away := isAway(s, cfg, now)
+	manual := s.ManualMode(now)
+	_, end := cfg.Scheduled(now)
+	switch {
+	case away && manual == storage.AwayOn && s.Until.IsZero():
+		fmt.Println("Away until 'n0tif away off'.")
+	case away && manual == storage.AwayOn:
+		fmt.Printf("Away until %s.\n", s.Until.Format("Mon 2 Jan 15:04"))
+	case away:
+		fmt.Printf("Away as planned, until %s.\n", end.Format("Mon 2 Jan 15:04"))
+	case manual == storage.AwayOff:
+		fmt.Printf("Back early from the planned absence, which ends %s.\n", s.Until.Format("Mon 2 Jan 15:04"))
+	default:
+		fmt.Println("Not away.")
+	}
+	if away {
+		fmt.Printf("Notifications wait for the daily summary at %s.\n", awaySummaryAt(cfg))
+	}
+	if !s.Since.IsZero() {
+		fmt.Printf("Email since %s: %d, %d of them not summed up yet.\n", s.Since.Format("Mon 2 Jan 15:04"), s.Total, len(s.Pending))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+)
+
+// backfillTag identifies the progress notification, so each update replaces it
+const backfillTag = "backfill"
+
+// backfillToast shows how a check fetching a large backlog, e.g. after a long
+// time offline, is getting on in one notification updated in place, rather than
+// nothing until the notification of everything it found. Each update takes a
+// PowerShell run, so they are shown on a goroutine of their own, skipping those
+// superseded meanwhile; the check never waits for them.
+type backfillToast struct {
+	identity notify.Identity
+	title    string
+	log      *logging.Logger
+	latest   chan email.Progress // the progress not shown yet, if any
+}
+
+// newBackfillToast starts showing the progress reported to the returned toast's report
+func newBackfillToast(identity notify.Identity, account string) *backfillToast {
+	b := &backfillToast{
+		identity: identity,
+		title:    "Catching up on new email",
+		log:      logging.For("notify"),
+		latest:   make(chan email.Progress, 1),
+	}
+	if account != "" {
+		b.title = fmt.Sprintf("%s (%s)", b.title, account)
+	}
+	go b.run()
+	return b
+}
+
+// report is the progress handler of the checker. It replaces progress that
+// hasn't been shown yet, so the last report, which ends the toast, is never lost.
+func (b *backfillToast) report(p email.Progress) {
+	for {
+		select {
+		case b.latest <- p:
+			return
+		default:
+		}
+		select {
+		case <-b.latest:
+		default:
+		}
+	}
+}
+
+// run shows the reported progress until the process ends
+func (b *backfillToast) run() {
+	var toast *notify.ProgressToast
+	for p := range b.latest {
+		switch {
+		case p.Finished:
+			if toast != nil {
+				if err := toast.Remove(); err != nil {
+					b.log.Debugf("Failed to remove progress notification: %v", err)
+				}
+				toast = nil
+			}
+		case toast == nil:
+			var err error
+			if toast, err = notify.ShowProgress(b.identity, backfillTag, b.title, "Syncing headers", p.Done, p.Total); err != nil {
+				b.log.Warnf("Failed to show progress notification: %v", err)
+			}
+		default:
+			if err := toast.Update("Syncing headers", p.Done, p.Total); err != nil {
+				b.log.Debugf("Failed to update progress notification: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// controlTimeout bounds how long a command waits for the running monitor to answer
+const controlTimeout = 30 * time.Second
+
+// pauseMonitor pauses the running monitor of the active profile, if any, so its
+// data files can be copied or replaced. Call the returned function to resume it.
+func pauseMonitor() (resume func(), err error) {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := control.Call(appFolder, "suspend-storage", controlTimeout); err != nil {
+		if errors.Is(err, control.ErrNotRunning) {
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("pause the running n0tif: %w", err)
+	}
+	fmt.Println("Paused the running n0tif instance.")
+	return func() {
+		if _, err := control.Call(appFolder, "resume-storage", controlTimeout); err != nil {
+			fmt.Printf("Warning: Failed to resume the running n0tif: %v (it resumes by itself shortly)\n", err)
+			return
+		}
+		fmt.Println("Resumed the running n0tif instance.")
+	}, nil
+}
+
+// runBackupCommand handles "n0tif backup <file>"
+func runBackupCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: n0tif [-profile name] backup <file.zip>")
+		os.Exit(2)
+	}
+
+	resume, err := pauseMonitor()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	summary, err := storage.CreateBackup(args[0])
+	resume()
+	if err != nil {
+		fmt.Printf("Backup failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Backed up %d file(s) to %s\n", len(summary.Files), args[0])
+	fmt.Println("Saved passwords kept in the keyring or protected with DPAPI can only be restored on this machine")
+	fmt.Println("and Windows account; use 'n0tif export' to move to another machine.")
+}
+
+// runRestoreCommand handles "n0tif restore <file>"
+func runRestoreCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: n0tif [-profile name] restore <file.zip>")
+		os.Exit(2)
+	}
+	if _, err := os.Stat(args[0]); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !promptYesNo("Replace all data of this profile with the backup?") {
+		fmt.Println("Restore cancelled.")
+		os.Exit(1)
+	}
+
+	resume, err := pauseMonitor()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	summary, err := storage.RestoreBackup(args[0])
+	resume()
+	if err != nil {
+		fmt.Printf("Restore failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Restored %d file(s) from the backup taken %s\n", len(summary.Files), summary.Created.Format(time.RFC1123))
+	fmt.Println("Restart any running n0tif instance of this profile to pick up restored credentials and settings.")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/power"
+)
+
+// batteryPollInterval is how often the power state is read
+const batteryPollInterval = time.Minute
+
+// batteryWatch stretches the check interval while the machine runs on battery
+// and puts it back once plugged in. It owns the interval of the checker, so
+// changes of the settings go through update.
+type batteryWatch struct {
+	apply func(seconds int) // sets the check interval of the checker
+
+	mu      sync.Mutex
+	base    int // check_interval of the settings, in seconds
+	cfg     config.BatteryConfig
+	state   power.State
+	known   bool // state has been read
+	applied int  // the interval the checker was given last
+}
+
+// newBatteryWatch starts watching the power state; base is the interval the checker starts with
+func newBatteryWatch(base int, cfg config.BatteryConfig, apply func(seconds int)) *batteryWatch {
+	b := &batteryWatch{apply: apply, base: base, cfg: cfg, applied: base}
+	b.read()
+	go b.run()
+	return b
+}
+
+// update applies a changed check interval or battery settings
+func (b *batteryWatch) update(base int, cfg config.BatteryConfig) {
+	b.mu.Lock()
+	b.base, b.cfg = base, cfg
+	b.mu.Unlock()
+	b.adjust()
+}
+
+// run reads the power state every batteryPollInterval
+func (b *batteryWatch) run() {
+	ticker := time.NewTicker(batteryPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.read()
+	}
+}
+
+// read takes in the power state and adjusts the interval to it. A machine whose
+// state can't be read counts as plugged in.
+func (b *batteryWatch) read() {
+	state, err := power.Read()
+	b.mu.Lock()
+	if err != nil {
+		if b.known || !errors.Is(err, power.ErrUnsupported) {
+			logging.Debugf("Failed to read the power state: %v", err)
+		}
+		state = power.State{Percent: -1}
+	} else if !b.known || state.OnBattery != b.state.OnBattery {
+		logging.Debugf("Power: %s", state)
+	}
+	b.state, b.known = state, err == nil
+	b.mu.Unlock()
+	b.adjust()
+}
+
+// adjust gives the checker the interval for the current state, if it changed
+func (b *batteryWatch) adjust() {
+	b.mu.Lock()
+	seconds := batteryInterval(b.base, b.cfg, b.state)
+	changed := seconds != b.applied
+	b.applied = seconds
+	state, base := b.state, b.base
+	b.mu.Unlock()
+	if !changed {
+		return
+	}
+	if seconds != base {
+		logging.Infof("Running %s, checking every %ds instead of %ds.", state, seconds, base)
+	} else if state.OnBattery {
+		logging.Infof("Checking every %ds again.", seconds)
+	} else {
+		logging.Infof("Plugged in, checking every %ds again.", seconds)
+	}
+	b.apply(seconds)
+}
+
+// batteryInterval returns the check interval in seconds for state: base, or
+// the longer interval of cfg that applies on battery
+func batteryInterval(base int, cfg config.BatteryConfig, state power.State) int {
+	if !state.OnBattery {
+		return base
+	}
+	seconds := max(base, cfg.CheckInterval)
+	low := state.Saver || (state.Percent >= 0 && state.Percent < cfg.LowPercent)
+	if cfg.LowPercent > 0 && low {
+		seconds = max(seconds, cfg.LowCheckInterval)
+	}
+	return seconds
+}
+
+// status describes the power state for the status report, e.g. "on battery,
+// 45% (checking every 300s instead of 60s)"; empty while it is unknown
+func (b *batteryWatch) status() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.known {
+		return ""
+	}
+	if b.applied != b.base {
+		return fmt.Sprintf("%s (checking every %ds instead of %ds)", b.state, b.applied, b.base)
+	}
+	return b.state.String()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/byigitt/n0tif/internal/websocket"
+)
+
+// browserUnreadInterval is how often a connected extension is told about a
+// changed unread count, which changes without new email when mail is read
+const browserUnreadInterval = 10 * time.Second
+
+// browserQueue is how many messages wait for a slow extension before new email is dropped
+const browserQueue = 16
+
+// Types of the messages sent to the browser extension
+const (
+	browserTypeHello  = "hello"  // first message, with the unread count
+	browserTypeEmail  = "email"  // new email arrived
+	browserTypeUnread = "unread" // the unread count changed
+)
+
+// browserMessage is one message of /ws, as JSON
+type browserMessage struct {
+	Type   string         `json:"type"`
+	Unread *int           `json:"unread,omitempty"` // unread email across the accounts; absent until counted
+	Emails []browserEmail `json:"emails,omitempty"` // newest first
+}
+
+// browserEmail describes a new email to the extension
+type browserEmail struct {
+	Account string    `json:"account"`
+	Mailbox string    `json:"mailbox"`
+	From    string    `json:"from"`
+	Sender  string    `json:"sender"` // display name, or the address if there is none
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+	Link    string    `json:"link,omitempty"` // opens the email in webmail; absent if the webmail isn't known
+}
+
+// webmailTemplates are the webmail of well-known providers by IMAP server. Only
+// Gmail can search from a link; the others open the inbox.
+var webmailTemplates = map[string]string{
+	"imap.gmail.com":        "https://mail.google.com/mail/u/0/#search/from%3A{from}+subject%3A%22{subject}%22",
+	"outlook.office365.com": "https://outlook.office.com/mail/inbox",
+	"imap-mail.outlook.com": "https://outlook.live.com/mail/0/inbox",
+	"imap.mail.yahoo.com":   "https://mail.yahoo.com/",
+	"imap.mail.me.com":      "https://www.icloud.com/mail/",
+	"imap.fastmail.com":     "https://app.fastmail.com/mail/Inbox/",
+}
+
+// webmailLink returns the link that opens m in the webmail of template, which
+// names the sender's address as {from} and the subject as {subject}
+func webmailLink(template string, m storage.MessageRecord) string {
+	if template == "" {
+		return ""
+	}
+	from := m.From
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		from = addr.Address
+	}
+	return strings.NewReplacer("{from}", url.QueryEscape(from), "{subject}", url.QueryEscape(m.Subject)).Replace(template)
+}
+
+// browserOrigin reports whether a browser page of origin may connect to /ws.
+// Extensions and tools that send no origin may; web pages may not, since any
+// site could otherwise try the token against the local API.
+func browserOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "chrome-extension", "moz-extension", "safari-web-extension", "ms-browser-extension":
+		return true
+	}
+	return false
+}
+
+// serveBrowserEvents streams new email and the unread count to the browser
+// extension connected through r, until it disconnects or the API stops
+func serveBrowserEvents(w http.ResponseWriter, r *http.Request, hooks monitorHooks, webmail string, stopping <-chan struct{}) {
+	if !browserOrigin(r.Header.Get("Origin")) {
+		writeAPIError(w, http.StatusForbidden, errors.New("only browser extensions may connect"))
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		logging.Debugf("Browser extension connection refused: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	queue := make(chan []storage.MessageRecord, browserQueue)
+	unsubscribe := hooks.subscribe(func(emails []storage.MessageRecord) {
+		select {
+		case queue <- emails:
+		default:
+			logging.Debugf("Browser extension is falling behind; dropped %d new email(s)", len(emails))
+		}
+	})
+	defer unsubscribe()
+
+	send := func(m browserMessage) bool {
+		data, _ := json.Marshal(m)
+		return conn.WriteText(data) == nil
+	}
+	unread := totalUnread(hooks.status())
+	if !send(browserMessage{Type: browserTypeHello, Unread: unread}) {
+		return
+	}
+
+	ticker := time.NewTicker(browserUnreadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case emails := <-queue:
+			m := browserMessage{Type: browserTypeEmail}
+			for _, e := range emails {
+				m.Emails = append(m.Emails, browserEmail{
+					Account: e.Account,
+					Mailbox: e.Mailbox,
+					From:    e.From,
+					Sender:  storage.SenderName(e.From),
+					Subject: e.Subject,
+					Date:    e.Date,
+					Link:    webmailLink(webmail, e),
+				})
+			}
+			unread = totalUnread(hooks.status())
+			m.Unread = unread
+			if !send(m) {
+				return
+			}
+		case <-ticker.C:
+			if now := totalUnread(hooks.status()); !sameUnread(now, unread) {
+				unread = now
+				if !send(browserMessage{Type: browserTypeUnread, Unread: unread}) {
+					return
+				}
+			}
+		case <-conn.Done():
+			return
+		case <-stopping:
+			return
+		}
+	}
+}
+
+// totalUnread adds up the unread email of the accounts of report; nil if none has been counted
+func totalUnread(report statusReport) *int {
+	var total *int
+	for _, a := range report.Accounts {
+		if a.Unread == nil {
+			continue
+		}
+		if total == nil {
+			total = new(int)
+		}
+		*total += *a.Unread
+	}
+	return total
+}
+
+func sameUnread(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// browserWebmail is the webmail template the links to email of cfg use
+func browserWebmail(cfg config.Config) string {
+	if cfg.API.Webmail != "" {
+		return cfg.API.Webmail
+	}
+	return webmailTemplates[strings.ToLower(cfg.Email.ImapServer)]
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// clickScheme is the URL scheme notifications open when clicked, handled by "n0tif click"
+const clickScheme = "n0tif"
+
+// maxClickSenders limits the senders a click URL names, keeping it short for a
+// notification of a long list of emails
+const maxClickSenders = 10
+
+// maxClickSubject limits the characters of the subject a click URL carries
+const maxClickSubject = 200
+
+// clickURL is the URL a notification of emails opens when clicked. It names the
+// profile, as one handler serves them all, and the senders to credit the click to.
+func clickURL(emails []storage.MessageRecord) string {
+	q := url.Values{}
+	if p := storage.Profile(); p != "" {
+		q.Set("profile", p)
+	}
+	for _, sender := range notifiedSenders(emails) {
+		q.Add("sender", sender)
+	}
+	// The details of the newest email, for the on_click command
+	newest := emails[0]
+	q.Set("account", newest.Account)
+	q.Set("mailbox", newest.Mailbox)
+	q.Set("uid", strconv.FormatUint(uint64(newest.UID), 10))
+	q.Set("from", newest.From)
+	subject := []rune(newest.Subject)
+	if len(subject) > maxClickSubject {
+		subject = subject[:maxClickSubject]
+	}
+	q.Set("subject", string(subject))
+	return clickScheme + ":click?" + q.Encode()
+}
+
+// clickCommand is the on_click command with the placeholders replaced by the
+// details of the newest email that q of a click URL carries
+func clickCommand(onClick []string, q url.Values) *exec.Cmd {
+	from := q.Get("from")
+	address := from
+	if addr, err := mail.ParseAddress(from); err == nil {
+		address = addr.Address
+	}
+	r := strings.NewReplacer(
+		"{account}", q.Get("account"),
+		"{mailbox}", q.Get("mailbox"),
+		"{uid}", q.Get("uid"),
+		"{from}", address,
+		"{sender}", storage.SenderName(from),
+		"{subject}", q.Get("subject"),
+	)
+	args := make([]string, len(onClick))
+	for i, arg := range onClick {
+		args[i] = r.Replace(arg)
+	}
+	return exec.Command(args[0], args[1:]...)
+}
+
+// notifiedSenders names the distinct senders of emails, newest first
+func notifiedSenders(emails []storage.MessageRecord) []string {
+	var senders []string
+	for _, e := range emails {
+		if sender := storage.SenderName(e.From); !slices.Contains(senders, sender) && len(senders) < maxClickSenders {
+			senders = append(senders, sender)
+		}
+	}
+	return senders
+}
+
+// trackClicks registers the handler of click URLs and counts the notifications
+// of email published on bus, so "n0tif stats" can compare them with the clicks.
+// It reports false if clicks can't be tracked here; notifications then open the
+// mail client directly.
+func trackClicks(bus *events.Bus) bool {
+	exe, err := os.Executable()
+	if err != nil {
+		logging.Warnf("Notification clicks aren't tracked: %v", err)
+		return false
+	}
+	if err := registerClickHandler(exe, storage.Portable()); err != nil {
+		logging.Debugf("Notification clicks aren't tracked: %v", err)
+		return false
+	}
+	bus.Subscribe("clicks", events.NotificationSent, func(_ context.Context, e events.Event) {
+		if len(e.Emails) == 0 {
+			return
+		}
+		if err := storage.RecordNotificationShown(e.Time, notifiedSenders(e.Emails)); err != nil {
+			logging.Warnf("Failed to count notification: %v", err)
+		}
+	})
+	return true
+}
+
+// runClickCommand handles "n0tif click <url>", which Windows runs when a
+// notification is clicked: it counts the click and runs the on_click command of
+// the settings, or opens the mail client. The button of the notification asking
+// for a new password runs the account update wizard instead.
+func runClickCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: n0tif click <" + clickScheme + ":click?... URL>")
+		os.Exit(2)
+	}
+	u, err := url.Parse(args[0])
+	if err != nil || u.Scheme != clickScheme || (u.Opaque != "click" && u.Opaque != "reauth") {
+		fmt.Printf("Error: not a notification click URL: %q\n", args[0])
+		os.Exit(2)
+	}
+	q := u.Query()
+	if err := storage.SetProfile(q.Get("profile")); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if u.Opaque == "reauth" {
+		runReauthClick()
+		return
+	}
+
+	// Opening the mail client is what the click was for; a failure to count it mustn't stop that
+	if err := storage.RecordNotificationClicked(time.Now(), q["sender"]); err != nil {
+		logging.Warnf("Failed to count notification click: %v", err)
+	}
+	cfg := config.GetDefaultConfig()
+	if path, err := storage.GetConfigPath(); err == nil {
+		if settings, err := config.LoadSettings(path); err == nil {
+			settings.Apply(&cfg)
+		} else {
+			logging.Warnf("Failed to read the on_click command: %v", err)
+		}
+	}
+	cmd := exec.Command("explorer.exe", "mailto:")
+	if len(cfg.Notifications.OnClick) > 0 {
+		cmd = clickCommand(cfg.Notifications.OnClick, q)
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
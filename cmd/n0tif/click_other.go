@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// errClicksUnsupported is returned where notifications can't open a URL
+var errClicksUnsupported = errors.New("notification clicks can only be tracked on Windows")
+
+func registerClickHandler(exe string, portable bool) error {
+	return errClicksUnsupported
+}
+
+func unregisterClickHandler() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// clickKeyPath is the per-user registration of the click URL scheme
+const clickKeyPath = `Software\Classes\` + clickScheme
+
+// registerClickHandler makes Windows run "exe click <url>" for click URLs. The
+// registration is per user and needs no administrator rights.
+func registerClickHandler(exe string, portable bool) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, clickKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	if err := key.SetStringValue("", "URL:n0tif notification click"); err != nil {
+		return err
+	}
+	if err := key.SetStringValue("URL Protocol", ""); err != nil {
+		return err
+	}
+
+	command, _, err := registry.CreateKey(registry.CURRENT_USER, clickKeyPath+`\shell\open\command`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer command.Close()
+	line := syscall.EscapeArg(exe)
+	if portable {
+		line += " -portable"
+	}
+	return command.SetStringValue("", line+` click "%1"`)
+}
+
+// unregisterClickHandler removes the registration and reports whether there was one
+func unregisterClickHandler() (bool, error) {
+	// Keys can only be deleted once they have no subkeys
+	for _, path := range []string{`\shell\open\command`, `\shell\open`, `\shell`, ``} {
+		err := registry.DeleteKey(registry.CURRENT_USER, clickKeyPath+path)
+		if errors.Is(err, registry.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of the n0tif binary
+type command struct {
+	name    string
+	usage   string // arguments after the command name
+	summary string
+	run     func(args []string)
+}
+
+// commands lists the subcommands in the order they are shown in the usage text.
+// It is filled in init because printUsage, used by some commands, refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "", "Check for new email in the foreground (default)", runRunCommand},
+		{"start", "", "Start checking in the background", runStartCommand},
+		{"stop", "", "Stop the background instance of this profile", runStopCommand},
+		{"restart", "", "Restart the background instance of this profile", runRestartCommand},
+		{"status", "[-json]", "Show whether n0tif is running for this profile", runStatusCommand},
+		{"health", "[-max-age 15m]", "Exit with status 0 only if every account was checked successfully of late", runHealthCommand},
+		{"check-now", "", "Make the running instance check for new email right away", runCheckNowCommand},
+		{"mark-all-read", "", "Mark every email notified of since the running instance started as read", runMarkAllReadCommand},
+		{"pause", "[duration]", "Stop checking until resumed or for a while, e.g. 1h", runPauseCommand},
+		{"resume", "", "Resume checking after a pause", runResumeCommand},
+		{"away", "[on [-until YYYY-MM-DD]|off]", "Show or set whether you are away, which sums up new email once a day", runAwayCommand},
+		{"reload", "", "Make the running instance re-read its settings file", runReloadCommand},
+		{"loglevel", "[level] [duration]", "Show or change the log level of the running instance, e.g. debug 30m", runLogLevelCommand},
+		{"tray", "", "Show a notification area icon to watch and control the running instance", runTrayCommand},
+		{"tui", "", "Show a live dashboard of the running instance", runTUICommand},
+		{"logs", "[-f] [-n 100]", "Show the end of the log of this profile", runLogsCommand},
+		{"service", "[install|uninstall|start|stop|status]", "Manage the system service (default: install and start)", runServiceCommand},
+		{"autostart", "enable|disable|status", "Start in the background at login, without installing a service", runAutostartCommand},
+		{"uninstall", "[-purge] [-yes]", "Remove the services and stop n0tif; -purge also deletes all data", runUninstallCommand},
+		{"account", "add|update|remove|list|test [name]", "Manage the accounts, each kept in its own profile", runAccountCommand},
+		{"config", "check|edit|keygen|sign", "Check or edit the configuration, or sign managed settings", runConfigCommand},
+		{"test", "", "Log in to the mail server and show a test notification", runTestCommand},
+		{"test-connection", "", "Check DNS, TCP, TLS, login and INBOX access step by step", runTestConnectionCommand},
+		{"doctor", "[-json]", "Diagnose common problems and suggest fixes", runDoctorCommand},
+		{"folders", "[-json]", "List the mail folders of the account", runFoldersCommand},
+		{"recent", "[-n 20] [-mailbox INBOX] [-json]", "List the latest messages on the server", runRecentCommand},
+		{"history", "[-n 20] [-json]", "List the most recently arrived messages", runHistoryCommand},
+		{"search", "[-n 20] <text>", "Search the arrival history by sender or subject", runSearchCommand},
+		{"stats", "[-days 7]", "Show how much email arrived by day, hour and sender", runStatsCommand},
+		{"click", "<url>", "Count a click on a notification and open the mail client (run by Windows)", runClickCommand},
+		{"audit", "[-n 20] [-action name]", "List the actions taken on request, such as marking messages read", runAuditCommand},
+		{"export", "<file>", "Export credentials, state and settings, encrypted with a passphrase", runExportCommand},
+		{"import", "<file>", "Import an export file into this profile", runImportCommand},
+		{"backup", "<file.zip>", "Snapshot all data of this profile", runBackupCommand},
+		{"restore", "<file.zip>", "Replace the data of this profile with a backup", runRestoreCommand},
+		{"rekey", "[-to backend]", "Re-encrypt the saved password", runRekeyCommand},
+		{"app-password", "", "Get an app password from the provider and save it", runAppPasswordCommand},
+		{"api-token", "[-rotate]", "Show the token clients present to the HTTP API (-api)", runAPITokenCommand},
+		{"relay", "[hub-address]|key [-rotate]|set-key", "Show the notifications of a hub on another machine, or manage the relay key", runRelayCommand},
+		{"agent", "", "Hold the master password for this login session", runAgentCommand},
+		{"completion", "powershell|bash|zsh", "Print a shell completion script", runCompletionCommand},
+		{"version", "", "Show the version and build details", runVersionCommand},
+		{"help", "", "Show this help", func([]string) { printUsage() }},
+	}
+}
+
+// findCommand returns the named subcommand, or nil if there is none
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage describes the global flags and the subcommands
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: n0tif [flags] [command] [arguments]")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-44s %s\n", c.name+" "+c.usage, c.summary)
+	}
+	fmt.Fprintln(out, "\nFlags (before the command):")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nThe -background and -service flags of earlier versions still work as aliases for start and service.")
+}
+
+// printJSON writes v as indented JSON for the -json output mode
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// commandCompletions lists the arguments and flags offered after each subcommand
+var commandCompletions = map[string][]string{
+	"service":    {"install", "uninstall", "start", "stop", "status"},
+	"config":     {"check", "edit", "keygen", "sign"},
+	"account":    {"add", "update", "remove", "list", "test"},
+	"autostart":  {"enable", "disable", "status"},
+	"completion": {"powershell", "bash", "zsh"},
+	"pause":      {"15m", "30m", "1h", "2h"},
+	"away":       {"on", "off", "-until"},
+	"loglevel":   {"debug", "info", "warn", "error"},
+	"logs":       {"-f", "-n"},
+	"recent":     {"-n", "-mailbox", "-json"},
+	"history":    {"-n", "-json"},
+	"status":     {"-json"},
+	"folders":    {"-json"},
+	"doctor":     {"-json"},
+	"search":     {"-n"},
+	"stats":      {"-days"},
+	"audit":      {"-n", "-action"},
+	"rekey":      {"-to", "-old-hostname"},
+	"uninstall":  {"-purge", "-yes"},
+	"api-token":  {"-rotate"},
+	"relay":      {"key", "set-key"},
+	"health":     {"-max-age"},
+}
+
+// runCompletionCommand handles "n0tif completion powershell|bash|zsh". The scripts
+// call back into "n0tif completion profiles" to complete -profile with the profiles
+// that exist at that moment.
+func runCompletionCommand(args []string) {
+	shell := ""
+	if len(args) == 1 {
+		shell = args[0]
+	}
+	switch shell {
+	case "powershell":
+		fmt.Print(powershellCompletion())
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		// zsh runs the bash script through its bash compatibility layer
+		fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion())
+	case "profiles":
+		names, err := storage.ListProfiles()
+		if err != nil {
+			os.Exit(1)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	default:
+		fmt.Println("Usage: n0tif completion powershell|bash|zsh")
+		fmt.Println()
+		fmt.Println("PowerShell: n0tif completion powershell | Out-String | Invoke-Expression")
+		fmt.Println("            (add it to $PROFILE to load it in every session)")
+		fmt.Println("bash:       source <(n0tif completion bash)")
+		fmt.Println("zsh:        source <(n0tif completion zsh)")
+		os.Exit(2)
+	}
+}
+
+// completionFlags returns the global flags, and separately those that take a value
+func completionFlags() (all, withValue []string) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "daemon" {
+			return // internal
+		}
+		all = append(all, "-"+f.Name)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			withValue = append(withValue, "-"+f.Name, "--"+f.Name)
+		}
+	})
+	return all, withValue
+}
+
+// completionCommands returns the subcommand names in usage order
+func completionCommands() []string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return names
+}
+
+// bashCompletion returns the bash completion script
+func bashCompletion() string {
+	all, withValue := completionFlags()
+
+	var cases strings.Builder
+	names := make([]string, 0, len(commandCompletions))
+	for name := range commandCompletions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&cases, "        %s) words=%q ;;\n", name, strings.Join(commandCompletions[name], " "))
+	}
+
+	return fmt.Sprintf(`# bash completion for n0tif; load with: source <(n0tif completion bash)
+_n0tif_completion() {
+    local cur prev cmd words i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ "$prev" == "-profile" || "$prev" == "--profile" ]]; then
+        COMPREPLY=( $(compgen -W "$("${COMP_WORDS[0]}" completion profiles 2>/dev/null)" -- "$cur") )
+        return
+    fi
+    cmd=""
+    for (( i=1; i<COMP_CWORD; i++ )); do
+        case "${COMP_WORDS[i]}" in
+            %s) (( i++ )) ;;
+            -*) ;;
+            *) cmd="${COMP_WORDS[i]}"; break ;;
+        esac
+    done
+    case "$cmd" in
+        "") words=%q ;;
+%s        *) COMPREPLY=( $(compgen -f -- "$cur") ); return ;;
+    esac
+    COMPREPLY=( $(compgen -W "$words" -- "$cur") )
+}
+complete -F _n0tif_completion n0tif n0tif.exe
+`, strings.Join(withValue, "|"), strings.Join(append(completionCommands(), all...), " "), cases.String())
+}
+
+// powershellCompletion returns the PowerShell completion script
+func powershellCompletion() string {
+	all, withValue := completionFlags()
+
+	var table strings.Builder
+	for _, name := range completionCommands() {
+		fmt.Fprintf(&table, "        '%s' = @(%s)\n", name, psList(commandCompletions[name]))
+	}
+
+	return fmt.Sprintf(`# PowerShell completion for n0tif; load with:
+#   n0tif completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName 'n0tif', 'n0tif.exe' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $commands = @{
+%s    }
+    $globalFlags = @(%s)
+    $valueFlags = @(%s)
+
+    $words = @($commandAst.CommandElements | Where-Object { $_.Extent.EndOffset -le $cursorPosition } | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '') {
+        $words = @($words | Select-Object -First ($words.Count - 1))
+    }
+    $prev = if ($words.Count -gt 1) { $words[-1] } else { '' }
+
+    if ($prev -eq '-profile' -or $prev -eq '--profile') {
+        $candidates = @(& $words[0] completion profiles 2>$null)
+    } else {
+        $cmd = ''
+        for ($i = 1; $i -lt $words.Count; $i++) {
+            $w = $words[$i]
+            if ($valueFlags -contains $w) { $i++; continue }
+            if ($w.StartsWith('-')) { continue }
+            $cmd = $w
+            break
+        }
+        if ($cmd -eq '') {
+            $candidates = @($commands.Keys) + $globalFlags
+        } elseif ($commands.ContainsKey($cmd)) {
+            $candidates = $commands[$cmd]
+        } else {
+            return
+        }
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | Sort-Object | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`, table.String(), psList(all), psList(withValue))
+}
+
+// psList renders words as the elements of a PowerShell array literal
+func psList(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = "'" + w + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// runConfigCommand handles "n0tif config <action>"
+func runConfigCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: n0tif [flags] config check")
+		fmt.Println("       n0tif [flags] config edit")
+		fmt.Println("       n0tif config keygen <private-key-file>")
+		fmt.Println("       n0tif config sign <private-key-file> <settings.json> <signed.json>")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "check":
+		os.Exit(runConfigCheck())
+	case "edit":
+		os.Exit(runConfigEdit())
+	case "keygen":
+		os.Exit(runConfigKeygen(args[1:]))
+	case "sign":
+		os.Exit(runConfigSign(args[1:]))
+	default:
+		fmt.Printf("Unknown config action %q. Valid actions: check, edit, keygen, sign\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runConfigKeygen creates the Ed25519 key pair used to sign remotely managed settings.
+// The private key is written to a file; the public key goes into each client's remote block.
+func runConfigKeygen(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: n0tif config keygen <private-key-file>")
+		return 2
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	f, err := os.OpenFile(args[0], os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	_, err = fmt.Fprintln(f, base64.StdEncoding.EncodeToString(private))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Private key written to %s; keep it secret.\n", args[0])
+	fmt.Printf("Public key for the clients' \"remote\" settings:\n%s\n", base64.StdEncoding.EncodeToString(public))
+	return 0
+}
+
+// runConfigSign signs a settings file for publishing as remotely managed settings
+func runConfigSign(args []string) int {
+	if len(args) != 3 {
+		fmt.Println("Usage: n0tif config sign <private-key-file> <settings.json> <signed.json>")
+		return 2
+	}
+	keyData, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(keyData)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		fmt.Printf("Error: %s is not a key created by 'n0tif config keygen'\n", args[0])
+		return 1
+	}
+
+	if err := config.CheckSettingsFile(args[1]); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	settings, err := os.ReadFile(args[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	signed, err := config.SignSettings(ed25519.PrivateKey(key), settings)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(args[2], signed, 0644); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Signed settings written to %s; publish it at the clients' remote URL.\n", args[2])
+	return 0
+}
+
+// runConfigCheck loads the full configuration the way a normal start would and
+// reports every problem found. It returns the process exit code.
+func runConfigCheck() int {
+	var problems []error
+
+	settingsPath, err := storage.GetConfigPath()
+	if err != nil {
+		problems = append(problems, fmt.Errorf("cannot locate settings file: %w", err))
+	} else {
+		fmt.Printf("Settings file: %s\n", settingsPath)
+		if err := config.CheckSettingsFile(settingsPath); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	cfg, _, err := resolveAppConfig()
+	if err != nil {
+		problems = append(problems, err)
+	} else {
+		problems = append(problems, cfg.Validate()...)
+		problems = append(problems, checkNotifiers(cfg.Notifiers)...)
+		problems = append(problems, checkPushChannels(cfg.Push)...)
+		problems = append(problems, checkScripts()...)
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("Configuration OK.")
+		return 0
+	}
+
+	fmt.Printf("Found %d problem(s):\n", len(problems))
+	for _, p := range problems {
+		fmt.Printf("  - %v\n", p)
+	}
+	return 1
+}
+
+// runConfigEdit opens the settings file of the active profile in an editor and only
+// saves the result once it is valid. A running monitor picks the change up on its
+// own within seconds; reloading right away reports whether it accepted the settings.
+// It returns the process exit code.
+func runConfigEdit() int {
+	path, err := storage.GetConfigPath()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	original, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		original = nil
+	} else if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// Edit a copy so a half-finished file never reaches the monitor
+	draft, err := os.CreateTemp("", "n0tif-config-*.json")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	draftPath := draft.Name()
+	defer os.Remove(draftPath)
+	content := original
+	if content == nil {
+		content = starterSettings()
+	}
+	_, err = draft.Write(content)
+	if closeErr := draft.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	var edited []byte
+	for {
+		if err := openEditor(draftPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		problems := validateSettingsDraft(draftPath)
+		if len(problems) == 0 {
+			// Read after validating, which may have upgraded the draft's schema version
+			if edited, err = os.ReadFile(draftPath); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			break
+		}
+		fmt.Printf("The edited settings have %d problem(s):\n", len(problems))
+		for _, p := range problems {
+			fmt.Printf("  - %v\n", p)
+		}
+		if !promptYesNo("Edit again?") {
+			fmt.Printf("Nothing was saved; %s is unchanged.\n", path)
+			return 1
+		}
+	}
+
+	if original != nil && bytes.Equal(edited, original) {
+		fmt.Println("No changes.")
+		return 0
+	}
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, edited, 0644); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Saved %s.\n", path)
+
+	if pid, err := storage.ReadPIDFile(); err != nil || !processAlive(pid) {
+		return 0
+	}
+	if promptYesNo("Reload the running n0tif now?") {
+		sendControlCommand("reload", "")
+		fmt.Println("Settings reloaded.")
+	}
+	return 0
+}
+
+// validateSettingsDraft reports the syntax errors, unknown keys and invalid values in a settings file
+func validateSettingsDraft(path string) []error {
+	if err := config.CheckSettingsFile(path); err != nil {
+		return []error{err}
+	}
+	settings, err := config.LoadSettings(path)
+	if err != nil {
+		return []error{err}
+	}
+	return settings.Validate()
+}
+
+// starterSettings is what a new settings file starts out with: the check interval,
+// so there is something to edit
+func starterSettings() []byte {
+	data, _ := json.MarshalIndent(config.Settings{
+		CheckInterval: config.GetDefaultConfig().Email.CheckInterval,
+	}, "", "  ")
+	return append(data, '\n')
+}
+
+// openEditor opens path in $VISUAL or $EDITOR, falling back to notepad on Windows
+// and vi elsewhere, and waits for the editor to close
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad.exe"
+		}
+	}
+	// Allow editors that need arguments to wait, e.g. EDITOR="code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", fields[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// pauseTimeout resumes a paused monitor whose controller never came back, e.g. a crashed backup
+const pauseTimeout = 2 * time.Minute
+
+// defaultRecentLimit is how many messages the recent command returns without a limit
+const defaultRecentLimit = 10
+
+// runningAsService is set when the monitor was started by the service manager,
+// which has to be the one to stop it
+var runningAsService bool
+
+// monitorHooks are the parts of a running monitor the control endpoint and the HTTP API act on
+type monitorHooks struct {
+	status   func() statusReport
+	stop     func()
+	checkNow func() ([]string, error)
+	pause    func(d time.Duration) // pauses checking; zero pauses until resume
+	resume   func() bool
+	markRead func(mailbox string, uid uint32) error
+	// markAllRead marks every email notified of since the start as read and returns how many
+	markAllRead func() (int, error)
+	reload      func() error // re-reads the settings file; nil when hot reload is unavailable
+	notify      func(title, message string, style notify.Style) error
+	// reloadCredentials logs in with the password saved since the start from now on
+	reloadCredentials func() error
+	// setLogLevel changes the verbosity; a non-zero d switches back after d
+	setLogLevel func(level logging.Level, d time.Duration)
+	// subscribe calls handle with the new email of every check, newest first, until unsubscribed
+	subscribe func(handle func(emails []storage.MessageRecord)) (unsubscribe func())
+}
+
+// checkNowReport is the reply to the check-now command
+type checkNowReport struct {
+	NewEmails []string `json:"new_emails"`
+}
+
+// startControlServer lets other n0tif commands of the same profile control this
+// monitor. It returns nil if the server can't be started; the monitor runs without it.
+func startControlServer(hooks monitorHooks) *control.Server {
+
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		logging.Warnf("Control endpoint disabled, cannot locate app folder: %v", err)
+		return nil
+	}
+
+	var mu sync.Mutex
+	var resumeTimer *time.Timer
+	resumeStorage := func(string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if resumeTimer != nil {
+			resumeTimer.Stop()
+			resumeTimer = nil
+		}
+		if !storage.Suspended() {
+			return "not paused", nil
+		}
+		if err := storage.Resume(); err != nil {
+			return "", err
+		}
+		logging.Infof("Storage resumed.")
+		return "resumed", nil
+	}
+
+	server, err := control.Serve(appFolder, map[string]control.Handler{
+		"suspend-storage": func(string) (string, error) {
+			if err := storage.Suspend(); err != nil {
+				return "", err
+			}
+			logging.Infof("Storage paused on request; resuming automatically in %v.", pauseTimeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if resumeTimer != nil {
+				resumeTimer.Stop()
+			}
+			resumeTimer = time.AfterFunc(pauseTimeout, func() {
+				logging.Infof("Pause timed out.")
+				resumeStorage("")
+			})
+			return "paused", nil
+		},
+		"resume-storage": resumeStorage,
+		"pause": func(arg string) (string, error) {
+			var d time.Duration
+			if arg != "" {
+				var err error
+				if d, err = time.ParseDuration(arg); err != nil || d < 0 {
+					return "", fmt.Errorf("invalid duration %q", arg)
+				}
+			}
+			hooks.pause(d)
+			if d == 0 {
+				return "paused", nil
+			}
+			return "paused for " + d.String(), nil
+		},
+		"resume": func(string) (string, error) {
+			if !hooks.resume() {
+				return "not paused", nil
+			}
+			return "resumed", nil
+		},
+		"status": func(string) (string, error) {
+			data, err := json.Marshal(hooks.status())
+			return string(data), err
+		},
+		"check-now": func(string) (string, error) {
+			subjects, err := hooks.checkNow()
+			if err != nil {
+				return "", err
+			}
+			data, err := json.Marshal(checkNowReport{NewEmails: subjects})
+			return string(data), err
+		},
+		"recent": func(arg string) (string, error) {
+			limit := defaultRecentLimit
+			if arg != "" {
+				n, err := strconv.Atoi(arg)
+				if err != nil || n <= 0 {
+					return "", fmt.Errorf("invalid limit %q", arg)
+				}
+				limit = n
+			}
+			messages, err := storage.SearchMessages("", limit)
+			if err != nil {
+				return "", err
+			}
+			data, err := json.Marshal(messages)
+			return string(data), err
+		},
+		"mark-read": func(arg string) (string, error) {
+			// "<uid> <mailbox>"; the mailbox name may contain spaces
+			uidText, mailbox, ok := strings.Cut(arg, " ")
+			uid, err := strconv.ParseUint(uidText, 10, 32)
+			if !ok || err != nil || mailbox == "" {
+				return "", fmt.Errorf("invalid message %q", arg)
+			}
+			if err := hooks.markRead(mailbox, uint32(uid)); err != nil {
+				return "", err
+			}
+			return "marked read", nil
+		},
+		"mark-all-read": func(string) (string, error) {
+			n, err := hooks.markAllRead()
+			if err != nil {
+				return "", err
+			}
+			return strconv.Itoa(n), nil
+		},
+		"loglevel": func(arg string) (string, error) {
+			if arg == "" {
+				return logging.CurrentLevel().String(), nil
+			}
+			level, d, err := parseLogLevelArg(arg)
+			if err != nil {
+				return "", err
+			}
+			hooks.setLogLevel(level, d)
+			return level.String(), nil
+		},
+		"reload": func(string) (string, error) {
+			if hooks.reload == nil {
+				return "", errors.New("settings reload is not available in this instance")
+			}
+			if err := hooks.reload(); err != nil {
+				return "", err
+			}
+			return "reloaded", nil
+		},
+		"reload-credentials": func(string) (string, error) {
+			if err := hooks.reloadCredentials(); err != nil {
+				return "", err
+			}
+			return "reloaded", nil
+		},
+		"stop": func(string) (string, error) {
+			if runningAsService {
+				return "", fmt.Errorf("n0tif runs as a %s here; use 'n0tif service stop'", serviceKind)
+			}
+			logging.Infof("Stop requested.")
+			// Reply before shutting down so the caller isn't left waiting
+			time.AfterFunc(100*time.Millisecond, hooks.stop)
+			return "stopping", nil
+		},
+	})
+	if err != nil {
+		logging.Warnf("Failed to start control endpoint: %v", err)
+		return nil
+	}
+	return server
+}
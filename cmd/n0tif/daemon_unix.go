@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess makes the daemon child outlive the terminal it was started from
+func detachProcess(cmd *exec.Cmd) {
+	// A new session has no controlling terminal, so closing the terminal
+	// doesn't send the child SIGHUP, which would otherwise reload its settings
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess makes the daemon child outlive the console it was started from
+func detachProcess(cmd *exec.Cmd) {
+	// Use CREATE_NEW_PROCESS_GROUP to detach, but not DETACHED_PROCESS
+	// This combination should allow the console window to be hidden but the process to stay alive
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
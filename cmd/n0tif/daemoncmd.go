@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// stopTimeout is how long stop waits for the monitor to exit before killing it
+const stopTimeout = 10 * time.Second
+
+// checkNowTimeout bounds an immediate check, which may wait for a slow server
+const checkNowTimeout = 2 * time.Minute
+
+// runStopCommand handles "n0tif stop"
+func runStopCommand(args []string) {
+	stopped, err := stopMonitor()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !stopped {
+		fmt.Println("n0tif is not running for this profile.")
+		return
+	}
+	fmt.Println("n0tif has stopped.")
+}
+
+// runRestartCommand handles "n0tif restart": stop the background instance, then start a new one
+func runRestartCommand(args []string) {
+	cfg := loadAppConfig()
+
+	stopped, err := stopMonitor()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if stopped {
+		fmt.Println("Stopped the running instance.")
+	}
+	runInBackground(cfg)
+}
+
+// stopMonitor stops the running monitor of the active profile and waits for it to
+// exit. It asks the monitor to shut down cleanly and only kills the recorded PID when
+// the monitor doesn't answer. It reports whether anything was running.
+func stopMonitor() (bool, error) {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		return false, err
+	}
+
+	pid, pidErr := storage.ReadPIDFile()
+	if pidErr != nil && !errors.Is(pidErr, storage.ErrNoPIDFile) {
+		return false, fmt.Errorf("read PID file: %w", pidErr)
+	}
+	alive := pidErr == nil && processAlive(pid)
+
+	_, err = control.Call(appFolder, "stop", controlTimeout)
+	switch {
+	case err == nil:
+		if !alive {
+			// Nothing recorded to wait on; the monitor exits right after replying
+			return true, nil
+		}
+	case errors.Is(err, control.ErrNotRunning):
+		if !alive {
+			return false, nil
+		}
+		// Running but not answering, e.g. stuck or started by an older version
+		if err := killProcess(pid); err != nil {
+			return true, err
+		}
+	default:
+		return false, err
+	}
+
+	if !waitForExit(pid, stopTimeout) {
+		fmt.Printf("n0tif (PID %d) didn't exit within %v, terminating it.\n", pid, stopTimeout)
+		if err := killProcess(pid); err != nil {
+			return true, err
+		}
+		waitForExit(pid, stopTimeout)
+	}
+	return true, nil
+}
+
+// killProcess terminates the process without giving it a chance to clean up
+func killProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := p.Kill(); err != nil {
+		return fmt.Errorf("terminate PID %d: %w", pid, err)
+	}
+	return nil
+}
+
+// waitForExit polls until the process is gone, reporting whether it exited in time
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// runCheckNowCommand handles "n0tif check-now": the running monitor checks for new
+// email right away and notifies as usual
+func runCheckNowCommand(args []string) {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Checking for new email...")
+	reply, err := control.Call(appFolder, "check-now", checkNowTimeout)
+	if errors.Is(err, control.ErrNotRunning) {
+		fmt.Println("n0tif is not running for this profile. Start it with 'n0tif start'.")
+		os.Exit(3)
+	}
+	if err != nil {
+		fmt.Printf("Check failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	var report checkNowReport
+	if err := json.Unmarshal([]byte(reply), &report); err != nil {
+		fmt.Printf("Error: unexpected check-now reply: %v\n", err)
+		os.Exit(1)
+	}
+	if len(report.NewEmails) == 0 {
+		fmt.Println("No new email.")
+		return
+	}
+	fmt.Printf("%d new email(s):\n", len(report.NewEmails))
+	for _, subject := range report.NewEmails {
+		fmt.Printf("  %s\n", subject)
+	}
+}
+
+// runMarkAllReadCommand handles "n0tif mark-all-read": the running monitor marks
+// every email it notified of as read on the server, for catching up at once
+func runMarkAllReadCommand(args []string) {
+	n, err := strconv.Atoi(sendControlCommand("mark-all-read", ""))
+	if err != nil {
+		fmt.Printf("Error: unexpected mark-all-read reply: %v\n", err)
+		os.Exit(1)
+	}
+	if n == 0 {
+		fmt.Println("Nothing to mark read; every email notified of is marked already.")
+		return
+	}
+	fmt.Printf("Marked %d email(s) read.\n", n)
+}
+
+// runPauseCommand handles "n0tif pause [duration]": the running monitor stops
+// checking until "n0tif resume", or until the duration has elapsed
+func runPauseCommand(args []string) {
+	if len(args) > 1 {
+		fmt.Println("Usage: n0tif [-profile name] pause [duration, e.g. 30m or 1h]")
+		os.Exit(2)
+	}
+	arg := ""
+	if len(args) == 1 {
+		d, err := time.ParseDuration(args[0])
+		if err != nil || d <= 0 {
+			fmt.Printf("Error: invalid duration %q; use e.g. 30m or 1h\n", args[0])
+			os.Exit(2)
+		}
+		arg = d.String()
+	}
+	sendControlCommand("pause", arg)
+	if arg == "" {
+		fmt.Println("Checking paused until 'n0tif resume'.")
+	} else {
+		fmt.Printf("Checking paused for %s.\n", arg)
+	}
+}
+
+// runResumeCommand handles "n0tif resume"
+func runResumeCommand(args []string) {
+	if sendControlCommand("resume", "") == "not paused" {
+		fmt.Println("Checking wasn't paused.")
+		return
+	}
+	fmt.Println("Checking resumed.")
+}
+
+// sendControlCommand sends a command to the running monitor of the profile and
+// returns its reply, exiting when there is no monitor or the command fails
+func sendControlCommand(command, arg string) string {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	reply, err := control.CallWithArg(appFolder, command, arg, controlTimeout)
+	if errors.Is(err, control.ErrNotRunning) {
+		fmt.Println("n0tif is not running for this profile.")
+		os.Exit(3)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return reply
+}
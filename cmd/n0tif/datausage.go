@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+const (
+	// dataCapInterval is how often the month's data usage is compared with the cap
+	dataCapInterval = 10 * time.Minute
+	// megabyte is the unit of the monthly cap, as Windows counts it
+	megabyte = 1 << 20
+)
+
+// dataStatus is the data usage in the status report
+type dataStatus struct {
+	LastCheck  storage.DataUsage `json:"last_check"`
+	Today      storage.DataUsage `json:"today"`
+	Month      storage.DataUsage `json:"month"`
+	MonthlyCap int64             `json:"monthly_cap,omitempty"` // in bytes; 0 without a cap
+}
+
+// dataCap warns once a month when the connections to the mail server used more
+// data than the monthly cap of the settings
+type dataCap struct {
+	send func(title, message string) error
+
+	mu  sync.Mutex
+	cap int64 // in bytes; 0 while disabled
+}
+
+// newDataCap starts comparing the data usage with the cap of cfg; send shows the warning
+func newDataCap(cfg config.AlertsConfig, send func(title, message string) error) *dataCap {
+	d := &dataCap{send: send}
+	d.update(cfg)
+	go d.run()
+	return d
+}
+
+// update applies a changed cap
+func (d *dataCap) update(cfg config.AlertsConfig) {
+	limit := int64(cfg.MonthlyDataMB) * megabyte
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if limit == d.cap {
+		return
+	}
+	d.cap = limit
+	if limit == 0 {
+		logging.Infof("Monthly data cap disabled.")
+	} else {
+		logging.Infof("Warning when the mail server connections use more than %s a month.", formatBytes(limit))
+	}
+}
+
+func (d *dataCap) limit() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cap
+}
+
+// run compares the usage with the cap every dataCapInterval
+func (d *dataCap) run() {
+	ticker := time.NewTicker(dataCapInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.check(time.Now())
+	}
+}
+
+// check warns if the month of now is over the cap and hasn't been warned of yet
+func (d *dataCap) check(now time.Time) {
+	limit := d.limit()
+	if limit == 0 {
+		return
+	}
+	used, err := storage.DataUsageSince(monthStart(now))
+	if err != nil {
+		logging.Warnf("Failed to read the data usage: %v", err)
+		return
+	}
+	if used.Total() < limit {
+		return
+	}
+	first, err := storage.MarkDataCapWarned(now)
+	if err != nil {
+		logging.Warnf("Failed to record the data cap warning: %v", err)
+		return
+	}
+	if !first {
+		return
+	}
+	logging.Warnf("The mail server connections used %s this month, over the cap of %s.", formatBytes(used.Total()), formatBytes(limit))
+	message := fmt.Sprintf("Checking email used %s this month, over the cap of %s. Raise check_interval to use less.",
+		formatBytes(used.Total()), formatBytes(limit))
+	if err := d.send("n0tif data cap reached", message); err != nil {
+		logging.Warnf("Failed to show the data cap warning: %v", err)
+	}
+}
+
+// status returns the data usage for the status report, with last as that of
+// the last check
+func (d *dataCap) status(last storage.DataUsage, now time.Time) *dataStatus {
+	today, err := storage.DataUsageSince(now)
+	if err != nil {
+		logging.Debugf("Failed to read the data usage: %v", err)
+		return nil
+	}
+	month, err := storage.DataUsageSince(monthStart(now))
+	if err != nil {
+		logging.Debugf("Failed to read the data usage: %v", err)
+		return nil
+	}
+	return &dataStatus{LastCheck: last, Today: today, Month: month, MonthlyCap: d.limit()}
+}
+
+// monthStart returns the first day of the month of t
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// formatBytes renders n in the largest unit that keeps it at 1 or more, e.g. "4.1 MB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[prefix])
+}
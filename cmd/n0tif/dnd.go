@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/calendar"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// dndPollInterval is how often held notifications are checked for release
+const dndPollInterval = time.Minute
+
+// doNotDisturb holds back notifications while the calendar shows a meeting
+type doNotDisturb struct {
+	release func(held []storage.MessageRecord)
+
+	mu       sync.Mutex
+	calendar *calendar.ICSCalendar // nil while do-not-disturb is disabled
+	mode     string
+	pending  []storage.MessageRecord
+}
+
+// newDoNotDisturb creates the gate and starts releasing held notifications.
+// release is called with the held emails (newest first) once the meeting is over.
+func newDoNotDisturb(cfg config.DoNotDisturbConfig, release func(held []storage.MessageRecord)) *doNotDisturb {
+	d := &doNotDisturb{release: release}
+	d.update(cfg)
+	go d.watch()
+	return d
+}
+
+// update applies a changed do-not-disturb configuration
+func (d *doNotDisturb) update(cfg config.DoNotDisturbConfig) {
+	mode := cfg.Mode
+	if mode != config.DNDModeSuppress {
+		mode = config.DNDModeBatch
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mode = mode
+	if cfg.CalendarURL == "" {
+		if d.calendar != nil {
+			logging.Infof("Do-not-disturb disabled.")
+		}
+		d.calendar = nil
+		return
+	}
+	d.calendar = calendar.NewICSCalendar(cfg.CalendarURL, calendar.DefaultRefreshInterval)
+	logging.Infof("Do-not-disturb enabled (mode: %s).", mode)
+}
+
+// hold reports whether the notification for emails should be withheld.
+// In batch mode the emails are kept for the post-meeting digest.
+func (d *doNotDisturb) hold(emails []storage.MessageRecord) bool {
+	d.mu.Lock()
+	cal, mode := d.calendar, d.mode
+	d.mu.Unlock()
+	if cal == nil {
+		return false
+	}
+
+	busy, until, err := cal.BusyUntil(time.Now())
+	if err != nil {
+		logging.Warnf("Do-not-disturb: Calendar refresh failed: %v", err)
+	}
+	if !busy {
+		return false
+	}
+
+	if mode == config.DNDModeSuppress {
+		logging.Infof("Do-not-disturb: Busy until %s, suppressing notification for %d email(s).",
+			until.Format(time.Kitchen), len(emails))
+		return true
+	}
+
+	d.mu.Lock()
+	// Newer emails go first to keep the newest-first order of the digest
+	d.pending = append(append([]storage.MessageRecord{}, emails...), d.pending...)
+	held := len(d.pending)
+	d.mu.Unlock()
+
+	logging.Infof("Do-not-disturb: Busy until %s, holding %d email(s) for the digest.",
+		until.Format(time.Kitchen), held)
+	return true
+}
+
+// watch releases the held notifications as a digest once the calendar is free
+// (or do-not-disturb has been turned off in the meantime)
+func (d *doNotDisturb) watch() {
+	ticker := time.NewTicker(dndPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.mu.Lock()
+		cal, hasPending := d.calendar, len(d.pending) > 0
+		d.mu.Unlock()
+		if !hasPending {
+			continue
+		}
+
+		if cal != nil {
+			busy, _, err := cal.BusyUntil(time.Now())
+			if err != nil {
+				logging.Warnf("Do-not-disturb: Calendar refresh failed: %v", err)
+			}
+			if busy {
+				continue
+			}
+		}
+
+		d.mu.Lock()
+		held := d.pending
+		d.pending = nil
+		d.mu.Unlock()
+
+		logging.Infof("Do-not-disturb: Meeting over, releasing digest of %d email(s).", len(held))
+		d.release(held)
+	}
+}
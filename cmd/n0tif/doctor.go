@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/schema"
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/kardianos/service"
+)
+
+// doctorResult is the outcome of one diagnostic check
+type doctorResult struct {
+	Check  string `json:"check"`
+	Status string `json:"status"` // ok, warn, fail or skip
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctor collects the outcome of the diagnostic checks
+type doctor struct {
+	failures int
+	results  []doctorResult
+}
+
+// report records a result and, unless -json is set, prints it right away
+func (d *doctor) report(r doctorResult) {
+	d.results = append(d.results, r)
+	if *jsonOutput {
+		return
+	}
+	label := map[string]string{"ok": " OK ", "warn": "WARN", "fail": "FAIL", "skip": "SKIP"}[r.Status]
+	fmt.Printf("[%s] %s: %s\n", label, r.Check, r.Detail)
+	if r.Hint != "" {
+		fmt.Printf("       Hint: %s\n", r.Hint)
+	}
+}
+
+// ok reports a passed check
+func (d *doctor) ok(check, detail string) {
+	d.report(doctorResult{Check: check, Status: "ok", Detail: detail})
+}
+
+// warn reports something that works but may not be what the user wants
+func (d *doctor) warn(check, detail, hint string) {
+	d.report(doctorResult{Check: check, Status: "warn", Detail: detail, Hint: hint})
+}
+
+// fail reports a failed check with what to do about it
+func (d *doctor) fail(check string, err error, hint string) {
+	d.failures++
+	d.report(doctorResult{Check: check, Status: "fail", Detail: err.Error(), Hint: hint})
+}
+
+// runDoctorCommand handles "n0tif doctor [-json]": it checks everything n0tif
+// depends on and suggests a fix for each problem found
+func runDoctorCommand(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.BoolVar(jsonOutput, "json", *jsonOutput, "Print the results as JSON (same as the global -json)")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] doctor [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// The checks print their own results; the progress logging of the
+	// configuration loading would only get in the way
+	logging.SetOutput(io.Discard, logging.FormatText)
+
+	d := &doctor{}
+	d.checkSettings()
+	if !d.checkCredentials() {
+		// Loading the configuration would fail, or ask for the master password again
+		d.report(doctorResult{Check: "Configuration, mail server and notifications", Status: "skip", Detail: "the saved credentials are unusable"})
+		d.checkService()
+		d.checkLogFile()
+		d.summary()
+		return
+	}
+
+	cfg, _, err := resolveAppConfig()
+	if err == nil {
+		problems := cfg.Validate()
+		if len(problems) == 0 {
+			d.ok("Configuration", "valid")
+		} else {
+			d.fail("Configuration", errors.Join(problems...), "Run 'n0tif config check' and fix the settings file")
+		}
+		d.checkServer(cfg.Email)
+	} else {
+		d.fail("Configuration", err, "Save credentials with 'n0tif -server ... -user ... -pass ... -save'")
+	}
+
+	d.checkService()
+	d.checkLogFile()
+	d.checkEmailState()
+	if err == nil {
+		d.checkToasts(cfg.Email)
+	}
+	d.summary()
+}
+
+// summary prints the overall result and sets the exit code
+func (d *doctor) summary() {
+	if *jsonOutput {
+		printJSON(struct {
+			OK     bool           `json:"ok"`
+			Checks []doctorResult `json:"checks"`
+		}{d.failures == 0, d.results})
+		if d.failures > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if d.failures > 0 {
+		fmt.Printf("\n%d check(s) failed.\n", d.failures)
+		os.Exit(1)
+	}
+	fmt.Println("\nEverything looks good.")
+}
+
+// checkSettings validates the settings file, if there is one
+func (d *doctor) checkSettings() {
+	path, err := storage.GetConfigPath()
+	if err != nil {
+		d.fail("Settings file", err, "Check that the profile folder can be created")
+		return
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		d.ok("Settings file", "none, using defaults")
+		return
+	}
+	if err := config.CheckSettingsFile(path); err != nil {
+		d.fail("Settings file", err, "Fix or delete "+path)
+		return
+	}
+	d.ok("Settings file", path)
+}
+
+// checkCredentials makes sure the saved password can be decrypted.
+// It reports false when there are saved credentials that can't be used.
+func (d *doctor) checkCredentials() bool {
+	if !storage.CredentialsExist() {
+		d.warn("Saved credentials", "none", "Save them with -save so n0tif can run without a password on the command line")
+		return true
+	}
+	if err := unlockCredentials(); err != nil {
+		d.fail("Saved credentials", err, "Set "+masterPasswordEnvVar+" or start 'n0tif agent'")
+		return false
+	}
+	if _, err := storage.LoadCredentials(); err != nil {
+		hint := "Save the credentials again with -save"
+		if errors.Is(err, storage.ErrWrongPassphrase) {
+			hint = "The master password is wrong"
+		} else if scheme, _ := storage.CredentialsEncryption(); scheme == storage.EncryptionMachineKey {
+			hint = "If the computer was renamed, run 'n0tif rekey -old-hostname <previous name>'"
+		}
+		d.fail("Saved credentials", err, hint)
+		return false
+	}
+	scheme, _ := storage.CredentialsEncryption()
+	if (scheme == storage.EncryptionMachineKey || scheme == storage.EncryptionDPAPI) && storage.TPMAvailable() {
+		d.warn("Saved credentials", "decrypted ("+scheme+")", "A TPM is available; 'n0tif rekey -to tpm' keeps copies of the file from being decrypted elsewhere")
+		return true
+	}
+	d.ok("Saved credentials", "decrypted ("+scheme+")")
+	return true
+}
+
+// checkServer connects to the mail server step by step
+func (d *doctor) checkServer(cfg config.EmailConfig) {
+	var passed string
+	err := email.Diagnose(cfg, func(r email.StepResult) {
+		if r.Err != nil {
+			hint := serverHint(r)
+			if errors.Is(r.Err, email.ErrCertificateUntrusted) {
+				hint = certificateHint(cfg)
+			}
+			d.fail("Mail server", fmt.Errorf("%s: %w", r.Step, r.Err), hint)
+			return
+		}
+		passed = r.Step
+	})
+	if err == nil {
+		d.ok("Mail server", fmt.Sprintf("%s:%d reachable, %s OK", cfg.ImapServer, cfg.ImapPort, passed))
+	}
+}
+
+// serverHint suggests a fix for a failed step of email.Diagnose, going by the
+// class of the error: a connection dropping during login is no password problem
+func serverHint(r email.StepResult) string {
+	switch {
+	case errors.Is(r.Err, email.ErrAppPasswordRequired):
+		return "The provider wants an app password; run 'n0tif app-password' to get one"
+	case errors.Is(r.Err, email.ErrAuthFailed):
+		return "Check the username and password; many providers require an app password"
+	case errors.Is(r.Err, email.ErrMailboxNotFound):
+		return "The account has no accessible INBOX"
+	case errors.Is(r.Err, email.ErrThrottled):
+		return "The provider limits connections; close other mail clients or wait a while"
+	}
+	switch r.Step {
+	case email.StepDNS:
+		return "Check the server name and your internet connection"
+	case email.StepTCP:
+		return "Check the port and whether a firewall or proxy blocks it"
+	case email.StepTLS:
+		return "The server must support IMAP over TLS (usually port 993); check the system clock too"
+	default:
+		return "The server closed the connection; check whether antivirus or a proxy intercepts it"
+	}
+}
+
+// checkService reports whether the service of the profile is installed and running
+func (d *doctor) checkService() {
+	serviceLabel := strings.ToUpper(serviceKind[:1]) + serviceKind[1:]
+	svc, err := service.New(&n0tifService{}, newServiceConfig())
+	if err != nil {
+		d.fail(serviceLabel, err, "")
+		return
+	}
+	status, err := svc.Status()
+	switch {
+	case errors.Is(err, service.ErrNotInstalled):
+		d.ok(serviceLabel, "not installed")
+	case err != nil:
+		d.warn(serviceLabel, err.Error(), "")
+	case status == service.StatusRunning:
+		d.ok(serviceLabel, "installed and running")
+	default:
+		d.warn(serviceLabel, "installed but not running", "Start it with 'n0tif service start'")
+	}
+}
+
+// checkLogFile makes sure the background and service modes can write their log
+func (d *doctor) checkLogFile() {
+	path, err := storage.GetLogPath()
+	if err != nil {
+		d.fail("Log file", err, "")
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		d.fail("Log file", err, "Check the permissions of "+path)
+		return
+	}
+	f.Close()
+	d.ok("Log file", path)
+}
+
+// checkEmailState makes sure the tracking state of the profile can be read
+func (d *doctor) checkEmailState() {
+	err := storage.CheckEmailState()
+	switch {
+	case errors.Is(err, storage.ErrStateCorrupt):
+		d.warn("Email state", err.Error(), "n0tif recovers it on the next start, from the backup if that is intact; mail that arrived meanwhile may not be notified")
+	case errors.Is(err, schema.ErrTooNew):
+		d.fail("Email state", err, "Upgrade n0tif to the release that wrote it")
+	case err != nil:
+		d.fail("Email state", err, "Check the permissions of the profile folder")
+	default:
+		d.ok("Email state", "readable")
+	}
+}
+
+// checkToasts makes sure notifications can be shown
+func (d *doctor) checkToasts(cfg config.EmailConfig) {
+	err := notify.CheckToasts(resolveNotificationIdentity(cfg))
+	switch {
+	case errors.Is(err, notify.ErrToastsDisabled):
+		d.fail("Notifications", err, "Turn on notifications in Settings > System > Notifications")
+	case err != nil:
+		d.fail("Notifications", err, "Run 'n0tif test' to try showing one")
+	default:
+		d.ok("Notifications", "enabled")
+	}
+}
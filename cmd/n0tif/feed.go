@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// defaultFeedLimit is how many messages the feeds list without an n parameter
+const defaultFeedLimit = 50
+
+// feedTitle names the feeds in feed readers
+const feedTitle = "n0tif: new email"
+
+// atomFeed is the Atom document of /feed.atom
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Summary string     `xml:"summary"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// rssFeed is the RSS 2.0 document of /feed.rss
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// feedEntryID identifies m for feed readers, which show each ID once
+func feedEntryID(m storage.MessageRecord) string {
+	return fmt.Sprintf("urn:n0tif:%s:%s:%d:%d", url.PathEscape(m.Account), url.PathEscape(m.Mailbox), m.UID, m.Date.Unix())
+}
+
+// feedSummary describes m in a feed entry
+func feedSummary(m storage.MessageRecord) string {
+	return fmt.Sprintf("From %s in %s of %s", m.From, m.Mailbox, m.Account)
+}
+
+// feedTime is when m arrived as far as the feeds are concerned: when n0tif saw it
+func feedTime(m storage.MessageRecord) time.Time {
+	if m.SeenAt.IsZero() {
+		return m.Date
+	}
+	return m.SeenAt
+}
+
+// writeAtomFeed writes messages, newest first, as an Atom feed
+func writeAtomFeed(w io.Writer, messages []storage.MessageRecord) error {
+	feed := atomFeed{
+		ID:    "urn:n0tif:feed:" + url.PathEscape(storage.Profile()),
+		Title: feedTitle,
+	}
+	updated := time.Unix(0, 0)
+	for _, m := range messages {
+		t := feedTime(m)
+		if t.After(updated) {
+			updated = t
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      feedEntryID(m),
+			Title:   m.Subject,
+			Updated: t.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: m.From},
+			Summary: feedSummary(m),
+		})
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	return writeFeed(w, feed)
+}
+
+// writeRSSFeed writes messages, newest first, as an RSS 2.0 feed linking to link
+func writeRSSFeed(w io.Writer, link string, messages []storage.MessageRecord) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       feedTitle,
+			Link:        link,
+			Description: "Email that arrived in the accounts n0tif checks",
+		},
+	}
+	for _, m := range messages {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       m.Subject,
+			Description: feedSummary(m),
+			GUID:        rssGUID{Value: feedEntryID(m)},
+			PubDate:     feedTime(m).Format(time.RFC1123Z),
+		})
+	}
+	return writeFeed(w, feed)
+}
+
+func writeFeed(w io.Writer, feed interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
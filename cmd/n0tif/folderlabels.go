@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// folderLabel is how the notifications of email in one mailbox are labelled
+type folderLabel struct {
+	name string
+	icon string // path to the image; empty keeps the account's
+}
+
+// folderLabels labels notifications by the mailbox of their emails, following the settings file
+type folderLabels struct {
+	mu     sync.Mutex
+	labels map[string]folderLabel // by mailbox, INBOX in upper case
+}
+
+// update applies changed settings, generating the icons of folders with a color
+func (l *folderLabels) update(cfg config.NotificationsConfig) {
+	labels := make(map[string]folderLabel, len(cfg.Folders))
+	for _, f := range cfg.Folders {
+		label := folderLabel{name: f.Name, icon: f.Icon}
+		if label.icon == "" && f.Color != "" {
+			label.icon = colorIcon(f.Color)
+		}
+		labels[folderKey(f.Mailbox)] = label
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.labels = labels
+}
+
+// of returns the label of the mailbox emails are in. It reports false when they
+// are in several mailboxes or in one without a label.
+func (l *folderLabels) of(emails []storage.MessageRecord) (folderLabel, bool) {
+	if len(emails) == 0 {
+		return folderLabel{}, false
+	}
+	mailbox := folderKey(emails[0].Mailbox)
+	for _, e := range emails[1:] {
+		if folderKey(e.Mailbox) != mailbox {
+			return folderLabel{}, false
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	label, ok := l.labels[mailbox]
+	return label, ok
+}
+
+// folderKey is the name mailbox is looked up by; IMAP treats INBOX case-insensitively
+func folderKey(mailbox string) string {
+	if strings.EqualFold(mailbox, "INBOX") {
+		return "INBOX"
+	}
+	return mailbox
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+const (
+	// defaultFollowUpDays is how long a reply may take unless the settings say otherwise
+	defaultFollowUpDays = 3
+	// followUpInterval is how often the Sent folder is read and replies are looked for
+	followUpInterval = 30 * time.Minute
+	// followUpRepliesMailbox is where replies are looked for
+	followUpRepliesMailbox = "INBOX"
+)
+
+// followUps notifies when email sent to a watched address got no reply within
+// some days. It reads the Sent folder now and then, remembers the email to
+// watched addresses in followups.json and, once a reply is due, searches the
+// inbox for a message referring to it.
+type followUps struct {
+	account *liveAccount
+	log     *logging.Logger
+	send    func(title, message string) error
+	changed chan struct{}
+
+	mu  sync.Mutex
+	cfg config.FollowUpConfig
+}
+
+// newFollowUps starts the follow-ups of cfg for account; send shows a notification
+func newFollowUps(account *liveAccount, cfg config.FollowUpConfig, send func(title, message string) error) *followUps {
+	f := &followUps{
+		account: account,
+		log:     logging.For("followup").With("account", account.get().Username),
+		send:    send,
+		changed: make(chan struct{}, 1),
+	}
+	f.update(cfg)
+	go f.run()
+	return f
+}
+
+// update applies changed settings; the next round uses them
+func (f *followUps) update(cfg config.FollowUpConfig) {
+	f.mu.Lock()
+	was := len(f.cfg.Addresses)
+	f.cfg = cfg
+	f.mu.Unlock()
+
+	switch {
+	case len(cfg.Addresses) > 0:
+		f.log.Infof("Watching email sent to %s for replies within %d day(s).", strings.Join(cfg.Addresses, ", "), followUpDays(cfg))
+	case was > 0:
+		f.log.Infof("Follow-ups disabled.")
+	default:
+		return
+	}
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+func followUpDays(cfg config.FollowUpConfig) int {
+	if cfg.Days > 0 {
+		return cfg.Days
+	}
+	return defaultFollowUpDays
+}
+
+// run does a round right away and then every followUpInterval, or when the settings change
+func (f *followUps) run() {
+	ticker := time.NewTicker(followUpInterval)
+	defer ticker.Stop()
+	for {
+		f.round(time.Now())
+		select {
+		case <-ticker.C:
+		case <-f.changed:
+		}
+	}
+}
+
+// round reads the email sent since the last round and notifies of those due
+// without a reply. A failure leaves the state as it was for the next round.
+func (f *followUps) round(now time.Time) {
+	f.mu.Lock()
+	cfg := f.cfg
+	f.mu.Unlock()
+	if len(cfg.Addresses) == 0 {
+		return
+	}
+	days := followUpDays(cfg)
+
+	state, err := storage.LoadFollowUps()
+	if err != nil {
+		f.log.Warnf("Failed to read follow-ups: %v", err)
+		return
+	}
+	// The first round looks back as far as a reply may take
+	since := state.Scanned
+	if since.IsZero() {
+		since = now.AddDate(0, 0, -days)
+	}
+	sent, err := email.SentSince(f.account.get(), cfg.SentMailbox, since)
+	if err != nil {
+		f.log.Warnf("Failed to read the Sent folder: %v", err)
+		return
+	}
+	scanned := since
+	for _, m := range sent {
+		// SINCE goes by day, so email seen in an earlier round comes again
+		if !m.Date.After(state.Scanned) {
+			continue
+		}
+		if m.Date.After(scanned) {
+			scanned = m.Date
+		}
+		to := watchedRecipient(cfg.Addresses, m.Recipients)
+		if to == "" || slices.ContainsFunc(state.Pending, func(p storage.FollowUp) bool { return p.MessageID == m.MessageID }) {
+			continue
+		}
+		state.Pending = append(state.Pending, storage.FollowUp{
+			MessageID: m.MessageID,
+			To:        to,
+			Subject:   m.Subject,
+			Sent:      m.Date,
+			Due:       m.Date.AddDate(0, 0, days),
+		})
+		f.log.Debugf("Waiting for a reply from %s to '%s'", to, m.Subject)
+	}
+	state.Scanned = scanned
+
+	var due, waiting []storage.FollowUp
+	for _, p := range state.Pending {
+		if p.Due.After(now) {
+			waiting = append(waiting, p)
+		} else {
+			due = append(due, p)
+		}
+	}
+	if len(due) > 0 {
+		ids := make([]string, len(due))
+		for i, p := range due {
+			ids[i] = p.MessageID
+		}
+		answered, err := email.Replied(f.account.get(), followUpRepliesMailbox, ids)
+		if err != nil {
+			f.log.Warnf("Failed to look for replies: %v", err)
+			// Keep the email read from the Sent folder meanwhile
+			if err := storage.SaveFollowUps(state); err != nil {
+				f.log.Warnf("Failed to save follow-ups: %v", err)
+			}
+			return
+		}
+		var unanswered []storage.FollowUp
+		for _, p := range due {
+			if !answered[p.MessageID] {
+				unanswered = append(unanswered, p)
+			}
+		}
+		if len(unanswered) > 0 {
+			title, message := followUpNotification(unanswered, now)
+			if err := f.send(title, message); err != nil {
+				f.log.Warnf("Failed to show follow-up notification: %v", err)
+			}
+		}
+		state.Pending = waiting
+	}
+	if err := storage.SaveFollowUps(state); err != nil {
+		f.log.Warnf("Failed to save follow-ups: %v", err)
+	}
+}
+
+// watchedRecipient returns the first of recipients the watched addresses name, or ""
+func watchedRecipient(addresses, recipients []string) string {
+	for _, r := range recipients {
+		for _, a := range addresses {
+			a = strings.ToLower(a)
+			if r == a || (strings.HasPrefix(a, "@") && strings.HasSuffix(r, a)) {
+				return r
+			}
+		}
+	}
+	return ""
+}
+
+// followUpNotification phrases the email without a reply, e.g. "No reply from
+// bob@example.com" and "'Contract' was sent 3 days ago"
+func followUpNotification(unanswered []storage.FollowUp, now time.Time) (title, message string) {
+	first := unanswered[0]
+	subject := first.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	ago := int(now.Sub(first.Sent).Hours() / 24)
+	if len(unanswered) == 1 {
+		return "No reply from " + first.To, fmt.Sprintf("'%s' was sent %d day(s) ago", subject, ago)
+	}
+	return fmt.Sprintf("No reply to %d emails", len(unanswered)), fmt.Sprintf("Including '%s' to %s, sent %d day(s) ago", subject, first.To, ago)
+}
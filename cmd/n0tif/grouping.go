@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// notificationGroup coalesces new email into one notification. The first
+// email opens a window; at its end the server is checked once more, so email
+// that arrived in the meantime joins, and the group is notified of together.
+type notificationGroup struct {
+	recheck func()                                     // checks right away, adding what it finds
+	send    func(emails []storage.MessageRecord) error // shows the notification of a group
+
+	mu      sync.Mutex
+	window  time.Duration           // 0 while grouping is off
+	open    bool                    // a window is running
+	pending []storage.MessageRecord // the open group, newest first
+}
+
+// newNotificationGroup creates the grouping. recheck is called at the end of a
+// window; send is given the emails of a group, newest first.
+func newNotificationGroup(cfg config.NotificationsConfig, recheck func(), send func(emails []storage.MessageRecord) error) *notificationGroup {
+	g := &notificationGroup{recheck: recheck, send: send}
+	g.update(cfg)
+	return g
+}
+
+// update applies a changed grouping window. A window already open runs out as it was.
+func (g *notificationGroup) update(cfg config.NotificationsConfig) {
+	window := time.Duration(cfg.GroupSeconds) * time.Second
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if window == g.window {
+		return
+	}
+	g.window = window
+	if window > 0 {
+		logging.Infof("Grouping notifications of email arriving within %v.", window)
+	} else {
+		logging.Infof("Notification grouping disabled.")
+	}
+}
+
+// add notifies of emails (newest first), right away while grouping is off.
+// Otherwise they join the open group, or open one, and the error of showing
+// the notification is logged when the window ends rather than returned.
+func (g *notificationGroup) add(emails []storage.MessageRecord) error {
+	g.mu.Lock()
+	if g.window <= 0 && !g.open {
+		g.mu.Unlock()
+		return g.send(emails)
+	}
+	// Newer emails go first to keep the newest-first order
+	g.pending = append(append([]storage.MessageRecord{}, emails...), g.pending...)
+	if g.open {
+		logging.Debugf("Grouping: %d email(s) waiting for the window to end.", len(g.pending))
+		g.mu.Unlock()
+		return nil
+	}
+	g.open = true
+	window := g.window
+	g.mu.Unlock()
+
+	logging.Debugf("Grouping: Holding the notification for %v.", window)
+	time.AfterFunc(window, g.flush)
+	return nil
+}
+
+// flush ends the window: it checks once more and notifies of the group
+func (g *notificationGroup) flush() {
+	g.recheck()
+
+	g.mu.Lock()
+	emails := g.pending
+	g.pending = nil
+	g.open = false
+	g.mu.Unlock()
+
+	if len(emails) == 0 {
+		return
+	}
+	if err := g.send(emails); err != nil {
+		logging.Warnf("Grouping: Failed to notify of %d email(s): %v", len(emails), err)
+	}
+}
+
+// groupedNotification is the title and message of a notification of subjects, newest first
+func groupedNotification(subjects []string) (title, message string) {
+	if len(subjects) == 1 {
+		return "New Email", fmt.Sprintf("You have a new email: %s", subjects[0])
+	}
+	return "New Emails", fmt.Sprintf("You have %d new emails. Most recent: %s", len(subjects), subjects[0])
+}
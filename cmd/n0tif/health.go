@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// minHealthAge is the shortest time without a successful check that counts as
+// unhealthy, so short intervals don't turn a single slow check into an alert
+const minHealthAge = 5 * time.Minute
+
+// healthReport is the answer of "n0tif health" and the /healthz endpoint
+type healthReport struct {
+	Healthy  bool            `json:"healthy"`
+	Accounts []accountHealth `json:"accounts"`
+}
+
+// accountHealth tells whether an account is being checked successfully
+type accountHealth struct {
+	Account     string    `json:"account"`
+	Healthy     bool      `json:"healthy"`
+	LastSuccess time.Time `json:"last_success"`
+	Problem     string    `json:"problem,omitempty"`
+}
+
+// healthAge is how long an account may go without a successful check: three
+// intervals, but at least minHealthAge
+func healthAge(a accountStatus) time.Duration {
+	age := 3 * time.Duration(a.CheckInterval) * time.Second
+	if age < minHealthAge {
+		age = minHealthAge
+	}
+	return age
+}
+
+// evaluateHealth judges the status of a running monitor. An account is healthy when
+// a check succeeded within maxAge (healthAge when zero) or checking is paused on
+// purpose; until the first success the monitor's uptime counts instead.
+func evaluateHealth(r statusReport, maxAge time.Duration, now time.Time) healthReport {
+	report := healthReport{Healthy: true, Accounts: []accountHealth{}}
+	for _, a := range r.Accounts {
+		h := accountHealth{Account: a.Username, Healthy: true, LastSuccess: a.LastSuccess}
+		if a.Name != "" {
+			h.Account = a.Name
+		}
+		limit := maxAge
+		if limit == 0 {
+			limit = healthAge(a)
+		}
+		since := a.LastSuccess
+		if since.IsZero() {
+			since = r.StartedAt
+		}
+
+		if !a.Paused && now.Sub(since) > limit {
+			h.Healthy = false
+			switch {
+			case a.Offline != "":
+				h.Problem = "waiting for the network: " + a.Offline
+			case a.ThrottledUntil.After(now):
+				h.Problem = "throttled by provider: " + a.LastError
+			case a.LastError != "":
+				h.Problem = a.LastError
+			default:
+				h.Problem = "no check has finished"
+			}
+			if a.LastSuccess.IsZero() {
+				h.Problem = fmt.Sprintf("no successful check since the start %s ago: %s", formatDuration(now.Sub(since)), h.Problem)
+			} else {
+				h.Problem = fmt.Sprintf("no successful check for %s: %s", formatDuration(now.Sub(since)), h.Problem)
+			}
+			report.Healthy = false
+		}
+		report.Accounts = append(report.Accounts, h)
+	}
+	return report
+}
+
+// runHealthCommand handles "n0tif health [-max-age 15m]". It exits with status 0 when
+// every account is checked successfully, 1 when one isn't and 3 when n0tif isn't running.
+func runHealthCommand(args []string) {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	maxAge := fs.Duration("max-age", 0, "How long an account may go without a successful check (default: three check intervals, at least 5m)")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif health [-max-age 15m]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	reply, err := control.Call(appFolder, "status", controlTimeout)
+	if errors.Is(err, control.ErrNotRunning) {
+		if *jsonOutput {
+			printJSON(healthReport{Accounts: []accountHealth{}})
+		} else {
+			fmt.Println("UNHEALTHY: n0tif is not running for this profile.")
+		}
+		os.Exit(3)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var status statusReport
+	if err := json.Unmarshal([]byte(reply), &status); err != nil {
+		fmt.Printf("Error: unexpected status reply: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	report := evaluateHealth(status, *maxAge, now)
+	if *jsonOutput {
+		printJSON(report)
+	} else {
+		for _, a := range report.Accounts {
+			last := "never"
+			if !a.LastSuccess.IsZero() {
+				last = a.LastSuccess.Local().Format("2006-01-02 15:04:05")
+			}
+			if a.Healthy {
+				fmt.Printf("OK        %s (last successful check %s)\n", a.Account, last)
+			} else {
+				fmt.Printf("UNHEALTHY %s: %s\n", a.Account, a.Problem)
+			}
+		}
+	}
+	if !report.Healthy {
+		os.Exit(1)
+	}
+}
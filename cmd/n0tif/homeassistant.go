@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/mqtt"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+const (
+	// defaultDiscoveryPrefix is where Home Assistant looks for MQTT devices unless told otherwise
+	defaultDiscoveryPrefix = "homeassistant"
+	// unreadRefresh is how often the unread count is fetched, to notice mail read elsewhere
+	unreadRefresh = 5 * time.Minute
+	// How long the connection to the broker waits before it is tried again, doubling up to the maximum
+	mqttRetryMin = 5 * time.Second
+	mqttRetryMax = 5 * time.Minute
+)
+
+// Entity states, by the topic under the device's they are published to
+const (
+	haUnread      = "unread"
+	haLastSender  = "last_sender"
+	haLastSubject = "last_subject"
+	haEvent       = "event"
+	haStatus      = "status"
+)
+
+// homeAssistant registers the account as a Home Assistant device through MQTT
+// discovery and keeps its sensors current. States are retained, so Home Assistant
+// has them after its own restarts, and published again after reconnecting.
+type homeAssistant struct {
+	cfg     config.HomeAssistantConfig
+	account config.EmailConfig
+	node    string // identifies the device in topics and to Home Assistant
+	log     *logging.Logger
+	refresh chan struct{} // asks for the unread count to be fetched now
+
+	mu     sync.Mutex
+	client *mqtt.Client      // nil while disconnected
+	states map[string]string // the latest state of each sensor
+}
+
+// haDevice is how the device is described to Home Assistant
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+// haEntity is the discovery configuration of one entity
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Icon              string   `json:"icon,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Unit              string   `json:"unit_of_measurement,omitempty"`
+	EventTypes        []string `json:"event_types,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// haEmailEvent is the payload of the event entity for a new email
+type haEmailEvent struct {
+	EventType string `json:"event_type"`
+	Sender    string `json:"sender"`
+	From      string `json:"from"`
+	Subject   string `json:"subject"`
+	Mailbox   string `json:"mailbox"`
+}
+
+// startHomeAssistant publishes the account to the Home Assistant broker of cfg,
+// if it has one, and keeps it current from the new email published on bus. It
+// returns a function that stops it, marking the device unavailable.
+func startHomeAssistant(cfg config.Config, bus *events.Bus) (stop func()) {
+	if cfg.HomeAssistant.Broker == "" {
+		return func() {}
+	}
+	h := &homeAssistant{
+		cfg:     cfg.HomeAssistant,
+		account: cfg.Email,
+		node:    haNodeID(storage.Profile(), cfg.Email.Username),
+		log:     logging.For("homeassistant"),
+		refresh: make(chan struct{}, 1),
+		states:  make(map[string]string),
+	}
+	if h.cfg.DiscoveryPrefix == "" {
+		h.cfg.DiscoveryPrefix = defaultDiscoveryPrefix
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unsubscribe := bus.Subscribe("homeassistant", events.EmailReceived, func(_ context.Context, e events.Event) {
+		h.received(e.Emails)
+	})
+	go h.connect(ctx)
+	go h.countUnread(ctx)
+
+	return func() {
+		unsubscribe()
+		cancel()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.client != nil {
+			h.client.Publish(mqtt.Message{Topic: h.topic(haStatus), Payload: []byte("offline"), Retain: true})
+			h.client.Close()
+		}
+	}
+}
+
+// haNodeID makes an ID of the profile and account out of the characters topics and IDs allow
+func haNodeID(profile, username string) string {
+	var b strings.Builder
+	b.WriteString("n0tif_")
+	for _, r := range strings.ToLower(profile + "_" + username) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// topic is the topic of one of the device's states
+func (h *homeAssistant) topic(name string) string {
+	return "n0tif/" + h.node + "/" + name
+}
+
+// received updates the sensors and fires an event per email of emails, newest first
+func (h *homeAssistant) received(emails []storage.MessageRecord) {
+	if len(emails) == 0 {
+		return
+	}
+	h.setState(haLastSender, storage.SenderName(emails[0].From))
+	// An empty retained message would delete the state instead
+	subject := emails[0].Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	h.setState(haLastSubject, subject)
+	for i := len(emails) - 1; i >= 0; i-- {
+		m := emails[i]
+		payload, _ := json.Marshal(haEmailEvent{
+			EventType: "new_email",
+			Sender:    storage.SenderName(m.From),
+			From:      m.From,
+			Subject:   m.Subject,
+			Mailbox:   m.Mailbox,
+		})
+		h.publish(mqtt.Message{Topic: h.topic(haEvent), Payload: payload})
+	}
+	select {
+	case h.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// setState records the state of a sensor and publishes it when connected
+func (h *homeAssistant) setState(name, value string) {
+	h.mu.Lock()
+	h.states[name] = value
+	h.mu.Unlock()
+	h.publish(mqtt.Message{Topic: h.topic(name), Payload: []byte(value), Retain: true})
+}
+
+// publish sends m when connected; while disconnected only the states are kept
+func (h *homeAssistant) publish(m mqtt.Message) {
+	h.mu.Lock()
+	client := h.client
+	h.mu.Unlock()
+	if client == nil {
+		return
+	}
+	if err := client.Publish(m); err != nil {
+		h.log.Debugf("Failed to publish %s: %v", m.Topic, err)
+	}
+}
+
+// countUnread fetches the unread count of INBOX when new email arrives and every
+// unreadRefresh, which also catches email read elsewhere
+func (h *homeAssistant) countUnread(ctx context.Context) {
+	ticker := time.NewTicker(unreadRefresh)
+	defer ticker.Stop()
+	for {
+		if n, err := email.UnreadCount(h.account, "INBOX"); err != nil {
+			h.log.Debugf("Failed to count unread email: %v", err)
+		} else {
+			h.setState(haUnread, fmt.Sprint(n))
+		}
+		select {
+		case <-ticker.C:
+		case <-h.refresh:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connect keeps a connection to the broker until ctx is done, announcing the
+// device and its states each time it connects
+func (h *homeAssistant) connect(ctx context.Context) {
+	wait := mqttRetryMin
+	for {
+		client, err := mqtt.Connect(ctx, mqtt.Options{
+			Broker:   h.cfg.Broker,
+			ClientID: h.node,
+			Will:     &mqtt.Message{Topic: h.topic(haStatus), Payload: []byte("offline"), Retain: true},
+		})
+		if err == nil {
+			h.log.Infof("Connected to the Home Assistant broker as %s.", h.node)
+			wait = mqttRetryMin
+			h.announce(client)
+			select {
+			case <-client.Done():
+				h.mu.Lock()
+				h.client = nil
+				h.mu.Unlock()
+				err = client.Err()
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		h.log.Warnf("Home Assistant broker unavailable: %v. Trying again in %v.", err, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if wait *= 2; wait > mqttRetryMax {
+			wait = mqttRetryMax
+		}
+	}
+}
+
+// announce publishes the discovery configuration, the availability and the
+// known states through client, and makes it the connection states go to
+func (h *homeAssistant) announce(client *mqtt.Client) {
+	label := h.account.Name
+	if label == "" {
+		label = h.account.Username
+	}
+	device := haDevice{
+		Identifiers:  []string{h.node},
+		Name:         "n0tif " + label,
+		Manufacturer: "n0tif",
+		Model:        "Email notifier",
+		SWVersion:    currentBuildInfo().Version,
+	}
+	entities := []struct {
+		component, name string
+		entity          haEntity
+	}{
+		{"sensor", haUnread, haEntity{Name: "Unread email", Icon: "mdi:email", StateClass: "measurement", Unit: "emails"}},
+		{"sensor", haLastSender, haEntity{Name: "Last sender", Icon: "mdi:account"}},
+		{"sensor", haLastSubject, haEntity{Name: "Last subject", Icon: "mdi:email-open"}},
+		{"event", haEvent, haEntity{Name: "New email", Icon: "mdi:email-alert", EventTypes: []string{"new_email"}}},
+	}
+	for _, e := range entities {
+		e.entity.UniqueID = h.node + "_" + e.name
+		e.entity.StateTopic = h.topic(e.name)
+		e.entity.AvailabilityTopic = h.topic(haStatus)
+		e.entity.Device = device
+		payload, _ := json.Marshal(e.entity)
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", h.cfg.DiscoveryPrefix, e.component, h.node, e.name)
+		if err := client.Publish(mqtt.Message{Topic: topic, Payload: payload, Retain: true}); err != nil {
+			return // Done reports the lost connection
+		}
+	}
+	client.Publish(mqtt.Message{Topic: h.topic(haStatus), Payload: []byte("online"), Retain: true})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.client = client
+	for name, value := range h.states {
+		client.Publish(mqtt.Message{Topic: h.topic(name), Payload: []byte(value), Retain: true})
+	}
+}
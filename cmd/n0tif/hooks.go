@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+const (
+	defaultHookTimeout     = 30 * time.Second
+	defaultHookConcurrency = 4
+	// hookQueueLimit bounds how many hook commands may be waiting or running;
+	// those of new email beyond it are dropped
+	hookQueueLimit = 100
+	// hookOutputLimit caps how much of a hook's output is kept for the log
+	hookOutputLimit = 4096
+	// hookWaitDelay is how long a killed hook's output pipes may stay open, e.g.
+	// held by a process it started, before they are closed
+	hookWaitDelay = 5 * time.Second
+)
+
+// hookPayload is what a hook command reads from its standard input
+type hookPayload struct {
+	Event   string                  `json:"event"` // "email" or "digest"
+	Account string                  `json:"account"`
+	Emails  []storage.MessageRecord `json:"emails"` // newest first
+}
+
+// hookRunner runs the hook commands of the settings file on new email
+type hookRunner struct {
+	account string
+	log     *logging.Logger
+
+	queue chan struct{} // holds a token for each command waiting or running, bounding the goroutines
+
+	mu    sync.Mutex
+	hooks []config.HookConfig
+	slots chan struct{} // holds a token for each command running, bounding how many run at once
+}
+
+// newHookRunner prepares the hooks of cfg for the emails of account and runs
+// them on the new email published on bus
+func newHookRunner(cfg config.HooksConfig, account string, bus *events.Bus) *hookRunner {
+	r := &hookRunner{
+		account: account,
+		log:     logging.For("hooks").With("account", account),
+		queue:   make(chan struct{}, hookQueueLimit),
+	}
+	r.update(cfg)
+	bus.Subscribe("hooks", events.EmailReceived, func(_ context.Context, e events.Event) {
+		r.newEmails(e.Emails)
+	})
+	return r
+}
+
+// update applies changed hook settings. Commands already running keep going.
+func (r *hookRunner) update(cfg config.HooksConfig) {
+	concurrency := cfg.MaxConcurrent
+	if concurrency == 0 {
+		concurrency = defaultHookConcurrency
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.slots == nil || cap(r.slots) != concurrency {
+		r.slots = make(chan struct{}, concurrency)
+	}
+	if len(cfg.OnEmail) != len(r.hooks) {
+		r.log.Infof("%d hook(s) configured.", len(cfg.OnEmail))
+	}
+	r.hooks = cfg.OnEmail
+}
+
+// newEmails starts the hooks for emails, without waiting for them to finish.
+// Once hookQueueLimit commands are waiting or running, the rest are dropped.
+func (r *hookRunner) newEmails(emails []storage.MessageRecord) {
+	r.mu.Lock()
+	hooks, slots := r.hooks, r.slots
+	r.mu.Unlock()
+
+	dropped := 0
+	start := func(h config.HookConfig, event string, emails []storage.MessageRecord) {
+		select {
+		case r.queue <- struct{}{}:
+			go r.run(h, slots, event, emails)
+		default:
+			dropped++
+		}
+	}
+	for _, h := range hooks {
+		if h.Mode == config.HookDigest {
+			start(h, "digest", emails)
+			continue
+		}
+		for _, e := range emails {
+			start(h, "email", []storage.MessageRecord{e})
+		}
+	}
+	if dropped > 0 {
+		r.log.Warnf("Dropped %d hook run(s): %d are already waiting or running. Hooks in digest mode run once per check.", dropped, hookQueueLimit)
+	}
+}
+
+// run waits for a free slot, then runs the hook command h for emails and
+// records the outcome in the log and the audit log
+func (r *hookRunner) run(h config.HookConfig, slots chan struct{}, event string, emails []storage.MessageRecord) {
+	defer func() { <-r.queue }()
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	target := fmt.Sprintf("%s %s/%d", filepath.Base(h.Command[0]), emails[0].Mailbox, emails[0].UID)
+	if event == "digest" {
+		target = fmt.Sprintf("%s (%d emails)", filepath.Base(h.Command[0]), len(emails))
+	}
+
+	output, err := r.exec(h, event, emails)
+	rec := storage.AuditRecord{
+		Time:    time.Now(),
+		Action:  "hook",
+		Trigger: "new-email",
+		Target:  target,
+		Result:  storage.AuditOK,
+	}
+	if err != nil {
+		rec.Result = storage.AuditFailed
+		rec.Error = err.Error()
+		r.log.Warnf("Hook %s failed: %v; output: %q", target, err, output)
+	} else {
+		r.log.Debugf("Hook %s finished; output: %q", target, output)
+	}
+	if err := storage.AppendAudit(rec); err != nil {
+		r.log.Warnf("Failed to write audit log: %v", err)
+	}
+}
+
+// exec runs the command with the emails as JSON on stdin and the newest one in
+// the environment, returning its combined output
+func (r *hookRunner) exec(h config.HookConfig, event string, emails []storage.MessageRecord) (string, error) {
+	timeout := defaultHookTimeout
+	if h.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	payload, err := json.Marshal(hookPayload{Event: event, Account: r.account, Emails: emails})
+	if err != nil {
+		return "", err
+	}
+	newest := emails[0]
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"N0TIF_EVENT="+event,
+		"N0TIF_ACCOUNT="+r.account,
+		"N0TIF_COUNT="+strconv.Itoa(len(emails)),
+		"N0TIF_MAILBOX="+newest.Mailbox,
+		"N0TIF_UID="+strconv.FormatUint(uint64(newest.UID), 10),
+		"N0TIF_FROM="+newest.From,
+		"N0TIF_SUBJECT="+newest.Subject,
+		"N0TIF_DATE="+newest.Date.Format(time.RFC3339),
+	)
+	var output limitedBuffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = hookWaitDelay
+	hideWindow(cmd)
+
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("killed after %v", timeout)
+	}
+	return output.String(), err
+}
+
+// limitedBuffer keeps the first hookOutputLimit bytes written to it and drops the rest
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := hookOutputLimit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
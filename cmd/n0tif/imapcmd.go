@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/notify"
+)
+
+// runTestCommand handles "n0tif test": it checks that the configured account can
+// log in and that notifications show up, without touching the tracking state
+func runTestCommand(args []string) {
+	cfg := loadAppConfig()
+
+	fmt.Printf("Logging in to %s:%d as %s... ", cfg.Email.ImapServer, cfg.Email.ImapPort, cfg.Email.Username)
+	c, err := email.Dial(cfg.Email)
+	if err != nil {
+		fmt.Println("FAILED")
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	c.Logout()
+	fmt.Println("OK")
+
+	fmt.Print("Showing a test notification... ")
+	title := "N0tif Test"
+	if cfg.Email.Name != "" {
+		title = fmt.Sprintf("%s (%s)", title, cfg.Email.Name)
+	}
+	id := resolveNotificationIdentity(cfg.Email)
+	if err := notify.SendWindowsNotification(id, title, "Notifications are working.", false); err != nil {
+		fmt.Println("FAILED")
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+// runFoldersCommand handles "n0tif folders [-json]"
+func runFoldersCommand(args []string) {
+	fs := flag.NewFlagSet("folders", flag.ExitOnError)
+	fs.BoolVar(jsonOutput, "json", *jsonOutput, "Print the folders as JSON (same as the global -json)")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] folders [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg := loadAppConfig()
+
+	folders, err := email.ListFolders(cfg.Email)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		printJSON(folders)
+		return
+	}
+	for _, f := range folders {
+		if f.Selectable {
+			fmt.Println(f.Name)
+		} else {
+			fmt.Printf("%s (container)\n", f.Name)
+		}
+	}
+}
+
+// runTestConnectionCommand handles "n0tif test-connection": it walks through every
+// step of reaching the mailbox and shows which one fails
+func runTestConnectionCommand(args []string) {
+	cfg := loadAppConfig()
+
+	fmt.Printf("Testing %s:%d\n", cfg.Email.ImapServer, cfg.Email.ImapPort)
+	err := email.Diagnose(cfg.Email, func(r email.StepResult) {
+		if r.Err != nil {
+			fmt.Printf("[FAIL] %s: %v\n", r.Step, r.Err)
+			return
+		}
+		fmt.Printf("[ OK ] %s\n", r.Step)
+		for _, d := range r.Details {
+			fmt.Printf("       %s\n", d)
+		}
+	})
+	if errors.Is(err, email.ErrAppPasswordRequired) {
+		fmt.Println("The provider wants an app password; run 'n0tif app-password' to get one.")
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	fmt.Println("All checks passed.")
+}
+
+// runRecentCommand handles "n0tif recent [-n 20] [-mailbox INBOX] [-json]": it lists
+// the latest messages on the server, whether or not n0tif has seen them
+func runRecentCommand(args []string) {
+	fs := flag.NewFlagSet("recent", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Number of messages to show")
+	mailbox := fs.String("mailbox", "INBOX", "Mailbox to list")
+	asJSON := fs.Bool("json", false, "Print the messages as JSON (same as the global -json)")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] recent [-n 20] [-mailbox INBOX] [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg := loadAppConfig()
+	messages, err := email.RecentMessages(cfg.Email, *mailbox, *limit)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *asJSON || *jsonOutput {
+		if messages == nil {
+			messages = []email.Message{}
+		}
+		printJSON(messages)
+		return
+	}
+
+	if len(messages) == 0 {
+		fmt.Printf("No messages in %s.\n", *mailbox)
+		return
+	}
+	fmt.Printf("%-8s %-16s %-25s %s\n", "UID", "Date", "From", "Subject")
+	for _, m := range messages {
+		unread := " "
+		if !m.Seen {
+			unread = "*"
+		}
+		fmt.Printf("%-8d %-16s %-25s %s%s\n", m.UID, m.Date.Local().Format("2006-01-02 15:04"), truncate(m.From, 25), unread, truncate(m.Subject, 60))
+	}
+	fmt.Printf("\n%d message(s) in %s, newest first; * marks unread.\n", len(messages), *mailbox)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// importanceFilter leaves out the email the provider didn't mark as important,
+// so the provider's own sorting, e.g. Gmail's Priority Inbox, decides what is
+// notified of without rules of n0tif's
+type importanceFilter struct {
+	account *liveAccount
+	log     *logging.Logger
+
+	mu          sync.Mutex
+	enabled     bool
+	unsupported bool // the server was found to have no importance labels
+}
+
+// newImportanceFilter creates the filter for account; it is off unless cfg.ImportantOnly is set
+func newImportanceFilter(account *liveAccount, cfg config.NotificationsConfig) *importanceFilter {
+	f := &importanceFilter{account: account, log: logging.For("notify").With("account", account.get().Username)}
+	f.update(cfg)
+	return f
+}
+
+// update applies a changed setting
+func (f *importanceFilter) update(cfg config.NotificationsConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled = cfg.ImportantOnly
+}
+
+// important returns the emails marked as important, in the same order. If the
+// server can't be asked or has no importance labels, all of them are returned.
+func (f *importanceFilter) important(emails []storage.MessageRecord) []storage.MessageRecord {
+	f.mu.Lock()
+	enabled := f.enabled && !f.unsupported
+	f.mu.Unlock()
+	if !enabled || len(emails) == 0 {
+		return emails
+	}
+
+	uids := make(map[string][]uint32)
+	for _, e := range emails {
+		uids[e.Mailbox] = append(uids[e.Mailbox], e.UID)
+	}
+	important := make(map[string]map[uint32]bool, len(uids))
+	for mailbox, list := range uids {
+		found, err := email.Important(f.account.get(), mailbox, list)
+		if errors.Is(err, email.ErrImportanceUnsupported) {
+			f.log.Warnf("%s doesn't mark email as important; notifying of all new email.", f.account.get().ImapServer)
+			f.mu.Lock()
+			f.unsupported = true
+			f.mu.Unlock()
+			return emails
+		}
+		if err != nil {
+			f.log.Warnf("Could not ask which of %d email(s) are important, notifying of them: %v", len(list), err)
+			return emails
+		}
+		important[mailbox] = found
+	}
+
+	var kept []storage.MessageRecord
+	for _, e := range emails {
+		if important[e.Mailbox][e.UID] {
+			kept = append(kept, e)
+		}
+	}
+	if skipped := len(emails) - len(kept); skipped > 0 {
+		f.log.Infof("Skipping %d email(s) not marked as important.", skipped)
+	}
+	return kept
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// logFile is the rotating log of background and service mode; nil when logging to the console
+var logFile *logging.RotatingFile
+
+// setupLogFile sends the log, and the standard logger, to the rotating log file of the active profile
+func setupLogFile() error {
+	path, err := storage.GetLogPath()
+	if err != nil {
+		return err
+	}
+	f, err := logging.OpenRotating(path, logRotation(startupLogConfig()))
+	if err != nil {
+		return err
+	}
+	if err := logging.SetOutput(f, logFormat()); err != nil {
+		f.Close()
+		return err
+	}
+	logFile = f
+	log.SetOutput(f)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	return nil
+}
+
+// logFormat returns the log format from -log-format or, without it, the settings file
+func logFormat() string {
+	if flagWasSet("log-format") {
+		return *logFormatFlag
+	}
+	if format := startupLogConfig().Format; format != "" {
+		return format
+	}
+	return logging.FormatText
+}
+
+// applyLogFormat switches the running log to format, e.g. after a settings reload
+func applyLogFormat(format string) {
+	if format == "" {
+		format = logging.FormatText
+	}
+	var out io.Writer = os.Stderr
+	if logFile != nil {
+		out = logFile
+	}
+	if err := logging.SetOutput(out, format); err != nil {
+		logging.Warnf("Keeping the current log format: %v", err)
+		return
+	}
+	logging.Infof("Log format changed to %s.", format)
+}
+
+// startupLogConfig reads the log settings from the settings file. Logging starts
+// before the rest of the configuration is loaded; reloads update it later.
+func startupLogConfig() config.LogConfig {
+	cfg := config.GetDefaultConfig()
+	if path, err := storage.GetConfigPath(); err == nil {
+		if settings, err := config.LoadSettings(path); err == nil {
+			settings.Apply(&cfg)
+		}
+	}
+	return cfg.Log
+}
+
+// logRotation converts the log settings for the rotating log file
+func logRotation(c config.LogConfig) logging.Rotation {
+	return logging.Rotation{
+		MaxSize: int64(c.MaxSizeMB) << 20,
+		MaxAge:  time.Duration(c.MaxAgeDays) * 24 * time.Hour,
+		Keep:    c.Keep,
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+// logLevelSwitch changes the verbosity of the running monitor, optionally
+// switching back to the level it replaced after a while
+type logLevelSwitch struct {
+	mu          sync.Mutex
+	revert      *time.Timer   // pending switch back, nil if the level is permanent
+	revertLevel logging.Level // what revert switches back to
+}
+
+// set applies level; a non-zero d restores the previous level after d
+func (s *logLevelSwitch) set(level logging.Level, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := logging.CurrentLevel()
+	if s.revert != nil {
+		// A pending revert keeps pointing at the level from before the first temporary change
+		if s.revert.Stop() && d > 0 {
+			previous = s.revertLevel
+		}
+		s.revert = nil
+	}
+	logging.SetLevel(level)
+	logging.Infof("Log level set to %s.", level)
+	if d == 0 {
+		return
+	}
+
+	s.revertLevel = previous
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// A later change already replaced this revert
+		if s.revert != timer {
+			return
+		}
+		s.revert = nil
+		logging.SetLevel(previous)
+		logging.Infof("Log level restored to %s after %s.", previous, d)
+	})
+	s.revert = timer
+}
+
+// parseLogLevelArg parses the "<level> [duration]" argument of the loglevel control command
+func parseLogLevelArg(arg string) (logging.Level, time.Duration, error) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, 0, fmt.Errorf("invalid log level request %q", arg)
+	}
+	level, err := logging.ParseLevel(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	var d time.Duration
+	if len(fields) == 2 {
+		if d, err = time.ParseDuration(fields[1]); err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid duration %q", fields[1])
+		}
+	}
+	return level, d, nil
+}
+
+// runLogLevelCommand handles "n0tif loglevel [debug|info|warn|error] [duration]"
+func runLogLevelCommand(args []string) {
+	if len(args) > 2 {
+		fmt.Println("Usage: n0tif [-profile name] loglevel [debug|info|warn|error] [duration, e.g. 30m]")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		fmt.Printf("Log level: %s\n", sendControlCommand("loglevel", ""))
+		return
+	}
+
+	arg := strings.Join(args, " ")
+	level, d, err := parseLogLevelArg(arg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	sendControlCommand("loglevel", arg)
+	if d == 0 {
+		fmt.Printf("Log level set to %s until n0tif restarts.\n", level)
+	} else {
+		fmt.Printf("Log level set to %s for %s.\n", level, d)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// logPollInterval is how often "logs -f" looks for new output
+const logPollInterval = 500 * time.Millisecond
+
+// runLogsCommand handles "n0tif logs [-f] [-n 100]"
+func runLogsCommand(args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	lines := fs.Int("n", 100, "Number of lines to show from the end of the log")
+	follow := fs.Bool("f", false, "Keep printing new lines as they are written")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] logs [-f] [-n 100]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	logPath, err := storage.GetLogPath()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	f, err := os.Open(logPath)
+	if os.IsNotExist(err) && !*follow {
+		fmt.Printf("No log file yet at %s. Logs are written when n0tif runs in the background or as a service.\n", logPath)
+		return
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var offset int64
+	if f != nil {
+		offset, err = printLastLines(f, *lines)
+		f.Close()
+		if err != nil {
+			fmt.Printf("Error: failed to read %s: %v\n", logPath, err)
+			os.Exit(1)
+		}
+	}
+	if !*follow {
+		return
+	}
+
+	if err := followLog(logPath, offset); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printLastLines writes the last n lines of f to stdout and returns the offset
+// where reading stopped, so following can pick up from there
+func printLastLines(f *os.File, n int) (int64, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	// Read backwards in chunks until enough line breaks have been seen
+	const chunkSize = 64 * 1024
+	var buf []byte
+	pos := size
+	for pos > 0 && bytes.Count(buf, []byte("\n")) <= n {
+		read := int64(chunkSize)
+		if pos < read {
+			read = pos
+		}
+		pos -= read
+		chunk := make([]byte, read)
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return 0, err
+		}
+		buf = append(chunk, buf...)
+	}
+
+	// Drop a trailing newline so it doesn't count as an empty last line
+	buf = bytes.TrimSuffix(buf, []byte("\n"))
+	if n <= 0 || len(buf) == 0 {
+		return size, nil
+	}
+	start := len(buf)
+	for found := 0; found < n; found++ {
+		i := bytes.LastIndexByte(buf[:start], '\n')
+		if i < 0 {
+			start = 0
+			break
+		}
+		start = i
+	}
+	if buf[start] == '\n' {
+		start++
+	}
+	os.Stdout.Write(buf[start:])
+	fmt.Println()
+	return size, nil
+}
+
+// followLog prints lines appended to the log from offset on until interrupted.
+// The log may not exist yet, or be replaced by a restore; both are picked up.
+func followLog(path string, offset int64) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			offset = 0
+		case err != nil:
+			return err
+		case info.Size() < offset:
+			// Truncated or replaced; start over from the beginning
+			offset = 0
+			fallthrough
+		case info.Size() > offset:
+			if offset, err = copyFrom(path, offset); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-sigChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// copyFrom writes the content of path from offset on to stdout and returns the new offset
+func copyFrom(path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(os.Stdout, f)
+	return offset + n, err
+}
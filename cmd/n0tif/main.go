@@ -1,158 +1,278 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"golang.org/x/sys/windows" // Added for isAdmin check
-
 	"github.com/byigitt/n0tif/config"
 	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/network"
 	"github.com/byigitt/n0tif/internal/notify"
 	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/byigitt/n0tif/internal/tracing"
+)
+
+// How long, and how often, a service or background start probes for the network before the first check
+const (
+	startupNetworkTimeout = 2 * time.Minute
+	startupNetworkPoll    = 5 * time.Second
 )
 
 // Global flags for application configuration
 var (
-	imapServer  = flag.String("server", "", "IMAP server address")
-	imapPort    = flag.Int("port", 993, "IMAP server port")
-	username    = flag.String("user", "", "Email username/address")
-	password    = flag.String("pass", "", "Email password")
-	interval    = flag.Int("interval", 60, "Check interval in seconds")
-	save        = flag.Bool("save", false, "Save credentials for future use")
-	background  = flag.Bool("background", false, "Run in background (can be closed via Task Manager)")
-	serviceMode = flag.Bool("service", false, "Install and run as Windows service (auto-starts with Windows)")
-	isDaemon    = flag.Bool("daemon", false, "Internal use: Indicates process is a daemon child")
-	resetState  = flag.Bool("resetstate", false, "Reset email state for debugging")
+	imapServer    = flag.String("server", "", "IMAP server address")
+	imapPort      = flag.Int("port", 993, "IMAP server port")
+	username      = flag.String("user", "", "Email username/address")
+	password      = flag.String("pass", "", "Email password")
+	interval      = flag.Int("interval", 60, "Check interval in seconds")
+	save          = flag.Bool("save", false, "Save credentials for future use")
+	background    = flag.Bool("background", false, "Run in background (stop it with 'n0tif stop')")
+	serviceMode   = flag.Bool("service", false, "Install and run as a service (Windows service or systemd user service; starts automatically)")
+	isDaemon      = flag.Bool("daemon", false, "Internal use: Indicates process is a daemon child")
+	passStdin     = flag.Bool("pass-stdin", false, "Internal use: read the email password from standard input")
+	resetState    = flag.Bool("resetstate", false, "Reset email state for debugging")
+	accountName   = flag.String("name", "", "Account display name shown in notifications (e.g. Work)")
+	appID         = flag.String("appid", "", "Notification source name for this account")
+	iconPath      = flag.String("icon", "", "Path to an icon image for this account's notifications")
+	iconColor     = flag.String("color", "", "Hex color (e.g. #0078D4) for a generated notification icon")
+	pinSHA256     = flag.String("pin-sha256", "", "Trust only a server certificate with this base64 SHA-256 public key hash, e.g. a self-signed one")
+	calendarURL   = flag.String("calendar", "", "Published ICS calendar URL; notifications are held while busy")
+	dndMode       = flag.String("dnd", config.DNDModeBatch, "Do-not-disturb mode while busy: batch (digest afterwards) or suppress")
+	profile       = flag.String("profile", "", "Named profile with its own credentials, state and logs (e.g. work)")
+	storageType   = flag.String("storage", config.StorageJSON, "Storage backend: json or sqlite (adds notification history and statistics)")
+	masterPass    = flag.Bool("master-password", false, "With -save: protect the saved password with a master password")
+	tpmBound      = flag.Bool("tpm", false, "With -save: bind the saved password to this machine's TPM (Windows)")
+	portable      = flag.Bool("portable", false, "Keep all data next to the executable instead of the user profile (also enabled by a portable.ini there)")
+	logLevel      = flag.String("log-level", "info", "Log verbosity: debug, info, warn or error")
+	logFormatFlag = flag.String("log-format", logging.FormatText, "Log format: text or json")
+	apiAddress    = flag.String("api", "", "Serve the HTTP API on this loopback address, e.g. 127.0.0.1:7673 (see 'n0tif api-token')")
+	jsonOutput    = flag.Bool("json", false, "Print machine-readable JSON (status, health, recent, history, search, stats, audit, folders, doctor)")
 )
 
-// isAdmin checks if the current process is running with administrator privileges on Windows.
-func isAdmin() bool {
-	token := windows.GetCurrentProcessToken()
-	// GetCurrentProcessToken itself doesn't return an error directly in this form,
-	// but it returns a pseudo-handle. The operations on the token will fail if it's invalid.
-	// IsElevated() will handle this gracefully if the token is problematic.
-	// No explicit defer token.Close() is needed for the handle from GetCurrentProcessToken().
-	return token.IsElevated()
-}
-
 func main() {
+	flag.Usage = printUsage
 	flag.Parse() // Parse all flags once at the beginning
 
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	logging.SetLevel(level)
+
+	// Select the data location and profile before anything touches the data folder
+	if *portable || storage.PortableMarkerExists() {
+		if err := storage.EnablePortable(); err != nil {
+			log.Fatalf("Error: Failed to enable portable mode: %v", err)
+		}
+	}
+	if err := storage.SetProfile(*profile); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := logging.SetOutput(os.Stderr, logFormat()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
 	if *isDaemon {
 		// If this is a daemon child, its stdout/stderr might be nil (set by parent).
 		// setupFileLoggingAndExitOnFailure will attempt to redirect log.* to a file.
 		// If it fails, it writes an emergency log and exits.
 		setupFileLoggingAndExitOnFailure()
-		log.Println("N0tif daemon process initialised with file logging.")
+		logging.Infof("N0tif daemon process initialised with file logging.")
+	}
+	if *passStdin {
+		if err := readPasswordFromStdin(); err != nil {
+			logging.Eventf(logging.LevelError, "Failed to read the password from standard input: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	appCfgEmail := loadAppConfig() // Centralized config loading, uses global parsed flags
+	name, args := selectCommand(flag.Args())
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+	cmd.run(args)
+}
 
-	if *serviceMode {
-		// Determine if an install operation is being attempted.
-		// This includes "n0tif.exe -service install" or "n0tif.exe -service" (which implies install).
-		isInstallAttempt := false
-		serviceActionSpecified := false
+// selectCommand picks the subcommand to run. The flags of earlier versions keep
+// working: -service [action] means "service [action]", -background means "start",
+// and no command at all means "run".
+func selectCommand(args []string) (string, []string) {
+	switch {
+	case *serviceMode:
+		return "service", args
+	case *background:
+		return "start", args
+	case len(args) == 0:
+		return "run", nil
+	default:
+		return args[0], args[1:]
+	}
+}
 
-		// Check non-flag arguments for service actions like "install", "start", etc.
-		argsForService := flag.Args()
+// runRunCommand handles "n0tif run": monitor in the foreground until interrupted
+func runRunCommand(args []string) {
+	appCfg := loadAppConfig() // Centralized config loading, uses global parsed flags
 
-		if len(argsForService) > 0 {
-			action := argsForService[0]
-			if action == "install" {
-				isInstallAttempt = true
-				serviceActionSpecified = true
-			} else if action == "uninstall" || action == "start" || action == "stop" {
-				serviceActionSpecified = true
-				// isInstallAttempt remains false for these actions unless "install" was also somehow specified (which is unlikely here)
-			}
-		}
+	if !*isDaemon { // Only print this if truly foreground, not a -daemon child being run directly for testing
+		logging.Infof("Starting N0tif - Email Notification Service (Foreground)")
+	}
+	runEmailMonitor(appCfg)
+}
 
-		// If -service is used and no specific action like "uninstall", "start", "stop" is given via non-flag args,
-		// it defaults to install & start behavior within runAsWindowsService.
-		if !serviceActionSpecified {
-			isInstallAttempt = true
-		}
-
-		if isInstallAttempt {
-			if !isAdmin() {
-				// Use fmt.Println for direct user feedback before logging might be set up or if it goes to a file.
-				fmt.Println("--------------------------------------------------------------------")
-				fmt.Println("Administrator privileges are required to install or manage N0tif as a service.")
-				fmt.Println("Please re-run this command from a PowerShell or Command Prompt")
-				fmt.Println("that has been opened with 'Run as administrator'.")
-				fmt.Println("--------------------------------------------------------------------")
-				// Also log it, in case fmt.Println isn't visible (e.g. if output is redirected)
-				// Note: logging might not be set up yet if service setup fails early.
-				log.Println("Error: Administrator privileges required for service installation/management. Please re-run as administrator.")
-				os.Exit(1) // Exit because install/manage will fail
-			}
-		}
+// runStartCommand handles "n0tif start": relaunch detached in the background
+func runStartCommand(args []string) {
+	runInBackground(loadAppConfig())
+}
 
-		// service.go's runAsWindowsService handles its own logging via setupServiceLogging (which also sets log.SetOutput).
-		// The 'true' here is for the installAndStart parameter in runAsWindowsService.
-		// Pass flag.Args() which should contain service commands like "install", "start" etc.
-		// if they were provided after all flags.
-		runAsWindowsService(appCfgEmail, true, flag.Args())
+// runServiceCommand handles "n0tif service [install|uninstall|start|stop|status|run]".
+// Without an action the service is installed if needed and started.
+func runServiceCommand(args []string) {
+	action := ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "", "install", "uninstall", "start", "stop", "run":
+	case "status":
+		printServiceStatus()
 		return
+	default:
+		fmt.Printf("Unknown service action %q. Valid actions: install, uninstall, start, stop, status\n", action)
+		os.Exit(2)
 	}
 
-	if *background {
-		runInBackground(appCfgEmail) // Pass fully resolved config
-		return
+	// "run" is what the installed service is launched with by the service manager;
+	// everything else manages the service and, on Windows, needs elevation
+	runByServiceManager := action == "run"
+	if !runByServiceManager && serviceNeedsAdmin && !isAdmin() {
+		// Use fmt.Println for direct user feedback before logging might be set up or if it goes to a file.
+		fmt.Println("--------------------------------------------------------------------")
+		fmt.Println("Administrator privileges are required to install or manage N0tif as a service.")
+		fmt.Println("Please re-run this command from a PowerShell or Command Prompt")
+		fmt.Println("that has been opened with 'Run as administrator'.")
+		fmt.Println("--------------------------------------------------------------------")
+		// Also log it, in case fmt.Println isn't visible (e.g. if output is redirected)
+		logging.Errorf("Error: Administrator privileges required for service installation/management. Please re-run as administrator.")
+		os.Exit(1) // Exit because install/manage will fail
 	}
 
-	// Foreground execution
-	if !*isDaemon { // Only print this if truly foreground, not a -daemon child being run directly for testing
-		log.Println("Starting N0tif - Email Notification Service (Foreground)")
+	// Only installing and running need the account configuration; when running,
+	// it is loaded once logging to the service's log is set up
+	var appCfg config.Config
+	if action == "" || action == "install" {
+		appCfg = loadAppConfig()
 	}
-	runEmailMonitor(appCfgEmail)
+
+	// service.go's runAsService handles its own logging via setupServiceLogging (which also sets log.SetOutput).
+	// installAndStart is false only when the service manager launches the installed service.
+	runAsService(appCfg, !runByServiceManager, args)
 }
 
-// loadAppConfig resolves the email configuration from flags or storage.
+// loadAppConfig resolves the configuration from flags or storage.
 // It uses the globally parsed flags.
 // It will log.Fatal if essential configuration is missing and not loadable.
-func loadAppConfig() config.EmailConfig {
+func loadAppConfig() config.Config {
+	cfg, explicitCreds, err := resolveAppConfig()
+	if err != nil {
+		logging.Eventf(logging.LevelError, "Failed to load the configuration: %v", err)
+		os.Exit(1)
+	}
+
+	// Final validation for all paths, reporting every problem at once
+	if problems := cfg.Validate(); len(problems) > 0 {
+		for _, p := range problems {
+			logging.Errorf("Configuration error: %v", p)
+		}
+		logging.Eventf(logging.LevelError, "Invalid configuration (%d problem(s)). Run 'n0tif config check' for details.", len(problems))
+		os.Exit(1)
+	}
+
+	// Save credentials if -save flag is present AND we are using explicitly provided flags (not loaded ones).
+	if *save && explicitCreds {
+		logging.Infof("Saving provided credentials...")
+		if err := saveCredentials(cfg); err != nil {
+			logging.Warnf("Failed to save credentials: %v", err)
+		} else {
+			logging.Infof("Credentials saved successfully.")
+		}
+	}
+	return cfg
+}
+
+// saveCredentials saves the credentials, asking for a new master password when
+// -master-password is set and binding them to the TPM when -tpm is
+func saveCredentials(cfg config.Config) error {
+	if *tpmBound {
+		if !storage.TPMAvailable() {
+			return errors.New("no TPM is available on this machine")
+		}
+		return storage.SaveCredentialsWithBackend(cfg.Email, storage.EncryptionTPM)
+	}
+	if !*masterPass {
+		return storage.SaveCredentials(cfg.Email)
+	}
+	p, err := promptSecret("New master password: ", masterPasswordEnvVar, true)
+	if err != nil {
+		return err
+	}
+	storage.SetMasterPassword(p)
+	return storage.SaveCredentialsWithBackend(cfg.Email, storage.EncryptionMasterPassword)
+}
+
+// resolveAppConfig merges defaults, saved credentials, the settings file and flags.
+// It reports whether the credentials came from flags rather than storage.
+// It does not validate the result; see config.Config.Validate.
+func resolveAppConfig() (config.Config, bool, error) {
 	cfg := config.GetDefaultConfig() // Start with defaults
 
 	// Check if essential credential flags were explicitly set by the user on the command line.
-	// A simple check is if they are different from their zero/default values after flag.Parse().
-	// More robust: use flag.Visit to see which flags were actually set.
-	// For now, we assume if they are non-empty/non-default, they were set.
 	hasExplicitServer := *imapServer != ""
 	hasExplicitUser := *username != ""
 	hasExplicitPass := *password != ""
-	// For port and interval, we can check if they differ from default if needed, or assume if primary creds are set, these are also intended.
+	explicitCreds := hasExplicitServer || hasExplicitUser || hasExplicitPass
 
-	usingSavedCreds := false
 	// If no primary credential flags were set, try to load from storage.
-	if !hasExplicitServer && !hasExplicitUser && !hasExplicitPass {
+	if !explicitCreds {
 		if storage.CredentialsExist() {
-			log.Println("No explicit credentials provided via flags, attempting to load saved credentials...")
+			logging.Debugf("No explicit credentials provided via flags, attempting to load saved credentials...")
+			if err := unlockCredentials(); err != nil {
+				return cfg, false, err
+			}
 			savedCfg, err := storage.LoadCredentials()
 			if err != nil {
-				log.Fatalf("Failed to load saved credentials: %v. Please provide credentials or use -save.", err)
+				return cfg, false, fmt.Errorf("failed to load saved credentials: %w. Please provide credentials or use -save", err)
 			}
 			cfg.Email = *savedCfg
-			usingSavedCreds = true
-			log.Printf("Loaded credentials for %s on server %s", savedCfg.Username, savedCfg.ImapServer)
+			logging.Infof("Loaded credentials for %s on server %s", savedCfg.Username, savedCfg.ImapServer)
 		} else {
 			// If this is a daemon child, it MUST have received explicit args from its parent (runInBackground).
 			// So if it reaches here, something is wrong with how it was launched or parsed its args.
 			if *isDaemon {
-				log.Fatal("CRITICAL_DAEMON_CONFIG_ERROR: Daemon started without necessary credential arguments and no saved credentials found. This indicates an issue with parent process argument passing.")
-			} else {
-				log.Fatal("No credentials provided and no saved credentials found. Required flags: -server, -user, -pass, or use -save.")
+				return cfg, false, fmt.Errorf("CRITICAL_DAEMON_CONFIG_ERROR: Daemon started without necessary credential arguments and no saved credentials found. This indicates an issue with parent process argument passing")
 			}
+			return cfg, false, fmt.Errorf("no credentials provided and no saved credentials found. Required flags: -server, -user, -pass, or use -save")
 		}
 	} else {
 		// Use explicitly provided flags if they were set
@@ -169,86 +289,538 @@ func loadAppConfig() config.EmailConfig {
 		if hasExplicitPass {
 			cfg.Email.Password = *password
 		}
-		if *interval != config.GetDefaultConfig().Email.CheckInterval {
-			cfg.Email.CheckInterval = *interval
-		}
 	}
 
-	// Final validation for all paths
-	if cfg.Email.ImapServer == "" || cfg.Email.Username == "" || cfg.Email.Password == "" {
-		log.Fatal("Missing required email configuration: server, username, and password are required.")
+	// Notification identity flags override saved values so they can be changed without re-entering credentials
+	if *accountName != "" {
+		cfg.Email.Name = *accountName
+	}
+	if *appID != "" {
+		cfg.Email.Notification.AppID = *appID
+	}
+	if *iconPath != "" {
+		cfg.Email.Notification.Icon = *iconPath
+	}
+	if *iconColor != "" {
+		cfg.Email.Notification.Color = *iconColor
+	}
+	if *pinSHA256 != "" {
+		cfg.Email.PinSHA256 = *pinSHA256
 	}
 
-	// Save credentials if -save flag is present AND we are using explicitly provided flags (not loaded ones).
-	if *save && (hasExplicitServer || hasExplicitUser || hasExplicitPass) && !usingSavedCreds {
-		log.Println("Saving provided credentials...")
-		if err := storage.SaveCredentials(cfg.Email); err != nil {
-			log.Printf("Warning: Failed to save credentials: %v", err)
-		} else {
-			log.Println("Credentials saved successfully.")
-		}
+	// The settings file overrides saved values; explicitly passed flags override both
+	settingsPath, err := storage.GetConfigPath()
+	if err != nil {
+		return cfg, explicitCreds, fmt.Errorf("failed to locate settings file: %w", err)
+	}
+	settings, err := config.LoadSettings(settingsPath)
+	if err != nil {
+		return cfg, explicitCreds, fmt.Errorf("failed to load settings: %w", err)
+	}
+	settings.Apply(&cfg)
+	applyRemoteSettings(&cfg)
+
+	if flagWasSet("interval") {
+		cfg.Email.CheckInterval = *interval
+	}
+	if flagWasSet("calendar") {
+		cfg.DoNotDisturb.CalendarURL = *calendarURL
+	}
+	if flagWasSet("dnd") {
+		cfg.DoNotDisturb.Mode = *dndMode
+	}
+	if flagWasSet("storage") {
+		cfg.StorageBackend = *storageType
+	}
+	if flagWasSet("api") {
+		cfg.API.Listen = *apiAddress
 	}
-	return cfg.Email
+	return cfg, explicitCreds, nil
+}
+
+// flagWasSet reports whether the named flag was passed on the command line
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 // runEmailMonitor contains the main logic. Assumes logging is pre-configured.
-func runEmailMonitor(emailCfg config.EmailConfig) {
-	log.Println("runEmailMonitor: Initializing with loaded/parsed config.")
+func runEmailMonitor(cfg config.Config) {
+	emailCfg := cfg.Email
+	logging.Infof("Starting %s", currentBuildInfo())
+	logging.Debugf("runEmailMonitor: Initializing with loaded/parsed config.")
+
+	if err := storage.OpenBackend(cfg.StorageBackend); err != nil {
+		logging.Eventf(logging.LevelError, "Failed to open %s storage: %v", cfg.StorageBackend, err)
+		os.Exit(1)
+	}
+	defer storage.CloseBackend()
+	logging.Infof("Using %s storage backend.", cfg.StorageBackend)
+
+	compactor := storage.StartCompaction(cfg.Retention, storage.DefaultCompactionInterval)
+	defer compactor.Stop()
+
 	imapChecker, err := email.NewImapChecker(emailCfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize email checker: %v", err)
+		logging.Eventf(logging.LevelError, "Failed to initialize email checker: %v", err)
+		os.Exit(1)
+	}
+
+	// Recorded before the network wait so the instance can be stopped while it waits
+	if removePID, err := storage.WritePIDFile(); err != nil {
+		logging.Warnf("Failed to write PID file: %v", err)
+	} else {
+		defer removePID()
+	}
+
+	// Started by the service manager or at login, the network may not be up yet
+	if runningAsService || *isDaemon {
+		waitForNetwork(emailCfg)
 	}
 
-	log.Println("Initializing email tracking...")
+	logging.Infof("Initializing email tracking...")
 	if err := imapChecker.InitializeEmailTracking(); err != nil {
-		log.Printf("Warning: Failed to initialize email tracking: %v", err)
+		logging.Warnf("Failed to initialize email tracking: %v", err)
 	} else {
-		log.Println("Email tracking initialized successfully.")
+		logging.Infof("Email tracking initialized successfully.")
 	}
 
 	// Clear saved state and reinitialize if -resetstate flag is set
 	// This helps if you're debugging and want to force notifications for testing
 	if *resetState {
-		log.Println("Reset state flag detected, clearing all tracked email UIDs...")
+		logging.Infof("Reset state flag detected, clearing all tracked email UIDs...")
 		imapChecker.ResetState()
-		log.Println("Email state has been reset.")
+		logging.Infof("Email state has been reset.")
 	}
 
-	handleNewEmails := func(subjects []string) {
-		if len(subjects) == 0 {
+	endpoint := tracingEndpoint(cfg.Tracing)
+	tracing.SetEndpoint(endpoint, "n0tif")
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tracing.Shutdown(ctx)
+	}()
+
+	identity := resolveNotificationIdentity(emailCfg)
+	account := &liveAccount{cfg: emailCfg}
+	startedAt := time.Now()
+
+	// Features subscribe to what they need here instead of being called from the flow below
+	bus := events.New()
+	imapChecker.SetEvents(bus)
+	var notificationsSent dailyCounter
+	countNotifications(bus, &notificationsSent)
+	notifyLog := logging.For("notify").With("account", emailCfg.Username)
+	extras := newExtraNotifiers(cfg.Notifiers, notifyLog, bus)
+	emailHooks := newHookRunner(cfg.Hooks, emailCfg.Username, bus)
+
+	clicks := trackClicks(bus)
+	if !clicks && len(cfg.Notifications.OnClick) > 0 {
+		logging.Warnf("notifications on_click won't run: clicks on notifications can't be handled here.")
+	}
+
+	var toast emailToast
+	toast.update(cfg.Notifications)
+	var folders folderLabels
+	folders.update(cfg.Notifications)
+	previews := newEmailPreviews(account, cfg.Notifications)
+
+	// notifyOf shows a notification of emails in style; with clicks tracked, clicking it is counted for their senders
+	notifyOf := func(notificationTitle, notificationMessage string, emails []storage.MessageRecord, style notify.Style) error {
+		// A folder label names the folder after the account, and its icon replaces the account's
+		id, label := identity, emailCfg.Name
+		if folder, ok := folders.of(emails); ok {
+			if folder.name != "" && label != "" {
+				label += ": " + folder.name
+			} else if folder.name != "" {
+				label = folder.name
+			}
+			if folder.icon != "" {
+				id.Icon = folder.icon
+			}
+		}
+		if label != "" {
+			notificationTitle = fmt.Sprintf("%s (%s)", notificationTitle, label)
+		}
+
+		notifyLog.Debugf("Sending notification with title: '%s', message: '%s'",
+			notificationTitle, notificationMessage)
+
+		opts := []notify.Option{notify.WithStyle(style), notify.WithBody(previews.of(emails))}
+		if clicks && len(emails) > 0 {
+			opts = append(opts, notify.WithLaunch(clickURL(emails)))
+		}
+		if errNotify := notify.SendWindowsNotification(id, notificationTitle, notificationMessage, true, opts...); errNotify != nil {
+			notifyLog.Errorf("Failed to send notification: %v", errNotify)
+			notificationErrorsTotal.With(channelToast).Inc()
+			return errNotify
+		}
+		notifyLog.Debugf("Notification sent successfully")
+		notificationsSentTotal.With(channelToast).Inc()
+
+		bus.Publish(context.Background(), events.Event{
+			Type:    events.NotificationSent,
+			Account: emailCfg.Username,
+			Title:   notificationTitle,
+			Message: notificationMessage,
+			Emails:  emails,
+		})
+		return nil
+	}
+
+	readSync := newReadFilter(account, cfg.Notifications)
+	var notified notifiedEmails
+	follow := newFollowUps(account, cfg.FollowUp, func(title, message string) error {
+		return notifyOf(title, message, nil, toast.get())
+	})
+	reminders := newAgingReminders(account, cfg.Notifications, func(title, message string, emails []storage.MessageRecord) error {
+		return notifyOf(title, message, emails, toast.get())
+	})
+	dnd := newDoNotDisturb(cfg.DoNotDisturb, func(held []storage.MessageRecord) {
+		if held = readSync.unread(held); len(held) == 0 {
 			return
 		}
+		notifyOf("While You Were Busy",
+			fmt.Sprintf("%d email(s) arrived during your meeting. Most recent: %s", len(held), held[0].Subject), held, toast.get())
+	})
+
+	queue := newNotificationQueue(notifyLog)
+	group := newNotificationGroup(cfg.Notifications, func() { imapChecker.CheckNow() }, func(emails []storage.MessageRecord) error {
+		if unread := readSync.unread(emails); len(unread) > 0 {
+			title, message := groupedNotification(email.Subjects(unread))
+			if err := notifyOf(title, message, unread, toast.get()); err != nil {
+				return err
+			}
+		}
+		queue.done(emails, nil)
+		return nil
+	})
+	emailRules := newRuleSet(cfg.Rules)
+	importance := newImportanceFilter(account, cfg.Notifications)
+	push := newPushChannels(cfg.Push, notifyLog)
+	away := newAwayMode(emailCfg, cfg.Away, push, func(title, message string, emails []storage.MessageRecord) error {
+		return notifyOf(title, message, emails, toast.get())
+	})
+	scripts := newEmailScripts()
+	// Hooks have a subscription of their own, so rules, scripts and do-not-disturb don't hold them back
+	bus.Subscribe("notify", events.EmailReceived, func(ctx context.Context, e events.Event) {
+		// Email whose notification is still to come stays queued, the rest is done with
+		var waiting []storage.MessageRecord
+		defer func() { queue.done(e.Emails, waiting) }()
+
+		emails := e.Emails
+		if emails = importance.important(emails); len(emails) == 0 {
+			logging.Debugf("No new email marked as important to notify of")
+			return
+		}
+		if emails = emailRules.filter(emails); len(emails) == 0 {
+			logging.Debugf("Rules left no new email to notify of")
+			return
+		}
+		ctx, span := tracing.Start(ctx, "notify", "emails", len(emails))
+		defer span.End()
+		emails, decisions := scripts.decide(ctx, emails)
+		if len(emails) == 0 {
+			logging.Debugf("Scripts left no new email to notify of")
+			return
+		}
+		subjects := email.Subjects(emails)
 
 		// Debug log all received subjects
-		log.Printf("Debug: Received %d new email(s)", len(subjects))
+		logging.Debugf("Received %d new email(s)", len(subjects))
 		for i, subject := range subjects {
-			log.Printf("Debug: New email #%d: '%s'", i+1, subject)
+			logging.Debugf("New email #%d: '%s'", i+1, subject)
 		}
 
-		// Always use the newest email (first in sorted array) for single-email notification
-		mostRecentSubject := subjects[0]
+		// Pushes go out right away, as they are for when you are away from the desk
+		for _, m := range emails {
+			push.forward(emailCfg.Username, emailCfg.Name, m, emailRules.push(m))
+		}
 
-		notificationTitle := "New Email"
-		notificationMessage := fmt.Sprintf("You have a new email: %s", mostRecentSubject)
+		notified.add(emails)
+		if away.hold(emails) {
+			span.SetAttributes("away", true)
+			return
+		}
+		reminders.add(emails)
+		if dnd.hold(emails) {
+			span.SetAttributes("held", true)
+			return
+		}
 
-		if len(subjects) > 1 {
-			notificationTitle = "New Emails"
-			notificationMessage = fmt.Sprintf("You have %d new emails. Most recent: %s",
-				len(subjects), mostRecentSubject)
+		// Emails a script wrote the text for or a rule gave a toast style get a notification of their own
+		var errs []error
+		var grouped []storage.MessageRecord
+		for i, d := range decisions {
+			ruleToast := emailRules.toast(emails[i])
+			if d.Title == "" && d.Message == "" && ruleToast == nil {
+				grouped = append(grouped, emails[i])
+				continue
+			}
+			title, message := d.Title, d.Message
+			if title == "" {
+				title = "New Email"
+			}
+			if message == "" {
+				message = fmt.Sprintf("You have a new email: %s", subjects[i])
+			}
+			style := toast.get()
+			if ruleToast != nil {
+				style = toastStyle(*ruleToast)
+			}
+			if err := notifyOf(title, message, emails[i:i+1], style); err != nil {
+				errs = append(errs, err)
+				waiting = append(waiting, emails[i])
+			}
+		}
+		if len(grouped) == 0 {
+			span.SetError(errors.Join(errs...))
+			return
 		}
 
-		log.Printf("Sending notification with title: '%s', message: '%s'",
-			notificationTitle, notificationMessage)
+		// The group takes them off the queue once its notification is shown
+		waiting = append(waiting, grouped...)
+		errs = append(errs, group.add(grouped))
+		span.SetError(errors.Join(errs...))
+	})
 
-		if errNotify := notify.SendWindowsNotification(notificationTitle, notificationMessage, true); errNotify != nil {
-			log.Printf("Failed to send notification: %v", errNotify)
-		} else {
-			log.Printf("Notification sent successfully")
+	imapChecker.SetRestartHandler(func(crash error) {
+		title := "n0tif restarted after crash"
+		if emailCfg.Name != "" {
+			title = fmt.Sprintf("%s (%s)", title, emailCfg.Name)
 		}
-	}
+		message := fmt.Sprintf("Checking stopped with an internal error and has been restarted: %v. Details are in the log.", crash)
+		if err := notify.SendWindowsNotification(identity, title, message, false); err != nil {
+			notifyLog.Errorf("Failed to send crash notification: %v", err)
+		}
+	})
+	var credentialsAlerted atomic.Bool
+	imapChecker.SetFailureHandler(failureWindow(cfg.Alerts), func(since time.Time, err error) {
+		// A password that stopped working needs the user, so it is asked for until dismissed
+		if errors.Is(err, email.ErrCredentialsChanged) {
+			logging.Eventf(logging.LevelError, "%s refuses the saved password of %s: %v", emailCfg.ImapServer, emailCfg.Username, err)
+			if err := showCredentialsAlert(identity, emailCfg, clicks); err != nil {
+				notifyLog.Errorf("Failed to send password notification: %v", err)
+			}
+			credentialsAlerted.Store(true)
+			return
+		}
+		if err == nil && credentialsAlerted.Swap(false) {
+			if err := notify.RemoveTagged(identity, reauthTag); err != nil {
+				notifyLog.Debugf("Failed to remove password notification: %v", err)
+			}
+		}
+		title := fmt.Sprintf("n0tif can't reach %s", emailCfg.ImapServer)
+		message := fmt.Sprintf("Checking has failed since %s: %s", since.Local().Format("15:04"), email.FailureHint(err))
+		if err == nil {
+			title = fmt.Sprintf("n0tif can reach %s again", emailCfg.ImapServer)
+			message = "Checking works again; new email will be notified as usual."
+		}
+		if emailCfg.Name != "" {
+			title = fmt.Sprintf("%s (%s)", title, emailCfg.Name)
+		}
+		if err := notify.SendWindowsNotification(identity, title, message, false); err != nil {
+			notifyLog.Errorf("Failed to send failure notification: %v", err)
+		}
+	})
+	summary := newDailySummary(cfg.Alerts, func(title, message string) error {
+		if emailCfg.Name != "" {
+			title = fmt.Sprintf("%s (%s)", title, emailCfg.Name)
+		}
+		return notify.SendWindowsNotification(identity, title, message, false)
+	})
+	dataLimit := newDataCap(cfg.Alerts, func(title, message string) error {
+		if emailCfg.Name != "" {
+			title = fmt.Sprintf("%s (%s)", title, emailCfg.Name)
+		}
+		return notify.SendWindowsNotification(identity, title, message, false)
+	})
+	// The process checks a single account, so one worker; the offset keeps the
+	// instances of several profiles started at login from connecting together
+	scheduler := email.NewScheduler(1, 0, 0)
+	scheduler.SetTiming(schedulerTiming(cfg.Scheduler))
+	email.SetConnectionBudgets(cfg.Scheduler.ProviderConnections)
+	imapChecker.SetScheduler(scheduler)
+	imapChecker.SetProgressHandler(newBackfillToast(identity, emailCfg.Name).report)
+	imapChecker.SetMissedMail(missedMailMode(cfg.Notifications.MissedMail), func(ctx context.Context, emails []storage.MessageRecord) {
+		notified.add(emails)
+		title, message := missedSummary(emails)
+		notifyOf(title, message, emails, toast.get())
+	})
+	queue.replay(func(emails []storage.MessageRecord) error {
+		if emails = readSync.unread(emails); len(emails) == 0 {
+			return nil
+		}
+		title, message := groupedNotification(email.Subjects(emails))
+		return notifyOf(title, message, emails, toast.get())
+	})
+	imapChecker.StartChecking(func(ctx context.Context, emails []storage.MessageRecord) {
+		if len(emails) > 0 {
+			queue.add(emails)
+			bus.Publish(ctx, events.Event{Type: events.EmailReceived, Account: emailCfg.Username, Emails: emails})
+		}
+	})
+	logging.Infof("Email checker started for %s. Checking every %d seconds.", emailCfg.Username, emailCfg.CheckInterval)
+	battery := newBatteryWatch(emailCfg.CheckInterval, cfg.Battery, imapChecker.SetCheckInterval)
 
-	imapChecker.StartChecking(handleNewEmails)
-	log.Printf("Email checker started for %s. Checking every %d seconds.", emailCfg.Username, emailCfg.CheckInterval)
+	reloader := startConfigReloader(cfg, func(updated config.Config) {
+		battery.update(updated.Email.CheckInterval, updated.Battery)
+		dnd.update(updated.DoNotDisturb)
+		group.update(updated.Notifications)
+		readSync.update(updated.Notifications)
+		importance.update(updated.Notifications)
+		reminders.update(updated.Notifications)
+		follow.update(updated.FollowUp)
+		away.update(updated.Away)
+		toast.update(updated.Notifications)
+		folders.update(updated.Notifications)
+		previews.update(updated.Notifications)
+		compactor.SetPolicy(updated.Retention)
+		imapChecker.SetFailureWindow(failureWindow(updated.Alerts))
+		scheduler.SetTiming(schedulerTiming(updated.Scheduler))
+		email.SetConnectionBudgets(updated.Scheduler.ProviderConnections)
+		summary.update(updated.Alerts)
+		dataLimit.update(updated.Alerts)
+		extras.update(updated.Notifiers)
+		emailHooks.update(updated.Hooks)
+		emailRules.update(updated.Rules)
+		push.update(updated.Push)
+		scripts.reload()
+		if e := tracingEndpoint(updated.Tracing); e != endpoint {
+			endpoint = e
+			tracing.SetEndpoint(endpoint, "n0tif")
+			if endpoint == "" {
+				logging.Infof("Tracing disabled.")
+			}
+		}
+		if logFile != nil {
+			logFile.SetRotation(logRotation(updated.Log))
+		}
+		if updated.Log.Format != cfg.Log.Format && !flagWasSet("log-format") {
+			applyLogFormat(updated.Log.Format)
+		}
+		if updated.StorageBackend != cfg.StorageBackend {
+			logging.Infof("Storage backend changed to %s; restart n0tif for it to take effect.", updated.StorageBackend)
+		}
+		if updated.Remote != cfg.Remote {
+			logging.Infof("Remote settings source changed; restart n0tif for it to take effect.")
+		}
+		if updated.API != cfg.API {
+			logging.Infof("HTTP API settings changed; restart n0tif for it to take effect.")
+		}
+		if updated.Relay.Listen != cfg.Relay.Listen {
+			logging.Infof("Relay settings changed; restart n0tif for them to take effect.")
+		}
+		if updated.HomeAssistant != cfg.HomeAssistant {
+			logging.Infof("Home Assistant settings changed; restart n0tif for them to take effect.")
+		}
+	})
+	stopRemote := startRemoteSettings(cfg, reloader)
+	defer stopRemote()
+	stopRelay := startRelayHub(cfg.Relay, bus)
+	defer stopRelay()
+	stopHomeAssistant := startHomeAssistant(cfg, bus)
+	defer stopHomeAssistant()
+
+	// Closed by "n0tif stop" through the control endpoint
+	stopRequested := make(chan struct{})
+	var stopOnce sync.Once
+	status := func() statusReport {
+		check := imapChecker.Status()
+		report := statusReport{
+			Running:       true,
+			PID:           os.Getpid(),
+			Mode:          monitorMode(),
+			Profile:       storage.Profile(),
+			StartedAt:     startedAt,
+			Storage:       cfg.StorageBackend,
+			StoragePaused: storage.Suspended(),
+			LogLevel:      logging.CurrentLevel().String(),
+			Power:         battery.status(),
+			Accounts: []accountStatus{{
+				Name:               emailCfg.Name,
+				Username:           emailCfg.Username,
+				Server:             fmt.Sprintf("%s:%d", emailCfg.ImapServer, emailCfg.ImapPort),
+				LastCheck:          check.LastCheck,
+				LastError:          check.LastError,
+				LastSuccess:        check.LastSuccess,
+				CheckInterval:      int(check.Interval / time.Second),
+				NextCheck:          check.NextCheck,
+				Paused:             check.Paused,
+				PausedUntil:        check.PausedUntil,
+				Offline:            check.Offline,
+				ThrottledUntil:     check.ThrottledUntil,
+				NotificationsToday: notificationsSent.Today(),
+				Data:               dataLimit.status(check.Data, time.Now()),
+			}},
+		}
+		if check.UnreadKnown {
+			report.Accounts[0].Unread = &check.Unread
+		}
+		return report
+	}
+	// The tray shows the unread count, so it follows mark-read actions right away
+	// rather than at the next check
+	recountUnread := func() {
+		n, err := email.UnreadCount(account.get(), "INBOX")
+		if err != nil {
+			logging.Debugf("Failed to count unread email: %v", err)
+			return
+		}
+		imapChecker.SetUnread(n)
+	}
+	hooks := monitorHooks{
+		status:   status,
+		stop:     func() { stopOnce.Do(func() { close(stopRequested) }) },
+		checkNow: imapChecker.CheckNow,
+		pause:    imapChecker.Pause,
+		resume:   imapChecker.Resume,
+		markRead: func(mailbox string, uid uint32) error {
+			if err := email.MarkRead(account.get(), mailbox, uid); err != nil {
+				return err
+			}
+			go recountUnread()
+			return nil
+		},
+		markAllRead: func() (int, error) {
+			n, err := notified.markRead(func(mailbox string, uids []uint32) error {
+				return email.MarkAllRead(account.get(), mailbox, uids)
+			})
+			if n > 0 {
+				go recountUnread()
+			}
+			return n, err
+		},
+		notify: func(title, message string, style notify.Style) error {
+			return notifyOf(title, message, nil, style)
+		},
+		setLogLevel: new(logLevelSwitch).set,
+		subscribe: func(handle func(emails []storage.MessageRecord)) func() {
+			return bus.Subscribe("api", events.EmailReceived, func(_ context.Context, e events.Event) {
+				handle(e.Emails)
+			})
+		},
+	}
+	if reloader != nil {
+		hooks.reload = reloader.Reload
+	}
+	hooks.reloadCredentials = func() error {
+		return reloadPassword(account, imapChecker)
+	}
+	ctl := startControlServer(auditedHooks(hooks, triggerControl))
+	if ctl != nil {
+		defer ctl.Close()
+	}
+	if cfg.API.Listen != "" {
+		if stopAPI := startAPIServer(cfg, auditedHooks(hooks, triggerAPI)); stopAPI != nil {
+			defer stopAPI()
+		}
+	}
 
 	// Create a signal channel to keep the process alive indefinitely
 	sigChan := make(chan os.Signal, 1)
@@ -256,42 +828,137 @@ func runEmailMonitor(emailCfg config.EmailConfig) {
 
 	// Keep the daemon process alive explicitly
 	if *isDaemon {
-		log.Println("Daemon process is now running indefinitely.")
-		// Block indefinitely until a signal is received
-		<-sigChan
-	} else {
-		// For foreground mode, just wait for signals
-		<-sigChan
+		logging.Infof("Daemon process is now running indefinitely.")
+	}
+	// Block until a signal is received or a stop is requested
+	select {
+	case <-sigChan:
+	case <-stopRequested:
 	}
 
-	log.Println("Shutting down...")
+	logging.Infof("Shutting down...")
+}
+
+// tracingEndpoint is the OTLP endpoint spans go to: the settings file's, or the
+// standard OTEL_EXPORTER_OTLP_ENDPOINT variable when that is empty
+func tracingEndpoint(c config.TracingConfig) string {
+	if c.Endpoint != "" {
+		return c.Endpoint
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+}
+
+// failureWindow is how long checks fail before a notification says so; zero disables it
+func failureWindow(c config.AlertsConfig) time.Duration {
+	return time.Duration(c.FailureMinutes) * time.Minute
+}
+
+// schedulerTiming is the jitter window and check timeout of the scheduler
+func schedulerTiming(c config.SchedulerConfig) (jitter, timeout time.Duration) {
+	return time.Duration(c.JitterSeconds) * time.Second, time.Duration(c.CheckTimeoutSeconds) * time.Second
+}
+
+// resolveNotificationIdentity builds the toast identity for an account.
+// An explicit icon wins over a color; a color icon is generated on first use.
+func resolveNotificationIdentity(emailCfg config.EmailConfig) notify.Identity {
+	id := notify.Identity{
+		AppID: emailCfg.Notification.AppID,
+		Icon:  emailCfg.Notification.Icon,
+	}
+	if id.AppID == "" && emailCfg.Name != "" {
+		id.AppID = fmt.Sprintf("N0tif - %s", emailCfg.Name)
+	}
+
+	if id.Icon == "" && emailCfg.Notification.Color != "" {
+		id.Icon = colorIcon(emailCfg.Notification.Color)
+	}
+	return id
+}
+
+// colorIcon returns the path of the icon generated for color, creating it on
+// first use; it returns "" if that fails
+func colorIcon(color string) string {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		logging.Warnf("Failed to locate app folder for notification icon: %v", err)
+		return ""
+	}
+	icon, err := notify.ColorIcon(filepath.Join(appFolder, "icons"), color)
+	if err != nil {
+		logging.Warnf("Failed to create notification icon: %v", err)
+		return ""
+	}
+	return icon
+}
+
+// waitForNetwork holds the first check back, for a bounded time, until the network
+// is up, so a start early in boot or login doesn't begin with a burst of failures
+func waitForNetwork(cfg config.EmailConfig) {
+	if network.Probe(cfg.ImapServer, cfg.ImapPort) == network.Online {
+		return
+	}
+	logging.Infof("Waiting up to %v for the network before the first check...", startupNetworkTimeout)
+	if state := network.WaitOnline(cfg.ImapServer, cfg.ImapPort, startupNetworkTimeout, startupNetworkPoll); state != network.Online {
+		logging.Warnf("Network still unavailable (%s); starting anyway.", state)
+		return
+	}
+	logging.Infof("Network is up.")
 }
 
 // runInBackground relaunches the application as a background (detached) process.
-func runInBackground(emailCfg config.EmailConfig) {
+func runInBackground(cfg config.Config) {
+	emailCfg := cfg.Email
+	if pid, err := storage.ReadPIDFile(); err == nil && processAlive(pid) {
+		fmt.Printf("n0tif is already running for this profile (PID %d). Use 'n0tif restart' to restart it.\n", pid)
+		os.Exit(1)
+	}
+
 	exePath, err := os.Executable()
 	if err != nil {
 		log.Fatalf("Failed to get executable path: %v", err)
 	}
 
 	// Create necessary directory for logs
-	configDir, err := os.UserConfigDir()
+	logDir, err := storage.GetLogFolder()
 	if err != nil {
-		log.Fatalf("Failed to get user config directory: %v", err)
-	}
-
-	logDir := filepath.Join(configDir, "n0tif")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
 		log.Fatalf("Failed to create log directory: %v", err)
 	}
 
 	args := []string{
 		"-daemon",
+		fmt.Sprintf("-portable=%t", storage.Portable()),
+		"-profile", storage.Profile(),
 		"-server", emailCfg.ImapServer,
 		"-port", strconv.Itoa(emailCfg.ImapPort),
 		"-user", emailCfg.Username,
-		"-pass", emailCfg.Password,
+		"-pass-stdin",
 		"-interval", strconv.Itoa(emailCfg.CheckInterval),
+		"-log-level", *logLevel,
+	}
+	if flagWasSet("log-format") {
+		args = append(args, "-log-format", *logFormatFlag)
+	}
+	if emailCfg.Name != "" {
+		args = append(args, "-name", emailCfg.Name)
+	}
+	if emailCfg.Notification.AppID != "" {
+		args = append(args, "-appid", emailCfg.Notification.AppID)
+	}
+	if emailCfg.Notification.Icon != "" {
+		args = append(args, "-icon", emailCfg.Notification.Icon)
+	}
+	if emailCfg.Notification.Color != "" {
+		args = append(args, "-color", emailCfg.Notification.Color)
+	}
+	if emailCfg.PinSHA256 != "" {
+		args = append(args, "-pin-sha256", emailCfg.PinSHA256)
+	}
+	if cfg.DoNotDisturb.CalendarURL != "" {
+		args = append(args, "-calendar", cfg.DoNotDisturb.CalendarURL, "-dnd", cfg.DoNotDisturb.Mode)
+	}
+	args = append(args, "-storage", cfg.StorageBackend)
+	if cfg.API.Listen != "" {
+		args = append(args, "-api", cfg.API.Listen)
 	}
 
 	cmd := exec.Command(exePath, args...)
@@ -308,15 +975,25 @@ func runInBackground(emailCfg config.EmailConfig) {
 	cmd.Stdout = f
 	cmd.Stderr = f
 
-	// For Windows, use CREATE_NEW_PROCESS_GROUP to detach, but not DETACHED_PROCESS
-	// This combination should allow the console window to be hidden but the process to stay alive
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	// The password goes through a pipe rather than the arguments, which other
+	// users can read from the process list
+	passReader, passWriter, err := os.Pipe()
+	if err != nil {
+		log.Fatalf("Failed to create the password pipe: %v", err)
 	}
+	cmd.Stdin = passReader
+
+	detachProcess(cmd)
 
 	if err := cmd.Start(); err != nil {
 		log.Fatalf("Failed to start background process: %v", err)
 	}
+	passReader.Close()
+	_, err = io.WriteString(passWriter, emailCfg.Password+"\n")
+	passWriter.Close()
+	if err != nil {
+		log.Fatalf("Failed to pass the password to the background process: %v", err)
+	}
 
 	// Wait briefly for the process to start and create its logs
 	time.Sleep(500 * time.Millisecond)
@@ -334,12 +1011,23 @@ func runInBackground(emailCfg config.EmailConfig) {
 
 	// Print startup success message
 	fmt.Printf("N0tif has been started in the background (PID: %d)\n", cmd.Process.Pid)
-	fmt.Printf("You can close it from Task Manager using this PID.\n")
-	logPath := filepath.Join(configDir, "n0tif", "n0tif.log")
+	fmt.Printf("Stop it with 'n0tif stop'.\n")
+	logPath, _ := storage.GetLogPath()
 	fmt.Printf("Logs can be found at: %s\n", logPath)
 	os.Exit(0)
 }
 
+// readPasswordFromStdin sets -pass from the first line of standard input, where
+// runInBackground writes it for the daemon child
+func readPasswordFromStdin() error {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return err
+	}
+	*password = strings.TrimRight(line, "\r\n")
+	return nil
+}
+
 // writeEmergencyLog writes to a predefined temporary file if primary logging setup fails.
 // This is a last resort for daemon processes where stderr might be nil.
 func writeEmergencyLog(message string) {
@@ -360,29 +1048,9 @@ func writeEmergencyLog(message string) {
 // It is called very early in main() if the -daemon flag is set.
 // If it fails, it calls writeEmergencyLog and then os.Exit(1).
 func setupFileLoggingAndExitOnFailure() {
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		errMsg := fmt.Sprintf("CRITICAL_ERROR: Failed to get user config directory for logging: %v", err)
-		writeEmergencyLog(errMsg)
-		os.Exit(1)
-	}
-	logDir := filepath.Join(configDir, "n0tif")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		errMsg := fmt.Sprintf("CRITICAL_ERROR: Failed to create log directory '%s': %v", logDir, err)
+	if err := setupLogFile(); err != nil {
+		errMsg := fmt.Sprintf("CRITICAL_ERROR: Failed to open log file: %v", err)
 		writeEmergencyLog(errMsg)
 		os.Exit(1)
 	}
-	logFile := filepath.Join(logDir, "n0tif.log")
-
-	f, err := os.OpenFile(logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		errMsg := fmt.Sprintf("CRITICAL_ERROR: Failed to open log file '%s': %v", logFile, err)
-		writeEmergencyLog(errMsg)
-		os.Exit(1)
-	}
-
-	log.SetOutput(f)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	// Do not return 'f' as we are not redirecting stdout/stderr with Dup2 anymore.
-	// The file will be implicitly closed on process exit or if logger is reconfigured.
 }
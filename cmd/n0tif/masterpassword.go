@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/byigitt/n0tif/internal/agent"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// unlockCredentials supplies the master password when the saved credentials need one.
+// It tries the environment, then a running agent, then the terminal.
+func unlockCredentials() error {
+	scheme, err := storage.CredentialsEncryption()
+	if err != nil || scheme != storage.EncryptionMasterPassword || storage.HasMasterPassword() {
+		return nil
+	}
+
+	if p := os.Getenv(masterPasswordEnvVar); p != "" {
+		storage.SetMasterPassword(p)
+		return nil
+	}
+
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		return err
+	}
+	p, err := agent.Fetch(appFolder)
+	if err == nil {
+		logging.Infof("Master password supplied by the n0tif agent.")
+		storage.SetMasterPassword(p)
+		return nil
+	}
+	if !errors.Is(err, agent.ErrNotRunning) {
+		logging.Warnf("Failed to get master password from agent: %v", err)
+	}
+
+	p, err = promptSecret("Master password: ", masterPasswordEnvVar, false)
+	if err != nil {
+		return fmt.Errorf("credentials are protected by a master password: %w (or start 'n0tif agent')", err)
+	}
+	storage.SetMasterPassword(p)
+	return nil
+}
+
+// runAgentCommand implements "n0tif agent": it asks for the master password once,
+// checks it against the saved credentials and serves it to daemon starts until interrupted
+func runAgentCommand(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: n0tif [-profile name] agent")
+		os.Exit(2)
+	}
+
+	scheme, err := storage.CredentialsEncryption()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if scheme != storage.EncryptionMasterPassword {
+		log.Fatalf("Saved credentials are not protected by a master password (encryption: %s).", scheme)
+	}
+
+	p, err := promptSecret("Master password: ", masterPasswordEnvVar, false)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	storage.SetMasterPassword(p)
+	if _, err := storage.LoadCredentials(); err != nil {
+		log.Fatalf("Failed to unlock credentials: %v", err)
+	}
+
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	a, err := agent.Serve(appFolder, p)
+	if err != nil {
+		log.Fatalf("Failed to start agent: %v", err)
+	}
+	fmt.Println("n0tif agent is running; n0tif will no longer ask for the master password. Press Ctrl+C to stop.")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	if err := a.Close(); err != nil {
+		logging.Warnf("Failed to stop agent cleanly: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "github.com/byigitt/n0tif/internal/metrics"
+
+var (
+	notificationsSentTotal = metrics.NewCounter("n0tif_notifications_sent_total",
+		"Notifications delivered by channel.", "channel")
+	notificationErrorsTotal = metrics.NewCounter("n0tif_notification_errors_total",
+		"Notifications that failed by channel.", "channel")
+)
+
+// channelToast is the metrics label of desktop notifications
+const channelToast = "toast"
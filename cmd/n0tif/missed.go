@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// missedSummaryLines is how many emails the summary of missed email names
+const missedSummaryLines = 3
+
+// missedMailMode translates the missed_mail setting for the checker
+func missedMailMode(setting string) email.MissedMail {
+	switch setting {
+	case config.MissedMailSummary:
+		return email.MissedSummarize
+	case config.MissedMailSkip:
+		return email.MissedSkip
+	default:
+		return email.MissedNotify
+	}
+}
+
+// missedSummary phrases the email that arrived while n0tif wasn't running,
+// newest first, naming the first missedSummaryLines senders and subjects a line each
+func missedSummary(emails []storage.MessageRecord) (title, message string) {
+	lines := make([]string, 0, missedSummaryLines+1)
+	for i, m := range emails {
+		if i == missedSummaryLines {
+			lines = append(lines, fmt.Sprintf("and %d more", len(emails)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", m.From, m.Subject))
+	}
+	return fmt.Sprintf("While n0tif wasn't running: %d new email(s)", len(emails)), strings.Join(lines, "\n")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// notifiedEmails remembers the emails notified of since the monitor started, by
+// mailbox, so that "mark all read" can catch up with them in one go
+type notifiedEmails struct {
+	mu   sync.Mutex
+	uids map[string][]uint32 // by mailbox, in the order notified of
+}
+
+// add records emails as notified of
+func (n *notifiedEmails) add(emails []storage.MessageRecord) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.uids == nil {
+		n.uids = make(map[string][]uint32)
+	}
+	for _, e := range emails {
+		n.uids[e.Mailbox] = append(n.uids[e.Mailbox], e.UID)
+	}
+}
+
+// markRead marks the recorded emails read through mark, one call per mailbox,
+// and returns how many it marked. Mailboxes marked are forgotten; those that
+// failed are kept for the next attempt.
+func (n *notifiedEmails) markRead(mark func(mailbox string, uids []uint32) error) (int, error) {
+	n.mu.Lock()
+	pending := n.uids
+	n.uids = nil
+	n.mu.Unlock()
+
+	marked := 0
+	var errs []error
+	for mailbox, uids := range pending {
+		if err := mark(mailbox, uids); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", mailbox, err))
+			n.keep(mailbox, uids)
+			continue
+		}
+		marked += len(uids)
+	}
+	if marked > 0 {
+		logging.Infof("Marked %d notified email(s) read.", marked)
+	}
+	return marked, errors.Join(errs...)
+}
+
+// keep records uids of mailbox again after marking them failed
+func (n *notifiedEmails) keep(mailbox string, uids []uint32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.uids == nil {
+		n.uids = make(map[string][]uint32)
+	}
+	n.uids[mailbox] = append(uids, n.uids[mailbox]...)
+}
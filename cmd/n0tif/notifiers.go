@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/byigitt/n0tif/pkg/checker"
+	"github.com/byigitt/n0tif/pkg/pipeline"
+)
+
+// extraNotifiers are the notification channels added in the settings file. They
+// are told about every notification the toast shows.
+type extraNotifiers struct {
+	log *logging.Logger
+
+	mu        sync.Mutex
+	specs     []byte // the configuration the notifiers were built from, as JSON
+	notifiers []namedNotifier
+}
+
+type namedNotifier struct {
+	name string
+	pipeline.Notifier
+}
+
+// newExtraNotifiers builds the notifiers listed in specs and passes them the
+// notifications published on bus
+func newExtraNotifiers(specs []config.NotifierConfig, log *logging.Logger, bus *events.Bus) *extraNotifiers {
+	n := &extraNotifiers{log: log}
+	n.update(specs)
+	bus.Subscribe("notifiers", events.NotificationSent, func(ctx context.Context, e events.Event) {
+		n.notify(ctx, pipeline.Event{
+			Time:    e.Time,
+			Source:  "imap",
+			Account: e.Account,
+			Title:   e.Title,
+			Message: e.Message,
+			Urgent:  true,
+			Emails:  pipelineEmails(e.Emails),
+		})
+	})
+	return n
+}
+
+// pipelineEmails converts the emails of a notification for the notifiers
+func pipelineEmails(records []storage.MessageRecord) []checker.Email {
+	emails := make([]checker.Email, len(records))
+	for i, r := range records {
+		emails[i] = checker.Email{Mailbox: r.Mailbox, UID: r.UID, From: r.From, Subject: r.Subject, Date: r.Date}
+	}
+	return emails
+}
+
+// update rebuilds the notifiers when the list in the settings file changed. A
+// notifier that can't be built is left out and reported; the others still work.
+func (n *extraNotifiers) update(specs []config.NotifierConfig) {
+	encoded, _ := json.Marshal(specs)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if string(encoded) == string(n.specs) {
+		return
+	}
+	n.specs = encoded
+
+	n.notifiers = nil
+	for _, spec := range specs {
+		notifier, err := pipeline.NewNotifier(pipeline.Spec{Type: spec.Type, Options: spec.Options})
+		if err != nil {
+			n.log.Warnf("Notifier disabled: %v", err)
+			continue
+		}
+		n.notifiers = append(n.notifiers, namedNotifier{name: spec.Type, Notifier: notifier})
+	}
+	if len(n.notifiers) > 0 {
+		n.log.Infof("%d additional notifier(s) enabled.", len(n.notifiers))
+	}
+}
+
+// notify passes e to every notifier, counting and logging failures
+func (n *extraNotifiers) notify(ctx context.Context, e pipeline.Event) {
+	n.mu.Lock()
+	notifiers := n.notifiers
+	n.mu.Unlock()
+
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, e); err != nil {
+			n.log.Errorf("Notifier %s failed: %v", notifier.name, err)
+			notificationErrorsTotal.With(notifier.name).Inc()
+			continue
+		}
+		notificationsSentTotal.With(notifier.name).Inc()
+	}
+}
+
+// checkNotifiers reports the notifiers of the settings file that can't be built,
+// e.g. because the type is unknown on this platform or an option is misspelled
+func checkNotifiers(specs []config.NotifierConfig) []error {
+	var problems []error
+	for _, spec := range specs {
+		if spec.Type == "" {
+			continue // reported by Validate
+		}
+		if _, err := pipeline.NewNotifier(pipeline.Spec{Type: spec.Type, Options: spec.Options}); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+)
+
+// certificateHint explains how to get a server with an untrusted certificate
+// working, naming the pin of the certificate it presents now
+func certificateHint(cfg config.EmailConfig) string {
+	cert, err := email.ServerCertificate(cfg)
+	if err != nil {
+		return "The server's certificate isn't trusted; check the system clock, and pin a self-signed certificate with -pin-sha256"
+	}
+	pin := email.PinOf(cert)
+	if cfg.PinSHA256 != "" {
+		return fmt.Sprintf("The server's key is now %s, not the pinned one. Only if its administrator replaced the certificate, pin the new key with '-pin-sha256 %s -save'", pin, pin)
+	}
+	return fmt.Sprintf("If the server uses a self-signed certificate (%s), check its key %s with the administrator and trust it with '-pin-sha256 %s -save'", cert.Subject, pin, pin)
+}
+
+// offerPin shows the certificate of a server it couldn't be verified for and,
+// if the user trusts it, pins its key in cfg. It reports whether it did.
+func offerPin(cfg *config.EmailConfig) bool {
+	cert, err := email.ServerCertificate(*cfg)
+	if err != nil {
+		return false
+	}
+	pin := email.PinOf(cert)
+	fmt.Println("The server's certificate isn't issued by an authority this computer trusts:")
+	fmt.Printf("  Subject: %s\n", cert.Subject)
+	fmt.Printf("  Issuer:  %s\n", cert.Issuer)
+	fmt.Printf("  Valid:   %s to %s\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+	fmt.Printf("  Key pin: %s\n", pin)
+	fmt.Println("If the server uses a self-signed certificate, compare the key pin with its administrator's.")
+	if !promptYesNo("Trust this certificate for this account?") {
+		return false
+	}
+	cfg.PinSHA256 = pin
+	return true
+}
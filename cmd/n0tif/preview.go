@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// emailPreviews fetches the beginning of the text of an email for its
+// notification. Checks only fetch headers; the text is asked for here, just
+// before the notification is shown, so only the email notified of costs more.
+type emailPreviews struct {
+	account *liveAccount
+	log     *logging.Logger
+
+	mu      sync.Mutex
+	enabled bool
+}
+
+// newEmailPreviews creates the previews for account; they are off unless cfg.Preview is set
+func newEmailPreviews(account *liveAccount, cfg config.NotificationsConfig) *emailPreviews {
+	p := &emailPreviews{account: account, log: logging.For("notify").With("account", account.get().Username)}
+	p.update(cfg)
+	return p
+}
+
+// update applies a changed setting
+func (p *emailPreviews) update(cfg config.NotificationsConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enabled = cfg.Preview
+}
+
+// of returns the preview for the notification of emails: the beginning of the
+// text of a single email, "" for several or when it can't be fetched
+func (p *emailPreviews) of(emails []storage.MessageRecord) string {
+	p.mu.Lock()
+	enabled := p.enabled
+	p.mu.Unlock()
+	if !enabled || len(emails) != 1 || emails[0].UID == 0 {
+		return ""
+	}
+
+	m := emails[0]
+	previews, err := email.Previews(p.account.get(), m.Mailbox, []uint32{m.UID})
+	if err != nil {
+		p.log.Warnf("Could not fetch the text of the email for its notification: %v", err)
+		return ""
+	}
+	return previews[m.UID]
+}
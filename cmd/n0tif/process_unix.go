@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// processAlive reports whether a process with the given ID is running
+func processAlive(pid int) bool {
+	// Signal 0 checks for existence without delivering anything
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// hideWindow does nothing here: only Windows opens console windows for child processes
+func hideWindow(cmd *exec.Cmd) {}
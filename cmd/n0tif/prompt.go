@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passphraseEnvVar lets scripts supply a passphrase instead of typing it
+const passphraseEnvVar = "N0TIF_PASSPHRASE"
+
+// masterPasswordEnvVar supplies the credential master password without a prompt
+const masterPasswordEnvVar = "N0TIF_MASTER_PASSWORD"
+
+// promptPassphrase reads a passphrase from the terminal without echoing it.
+// With confirm set, it is asked for twice to catch typos.
+func promptPassphrase(prompt string, confirm bool) (string, error) {
+	return promptSecret(prompt, passphraseEnvVar, confirm)
+}
+
+// promptSecret is promptPassphrase with the environment variable that overrides the prompt;
+// an empty envVar always prompts
+func promptSecret(prompt, envVar string, confirm bool) (string, error) {
+	if envVar != "" {
+		if p := os.Getenv(envVar); p != "" {
+			return p, nil
+		}
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		if envVar == "" {
+			return "", errors.New("no terminal to read the passphrase from")
+		}
+		return "", fmt.Errorf("no terminal to read the passphrase from; set %s instead", envVar)
+	}
+
+	fmt.Print(prompt)
+	first, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if len(first) == 0 {
+		return "", errors.New("passphrase must not be empty")
+	}
+
+	if confirm {
+		fmt.Print("Repeat passphrase: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if string(first) != string(second) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return string(first), nil
+}
+
+// stdin is shared by the line prompts so input read ahead by one isn't lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// promptYesNo asks a yes/no question on the terminal, defaulting to no
+func promptYesNo(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// promptLine asks for a line of text, returning def when the answer is empty
+func promptLine(question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, _ := stdin.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+	return answer
+}
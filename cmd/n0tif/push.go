@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/byigitt/n0tif/pkg/pipeline"
+)
+
+// pushChannels are the push channels of the settings file, by name. Unlike the
+// additional notifiers they only get the email that rules forward to them.
+type pushChannels struct {
+	log *logging.Logger
+
+	mu       sync.Mutex
+	specs    []byte // the configuration the channels were built from, as JSON
+	channels map[string]namedNotifier
+}
+
+// newPushChannels builds the push channels of cfg
+func newPushChannels(cfg []config.PushConfig, log *logging.Logger) *pushChannels {
+	p := &pushChannels{log: log}
+	p.update(cfg)
+	return p
+}
+
+// update rebuilds the channels when the list in the settings file changed. A
+// channel that can't be built is left out and reported; the others still work.
+func (p *pushChannels) update(cfg []config.PushConfig) {
+	encoded, _ := json.Marshal(cfg)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if string(encoded) == string(p.specs) {
+		return
+	}
+	p.specs = encoded
+
+	p.channels = make(map[string]namedNotifier)
+	for _, c := range cfg {
+		notifier, err := pipeline.NewNotifier(pipeline.Spec{Type: c.Type, Options: c.Options})
+		if err != nil {
+			p.log.Warnf("Push channel %s disabled: %v", c.Name, err)
+			continue
+		}
+		p.channels[c.Name] = namedNotifier{name: c.Type, Notifier: notifier}
+	}
+	if len(p.channels) > 0 {
+		p.log.Infof("%d push channel(s) enabled.", len(p.channels))
+	}
+}
+
+// forward sends m of the account with the display name label to the named
+// channels in the background, so a slow push service doesn't hold up the toast
+func (p *pushChannels) forward(account, label string, m storage.MessageRecord, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	title := "New Email"
+	if label != "" {
+		title = fmt.Sprintf("%s (%s)", title, label)
+	}
+	p.send(names, pipeline.Event{
+		Time:    time.Now(),
+		Source:  "imap",
+		Account: account,
+		Title:   title,
+		Message: fmt.Sprintf("%s: %s", m.From, m.Subject),
+		Urgent:  true,
+		Emails:  pipelineEmails([]storage.MessageRecord{m}),
+	}, fmt.Sprintf("%s/%d", m.Mailbox, m.UID))
+}
+
+// send delivers e to the named channels in the background; what names the
+// pushed content in the log
+func (p *pushChannels) send(names []string, e pipeline.Event, what string) {
+	p.mu.Lock()
+	var targets []namedNotifier
+	for _, name := range names {
+		if c, ok := p.channels[name]; ok {
+			targets = append(targets, c)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, target := range targets {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := target.Notify(ctx, e); err != nil {
+				p.log.Errorf("Push of %s failed: %v", what, err)
+				notificationErrorsTotal.With(target.name).Inc()
+				return
+			}
+			notificationsSentTotal.With(target.name).Inc()
+		}()
+	}
+}
+
+// checkPushChannels reports the push channels of the settings file that can't be built
+func checkPushChannels(cfg []config.PushConfig) []error {
+	var problems []error
+	for _, c := range cfg {
+		if c.Type == "" {
+			continue // reported by Validate
+		}
+		if _, err := pipeline.NewNotifier(pipeline.Spec{Type: c.Type, Options: c.Options}); err != nil {
+			problems = append(problems, fmt.Errorf("push %s: %w", c.Name, err))
+		}
+	}
+	return problems
+}
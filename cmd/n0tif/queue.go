@@ -0,0 +1,97 @@
+package main
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// maxQueued caps the email waiting for its notification; the oldest is dropped beyond it
+const maxQueued = 200
+
+// notificationQueue is the email found but not notified of yet, kept in
+// notification_queue.json: email enters it as soon as a check finds it and
+// leaves once its notification is shown or it turns out not to need one. What
+// is left when the monitor stops, or when Windows refused the toast, is
+// notified of on the next start.
+type notificationQueue struct {
+	log *logging.Logger
+
+	mu     sync.Mutex
+	emails []storage.MessageRecord // newest first
+}
+
+// newNotificationQueue loads the email left waiting by the previous run
+func newNotificationQueue(log *logging.Logger) *notificationQueue {
+	q := &notificationQueue{log: log}
+	emails, err := storage.LoadNotificationQueue()
+	if err != nil {
+		log.Warnf("Failed to read the notification queue: %v", err)
+	}
+	q.emails = emails
+	return q
+}
+
+// add queues emails (newest first) until notified of
+func (q *notificationQueue) add(emails []storage.MessageRecord) {
+	if len(emails) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.emails = append(append([]storage.MessageRecord{}, emails...), q.emails...)
+	if len(q.emails) > maxQueued {
+		q.emails = q.emails[:maxQueued]
+	}
+	q.saveLocked()
+}
+
+// done removes emails from the queue, except those in keep, which still wait
+// for their notification
+func (q *notificationQueue) done(emails, keep []storage.MessageRecord) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kept := q.emails[:0]
+	for _, queued := range q.emails {
+		if !containsEmail(emails, queued) || containsEmail(keep, queued) {
+			kept = append(kept, queued)
+		}
+	}
+	if len(kept) == len(q.emails) {
+		return
+	}
+	q.emails = kept
+	q.saveLocked()
+}
+
+func (q *notificationQueue) saveLocked() {
+	if err := storage.SaveNotificationQueue(q.emails); err != nil {
+		q.log.Warnf("Failed to save the notification queue: %v", err)
+	}
+}
+
+// replay notifies of the email left waiting through send, which gets them
+// newest first, and keeps them queued if that fails
+func (q *notificationQueue) replay(send func(emails []storage.MessageRecord) error) {
+	q.mu.Lock()
+	emails := slices.Clone(q.emails)
+	q.mu.Unlock()
+	if len(emails) == 0 {
+		return
+	}
+	q.log.Infof("Notifying of %d email(s) found before n0tif last stopped.", len(emails))
+	if err := send(emails); err != nil {
+		q.log.Warnf("Failed to notify of the queued email, keeping it for the next start: %v", err)
+		return
+	}
+	q.done(emails, nil)
+}
+
+// containsEmail reports whether emails holds m
+func containsEmail(emails []storage.MessageRecord, m storage.MessageRecord) bool {
+	return slices.ContainsFunc(emails, func(e storage.MessageRecord) bool {
+		return e.Account == m.Account && e.Mailbox == m.Mailbox && e.UID == m.UID
+	})
+}
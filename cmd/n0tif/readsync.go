@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// readFilter leaves out email that was read elsewhere, e.g. on a phone, between
+// the check that found it and its notification, which grouping and
+// do-not-disturb can hold back for a while
+type readFilter struct {
+	account *liveAccount
+	log     *logging.Logger
+
+	mu      sync.Mutex
+	enabled bool
+}
+
+// newReadFilter creates the filter for account; it is off unless cfg.SkipRead is set
+func newReadFilter(account *liveAccount, cfg config.NotificationsConfig) *readFilter {
+	f := &readFilter{account: account, log: logging.For("notify").With("account", account.get().Username)}
+	f.update(cfg)
+	return f
+}
+
+// update applies a changed setting
+func (f *readFilter) update(cfg config.NotificationsConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled = cfg.SkipRead
+}
+
+// unread returns the emails still unread on the server, in the same order. If
+// the server can't be asked, all of them are returned: a notification too many
+// beats a missed one.
+func (f *readFilter) unread(emails []storage.MessageRecord) []storage.MessageRecord {
+	f.mu.Lock()
+	enabled := f.enabled
+	f.mu.Unlock()
+	if !enabled || len(emails) == 0 {
+		return emails
+	}
+
+	uids := make(map[string][]uint32)
+	for _, e := range emails {
+		uids[e.Mailbox] = append(uids[e.Mailbox], e.UID)
+	}
+	unseen := make(map[string]map[uint32]bool, len(uids))
+	for mailbox, list := range uids {
+		found, err := email.Unseen(f.account.get(), mailbox, list)
+		if err != nil {
+			f.log.Warnf("Could not check whether %d email(s) were read meanwhile, notifying of them: %v", len(list), err)
+			return emails
+		}
+		unseen[mailbox] = found
+	}
+
+	var kept []storage.MessageRecord
+	for _, e := range emails {
+		if unseen[e.Mailbox][e.UID] {
+			kept = append(kept, e)
+		}
+	}
+	if skipped := len(emails) - len(kept); skipped > 0 {
+		f.log.Infof("Skipping %d email(s) already read elsewhere.", skipped)
+	}
+	return kept
+}
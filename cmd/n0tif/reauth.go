@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// reauthTag identifies the notification asking for a new password, so entering
+// one can take it away
+const reauthTag = "reauth"
+
+// reauthURL is the URL the button of that notification opens, handled by "n0tif click"
+func reauthURL() string {
+	q := url.Values{}
+	if p := storage.Profile(); p != "" {
+		q.Set("profile", p)
+	}
+	return clickScheme + ":reauth?" + q.Encode()
+}
+
+// profileAccount is the name "n0tif account" knows the account of the active profile by
+func profileAccount() string {
+	if p := storage.Profile(); p != "" {
+		return p
+	}
+	return defaultAccount
+}
+
+// showCredentialsAlert asks for the password of an account whose login stopped
+// working, in a notification that stays until dismissed. With clicks, its
+// button runs the account update wizard; without, it names the command.
+func showCredentialsAlert(id notify.Identity, cfg config.EmailConfig, clicks bool) error {
+	account := cfg.Name
+	if account == "" {
+		account = cfg.Username
+	}
+	title := fmt.Sprintf("Re-enter password for %s account", account)
+	message := fmt.Sprintf("%s refuses the saved password; it was probably changed or revoked.", cfg.ImapServer)
+	opts := []notify.Option{notify.WithTag(reauthTag), notify.WithStyle(notify.Style{Scenario: "reminder"})}
+	if clicks {
+		opts = append(opts, notify.WithAction("Update password", reauthURL()))
+	} else {
+		message += fmt.Sprintf(" Run 'n0tif account update %s' to enter the new one.", profileAccount())
+	}
+	return notify.SendWindowsNotification(id, title, message, true, opts...)
+}
+
+// updateAccount asks for the new password of a saved account until the server
+// accepts it, saves it and takes away the notification asking for it
+func updateAccount(name string) error {
+	if !storage.CredentialsExist() {
+		return fmt.Errorf("account %s has no saved credentials; add it with 'n0tif account add %s'", name, name)
+	}
+	cfg, err := storage.SavedAccount()
+	if err != nil {
+		return err
+	}
+	if err := unlockCredentials(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Enter the new password of %s on %s.\n", cfg.Username, cfg.ImapServer)
+	for attempt := 1; ; attempt++ {
+		password, err := promptSecret("New password: ", "", false)
+		if err != nil {
+			return err
+		}
+		try := *cfg
+		try.Password = password
+		fmt.Printf("Logging in to %s:%d as %s... ", cfg.ImapServer, cfg.ImapPort, cfg.Username)
+		c, err := email.Dial(try)
+		if err == nil {
+			c.Logout()
+			fmt.Println("OK")
+			cfg.Password = password
+			break
+		}
+		fmt.Println("FAILED")
+		if errors.Is(err, email.ErrAppPasswordRequired) {
+			if err := guideAppPassword(cfg); err != nil {
+				return err
+			}
+			break
+		}
+		if !errors.Is(err, email.ErrAuthFailed) || attempt == appPasswordAttempts {
+			return err
+		}
+		fmt.Println("The server refused the password; check that it was typed correctly and try again.")
+	}
+
+	if err := storage.SaveCredentials(*cfg); err != nil {
+		return fmt.Errorf("failed to save credentials: %w", err)
+	}
+	if err := notify.RemoveTagged(resolveNotificationIdentity(*cfg), reauthTag); err != nil {
+		logging.Debugf("Failed to remove the password notification: %v", err)
+	}
+	fmt.Printf("Password of account %s saved.\n", name)
+	return nil
+}
+
+// liveAccount is the account the monitor logs in to, shared by everything that
+// connects so a password reloaded while running reaches all of them
+type liveAccount struct {
+	mu  sync.Mutex
+	cfg config.EmailConfig
+}
+
+func (a *liveAccount) get() config.EmailConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg
+}
+
+// reloadPassword switches the running monitor to the password saved for its
+// account since it started, and checks right away with it
+func reloadPassword(account *liveAccount, checker *email.ImapChecker) error {
+	saved, err := storage.LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("load saved credentials: %w", err)
+	}
+	cfg := account.get()
+	if saved.Username != cfg.Username || saved.ImapServer != cfg.ImapServer {
+		return fmt.Errorf("the saved credentials are for %s on %s, not %s on %s", saved.Username, saved.ImapServer, cfg.Username, cfg.ImapServer)
+	}
+
+	account.mu.Lock()
+	account.cfg.Password = saved.Password
+	account.mu.Unlock()
+	checker.SetPassword(saved.Password)
+	logging.Infof("Password of %s reloaded.", cfg.Username)
+	go checker.CheckNow()
+	return nil
+}
+
+// restartForNewPassword gets the running instance of the profile, which logs in
+// with the password it started with, to use the new one. It is asked to reload
+// the password; when it can't, it is restarted the way it was started.
+func restartForNewPassword() {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Restart n0tif for this profile to use the new password: %v\n", err)
+		return
+	}
+	_, reloadErr := control.Call(appFolder, "reload-credentials", controlTimeout)
+	if reloadErr == nil {
+		fmt.Println("n0tif now uses the new password.")
+		return
+	}
+
+	mode := ""
+	if !errors.Is(reloadErr, control.ErrNotRunning) {
+		var report statusReport
+		if reply, err := control.Call(appFolder, "status", controlTimeout); err == nil && json.Unmarshal([]byte(reply), &report) == nil {
+			mode = report.Mode
+		}
+	}
+	switch mode {
+	case "foreground":
+		// Started in a console, so it is restarted there
+		fmt.Printf("Restart n0tif for this profile to use the new password: %v\n", reloadErr)
+		return
+	case "background":
+	default:
+		// A service is restarted by its manager, also when it doesn't answer
+		restarted, err := restartRunningService()
+		if err != nil {
+			fmt.Printf("Restart the n0tif %s to use the new password: %v\n", serviceKind, err)
+			return
+		}
+		if restarted {
+			fmt.Printf("Restarted the n0tif %s to use the new password.\n", serviceKind)
+			return
+		}
+	}
+
+	// In the background, or not answering, e.g. a stuck instance or one of an older version
+	stopped, err := stopMonitor()
+	if err != nil {
+		fmt.Printf("Restart n0tif for this profile to use the new password: %v\n", err)
+		return
+	}
+	if stopped {
+		fmt.Println("Restarting n0tif to use the new password.")
+		runInBackground(loadAppConfig())
+	}
+}
+
+// runReauthClick runs the account update wizard from the button of the
+// notification asking for a new password, in the console Windows opened for it
+func runReauthClick() {
+	if err := updateAccount(profileAccount()); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		promptLine("Press Enter to close this window", "")
+		os.Exit(1)
+	}
+	restartForNewPassword()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// runRekeyCommand handles "n0tif rekey [-to backend] [-old-hostname name]"
+func runRekeyCommand(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	to := fs.String("to", "", "Backend to re-encrypt with: keyring, dpapi, machine-key, tpm or master-password (default: the most secure available)")
+	oldHostname := fs.String("old-hostname", "", "Previous computer name, for machine-key credentials that broke after a rename")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] rekey [-to backend] [-old-hostname name]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *to != "" {
+		if _, err := storage.GetSecretBackend(*to); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *to == storage.EncryptionTPM && !storage.TPMAvailable() {
+		fmt.Println("Error: no TPM is available on this machine")
+		os.Exit(1)
+	}
+
+	if err := unlockCredentials(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := storage.RekeyOptions{Backend: *to, OldHostname: *oldHostname}
+	if *to == storage.EncryptionMasterPassword {
+		p, err := promptSecret("New master password: ", "", true)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.NewMasterPassword = p
+	}
+
+	result, err := storage.RekeyCredentials(opts)
+	if err != nil {
+		fmt.Printf("Rekey failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Credentials re-encrypted: %s -> %s\n", result.From, result.To)
+	fmt.Println("Restart any running n0tif instance of this profile to pick up the change.")
+}
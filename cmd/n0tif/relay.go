@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/relay"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// relayKeyEnvVar supplies the relay key to "n0tif relay set-key" without a prompt
+const relayKeyEnvVar = "N0TIF_RELAY_KEY"
+
+// How long the relay client waits before connecting again, doubling up to the maximum
+const (
+	relayRetryMin = 5 * time.Second
+	relayRetryMax = 5 * time.Minute
+)
+
+// startRelayHub relays every notification shown to the machines connecting to
+// the relay's listen address, if it has one. It returns a function that stops it.
+func startRelayHub(c config.RelayConfig, bus *events.Bus) (stop func()) {
+	if c.Listen == "" {
+		return func() {}
+	}
+	key, err := storage.RelayKey(false)
+	if err != nil {
+		logging.Errorf("Relay disabled, cannot read the relay key: %v", err)
+		return func() {}
+	}
+	certPath, err := storage.GetRelayCertPath()
+	if err != nil {
+		logging.Errorf("Relay disabled, cannot locate its certificate: %v", err)
+		return func() {}
+	}
+	cert, err := relay.LoadOrCreateCertificate(certPath)
+	if err != nil {
+		logging.Errorf("Relay disabled, cannot load its certificate: %v", err)
+		return func() {}
+	}
+	server, err := relay.Listen(c.Listen, key, cert)
+	if err != nil {
+		logging.Errorf("Relay disabled, cannot listen on %s: %v", c.Listen, err)
+		return func() {}
+	}
+	logging.Infof("Relaying notifications to machines connecting to %s.", server.Addr())
+
+	unsubscribe := bus.Subscribe("relay", events.NotificationSent, func(_ context.Context, e events.Event) {
+		server.Publish(relay.Notification{Account: e.Account, Title: e.Title, Message: e.Message, Sent: e.Time})
+	})
+	return func() {
+		unsubscribe()
+		server.Close()
+	}
+}
+
+// runRelayCommand handles "n0tif relay [hub-address]", "n0tif relay key [-rotate]"
+// and "n0tif relay set-key"
+func runRelayCommand(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "key":
+			runRelayKeyCommand(args[1:])
+			return
+		case "set-key":
+			runRelaySetKeyCommand(args[1:])
+			return
+		}
+	}
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: n0tif relay [hub-address] | key [-rotate] | set-key")
+		os.Exit(2)
+	}
+
+	cfg := config.GetDefaultConfig()
+	if path, err := storage.GetConfigPath(); err == nil {
+		settings, err := config.LoadSettings(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		settings.Apply(&cfg)
+	}
+	address := cfg.Relay.Connect
+	if len(args) == 1 {
+		address = args[0]
+	}
+	if address == "" {
+		fmt.Println("Error: no hub to connect to; pass its address or set relay.connect in the settings file.")
+		os.Exit(2)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, relay.DefaultPort)
+	}
+
+	key, err := storage.LoadRelayKey()
+	if errors.Is(err, storage.ErrNoRelayKey) {
+		fmt.Println("Error: no relay key set. Run 'n0tif relay key' on the hub and 'n0tif relay set-key' here.")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The hub's titles already name the account; the flags only change the look
+	identity := resolveNotificationIdentity(config.EmailConfig{
+		Notification: config.NotificationIdentity{AppID: *appID, Icon: *iconPath, Color: *iconColor},
+	})
+	style := toastStyle(cfg.Notifications.Toast)
+	notifyLog := logging.For("notify")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	logging.Infof("Showing the notifications of the hub at %s. Press Ctrl+C to stop.", address)
+
+	wait := relayRetryMin
+	for {
+		connected := time.Now()
+		err := relay.Follow(ctx, address, key, func(n relay.Notification) {
+			notifyLog.Debugf("Relayed notification: '%s'", n.Title)
+			if err := notify.SendWindowsNotification(identity, n.Title, n.Message, true, notify.WithStyle(style)); err != nil {
+				notifyLog.Errorf("Failed to send notification: %v", err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that lasted started a new series of retries
+		if time.Since(connected) > relayRetryMax {
+			wait = relayRetryMin
+		}
+		logging.Warnf("Lost the hub at %s: %v. Connecting again in %v.", address, err, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if wait *= 2; wait > relayRetryMax {
+			wait = relayRetryMax
+		}
+	}
+}
+
+// runRelayKeyCommand handles "n0tif relay key [-rotate]" on the hub
+func runRelayKeyCommand(args []string) {
+	rotate := false
+	switch {
+	case len(args) == 1 && (args[0] == "-rotate" || args[0] == "--rotate"):
+		rotate = true
+	case len(args) > 0:
+		fmt.Fprintln(os.Stderr, "Usage: n0tif relay key [-rotate]")
+		os.Exit(2)
+	}
+
+	key, err := storage.RelayKey(rotate)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(key)
+	if rotate {
+		fmt.Fprintln(os.Stderr, "Set the new key on every client with 'n0tif relay set-key', and restart n0tif here.")
+	}
+}
+
+// runRelaySetKeyCommand handles "n0tif relay set-key" on a client
+func runRelaySetKeyCommand(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: n0tif relay set-key")
+		os.Exit(2)
+	}
+	key, err := promptSecret("Relay key (from 'n0tif relay key' on the hub): ", relayKeyEnvVar, false)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := storage.SetRelayKey(key); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Relay key saved.")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// configWatchInterval is how often the settings file is polled for changes
+const configWatchInterval = 2 * time.Second
+
+// configReloader re-reads the settings file of the active profile and hands the
+// updated configuration to the running monitor
+type configReloader struct {
+	path  string
+	apply func(config.Config)
+
+	mu  sync.Mutex
+	cfg config.Config
+}
+
+// startConfigReloader reloads the settings whenever the file changes or SIGHUP is received.
+// Settings from the file win over command-line flags once the file is edited.
+func startConfigReloader(cfg config.Config, apply func(config.Config)) *configReloader {
+	path, err := storage.GetConfigPath()
+	if err != nil {
+		logging.Warnf("Config hot reload disabled, cannot locate settings file: %v", err)
+		return nil
+	}
+
+	r := &configReloader{path: path, apply: apply, cfg: cfg}
+	config.WatchFile(path, configWatchInterval, func() {
+		logging.Infof("Settings file %s changed, reloading...", path)
+		r.Reload()
+	})
+
+	// SIGHUP is the conventional reload signal; Windows never delivers it
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			logging.Infof("SIGHUP received, reloading settings...")
+			r.Reload()
+		}
+	}()
+
+	logging.Infof("Watching %s for settings changes.", path)
+	return r
+}
+
+// Reload re-reads the settings file and applies it. An unreadable or invalid
+// file keeps the current configuration running.
+func (r *configReloader) Reload() error {
+	settings, err := config.LoadSettings(r.path)
+	if err != nil {
+		logging.Warnf("Reload failed, keeping current settings: %v", err)
+		return err
+	}
+
+	r.mu.Lock()
+	cfg := r.cfg
+	settings.Apply(&cfg)
+	applyRemoteSettings(&cfg)
+	if problems := cfg.Validate(); len(problems) > 0 {
+		r.mu.Unlock()
+		for _, p := range problems {
+			logging.Warnf("Reload failed, keeping current settings: %v", p)
+		}
+		return problems[0]
+	}
+	r.cfg = cfg
+	r.mu.Unlock()
+
+	r.apply(cfg)
+	logging.Infof("Settings reloaded (check interval: %ds, do-not-disturb calendar set: %t).",
+		cfg.Email.CheckInterval, cfg.DoNotDisturb.CalendarURL != "")
+	return nil
+}
+
+// runReloadCommand handles "n0tif reload": the running instance re-reads its
+// settings file right away, e.g. after it was replaced by a tool that keeps the
+// modification time
+func runReloadCommand(args []string) {
+	sendControlCommand("reload", "")
+	fmt.Println("Settings reloaded.")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// reminderCheckInterval is how often due reminders are looked for
+const reminderCheckInterval = time.Minute
+
+// agingReminders notifies once more of email still unread a while after its
+// notification. The emails waiting are kept in reminders.json, so a restart
+// doesn't forget them, and their flags are checked on the server when due.
+type agingReminders struct {
+	account *liveAccount
+	log     *logging.Logger
+	send    func(title, message string, emails []storage.MessageRecord) error
+
+	mu      sync.Mutex
+	after   time.Duration // 0 while reminders are off
+	pending []storage.Reminder
+}
+
+// newAgingReminders starts the reminders of cfg for account; send shows a reminder
+func newAgingReminders(account *liveAccount, cfg config.NotificationsConfig, send func(title, message string, emails []storage.MessageRecord) error) *agingReminders {
+	r := &agingReminders{account: account, log: logging.For("reminders").With("account", account.get().Username), send: send}
+	pending, err := storage.LoadReminders()
+	if err != nil {
+		r.log.Warnf("Failed to read pending reminders: %v", err)
+	}
+	r.pending = pending
+	r.update(cfg)
+	go r.run()
+	return r
+}
+
+// update applies a changed reminder delay. Turning reminders off forgets those pending.
+func (r *agingReminders) update(cfg config.NotificationsConfig) {
+	after := time.Duration(cfg.RemindAfterMinutes) * time.Minute
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if after == r.after {
+		return
+	}
+	r.after = after
+	if after > 0 {
+		r.log.Infof("Reminding of email still unread after %s.", reminderAge(after))
+		return
+	}
+	r.log.Infof("Aging reminders disabled.")
+	if len(r.pending) > 0 {
+		r.pending = nil
+		r.saveLocked()
+	}
+}
+
+// add schedules reminders of emails, which were just notified of
+func (r *agingReminders) add(emails []storage.MessageRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.after <= 0 || len(emails) == 0 {
+		return
+	}
+	due := time.Now().Add(r.after)
+	for _, m := range emails {
+		r.pending = append(r.pending, storage.Reminder{Mailbox: m.Mailbox, UID: m.UID, From: m.From, Subject: m.Subject, Due: due})
+	}
+	r.saveLocked()
+}
+
+func (r *agingReminders) saveLocked() {
+	if err := storage.SaveReminders(r.pending); err != nil {
+		r.log.Warnf("Failed to save pending reminders: %v", err)
+	}
+}
+
+// run looks for due reminders every reminderCheckInterval
+func (r *agingReminders) run() {
+	ticker := time.NewTicker(reminderCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.remind(time.Now())
+	}
+}
+
+// remind notifies of the reminders due at now whose email is still unread.
+// Email read or gone is dropped; if the server can't be asked, the reminders
+// wait for the next round.
+func (r *agingReminders) remind(now time.Time) {
+	r.mu.Lock()
+	after := r.after
+	var due []storage.Reminder
+	for _, p := range r.pending {
+		if !p.Due.After(now) {
+			due = append(due, p)
+		}
+	}
+	r.mu.Unlock()
+	if after <= 0 || len(due) == 0 {
+		return
+	}
+
+	uids := make(map[string][]uint32)
+	for _, p := range due {
+		uids[p.Mailbox] = append(uids[p.Mailbox], p.UID)
+	}
+	unseen := make(map[string]map[uint32]bool, len(uids))
+	for mailbox, list := range uids {
+		found, err := email.Unseen(r.account.get(), mailbox, list)
+		if err != nil {
+			r.log.Warnf("Could not check whether %d email(s) were read, trying again later: %v", len(list), err)
+			return
+		}
+		unseen[mailbox] = found
+	}
+
+	// Newest first, like every other notification of email
+	var unread []storage.MessageRecord
+	for i := len(due) - 1; i >= 0; i-- {
+		p := due[i]
+		if unseen[p.Mailbox][p.UID] {
+			unread = append(unread, storage.MessageRecord{Account: r.account.get().Username, Mailbox: p.Mailbox, UID: p.UID, From: p.From, Subject: p.Subject})
+		}
+	}
+	r.mu.Lock()
+	kept := r.pending[:0]
+	for _, p := range r.pending {
+		if p.Due.After(now) {
+			kept = append(kept, p)
+		}
+	}
+	r.pending = kept
+	r.saveLocked()
+	r.mu.Unlock()
+
+	if len(unread) == 0 {
+		r.log.Debugf("%d email(s) due for a reminder were read meanwhile", len(due))
+		return
+	}
+	title, message := reminderNotification(after, unread)
+	if err := r.send(title, message, unread); err != nil {
+		r.log.Warnf("Failed to show reminder: %v", err)
+	}
+}
+
+// reminderNotification phrases a reminder of emails, newest first, e.g.
+// "Still unread after 2h" and "'Contract for signature' from Alice"
+func reminderNotification(after time.Duration, emails []storage.MessageRecord) (title, message string) {
+	age := reminderAge(after)
+	newest := emails[0]
+	subject := newest.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	if len(emails) == 1 {
+		return "Still unread after " + age, fmt.Sprintf("'%s' from %s", subject, storage.SenderName(newest.From))
+	}
+	return fmt.Sprintf("%d emails still unread after %s", len(emails), age), fmt.Sprintf("Most recent: '%s' from %s", subject, storage.SenderName(newest.From))
+}
+
+// reminderAge renders d in hours and minutes, e.g. "2h" or "1h30m"
+func reminderAge(d time.Duration) string {
+	s := d.Round(time.Minute).String()
+	s = strings.TrimSuffix(s, "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/remote"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// applyRemoteSettings overlays the cached remotely managed settings onto cfg.
+// They win over the local settings file; flags still override both.
+func applyRemoteSettings(cfg *config.Config) {
+	if cfg.Remote.URL == "" {
+		return
+	}
+	path, err := storage.GetRemoteConfigPath()
+	if err != nil {
+		logging.Warnf("Failed to locate remote settings cache: %v", err)
+		return
+	}
+	settings, err := remote.LoadCached(path, cfg.Remote)
+	if err != nil {
+		logging.Warnf("Ignoring cached remote settings: %v", err)
+		return
+	}
+	if settings != nil {
+		settings.Apply(cfg)
+	}
+}
+
+// startRemoteSettings keeps the remote settings cache current and reloads the
+// configuration when it changes. It returns a function that stops polling.
+func startRemoteSettings(cfg config.Config, reloader *configReloader) (stop func()) {
+	if cfg.Remote.URL == "" || reloader == nil {
+		return func() {}
+	}
+	path, err := storage.GetRemoteConfigPath()
+	if err != nil {
+		logging.Warnf("Remote settings disabled, cannot locate cache: %v", err)
+		return func() {}
+	}
+	logging.Infof("Fetching managed settings from %s every %v.", cfg.Remote.URL, cfg.Remote.Refresh())
+	return remote.Watch(cfg.Remote, path, func() { reloader.Reload() })
+}
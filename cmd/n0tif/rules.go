@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/mail"
+	"strings"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/rules"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// compiledRule is a rule of the settings file with its condition compiled
+type compiledRule struct {
+	when   *rules.Expr
+	action string
+	toast  *config.ToastStyle // nil for the usual notification
+	push   []string           // names of the push channels the email is forwarded to
+}
+
+// ruleSet decides by the rules of the settings file which new emails are notified of
+type ruleSet struct {
+	log *logging.Logger
+
+	mu    sync.Mutex
+	rules []compiledRule
+}
+
+// newRuleSet compiles the rules of cfg
+func newRuleSet(cfg []config.RuleConfig) *ruleSet {
+	s := &ruleSet{log: logging.For("rules")}
+	s.update(cfg)
+	return s
+}
+
+// update recompiles the rules. A rule that does not compile is left out and
+// reported; config check and reloading catch those before they get here.
+func (s *ruleSet) update(cfg []config.RuleConfig) {
+	var compiled []compiledRule
+	for i, r := range cfg {
+		when, err := rules.Compile(r.When)
+		if err != nil {
+			s.log.Warnf("Rule %d disabled: %v", i+1, err)
+			continue
+		}
+		compiled = append(compiled, compiledRule{when: when, action: r.Action, toast: r.Toast, push: r.Push})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(compiled) != len(s.rules) {
+		s.log.Infof("%d rule(s) enabled.", len(compiled))
+	}
+	s.rules = compiled
+}
+
+// filter returns the emails to notify of, leaving out those the first matching rule ignores
+func (s *ruleSet) filter(emails []storage.MessageRecord) []storage.MessageRecord {
+	s.mu.Lock()
+	compiled := s.rules
+	s.mu.Unlock()
+	if len(compiled) == 0 {
+		return emails
+	}
+
+	var kept []storage.MessageRecord
+	for _, m := range emails {
+		e := ruleEmail(m)
+		action := config.RuleNotify
+		for _, r := range compiled {
+			if r.when.Match(e) {
+				s.log.Debugf("Rule %q matched %s/%d: %s", r.when, m.Mailbox, m.UID, r.action)
+				action = r.action
+				break
+			}
+		}
+		if action != config.RuleIgnore {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// toast returns the toast style of the first rule matching m, or nil if that
+// rule has none and m goes into the usual notification
+func (s *ruleSet) toast(m storage.MessageRecord) *config.ToastStyle {
+	if r := s.first(m); r != nil {
+		return r.toast
+	}
+	return nil
+}
+
+// push returns the names of the push channels the first rule matching m forwards it to
+func (s *ruleSet) push(m storage.MessageRecord) []string {
+	if r := s.first(m); r != nil {
+		return r.push
+	}
+	return nil
+}
+
+// first returns the first rule matching m, or nil
+func (s *ruleSet) first(m storage.MessageRecord) *compiledRule {
+	s.mu.Lock()
+	compiled := s.rules
+	s.mu.Unlock()
+
+	e := ruleEmail(m)
+	for i := range compiled {
+		if compiled[i].when.Match(e) {
+			return &compiled[i]
+		}
+	}
+	return nil
+}
+
+// ruleEmail is what the conditions of rules see of m
+func ruleEmail(m storage.MessageRecord) rules.Email {
+	e := rules.Email{
+		Account: m.Account,
+		Mailbox: m.Mailbox,
+		UID:     m.UID,
+		From:    strings.TrimSpace(m.From),
+		Subject: m.Subject,
+		Date:    m.Date,
+	}
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		e.From, e.Name = addr.Address, addr.Name
+	}
+	return e
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/scripting"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// emailScripts runs the Lua scripts of the scripts folder on new email
+type emailScripts struct {
+	log *logging.Logger
+
+	mu     sync.Mutex
+	engine *scripting.Engine
+}
+
+// newEmailScripts loads the scripts of the active profile
+func newEmailScripts() *emailScripts {
+	s := &emailScripts{log: logging.For("scripts")}
+	s.reload()
+	return s
+}
+
+// reload loads the scripts again, so edits apply on the next reload of the settings.
+// A script that fails to load is left out and reported; the others still run.
+func (s *emailScripts) reload() {
+	dir, err := storage.GetScriptsFolder()
+	if err != nil {
+		s.log.Warnf("Scripts disabled, cannot locate the scripts folder: %v", err)
+		return
+	}
+	engine, err := scripting.Load(dir, s.log)
+	if err != nil {
+		s.log.Warnf("Script disabled: %v", err)
+	}
+	if engine == nil {
+		return
+	}
+
+	s.mu.Lock()
+	old := s.engine
+	s.engine = engine
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	if engine.Len() > 0 || (old != nil && old.Len() > 0) {
+		s.log.Infof("%d script(s) loaded from %s.", engine.Len(), dir)
+	}
+}
+
+// decide runs the scripts on emails, returning the emails to notify of with
+// what the scripts decided about each
+func (s *emailScripts) decide(ctx context.Context, emails []storage.MessageRecord) ([]storage.MessageRecord, []scripting.Decision) {
+	s.mu.Lock()
+	engine := s.engine
+	s.mu.Unlock()
+
+	if engine == nil || engine.Len() == 0 {
+		return emails, make([]scripting.Decision, len(emails))
+	}
+
+	var kept []storage.MessageRecord
+	var decisions []scripting.Decision
+	for _, m := range emails {
+		d, err := engine.OnEmail(ctx, m)
+		if err != nil {
+			s.log.Warnf("Script failed on %s/%d: %v", m.Mailbox, m.UID, err)
+		}
+		if d.Suppress {
+			s.log.Debugf("Scripts suppressed the notification of %s/%d", m.Mailbox, m.UID)
+			continue
+		}
+		kept = append(kept, m)
+		decisions = append(decisions, d)
+	}
+	return kept, decisions
+}
+
+// checkScripts reports the scripts of the active profile that fail to load
+func checkScripts() []error {
+	dir, err := storage.GetScriptsFolder()
+	if err != nil {
+		return []error{err}
+	}
+	err = scripting.Check(dir)
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	if err != nil {
+		return []error{err}
+	}
+	return nil
+}
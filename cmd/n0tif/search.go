@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// runSearchCommand handles "n0tif search [-n 20] <query>"
+func runSearchCommand(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Maximum number of results")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] search [-n 20] <text in sender or subject>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+
+	if err := openConfiguredBackend(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer storage.CloseBackend()
+
+	results, err := storage.SearchMessages(query, *limit)
+	if err != nil {
+		fmt.Printf("Search failed: %v\n", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 && !*jsonOutput {
+		fmt.Println("No matching messages in the arrival history.")
+		return
+	}
+
+	printMessages(results)
+}
+
+// runHistoryCommand handles "n0tif history [-n 20] [-json]"
+func runHistoryCommand(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Number of messages to show")
+	fs.BoolVar(jsonOutput, "json", *jsonOutput, "Print the messages as JSON (same as the global -json)")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] history [-n 20] [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := openConfiguredBackend(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer storage.CloseBackend()
+
+	results, err := storage.SearchMessages("", *limit)
+	if err != nil {
+		fmt.Printf("Failed to read history: %v\n", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 && !*jsonOutput {
+		fmt.Println("The arrival history is empty.")
+		return
+	}
+	printMessages(results)
+}
+
+// printMessages lists messages one per line, or as JSON with -json
+func printMessages(results []storage.MessageRecord) {
+	if *jsonOutput {
+		if results == nil {
+			results = []storage.MessageRecord{}
+		}
+		printJSON(results)
+		return
+	}
+	for _, m := range results {
+		fmt.Printf("%s  %-30s  %s\n", m.Date.Local().Format("2006-01-02 15:04"), truncate(m.From, 30), m.Subject)
+	}
+	fmt.Printf("\n%d message(s) shown, newest first.\n", len(results))
+}
+
+// openConfiguredBackend opens the storage backend chosen by the -storage flag or the
+// settings file, without requiring credentials the way a full config load does
+func openConfiguredBackend() error {
+	backend := config.GetDefaultConfig().StorageBackend
+	if path, err := storage.GetConfigPath(); err == nil {
+		if settings, err := config.LoadSettings(path); err == nil && settings.StorageBackend != "" {
+			backend = settings.StorageBackend
+		}
+	}
+	if flagWasSet("storage") {
+		backend = *storageType
+	}
+	return storage.OpenBackend(backend)
+}
+
+// truncate shortens s to at most n runes, marking the cut with "..."
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(r[:n])
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -1,30 +1,56 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
 	"github.com/kardianos/service"
 )
 
-// Define service configuration
-var serviceConfig = &service.Config{
-	Name:        "N0tifEmailService",
-	DisplayName: "N0tif Email Notification Service",
-	Description: "Checks for new emails and sends Windows notifications",
+// serviceLog tags the lines about the service with its component
+var serviceLog = logging.For("service")
+
+// newServiceConfig returns the service configuration for the active profile.
+// Each profile is installed as its own service so they can run side by side.
+func newServiceConfig() *service.Config {
+	cfg := &service.Config{
+		Name:        "N0tifEmailService",
+		DisplayName: "N0tif Email Notification Service",
+		Description: "Checks for new emails and sends Windows notifications",
+		Arguments:   []string{"service", "run"},
+	}
+	if p := storage.Profile(); p != "" {
+		cfg.Name += "-" + p
+		cfg.DisplayName += " (" + p + ")"
+		cfg.Arguments = []string{"-profile", p, "service", "run"}
+	}
+	if storage.Portable() {
+		cfg.Arguments = append([]string{"-portable"}, cfg.Arguments...)
+	}
+	if flagWasSet("log-level") {
+		cfg.Arguments = append([]string{"-log-level", *logLevel}, cfg.Arguments...)
+	}
+	if flagWasSet("log-format") {
+		cfg.Arguments = append([]string{"-log-format", *logFormatFlag}, cfg.Arguments...)
+	}
+	configureService(cfg)
+	return cfg
 }
 
 // Service struct to hold state
 type n0tifService struct {
-	emailCfg config.EmailConfig
-	logger   service.Logger
+	cfg    config.Config
+	logger service.Logger
 }
 
 // Start implements the service.Service interface
 func (s *n0tifService) Start(svc service.Service) error {
+	serviceLog.Eventf(logging.LevelInfo, "N0tif service started (%s).", currentBuildInfo())
 	// Start should not block. Do the work in a goroutine.
 	go s.run()
 	return nil
@@ -33,57 +59,47 @@ func (s *n0tifService) Start(svc service.Service) error {
 // Stop implements the service.Service interface
 func (s *n0tifService) Stop(svc service.Service) error {
 	// Perform cleanup tasks if any
-	log.Println("N0tif service stopping.")
+	serviceLog.Eventf(logging.LevelInfo, "N0tif service stopping.")
 	return nil
 }
 
 // run does the actual work of monitoring emails
 func (s *n0tifService) run() {
 	// The service is inherently a daemon, so pass true for daemonMode.
-	// The EmailConfig is now directly available in s.emailCfg.
-	log.Println("N0tif service run method executing runEmailMonitor.")
-	runEmailMonitor(s.emailCfg)
+	// The Config is now directly available in s.cfg.
+	serviceLog.Debugf("N0tif service run method executing runEmailMonitor.")
+	runningAsService = true
+	runEmailMonitor(s.cfg)
 }
 
 // setupServiceLogging configures logging to go to both the service log and our custom log file
 func setupServiceLogging(svc service.Service) {
-	// Get service logger
-	var err error
-	_, err = svc.Logger(nil)
-	if err != nil {
-		log.Printf("Failed to get service logger: %v", err)
+	// Started by the service manager, lifecycle events and failures also go to the
+	// system log (the Windows Event Log on Windows); interactively they would only
+	// repeat on the console what the log file already has
+	if !service.Interactive() {
+		if eventLog, err := svc.SystemLogger(nil); err != nil {
+			serviceLog.Errorf("Failed to get service logger: %v", err)
+		} else {
+			logging.SetEventLog(eventLog)
+		}
 	}
 
 	// Configure custom log file as well, this will be used by runEmailMonitor
-	appDataDir := os.Getenv("APPDATA")
-	logDir := filepath.Join(appDataDir, "n0tif")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		log.Printf("Failed to create log directory: %v", err)
-		return
-	}
-
-	logFile := filepath.Join(logDir, "n0tif.log")
-	f, err := os.OpenFile(logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Printf("Failed to open log file: %v", err)
+	if err := setupLogFile(); err != nil {
+		serviceLog.Errorf("Failed to open log file: %v", err)
 		return
 	}
-
-	// Set standard log output to this file. This will be used by runEmailMonitor.
-	log.SetOutput(f)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	log.Println("Service logging configured to file.")
+	serviceLog.Debugf("Service logging configured to file.")
 }
 
-// runAsWindowsService attempts to run the program as a Windows service
-// Takes resolved EmailConfig now
-func runAsWindowsService(emailCfg config.EmailConfig, installAndStart bool, serviceArgs []string) {
+// runAsService attempts to run the program as a service of the platform's service manager
+// Takes resolved Config now
+func runAsService(cfg config.Config, installAndStart bool, serviceArgs []string) {
 	prg := &n0tifService{
-		emailCfg: emailCfg,
+		cfg: cfg,
 	}
-	svc, err := service.New(prg, serviceConfig)
+	svc, err := service.New(prg, newServiceConfig())
 	if err != nil {
 		log.Fatalf("Failed to create service: %v", err)
 	}
@@ -111,31 +127,72 @@ func runAsWindowsService(emailCfg config.EmailConfig, installAndStart bool, serv
 		// Default install and start logic if no specific control action
 		status, errStatus := svc.Status()
 		if errStatus != nil { // Error means service is likely not installed
-			log.Println("Service not found or status error, attempting to install...")
+			serviceLog.Infof("Service not found or status error, attempting to install...")
 			if errInstall := svc.Install(); errInstall != nil {
 				log.Fatalf("Failed to install service: %v", errInstall)
 			}
-			log.Println("Service installed successfully.")
+			serviceLog.Infof("Service installed successfully.")
 			status = service.StatusStopped // Assume it's stopped after install
 		}
 
 		if status != service.StatusRunning {
-			log.Println("Service not running, attempting to start...")
+			serviceLog.Infof("Service not running, attempting to start...")
 			if errStart := svc.Start(); errStart != nil {
 				log.Fatalf("Failed to start service: %v", errStart)
 			}
-			log.Println("Service started successfully.")
+			serviceLog.Infof("Service started successfully.")
 		} else {
-			log.Println("Service is already running.")
+			serviceLog.Infof("Service is already running.")
 		}
 		fmt.Println("N0tif service is configured and running.")
-		fmt.Printf("Logs are at: %s\\n0tif\\n0tif.log\n", os.Getenv("APPDATA"))
+		logPath, _ := storage.GetLogPath()
+		fmt.Printf("Logs are at: %s\n", logPath)
 		return
 	}
 
-	// If not installing/starting, just run the service (e.g., when SCM starts it)
-	log.Println("Running service directly (e.g., started by SCM).")
+	// If not installing/starting, just run the service (e.g., when SCM starts it).
+	// The configuration is loaded only now so that failures, such as credentials that
+	// can't be decrypted, reach the log file and the event log.
+	serviceLog.Infof("Running service directly (e.g., started by SCM).")
+	prg.cfg = loadAppConfig()
 	if errRun := svc.Run(); errRun != nil {
 		log.Fatalf("Failed to run service: %v", errRun)
 	}
 }
+
+// restartRunningService restarts the service of the active profile when it is
+// installed and running, and reports whether it was
+func restartRunningService() (bool, error) {
+	svc, err := service.New(&n0tifService{}, newServiceConfig())
+	if err != nil {
+		return false, err
+	}
+	if status, err := svc.Status(); err != nil || status != service.StatusRunning {
+		return false, nil
+	}
+	return true, svc.Restart()
+}
+
+// printServiceStatus prints whether the service of the active profile is installed and running
+func printServiceStatus() {
+	cfg := newServiceConfig()
+	svc, err := service.New(&n0tifService{}, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	status, err := svc.Status()
+	switch {
+	case errors.Is(err, service.ErrNotInstalled):
+		fmt.Printf("The %s %s is not installed.\n", serviceKind, cfg.Name)
+		os.Exit(3)
+	case err != nil:
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	case status == service.StatusRunning:
+		fmt.Printf("The %s %s is running.\n", serviceKind, cfg.Name)
+	default:
+		fmt.Printf("The %s %s is installed but not running.\n", serviceKind, cfg.Name)
+		os.Exit(3)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/kardianos/service"
+)
+
+// serviceKind names the kind of service n0tif installs on this platform
+const serviceKind = "launchd agent"
+
+// serviceNeedsAdmin is set where installing and managing the service needs elevation.
+// A launchd agent lives in ~/Library/LaunchAgents and belongs to the user.
+const serviceNeedsAdmin = false
+
+// configureService adds the platform specific settings to the service configuration.
+// As an agent, n0tif runs in the user's login session, where notifications can be shown.
+func configureService(cfg *service.Config) {
+	cfg.Description = "Checks for new emails and sends desktop notifications"
+	cfg.Option = service.KeyValue{
+		"UserService": true,
+		"RunAtLoad":   true, // start at login
+		"KeepAlive":   true, // restart after a crash
+	}
+	// Output that bypasses the log file, e.g. a panic, lands next to it
+	if dir, err := storage.GetLogFolder(); err != nil {
+		serviceLog.Warnf("Cannot locate the log folder for the agent's output: %v", err)
+	} else {
+		cfg.Option["LogDirectory"] = dir
+	}
+}
+
+// isAdmin reports whether the process runs as root
+func isAdmin() bool {
+	return os.Geteuid() == 0
+}
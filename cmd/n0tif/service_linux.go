@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+
+	"github.com/kardianos/service"
+)
+
+// serviceKind names the kind of service n0tif installs on this platform
+const serviceKind = "systemd user service"
+
+// serviceNeedsAdmin is set where installing and managing the service needs elevation.
+// A user service lives in ~/.config/systemd/user and is managed with systemctl --user.
+const serviceNeedsAdmin = false
+
+// systemdUserUnit is the unit file of the service. The stock kardianos template is
+// written for system services; a user unit has to be wanted by default.target and
+// runs in the user's session, where the desktop notifications are shown.
+const systemdUserUnit = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+
+[Service]
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
+Restart={{.Restart}}
+RestartSec=30
+
+[Install]
+WantedBy=default.target
+`
+
+// configureService adds the platform specific settings to the service configuration
+func configureService(cfg *service.Config) {
+	cfg.Description = "Checks for new emails and sends desktop notifications"
+	cfg.Option = service.KeyValue{
+		"UserService":   true,
+		"SystemdScript": systemdUserUnit,
+		"ReloadSignal":  "HUP", // reloads the settings file, see startConfigReloader
+		"Restart":       "on-failure",
+	}
+}
+
+// isAdmin reports whether the process runs as root
+func isAdmin() bool {
+	return os.Geteuid() == 0
+}
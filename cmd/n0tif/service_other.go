@@ -0,0 +1,23 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import (
+	"os"
+
+	"github.com/kardianos/service"
+)
+
+// serviceKind names the kind of service n0tif installs on this platform
+const serviceKind = "system service"
+
+// serviceNeedsAdmin is set where installing and managing the service needs elevation
+const serviceNeedsAdmin = true
+
+// configureService adds the platform specific settings to the service configuration
+func configureService(cfg *service.Config) {}
+
+// isAdmin reports whether the process runs as root
+func isAdmin() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/kardianos/service"
+	"golang.org/x/sys/windows"
+)
+
+// serviceKind names the kind of service n0tif installs on this platform
+const serviceKind = "Windows service"
+
+// serviceNeedsAdmin is set where installing and managing the service needs elevation
+const serviceNeedsAdmin = true
+
+// configureService adds the platform specific settings to the service configuration.
+// Delayed automatic start lets Windows bring up the network before n0tif starts.
+func configureService(cfg *service.Config) {
+	cfg.Option = service.KeyValue{
+		"DelayedAutoStart": true,
+	}
+}
+
+// isAdmin checks if the current process is running with administrator privileges on Windows.
+func isAdmin() bool {
+	token := windows.GetCurrentProcessToken()
+	// GetCurrentProcessToken itself doesn't return an error directly in this form,
+	// but it returns a pseudo-handle. The operations on the token will fail if it's invalid.
+	// IsElevated() will handle this gracefully if the token is problematic.
+	// No explicit defer token.Close() is needed for the handle from GetCurrentProcessToken().
+	return token.IsElevated()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// statsTopSenders is how many of the busiest senders "n0tif stats" lists
+const statsTopSenders = 10
+
+// statsReport is the -json output of "n0tif stats"
+type statsReport struct {
+	*storage.UsageStats
+	Clicks []storage.SenderClicks `json:"clicks"` // most notified sender first
+}
+
+// runStatsCommand handles "n0tif stats [-days 7]"
+func runStatsCommand(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	days := fs.Int("days", 7, "Number of days to sum up, today included")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] [-json] stats [-days 7]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *days < 1 {
+		fmt.Println("Error: -days must be at least 1")
+		os.Exit(2)
+	}
+
+	if err := openConfiguredBackend(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer storage.CloseBackend()
+
+	since := time.Now().AddDate(0, 0, -(*days - 1))
+	stats, err := storage.Usage(since)
+	if err != nil {
+		fmt.Printf("Failed to read usage statistics: %v\n", err)
+		os.Exit(1)
+	}
+	clicks, err := storage.Clicks(since)
+	if err != nil {
+		fmt.Printf("Failed to read click statistics: %v\n", err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		printJSON(statsReport{UsageStats: stats, Clicks: clicks})
+		return
+	}
+	if stats.Total == 0 {
+		fmt.Printf("No email arrived in the last %d day(s).\n", *days)
+		return
+	}
+
+	fmt.Printf("%d email(s) in the last %d day(s)\n", stats.Total, *days)
+
+	fmt.Println("\nBy day:")
+	for _, d := range stats.Days {
+		fmt.Printf("  %s  %5d  %s\n", d.Day, d.Emails, bar(d.Emails, stats.Total))
+	}
+
+	fmt.Println("\nBy hour:")
+	busiest := 0
+	for _, n := range stats.Hours {
+		busiest = max(busiest, n)
+	}
+	for hour, n := range stats.Hours {
+		if n > 0 {
+			fmt.Printf("  %02d:00  %5d  %s\n", hour, n, bar(n, busiest))
+		}
+	}
+
+	fmt.Println("\nTop senders:")
+	for i, s := range stats.Senders {
+		if i == statsTopSenders {
+			fmt.Printf("  ... and %d more\n", len(stats.Senders)-i)
+			break
+		}
+		fmt.Printf("  %5d  %s\n", s.Emails, truncate(s.Sender, 50))
+	}
+
+	if len(clicks) == 0 {
+		return
+	}
+	// A notification that wasn't clicked was dismissed or expired; Windows doesn't tell which
+	fmt.Println("\nNotifications clicked:")
+	fmt.Printf("  %5s  %-10s  %s\n", "shown", "clicked", "sender")
+	for i, c := range clicks {
+		if i == statsTopSenders {
+			fmt.Printf("  ... and %d more\n", len(clicks)-i)
+			break
+		}
+		clicked := fmt.Sprintf("%d (%d%%)", c.Clicked, percent(c.Clicked, c.Shown))
+		fmt.Printf("  %5d  %-10s  %s\n", c.Shown, clicked, truncate(c.Sender, 50))
+	}
+}
+
+// percent is n as a whole percentage of total, capped at 100
+func percent(n, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return min(n*100/total, 100)
+}
+
+// bar draws n relative to total as up to 30 block characters
+func bar(n, total int) string {
+	if total == 0 {
+		return ""
+	}
+	width := n * 30 / total
+	if width == 0 && n > 0 {
+		width = 1
+	}
+	return strings.Repeat("#", width)
+}
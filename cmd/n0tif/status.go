@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// statusReport is what a running monitor answers to the "status" control command
+type statusReport struct {
+	Running       bool            `json:"running"`
+	PID           int             `json:"pid"`
+	Mode          string          `json:"mode"` // foreground, background or service
+	Profile       string          `json:"profile,omitempty"`
+	StartedAt     time.Time       `json:"started_at"`
+	Storage       string          `json:"storage"`
+	StoragePaused bool            `json:"storage_paused"`
+	LogLevel      string          `json:"log_level,omitempty"`
+	Power         string          `json:"power,omitempty"` // e.g. "on battery, 45%"; empty if unknown
+	Accounts      []accountStatus `json:"accounts"`
+}
+
+// accountStatus describes the checking of one account
+type accountStatus struct {
+	Name               string      `json:"name,omitempty"`
+	Username           string      `json:"username"`
+	Server             string      `json:"server"`
+	LastCheck          time.Time   `json:"last_check"`
+	LastError          string      `json:"last_error,omitempty"`
+	LastSuccess        time.Time   `json:"last_success"`
+	CheckInterval      int         `json:"check_interval"` // in seconds
+	NextCheck          time.Time   `json:"next_check"`
+	Paused             bool        `json:"paused"`
+	PausedUntil        time.Time   `json:"paused_until,omitempty"`
+	Offline            string      `json:"offline,omitempty"`         // why checks wait for the network
+	ThrottledUntil     time.Time   `json:"throttled_until,omitempty"` // checks wait for the provider's limit until then
+	NotificationsToday int         `json:"notifications_today"`
+	Unread             *int        `json:"unread,omitempty"` // unread messages in INBOX; nil before they are counted
+	Data               *dataStatus `json:"data,omitempty"`   // data exchanged with the server; nil if it can't be read
+}
+
+// dailyCounter counts events per local calendar day
+type dailyCounter struct {
+	mu    sync.Mutex
+	day   string
+	count int
+}
+
+// Add counts one event now
+func (c *dailyCounter) Add() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	today := time.Now().Format("2006-01-02")
+	if c.day != today {
+		c.day, c.count = today, 0
+	}
+	c.count++
+}
+
+// countNotifications counts the notifications published on bus in c and records them in the history
+func countNotifications(bus *events.Bus, c *dailyCounter) {
+	bus.Subscribe("history", events.NotificationSent, func(_ context.Context, e events.Event) {
+		c.Add()
+		record := storage.NotificationRecord{
+			Account: e.Account,
+			SentAt:  e.Time,
+			Title:   e.Title,
+			Message: e.Message,
+		}
+		if err := storage.RecordNotification(record); err != nil {
+			logging.Warnf("Failed to record notification history: %v", err)
+		}
+	})
+}
+
+// Today returns the number of events counted today
+func (c *dailyCounter) Today() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.day != time.Now().Format("2006-01-02") {
+		return 0
+	}
+	return c.count
+}
+
+// monitorMode names how the running monitor was started
+func monitorMode() string {
+	switch {
+	case runningAsService:
+		return "service"
+	case *isDaemon:
+		return "background"
+	default:
+		return "foreground"
+	}
+}
+
+// runStatusCommand handles "n0tif status [-json]". It exits with status 3 when n0tif isn't running.
+func runStatusCommand(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.BoolVar(jsonOutput, "json", *jsonOutput, "Print the report as JSON (same as the global -json)")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif [-profile name] status [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	reply, err := control.Call(appFolder, "status", controlTimeout)
+	if errors.Is(err, control.ErrNotRunning) {
+		if *jsonOutput {
+			printJSON(struct {
+				Running bool `json:"running"`
+			}{})
+		} else if pid, err := storage.ReadPIDFile(); err == nil && processAlive(pid) {
+			// Still starting up, e.g. waiting for the network before its first check
+			fmt.Printf("n0tif is starting for this profile (PID %d) and not answering yet.\n", pid)
+		} else {
+			fmt.Println("n0tif is not running for this profile.")
+		}
+		os.Exit(3)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var report statusReport
+	if err := json.Unmarshal([]byte(reply), &report); err != nil {
+		fmt.Printf("Error: unexpected status reply: %v\n", err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		printJSON(report)
+		return
+	}
+	printStatus(report, time.Now())
+}
+
+func printStatus(r statusReport, now time.Time) {
+	fmt.Printf("n0tif is running (%s, PID %d)\n", r.Mode, r.PID)
+	fmt.Printf("  Uptime:   %s (since %s)\n", formatDuration(now.Sub(r.StartedAt)), r.StartedAt.Local().Format("2006-01-02 15:04"))
+	storageLine := r.Storage
+	if r.StoragePaused {
+		storageLine += " (paused)"
+	}
+	fmt.Printf("  Storage:  %s\n", storageLine)
+	if r.LogLevel != "" {
+		fmt.Printf("  Logging:  %s\n", r.LogLevel)
+	}
+	if r.Power != "" {
+		fmt.Printf("  Power:    %s\n", r.Power)
+	}
+
+	for _, a := range r.Accounts {
+		label := a.Username
+		if a.Name != "" {
+			label = fmt.Sprintf("%s (%s)", a.Name, a.Username)
+		}
+		fmt.Printf("\nAccount %s on %s\n", label, a.Server)
+		if a.LastCheck.IsZero() {
+			fmt.Println("  Last check:          not yet")
+		} else {
+			fmt.Printf("  Last check:          %s (%s ago)\n", a.LastCheck.Local().Format("15:04:05"), formatDuration(now.Sub(a.LastCheck)))
+		}
+		if a.LastError != "" {
+			fmt.Printf("  Last error:          %s\n", a.LastError)
+			if !a.LastSuccess.IsZero() {
+				fmt.Printf("  Last success:        %s (%s ago)\n", a.LastSuccess.Local().Format("2006-01-02 15:04:05"), formatDuration(now.Sub(a.LastSuccess)))
+			}
+		} else if !a.LastCheck.IsZero() {
+			fmt.Println("  Last error:          none")
+		}
+		if a.Offline != "" {
+			fmt.Printf("  Checking:            waiting for the network (%s)\n", a.Offline)
+		} else if a.ThrottledUntil.After(now) {
+			fmt.Printf("  Checking:            throttled by provider, trying again in %s\n", formatDuration(a.ThrottledUntil.Sub(now)))
+		} else if a.Paused {
+			if a.PausedUntil.IsZero() {
+				fmt.Println("  Checking:            paused until 'n0tif resume'")
+			} else {
+				fmt.Printf("  Checking:            paused for %s more\n", formatDuration(a.PausedUntil.Sub(now)))
+			}
+		} else if !a.NextCheck.IsZero() {
+			eta := a.NextCheck.Sub(now)
+			if eta < 0 {
+				eta = 0
+			}
+			fmt.Printf("  Next check in:       %s\n", formatDuration(eta))
+		}
+		fmt.Printf("  Notifications today: %d\n", a.NotificationsToday)
+		if a.Unread != nil {
+			fmt.Printf("  Unread:              %d\n", *a.Unread)
+		}
+		if d := a.Data; d != nil {
+			month := formatBytes(d.Month.Total())
+			if d.MonthlyCap > 0 {
+				month += " of " + formatBytes(d.MonthlyCap)
+			}
+			fmt.Printf("  Data used:           %s last check, %s today, %s this month\n",
+				formatBytes(d.LastCheck.Total()), formatBytes(d.Today.Total()), month)
+		}
+	}
+}
+
+// formatDuration renders d rounded to whole seconds, e.g. "2h3m0s"
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// dailySummary shows a notification summing up the day's email at a set time
+type dailySummary struct {
+	send func(title, message string) error
+
+	mu      sync.Mutex
+	at      string // "HH:MM"; empty while the summary is disabled
+	changed chan struct{}
+}
+
+// newDailySummary starts the summary schedule; send shows the notification
+func newDailySummary(cfg config.AlertsConfig, send func(title, message string) error) *dailySummary {
+	s := &dailySummary{send: send, changed: make(chan struct{}, 1)}
+	s.update(cfg)
+	go s.run()
+	return s
+}
+
+// update applies a changed summary time
+func (s *dailySummary) update(cfg config.AlertsConfig) {
+	s.mu.Lock()
+	if s.at == cfg.DailySummary {
+		s.mu.Unlock()
+		return
+	}
+	s.at = cfg.DailySummary
+	s.mu.Unlock()
+
+	if cfg.DailySummary == "" {
+		logging.Infof("Daily summary disabled.")
+	} else {
+		logging.Infof("Daily summary enabled at %s.", cfg.DailySummary)
+	}
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// next returns when the summary is due after now, or false while it is disabled
+func (s *dailySummary) next(now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	at := s.at
+	s.mu.Unlock()
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, false
+	}
+	due := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !due.After(now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due, true
+}
+
+// run waits for each due time and shows the summary, rescheduling on changes
+func (s *dailySummary) run() {
+	for {
+		due, ok := s.next(time.Now())
+		if !ok {
+			<-s.changed
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-timer.C:
+			s.notify(due)
+		case <-s.changed:
+			timer.Stop()
+		}
+	}
+}
+
+// notify shows the summary of the day of at
+func (s *dailySummary) notify(at time.Time) {
+	stats, err := storage.Usage(at)
+	if err != nil {
+		logging.Warnf("Daily summary: Failed to read usage statistics: %v", err)
+		return
+	}
+	if err := s.send("n0tif daily summary", summaryMessage(stats)); err != nil {
+		logging.Warnf("Daily summary: Failed to show notification: %v", err)
+	}
+}
+
+// summaryMessage phrases a day's statistics, e.g. "Today: 42 emails, busiest sender: GitHub"
+func summaryMessage(stats *storage.UsageStats) string {
+	switch {
+	case stats.Total == 0:
+		return "Today: no new email."
+	case stats.Total == 1:
+		return fmt.Sprintf("Today: 1 email, from %s", stats.Senders[0].Sender)
+	default:
+		return fmt.Sprintf("Today: %d emails, busiest sender: %s", stats.Total, stats.Senders[0].Sender)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// enableVirtualTerminal is a no-op: Unix terminals interpret escape sequences natively
+func enableVirtualTerminal(in, out uintptr) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal makes the console interpret ANSI escape sequences on
+// output and report special keys such as the arrows as escape sequences
+func enableVirtualTerminal(in, out uintptr) error {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(out), &mode); err != nil {
+		return err
+	}
+	if err := windows.SetConsoleMode(windows.Handle(out), mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		return err
+	}
+	if err := windows.GetConsoleMode(windows.Handle(in), &mode); err != nil {
+		return err
+	}
+	return windows.SetConsoleMode(windows.Handle(in), mode|windows.ENABLE_VIRTUAL_TERMINAL_INPUT)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// toastStyle is the notification style of a toast style of the settings file
+func toastStyle(s config.ToastStyle) notify.Style {
+	style := notify.Style{Duration: s.Duration, Scenario: s.Scenario, SuppressPopup: s.SuppressPopup, Hero: s.Hero}
+	if style.Hero == "" && s.HeroColor != "" {
+		style.Hero = colorHero(s.HeroColor)
+	}
+	return style
+}
+
+// colorHero returns a generated banner in the given color, or "" (logged) when it
+// can't be created, so the toast is shown without one
+func colorHero(color string) string {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		logging.Warnf("Failed to locate app folder for notification banner: %v", err)
+		return ""
+	}
+	hero, err := notify.ColorHero(filepath.Join(appFolder, "icons"), color)
+	if err != nil {
+		logging.Warnf("Failed to create notification banner: %v", err)
+		return ""
+	}
+	return hero
+}
+
+// emailToast is the style of the notifications of new email, which follows the settings file
+type emailToast struct {
+	mu    sync.Mutex
+	style notify.Style
+}
+
+// update applies changed settings
+func (t *emailToast) update(cfg config.NotificationsConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.style = toastStyle(cfg.Toast)
+}
+
+// get returns the current style
+func (t *emailToast) get() notify.Style {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.style
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// runExportCommand handles "n0tif export <file>"
+func runExportCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: n0tif [-profile name] export <file>")
+		os.Exit(2)
+	}
+	path := args[0]
+
+	if err := unlockCredentials(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	passphrase, err := promptPassphrase("Passphrase to protect the export: ", true)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// State and history live in the backend the settings choose
+	if err := openConfiguredBackend(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := storage.ExportBundle(passphrase)
+	storage.CloseBackend()
+	if err != nil {
+		fmt.Printf("Export failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The bundle holds the plaintext password under the passphrase; keep it private anyway
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Printf("Failed to write %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported credentials, state, history and settings to %s\n", path)
+	fmt.Println("Keep the passphrase: it is required to import the file on the new machine.")
+}
+
+// runImportCommand handles "n0tif import <file>"
+func runImportCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: n0tif [-profile name] import <file>")
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Failed to read %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	if storage.CredentialsExist() && !promptYesNo("This profile already has saved credentials. Replace its data with the imported data?") {
+		fmt.Println("Import cancelled.")
+		os.Exit(1)
+	}
+
+	// Imported credentials keep this profile's master password, if it has one
+	if err := unlockCredentials(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	passphrase, err := promptPassphrase("Passphrase of the export: ", false)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := openConfiguredBackend(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	summary, err := storage.ImportBundle(data, passphrase)
+	storage.CloseBackend()
+	if err != nil {
+		fmt.Printf("Import failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Imported export from %s:\n", summary.Created.Format(time.RFC1123))
+	fmt.Printf("  credentials: %t\n  email state: %t\n  history:     %d message(s)\n  settings:    %t\n",
+		summary.HasCredentials, summary.HasState, summary.Messages, summary.HasSettings)
+	fmt.Println("Restart any running n0tif instance of this profile to pick up the imported credentials.")
+}
@@ -0,0 +1,295 @@
+//go:build !darwin || cgo
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/notify"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// trayRefreshInterval is how often the tray icon asks the monitor for its status
+const trayRefreshInterval = 5 * time.Second
+
+// trayPause is how long "Pause 1h" pauses checking
+const trayPause = time.Hour
+
+// Tray icon colors
+const (
+	trayColorOK        = "#2EA043" // last check succeeded
+	trayColorIdle      = "#8C8C8C" // not running or paused
+	trayColorFailing   = "#D1242F" // last check failed
+	trayColorThrottled = "#D29922" // the provider limits the checks for a while
+)
+
+// maxTooltip is the longest tooltip the notification area shows
+const maxTooltip = 127
+
+// trayState is what the tray icon shows about the monitor
+type trayState struct {
+	color   string
+	summary string // first menu line and tooltip
+	running bool
+	service bool // the monitor runs as a Windows service, which only the service manager stops
+	paused  bool
+	unread  int // unread email across the accounts, shown as a badge
+}
+
+// runTrayCommand handles "n0tif tray": a notification area icon that shows whether
+// the monitor of the profile is working and controls it through the control endpoint
+func runTrayCommand(args []string) {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	icons := newTrayIcons()
+	for _, c := range []string{trayColorOK, trayColorIdle, trayColorFailing} {
+		if _, err := icons.get(c, 0); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	systray.Run(func() { runTray(appFolder, icons) }, nil)
+}
+
+// trayIconKey identifies a rendered tray icon
+type trayIconKey struct {
+	color  string
+	unread int
+}
+
+// trayIcons renders tray icons as they are first needed and keeps them, as the
+// unread count changes every few minutes at most
+type trayIcons map[trayIconKey][]byte
+
+func newTrayIcons() trayIcons {
+	return make(trayIcons)
+}
+
+// get returns the icon of color with the unread count as a badge
+func (icons trayIcons) get(color string, unread int) ([]byte, error) {
+	key := trayIconKey{color, unread}
+	if icon, ok := icons[key]; ok {
+		return icon, nil
+	}
+	icon, err := notify.BadgeIconICO(color, unread)
+	if err != nil {
+		return nil, err
+	}
+	icons[key] = icon
+	return icon, nil
+}
+
+// runTray builds the menu and keeps it in sync with the monitor until Quit is chosen
+func runTray(appFolder string, icons trayIcons) {
+	systray.SetTitle("n0tif")
+	mStatus := systray.AddMenuItem("", "")
+	mStatus.Disable()
+	systray.AddSeparator()
+	mCheck := systray.AddMenuItem("Check Now", "Check for new email right away")
+	mPause := systray.AddMenuItem("Pause 1h", "Stop checking for an hour")
+	mRecent := systray.AddMenuItem("Recent Emails", "Show the most recently arrived messages")
+	mMarkRead := systray.AddMenuItem("Mark All Read", "Mark every email notified of as read on the server")
+	mLogs := systray.AddMenuItem("Open Logs", "Open the log file")
+	systray.AddSeparator()
+	mQuit := systray.AddMenuItem("Quit", "Stop n0tif and remove this icon")
+
+	var state trayState
+	refresh := func() {
+		state = queryTrayState(appFolder)
+		if icon, err := icons.get(state.color, state.unread); err == nil {
+			systray.SetIcon(icon)
+		}
+		tooltip := "n0tif: " + state.summary
+		if state.unread > 0 {
+			tooltip += fmt.Sprintf(" (%d unread)", state.unread)
+		}
+		if len(tooltip) > maxTooltip {
+			tooltip = tooltip[:maxTooltip-3] + "..."
+		}
+		systray.SetTooltip(tooltip)
+		mStatus.SetTitle(state.summary)
+		if state.paused {
+			mPause.SetTitle("Resume")
+		} else {
+			mPause.SetTitle("Pause 1h")
+		}
+		for _, item := range []*systray.MenuItem{mCheck, mPause, mRecent, mMarkRead} {
+			if state.running {
+				item.Enable()
+			} else {
+				item.Disable()
+			}
+		}
+	}
+	refresh()
+
+	ticker := time.NewTicker(trayRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-mCheck.ClickedCh:
+			// A check can take a while; keep the menu responsive
+			go trayCheckNow(appFolder)
+		case <-mPause.ClickedCh:
+			command, arg := "pause", trayPause.String()
+			if state.paused {
+				command, arg = "resume", ""
+			}
+			if _, err := control.CallWithArg(appFolder, command, arg, controlTimeout); err != nil {
+				trayNotify("Couldn't "+command+" checking", err.Error())
+			}
+		case <-mRecent.ClickedCh:
+			trayShowRecent(appFolder)
+		case <-mMarkRead.ClickedCh:
+			go trayMarkAllRead(appFolder)
+		case <-mLogs.ClickedCh:
+			if err := openLogFile(); err != nil {
+				trayNotify("Couldn't open the log", err.Error())
+			}
+		case <-mQuit.ClickedCh:
+			if state.running && !state.service {
+				if _, err := control.Call(appFolder, "stop", controlTimeout); err != nil {
+					logging.Errorf("Failed to stop n0tif: %v", err)
+				}
+			}
+			systray.Quit()
+			return
+		}
+		refresh()
+	}
+}
+
+// queryTrayState asks the monitor for its status and decides how to show it
+func queryTrayState(appFolder string) trayState {
+	reply, err := control.Call(appFolder, "status", trayRefreshInterval)
+	if errors.Is(err, control.ErrNotRunning) {
+		return trayState{color: trayColorIdle, summary: "Not running"}
+	}
+	if err != nil {
+		return trayState{color: trayColorFailing, summary: "Not responding: " + err.Error()}
+	}
+	var report statusReport
+	if err := json.Unmarshal([]byte(reply), &report); err != nil {
+		return trayState{color: trayColorFailing, summary: "Unexpected status reply"}
+	}
+
+	state := trayState{color: trayColorOK, running: true, service: report.Mode == "service", summary: "Waiting for the first check"}
+	for _, a := range report.Accounts {
+		if a.Unread != nil {
+			state.unread += *a.Unread
+		}
+		switch {
+		case a.Paused:
+			state.paused = true
+			state.color = trayColorIdle
+			state.summary = "Paused"
+			if !a.PausedUntil.IsZero() {
+				state.summary += " until " + a.PausedUntil.Local().Format("15:04")
+			}
+		case a.Offline != "":
+			state.color = trayColorIdle
+			state.summary = "Offline: " + a.Offline
+		case a.ThrottledUntil.After(time.Now()):
+			state.color = trayColorThrottled
+			state.summary = "Throttled by provider until " + a.ThrottledUntil.Local().Format("15:04")
+		case a.LastError != "":
+			state.color = trayColorFailing
+			state.summary = "Last check failed: " + a.LastError
+		case !a.LastCheck.IsZero():
+			state.summary = "Last checked " + a.LastCheck.Local().Format("15:04")
+		}
+	}
+	if state.service {
+		state.summary = "Service: " + state.summary
+	}
+	return state
+}
+
+// trayCheckNow runs an immediate check and reports when nothing new turned up;
+// new email is announced by the monitor's own notifications
+func trayCheckNow(appFolder string) {
+	reply, err := control.Call(appFolder, "check-now", checkNowTimeout)
+	if err != nil {
+		trayNotify("Check failed", err.Error())
+		return
+	}
+	var report checkNowReport
+	if err := json.Unmarshal([]byte(reply), &report); err == nil && len(report.NewEmails) == 0 {
+		trayNotify("No new email", "Your inbox is up to date.")
+	}
+}
+
+// trayMarkAllRead marks every email notified of as read and says how many
+func trayMarkAllRead(appFolder string) {
+	reply, err := control.Call(appFolder, "mark-all-read", controlTimeout)
+	if err != nil {
+		trayNotify("Couldn't mark email read", err.Error())
+		return
+	}
+	if reply == "0" {
+		trayNotify("Nothing to mark read", "Every email notified of is marked read already.")
+		return
+	}
+	trayNotify("Marked read", reply+" email(s) notified of are now marked read.")
+}
+
+// trayShowRecent lists the latest arrivals in a notification
+func trayShowRecent(appFolder string) {
+	reply, err := control.CallWithArg(appFolder, "recent", "5", controlTimeout)
+	if err != nil {
+		trayNotify("Couldn't get recent emails", err.Error())
+		return
+	}
+	var messages []storage.MessageRecord
+	if err := json.Unmarshal([]byte(reply), &messages); err != nil {
+		trayNotify("Couldn't get recent emails", err.Error())
+		return
+	}
+	if len(messages) == 0 {
+		trayNotify("Recent Emails", "No messages have arrived yet.")
+		return
+	}
+	lines := make([]string, len(messages))
+	for i, m := range messages {
+		lines[i] = fmt.Sprintf("%s: %s", truncate(m.From, 25), truncate(m.Subject, 40))
+	}
+	trayNotify("Recent Emails", strings.Join(lines, "\n"))
+}
+
+// trayNotify shows a notification on behalf of the tray icon
+func trayNotify(title, message string) {
+	if err := notify.SendWindowsNotification(notify.Identity{}, title, message, false); err != nil {
+		logging.Errorf("Failed to show notification: %v", err)
+	}
+}
+
+// openLogFile opens the log of the profile with the associated application
+func openLogFile() error {
+	logPath, err := storage.GetLogPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(logPath); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		return exec.Command("explorer.exe", logPath).Start()
+	}
+	return openURL(logPath)
+}
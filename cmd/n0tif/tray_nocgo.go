@@ -0,0 +1,15 @@
+//go:build darwin && !cgo
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runTrayCommand handles "n0tif tray" in builds without cgo, which the macOS
+// menu bar icon needs
+func runTrayCommand(args []string) {
+	fmt.Println("Error: this build of n0tif has no tray icon; on macOS it needs to be built with cgo (CGO_ENABLED=1)")
+	os.Exit(1)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/control"
+	"github.com/byigitt/n0tif/internal/storage"
+	"golang.org/x/term"
+)
+
+// tuiRefreshInterval is how often the dashboard polls the monitor
+const tuiRefreshInterval = 2 * time.Second
+
+// tuiRecentLimit is how many recent messages the dashboard lists
+const tuiRecentLimit = 100
+
+// Keys the dashboard reacts to, after escape sequences have been decoded
+const (
+	keyUp   = "up"
+	keyDown = "down"
+	keyQuit = "q"
+)
+
+// The dashboard follows the model/update/view structure: everything that happens,
+// from key presses to replies of the monitor, arrives as a message on one channel,
+// update changes the model and view renders it from scratch.
+
+// tuiStatusMsg carries a status reply of the monitor
+type tuiStatusMsg struct {
+	report statusReport
+	err    error
+}
+
+// tuiRecentMsg carries the recent messages of the monitor
+type tuiRecentMsg struct {
+	messages []storage.MessageRecord
+	err      error
+}
+
+// tuiKeyMsg is a key press
+type tuiKeyMsg string
+
+// tuiInfoMsg is the outcome of an action, shown above the key help
+type tuiInfoMsg string
+
+// tuiMarkedMsg reports that a message was marked read on the server
+type tuiMarkedMsg struct {
+	key string
+}
+
+// tuiModel is the state of the dashboard
+type tuiModel struct {
+	appFolder string
+	status    *statusReport
+	statusErr error
+	messages  []storage.MessageRecord
+	recentErr error
+	marked    map[string]bool // messages marked read from the dashboard
+	selected  int
+	offset    int // index of the first visible message
+	info      string
+}
+
+// runTUICommand handles "n0tif tui": a live dashboard of the running monitor
+func runTUICommand(args []string) {
+	appFolder, err := storage.GetAppFolder()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	in, out := os.Stdin.Fd(), os.Stdout.Fd()
+	if !term.IsTerminal(int(in)) || !term.IsTerminal(int(out)) {
+		fmt.Println("Error: the dashboard needs an interactive terminal; use 'n0tif status' instead")
+		os.Exit(1)
+	}
+	if err := enableVirtualTerminal(in, out); err != nil {
+		fmt.Printf("Error: terminal doesn't support the dashboard: %v\n", err)
+		os.Exit(1)
+	}
+	oldState, err := term.MakeRaw(int(in))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Alternate screen, hidden cursor; both undone on the way out
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		term.Restore(int(in), oldState)
+	}()
+
+	msgs := make(chan interface{}, 16)
+	go readKeys(msgs)
+
+	m := &tuiModel{appFolder: appFolder, marked: make(map[string]bool)}
+	m.refresh(msgs)
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		m.render()
+		select {
+		case <-ticker.C:
+			m.refresh(msgs)
+		case msg := <-msgs:
+			if key, ok := msg.(tuiKeyMsg); ok && (key == keyQuit || key == "\x03") {
+				return
+			}
+			m.update(msg, msgs)
+		}
+	}
+}
+
+// readKeys decodes key presses from the raw terminal and sends them as messages
+func readKeys(msgs chan<- interface{}) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			msgs <- tuiKeyMsg(keyQuit)
+			return
+		}
+		switch seq := string(buf[:n]); seq {
+		case "\x1b[A", "\x1bOA", "k":
+			msgs <- tuiKeyMsg(keyUp)
+		case "\x1b[B", "\x1bOB", "j":
+			msgs <- tuiKeyMsg(keyDown)
+		default:
+			msgs <- tuiKeyMsg(strings.ToLower(seq))
+		}
+	}
+}
+
+// refresh asks the monitor for its status and recent messages in the background
+func (m *tuiModel) refresh(msgs chan<- interface{}) {
+	go func() {
+		reply, err := control.Call(m.appFolder, "status", tuiRefreshInterval)
+		var report statusReport
+		if err == nil {
+			err = json.Unmarshal([]byte(reply), &report)
+		}
+		msgs <- tuiStatusMsg{report: report, err: err}
+	}()
+	go func() {
+		reply, err := control.CallWithArg(m.appFolder, "recent", strconv.Itoa(tuiRecentLimit), tuiRefreshInterval)
+		var messages []storage.MessageRecord
+		if err == nil {
+			err = json.Unmarshal([]byte(reply), &messages)
+		}
+		msgs <- tuiRecentMsg{messages: messages, err: err}
+	}()
+}
+
+// update applies a message to the model, starting actions in the background
+func (m *tuiModel) update(msg interface{}, msgs chan<- interface{}) {
+	switch msg := msg.(type) {
+	case tuiStatusMsg:
+		m.statusErr = msg.err
+		m.status = nil
+		if msg.err == nil {
+			m.status = &msg.report
+		}
+	case tuiRecentMsg:
+		m.recentErr = msg.err
+		if msg.err == nil {
+			m.messages = msg.messages
+		}
+		if m.selected >= len(m.messages) {
+			m.selected = len(m.messages) - 1
+		}
+		if m.selected < 0 {
+			m.selected = 0
+		}
+	case tuiInfoMsg:
+		m.info = string(msg)
+		m.refresh(msgs)
+	case tuiMarkedMsg:
+		m.marked[msg.key] = true
+		m.info = "Marked read."
+	case tuiKeyMsg:
+		m.handleKey(string(msg), msgs)
+	}
+}
+
+// handleKey moves the selection or starts the action bound to the key
+func (m *tuiModel) handleKey(key string, msgs chan<- interface{}) {
+	switch key {
+	case keyUp:
+		if m.selected > 0 {
+			m.selected--
+		}
+	case keyDown:
+		if m.selected < len(m.messages)-1 {
+			m.selected++
+		}
+	case "c":
+		m.info = "Checking..."
+		go func() {
+			reply, err := control.Call(m.appFolder, "check-now", checkNowTimeout)
+			if err != nil {
+				msgs <- tuiInfoMsg("Check failed: " + err.Error())
+				return
+			}
+			var report checkNowReport
+			json.Unmarshal([]byte(reply), &report)
+			msgs <- tuiInfoMsg(fmt.Sprintf("Check done, %d new email(s).", len(report.NewEmails)))
+		}()
+	case "p":
+		command, done := "pause", "Checking paused."
+		if m.paused() {
+			command, done = "resume", "Checking resumed."
+		}
+		go func() {
+			if _, err := control.Call(m.appFolder, command, controlTimeout); err != nil {
+				msgs <- tuiInfoMsg("Error: " + err.Error())
+				return
+			}
+			msgs <- tuiInfoMsg(done)
+		}()
+	case "r":
+		if len(m.messages) == 0 {
+			return
+		}
+		rec := m.messages[m.selected]
+		m.info = "Marking read..."
+		go func() {
+			arg := fmt.Sprintf("%d %s", rec.UID, rec.Mailbox)
+			if _, err := control.CallWithArg(m.appFolder, "mark-read", arg, controlTimeout); err != nil {
+				msgs <- tuiInfoMsg("Error: " + err.Error())
+				return
+			}
+			msgs <- tuiMarkedMsg{key: messageKey(rec)}
+		}()
+	}
+}
+
+// paused reports whether the monitor said checking is paused
+func (m *tuiModel) paused() bool {
+	if m.status == nil {
+		return false
+	}
+	for _, a := range m.status.Accounts {
+		if a.Paused {
+			return true
+		}
+	}
+	return false
+}
+
+// messageKey identifies a message across refreshes
+func messageKey(rec storage.MessageRecord) string {
+	return fmt.Sprintf("%s/%s/%d", rec.Account, rec.Mailbox, rec.UID)
+}
+
+// render draws the whole dashboard
+func (m *tuiModel) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 10 {
+		width, height = 80, 24
+	}
+	now := time.Now()
+
+	var lines []string
+	add := func(format string, a ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+
+	title := "n0tif dashboard"
+	if p := storage.Profile(); p != "" {
+		title += " - profile " + p
+	}
+	add("\x1b[1m%s\x1b[0m  %s", title, now.Format("15:04:05"))
+	add("")
+
+	switch {
+	case errors.Is(m.statusErr, control.ErrNotRunning):
+		add("n0tif is not running for this profile. Start it with 'n0tif start'.")
+	case m.statusErr != nil:
+		add("\x1b[31mStatus unavailable: %v\x1b[0m", m.statusErr)
+	case m.status == nil:
+		add("Connecting...")
+	default:
+		r := m.status
+		add("Running %s, PID %d, up %s, %s storage", r.Mode, r.PID, formatDuration(now.Sub(r.StartedAt)), r.Storage)
+		for _, a := range r.Accounts {
+			add("%s", accountLine(a, now))
+		}
+	}
+
+	add("")
+	add("\x1b[1mRecent messages\x1b[0m")
+	// Title, status, gaps, header and the three footer lines take the rest
+	visible := height - len(lines) - 3
+	if visible < 1 {
+		visible = 1
+	}
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+visible {
+		m.offset = m.selected - visible + 1
+	}
+	switch {
+	case m.recentErr != nil && !errors.Is(m.recentErr, control.ErrNotRunning):
+		add("  unavailable: %v", m.recentErr)
+	case len(m.messages) == 0:
+		add("  none yet")
+	}
+	for i := m.offset; i < len(m.messages) && i < m.offset+visible; i++ {
+		rec := m.messages[i]
+		mark := " "
+		if m.marked[messageKey(rec)] {
+			mark = "✓"
+		}
+		line := fmt.Sprintf("%s %s  %-25s  %s", mark, rec.Date.Local().Format("01-02 15:04"), truncate(rec.From, 25), rec.Subject)
+		line = truncate(line, width-1)
+		if i == m.selected {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, truncate(m.info, width-1))
+	lines = append(lines, "\x1b[2m↑/↓ select  c check now  p pause/resume  r mark read  q quit\x1b[0m")
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+// accountLine summarizes the checking of one account
+func accountLine(a accountStatus, now time.Time) string {
+	label := a.Username
+	if a.Name != "" {
+		label = a.Name
+	}
+	state := "\x1b[32m●\x1b[0m"
+	detail := "waiting for the first check"
+	if !a.LastCheck.IsZero() {
+		detail = "checked " + a.LastCheck.Local().Format("15:04:05")
+	}
+	switch {
+	case a.Paused:
+		state = "\x1b[90m●\x1b[0m"
+		detail = "paused"
+		if !a.PausedUntil.IsZero() {
+			detail += " for " + formatDuration(a.PausedUntil.Sub(now))
+		}
+	case a.Offline != "":
+		state = "\x1b[90m●\x1b[0m"
+		detail = "offline: " + a.Offline
+	case a.ThrottledUntil.After(now):
+		state = "\x1b[33m●\x1b[0m"
+		detail += ", throttled by provider for " + formatDuration(a.ThrottledUntil.Sub(now))
+	case a.LastError != "":
+		state = "\x1b[31m●\x1b[0m"
+		detail += ", failed: " + a.LastError
+	case !a.NextCheck.IsZero():
+		eta := a.NextCheck.Sub(now)
+		if eta < 0 {
+			eta = 0
+		}
+		detail += ", next in " + formatDuration(eta)
+	}
+	return fmt.Sprintf("%s %s  %s  (%d notification(s) today)", state, label, detail, a.NotificationsToday)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/kardianos/service"
+)
+
+// runUninstallCommand handles "n0tif uninstall [-purge] [-yes]": it removes n0tif
+// from the machine for every profile. The service and running instances are always
+// removed; saved passwords and all data only with -purge.
+func runUninstallCommand(args []string) {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	purge := fs.Bool("purge", false, "Also delete saved credentials, state, history, settings and logs")
+	yes := fs.Bool("yes", false, "Don't ask for confirmation")
+	fs.Usage = func() {
+		fmt.Println("Usage: n0tif uninstall [-purge] [-yes]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	profiles, err := storage.ListProfiles()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	profiles = append([]string{""}, profiles...)
+
+	if !*yes {
+		question := fmt.Sprintf("Stop n0tif and remove its %ss?", serviceKind)
+		if *purge {
+			question = fmt.Sprintf("Stop n0tif, remove its %ss and DELETE all saved credentials and data?", serviceKind)
+		}
+		if !promptYesNo(question) {
+			fmt.Println("Nothing was changed.")
+			return
+		}
+	}
+
+	failed := false
+	for _, p := range profiles {
+		if err := storage.SetProfile(p); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			failed = true
+			continue
+		}
+		label := "default profile"
+		if p != "" {
+			label = "profile " + p
+		}
+		if err := uninstallProfile(*purge); err != nil {
+			fmt.Printf("Error: %s: %v\n", label, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Cleaned up the %s.\n", label)
+	}
+	if failed {
+		fmt.Println("Some steps failed; fix the errors above and run uninstall again.")
+		os.Exit(1)
+	}
+
+	if removed, err := unregisterClickHandler(); err != nil {
+		fmt.Printf("Error: failed to remove the notification click handler: %v\n", err)
+		os.Exit(1)
+	} else if removed {
+		fmt.Println("Removed the notification click handler.")
+	}
+
+	if *purge {
+		root, err := storage.RemoveAllData()
+		if err != nil {
+			fmt.Printf("Error: failed to delete %s: %v\n", root, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %s.\n", root)
+	}
+	fmt.Println("n0tif has been uninstalled. You can now delete n0tif.exe.")
+}
+
+// uninstallProfile removes the service and autostart entry and stops the instance of
+// the active profile, and with purge deletes its saved credentials
+func uninstallProfile(purge bool) error {
+	svc, err := service.New(&n0tifService{}, newServiceConfig())
+	if err != nil {
+		return err
+	}
+	status, err := svc.Status()
+	switch {
+	case errors.Is(err, service.ErrNotInstalled):
+		// Nothing to remove
+	case err != nil:
+		return fmt.Errorf("query service: %w", err)
+	default:
+		if serviceNeedsAdmin && !isAdmin() {
+			return fmt.Errorf("a %s is installed; run uninstall as administrator to remove it", serviceKind)
+		}
+		if status == service.StatusRunning {
+			if err := svc.Stop(); err != nil {
+				return fmt.Errorf("stop service: %w", err)
+			}
+		}
+		if err := svc.Uninstall(); err != nil {
+			return fmt.Errorf("remove service: %w", err)
+		}
+		fmt.Printf("Removed the %s service.\n", newServiceConfig().Name)
+	}
+
+	if removed, err := disableAutostart(autostartName()); err != nil {
+		return fmt.Errorf("disable autostart: %w", err)
+	} else if removed {
+		fmt.Println("Disabled autostart.")
+	}
+
+	if stopped, err := stopMonitor(); err != nil {
+		return fmt.Errorf("stop running instance: %w", err)
+	} else if stopped {
+		fmt.Println("Stopped the running instance.")
+	}
+
+	if purge {
+		// The file goes with the data folder, but a password in the keyring would stay behind
+		if err := storage.DeleteCredentials(); err != nil {
+			return fmt.Errorf("delete credentials: %w", err)
+		}
+	}
+	return nil
+}
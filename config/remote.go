@@ -0,0 +1,106 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/schema"
+)
+
+// DefaultRemoteRefresh is how often managed settings are fetched when no interval is configured
+const DefaultRemoteRefresh = 15 * time.Minute
+
+// signedSettingsFormat identifies a signed settings document
+const signedSettingsFormat = "n0tif-signed-settings"
+
+// RemoteConfig points a fleet-managed install at centrally published settings.
+// Only settings are ever taken from the remote document; credentials stay local.
+type RemoteConfig struct {
+	URL             string `json:"url"`                        // https URL of the signed settings document
+	PublicKey       string `json:"public_key"`                 // base64 Ed25519 key the document must be signed with
+	RefreshInterval int    `json:"refresh_interval,omitempty"` // in seconds; 0 means DefaultRemoteRefresh
+}
+
+// Refresh returns how often the remote settings are fetched
+func (r RemoteConfig) Refresh() time.Duration {
+	if r.RefreshInterval > 0 {
+		return time.Duration(r.RefreshInterval) * time.Second
+	}
+	return DefaultRemoteRefresh
+}
+
+// Key decodes the configured public key
+func (r RemoteConfig) Key() (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(r.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a %d byte Ed25519 key, got %d bytes", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// signedSettings is the published document: the settings file verbatim plus
+// a signature over exactly those bytes
+type signedSettings struct {
+	Format    string `json:"format"`
+	Settings  []byte `json:"settings"`
+	Signature []byte `json:"signature"`
+}
+
+// SignSettings wraps a settings file in a document signed with key, ready to publish
+func SignSettings(key ed25519.PrivateKey, settings []byte) ([]byte, error) {
+	if _, err := parseSettings(settings); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(signedSettings{
+		Format:    signedSettingsFormat,
+		Settings:  settings,
+		Signature: ed25519.Sign(key, settings),
+	}, "", "  ")
+}
+
+// VerifySettings checks a signed settings document against the remote's public key
+// and returns the settings it carries. A remote block inside the document is
+// dropped, so a managed document can't redirect where settings come from.
+func VerifySettings(r RemoteConfig, document []byte) (*Settings, error) {
+	key, err := r.Key()
+	if err != nil {
+		return nil, err
+	}
+	var doc signedSettings
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("parse signed settings: %w", err)
+	}
+	if doc.Format != signedSettingsFormat {
+		return nil, errors.New("not a signed n0tif settings document")
+	}
+	if !ed25519.Verify(key, doc.Settings, doc.Signature) {
+		return nil, errors.New("signature does not match the configured public key")
+	}
+
+	s, err := parseSettings(doc.Settings)
+	if err != nil {
+		return nil, err
+	}
+	s.Remote = nil
+	return s, nil
+}
+
+// parseSettings decodes settings JSON, upgrading older schema versions
+func parseSettings(data []byte) (*Settings, error) {
+	upgraded, _, err := schema.Upgrade(data, settingsMigrations)
+	if err != nil {
+		return nil, err
+	}
+	var s Settings
+	if err := json.Unmarshal(upgraded, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/schema"
+)
+
+// settingsMigrations upgrade config.json; see package schema
+var settingsMigrations = []schema.Migration{
+	schema.Stamp, // 0 -> 1: introduce schema_version
+}
+
+// Settings is the hand-editable part of the configuration, stored as config.json
+// in the profile folder. Credentials are deliberately kept out of it.
+// Zero or missing values leave the corresponding setting unchanged.
+type Settings struct {
+	SchemaVersion  int                  `json:"schema_version,omitempty"`
+	CheckInterval  int                  `json:"check_interval,omitempty"` // in seconds
+	DoNotDisturb   *DoNotDisturbConfig  `json:"do_not_disturb,omitempty"`
+	Notifications  *NotificationsConfig `json:"notifications,omitempty"`
+	StorageBackend string               `json:"storage_backend,omitempty"`
+	Retention      *RetentionConfig     `json:"retention,omitempty"`
+	Remote         *RemoteConfig        `json:"remote,omitempty"`
+	Log            *LogConfig           `json:"log,omitempty"`
+	API            *APIConfig           `json:"api,omitempty"`
+	Relay          *RelayConfig         `json:"relay,omitempty"`
+	HomeAssistant  *HomeAssistantConfig `json:"home_assistant,omitempty"`
+	FollowUp       *FollowUpConfig      `json:"follow_up,omitempty"`
+	Away           *AwayConfig          `json:"away,omitempty"`
+	Alerts         *AlertsConfig        `json:"alerts,omitempty"`
+	Scheduler      *SchedulerConfig     `json:"scheduler,omitempty"`
+	Battery        *BatteryConfig       `json:"battery,omitempty"`
+	Tracing        *TracingConfig       `json:"tracing,omitempty"`
+	Notifiers      []NotifierConfig     `json:"notifiers,omitempty"`
+	Push           []PushConfig         `json:"push,omitempty"`
+	Hooks          *HooksConfig         `json:"hooks,omitempty"`
+	Rules          []RuleConfig         `json:"rules,omitempty"`
+}
+
+// LoadSettings reads the settings file at path.
+// A missing file is not an error and yields empty settings.
+func LoadSettings(path string) (*Settings, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Settings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	upgraded, version, err := schema.Upgrade(data, settingsMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if version < schema.Current(settingsMigrations) {
+		if err := writeFileAtomic(path, upgraded); err != nil {
+			logging.Warnf("Failed to upgrade %s in place: %v", path, err)
+		} else {
+			logging.Infof("Upgraded %s from schema version %d to %d", path, version, schema.Current(settingsMigrations))
+		}
+	}
+
+	var s Settings
+	if err := json.Unmarshal(upgraded, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file
+func writeFileAtomic(path string, data []byte) error {
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, path)
+}
+
+// Apply overlays the settings that are present onto cfg
+func (s *Settings) Apply(cfg *Config) {
+	if s.CheckInterval > 0 {
+		cfg.Email.CheckInterval = s.CheckInterval
+	}
+	if s.DoNotDisturb != nil {
+		cfg.DoNotDisturb = *s.DoNotDisturb
+		if cfg.DoNotDisturb.Mode == "" {
+			cfg.DoNotDisturb.Mode = DNDModeBatch
+		}
+	}
+	if s.Notifications != nil {
+		cfg.Notifications = *s.Notifications
+	}
+	if s.StorageBackend != "" {
+		cfg.StorageBackend = s.StorageBackend
+	}
+	if s.Retention != nil {
+		cfg.Retention = *s.Retention
+	}
+	if s.Remote != nil {
+		cfg.Remote = *s.Remote
+	}
+	if s.Log != nil {
+		cfg.Log = *s.Log
+	}
+	if s.API != nil {
+		cfg.API = *s.API
+	}
+	if s.Relay != nil {
+		cfg.Relay = *s.Relay
+	}
+	if s.HomeAssistant != nil {
+		cfg.HomeAssistant = *s.HomeAssistant
+	}
+	if s.FollowUp != nil {
+		cfg.FollowUp = *s.FollowUp
+	}
+	if s.Away != nil {
+		cfg.Away = *s.Away
+	}
+	if s.Alerts != nil {
+		cfg.Alerts = *s.Alerts
+	}
+	if s.Scheduler != nil {
+		cfg.Scheduler = *s.Scheduler
+	}
+	if s.Battery != nil {
+		cfg.Battery = *s.Battery
+	}
+	if s.Tracing != nil {
+		cfg.Tracing = *s.Tracing
+	}
+	if s.Notifiers != nil {
+		cfg.Notifiers = s.Notifiers
+	}
+	if s.Push != nil {
+		cfg.Push = s.Push
+	}
+	if s.Hooks != nil {
+		cfg.Hooks = *s.Hooks
+	}
+	if s.Rules != nil {
+		cfg.Rules = s.Rules
+	}
+}
+
+// WatchFile polls path every interval and calls onChange when its modification
+// time or size changes, including when the file is created or removed.
+// Polling keeps this dependency free and works the same on every platform.
+// Call the returned function to stop watching.
+func WatchFile(path string, interval time.Duration, onChange func()) (stop func()) {
+	done := make(chan struct{})
+	last := fileVersion(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if v := fileVersion(path); v != last {
+					last = v
+					onChange()
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// fileVersion identifies the current contents of a file well enough to notice edits
+func fileVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,394 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/rules"
+	"github.com/byigitt/n0tif/internal/schema"
+)
+
+var hexColorPattern = regexp.MustCompile(`^#?[0-9A-Fa-f]{6}$`)
+
+// clickPlaceholderPattern finds what looks like a placeholder in an argument of on_click
+var clickPlaceholderPattern = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// Validate checks the configuration and returns every problem found,
+// so they can all be fixed in one go instead of one failed start at a time
+func (c Config) Validate() []error {
+	var problems []error
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	e := c.Email
+	if e.ImapServer == "" {
+		add("email server is required (-server)")
+	}
+	if e.Username == "" {
+		add("email username is required (-user)")
+	}
+	if e.Password == "" {
+		add("email password is required (-pass)")
+	}
+	if e.ImapPort < 1 || e.ImapPort > 65535 {
+		add("IMAP port %d is out of range 1-65535", e.ImapPort)
+	}
+	if _, err := e.Pin(); err != nil {
+		add("pin_sha256 %q is invalid: %v", e.PinSHA256, err)
+	}
+
+	return append(problems, c.validateSettings()...)
+}
+
+// Validate checks the settings as they would apply on top of the defaults,
+// leaving out the credentials, which the settings file never holds
+func (s *Settings) Validate() []error {
+	cfg := GetDefaultConfig()
+	s.Apply(&cfg)
+	return cfg.validateSettings()
+}
+
+// validateSettings checks everything but the credentials
+func (c Config) validateSettings() []error {
+	var problems []error
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	e := c.Email
+	if e.CheckInterval < 1 {
+		add("check interval must be at least 1 second, got %d", e.CheckInterval)
+	}
+
+	n := e.Notification
+	if n.Color != "" && !hexColorPattern.MatchString(n.Color) {
+		add("notification color %q is not a #RRGGBB hex color", n.Color)
+	}
+	if n.Icon != "" {
+		if _, err := os.Stat(n.Icon); err != nil {
+			add("notification icon %q is not readable: %v", n.Icon, err)
+		}
+	}
+
+	d := c.DoNotDisturb
+	if d.Mode != DNDModeBatch && d.Mode != DNDModeSuppress {
+		add("do-not-disturb mode %q is invalid: use %s or %s", d.Mode, DNDModeBatch, DNDModeSuppress)
+	}
+	if d.CalendarURL != "" {
+		if u, err := url.Parse(d.CalendarURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("do-not-disturb calendar URL %q must be an http(s) URL", d.CalendarURL)
+		}
+	}
+
+	if c.StorageBackend != StorageJSON && c.StorageBackend != StorageSQLite {
+		add("storage backend %q is invalid: use %s or %s", c.StorageBackend, StorageJSON, StorageSQLite)
+	}
+	if r := c.Remote; r.URL != "" {
+		if u, err := url.Parse(r.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+			add("remote config URL %q must be an https URL", r.URL)
+		}
+		if _, err := r.Key(); err != nil {
+			add("remote config public key: %v", err)
+		}
+		if r.RefreshInterval < 0 {
+			add("remote config refresh_interval must not be negative, got %d", r.RefreshInterval)
+		}
+	}
+	if c.Notifications.GroupSeconds < 0 {
+		add("notifications group_seconds must not be negative, got %d", c.Notifications.GroupSeconds)
+	}
+	if c.Notifications.RemindAfterMinutes < 0 {
+		add("notifications remind_after_minutes must not be negative, got %d", c.Notifications.RemindAfterMinutes)
+	}
+	switch c.Notifications.MissedMail {
+	case "", MissedMailNotify, MissedMailSummary, MissedMailSkip:
+	default:
+		add("notifications missed_mail %q is invalid: use %s, %s or %s",
+			c.Notifications.MissedMail, MissedMailNotify, MissedMailSummary, MissedMailSkip)
+	}
+	if err := c.Notifications.Toast.Check(); err != nil {
+		add("notifications toast %v", err)
+	}
+	if len(c.Notifications.OnClick) > 0 {
+		if c.Notifications.OnClick[0] == "" {
+			add("notifications on_click has no program")
+		}
+		for _, arg := range c.Notifications.OnClick {
+			for _, name := range clickPlaceholderPattern.FindAllString(arg, -1) {
+				if !slices.Contains(ClickPlaceholders, name) {
+					add("notifications on_click placeholder %s is unknown: use %s", name, strings.Join(ClickPlaceholders, ", "))
+				}
+			}
+		}
+	}
+	seenFolders := make(map[string]bool)
+	for i, f := range c.Notifications.Folders {
+		mailbox := f.Mailbox
+		if strings.EqualFold(mailbox, "INBOX") {
+			mailbox = "INBOX"
+		}
+		switch {
+		case mailbox == "":
+			add("notifications folders[%d] needs a mailbox", i)
+		case seenFolders[mailbox]:
+			add("notifications folders[%d]: mailbox %q is listed twice", i, f.Mailbox)
+		}
+		seenFolders[mailbox] = true
+		if f.Name == "" && f.Icon == "" && f.Color == "" {
+			add("notifications folders[%d] sets neither a name nor an icon", i)
+		}
+		if f.Color != "" && !hexColorPattern.MatchString(f.Color) {
+			add("notifications folders[%d] color %q is not a #RRGGBB hex color", i, f.Color)
+		}
+		if f.Icon != "" {
+			if _, err := os.Stat(f.Icon); err != nil {
+				add("notifications folders[%d] icon %q is not readable: %v", i, f.Icon, err)
+			}
+		}
+	}
+	if c.Retention.HistoryDays < 0 {
+		add("retention history_days must not be negative, got %d", c.Retention.HistoryDays)
+	}
+	if c.Retention.MessagesPerMailbox < 0 {
+		add("retention messages_per_mailbox must not be negative, got %d", c.Retention.MessagesPerMailbox)
+	}
+	if c.Log.MaxSizeMB < 0 {
+		add("log max_size_mb must not be negative, got %d", c.Log.MaxSizeMB)
+	}
+	if c.Log.MaxAgeDays < 0 {
+		add("log max_age_days must not be negative, got %d", c.Log.MaxAgeDays)
+	}
+	if c.Log.Keep < 0 {
+		add("log keep must not be negative, got %d", c.Log.Keep)
+	}
+	if c.Log.Format != "" && c.Log.Format != "text" && c.Log.Format != "json" {
+		add("log format %q is invalid: use text or json", c.Log.Format)
+	}
+	if c.Alerts.FailureMinutes < 0 {
+		add("alerts failure_minutes must not be negative, got %d", c.Alerts.FailureMinutes)
+	}
+	if c.Alerts.DailySummary != "" {
+		if _, err := time.Parse("15:04", c.Alerts.DailySummary); err != nil {
+			add("alerts daily_summary %q is not a HH:MM time", c.Alerts.DailySummary)
+		}
+	}
+	if c.Alerts.MonthlyDataMB < 0 {
+		add("alerts monthly_data_mb must not be negative, got %d", c.Alerts.MonthlyDataMB)
+	}
+	if c.Scheduler.JitterSeconds < 0 {
+		add("scheduler jitter_seconds must not be negative, got %d", c.Scheduler.JitterSeconds)
+	}
+	if c.Scheduler.CheckTimeoutSeconds < 0 {
+		add("scheduler check_timeout_seconds must not be negative, got %d", c.Scheduler.CheckTimeoutSeconds)
+	}
+	for host, n := range c.Scheduler.ProviderConnections {
+		if host == "" || n < 0 {
+			add("scheduler provider_connections needs server names with a non-negative number, got %q: %d", host, n)
+		}
+	}
+	if c.Battery.CheckInterval < 0 {
+		add("battery check_interval must not be negative, got %d", c.Battery.CheckInterval)
+	}
+	if c.Battery.LowPercent < 0 || c.Battery.LowPercent > 100 {
+		add("battery low_percent must be between 0 and 100, got %d", c.Battery.LowPercent)
+	}
+	if c.Battery.LowPercent > 0 && c.Battery.LowCheckInterval <= 0 {
+		add("battery low_check_interval must be positive when low_percent is set")
+	}
+	if e := c.Tracing.Endpoint; e != "" {
+		if u, err := url.Parse(e); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tracing endpoint %q must be an http(s) URL", e)
+		}
+	}
+	for i, n := range c.Notifiers {
+		if n.Type == "" {
+			add("notifiers[%d] has no type", i)
+		}
+	}
+	pushNames := make(map[string]bool)
+	for i, p := range c.Push {
+		switch {
+		case p.Name == "":
+			add("push[%d] has no name", i)
+		case pushNames[p.Name]:
+			add("push[%d]: name %q is used twice", i, p.Name)
+		}
+		pushNames[p.Name] = true
+		if p.Type == "" {
+			add("push[%d] has no type", i)
+		}
+	}
+	for i, p := range c.Away.Periods {
+		if from, until, err := p.Bounds(); err != nil {
+			add("away periods[%d] needs from and until as YYYY-MM-DD dates", i)
+		} else if !until.After(from) {
+			add("away periods[%d] ends before it begins", i)
+		}
+	}
+	if c.Away.SummaryAt != "" {
+		if _, err := time.Parse("15:04", c.Away.SummaryAt); err != nil {
+			add("away summary_at %q is not a HH:MM time", c.Away.SummaryAt)
+		}
+	}
+	for _, name := range c.Away.Channels {
+		if !pushNames[name] {
+			add("away sends summaries to %q, which is not in push", name)
+		}
+	}
+	for i, h := range c.Hooks.OnEmail {
+		if len(h.Command) == 0 || h.Command[0] == "" {
+			add("hooks on_email[%d] has no command", i)
+		}
+		if h.Mode != "" && h.Mode != HookEach && h.Mode != HookDigest {
+			add("hooks on_email[%d] mode %q is invalid: use %s or %s", i, h.Mode, HookEach, HookDigest)
+		}
+		if h.TimeoutSeconds < 0 {
+			add("hooks on_email[%d] timeout_seconds must not be negative, got %d", i, h.TimeoutSeconds)
+		}
+	}
+	if c.Hooks.MaxConcurrent < 0 {
+		add("hooks max_concurrent must not be negative, got %d", c.Hooks.MaxConcurrent)
+	}
+	for i, r := range c.Rules {
+		if _, err := rules.Compile(r.When); err != nil {
+			add("rules[%d] condition %q: %v", i, r.When, err)
+		}
+		if r.Action != RuleNotify && r.Action != RuleIgnore {
+			add("rules[%d] action %q is invalid: use %s or %s", i, r.Action, RuleNotify, RuleIgnore)
+		}
+		if r.Toast != nil {
+			if r.Action == RuleIgnore {
+				add("rules[%d] ignores email, so it can't have a toast style", i)
+			} else if err := r.Toast.Check(); err != nil {
+				add("rules[%d] toast %v", i, err)
+			}
+		}
+		if len(r.Push) > 0 && r.Action == RuleIgnore {
+			add("rules[%d] ignores email, so it can't push it", i)
+		}
+		for _, name := range r.Push {
+			if !pushNames[name] {
+				add("rules[%d] pushes to %q, which is not in push", i, name)
+			}
+		}
+	}
+	if c.API.Listen != "" {
+		if err := checkLoopbackAddress(c.API.Listen); err != nil {
+			add("api listen address %q: %v", c.API.Listen, err)
+		}
+	}
+	if w := c.API.Webmail; w != "" {
+		if u, err := url.Parse(strings.NewReplacer("{from}", "", "{subject}", "").Replace(w)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("api webmail %q must be an http(s) URL", w)
+		}
+	}
+
+	for _, a := range c.FollowUp.Addresses {
+		if !strings.Contains(a, "@") || strings.Count(a, "@") > 1 || strings.HasSuffix(a, "@") {
+			add("follow_up address %q must be user@host or @host", a)
+		}
+	}
+	if c.FollowUp.Days < 0 {
+		add("follow_up days must not be negative, got %d", c.FollowUp.Days)
+	}
+	if b := c.HomeAssistant.Broker; b != "" {
+		if u, err := url.Parse(b); err != nil || (u.Scheme != "mqtt" && u.Scheme != "mqtts") || u.Host == "" {
+			add("home_assistant broker %q must be an mqtt:// or mqtts:// URL", redactURL(b))
+		}
+	}
+	if c.Relay.Listen != "" {
+		if err := checkRelayAddress(c.Relay.Listen, true); err != nil {
+			add("relay listen address %q: %v", c.Relay.Listen, err)
+		}
+	}
+	if c.Relay.Connect != "" {
+		if err := checkRelayAddress(c.Relay.Connect, false); err != nil {
+			add("relay connect address %q: %v", c.Relay.Connect, err)
+		}
+	}
+
+	return problems
+}
+
+// CheckSettingsFile strictly parses the settings file at path, reporting
+// syntax errors and unknown keys (usually typos) that LoadSettings ignores.
+// A missing file is not a problem.
+func CheckSettingsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check the file as it will be after migration, so fields renamed by a schema upgrade aren't reported
+	upgraded, _, err := schema.Upgrade(data, settingsMigrations)
+	if err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return fmt.Errorf("%s: line %d: %v", path, line, err)
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(upgraded))
+	dec.DisallowUnknownFields()
+	var s Settings
+	if err := dec.Decode(&s); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// redactURL hides the password in the user info of a URL in messages
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil {
+		return u.Redacted()
+	}
+	return s
+}
+
+// checkRelayAddress checks a host:port address of the relay; the host may only
+// be left out of the address the hub listens on
+func checkRelayAddress(address string, listen bool) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	if host == "" && !listen {
+		return fmt.Errorf("host of the hub is missing")
+	}
+	return nil
+}
+
+// checkLoopbackAddress makes sure the API is only reachable from this machine
+func checkLoopbackAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("host must be a loopback address such as 127.0.0.1")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package agent holds the master password in memory for other n0tif processes,
+// so it is typed once per login session rather than on every daemon start.
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// infoFileName is written next to the credentials and tells clients where the agent listens
+const infoFileName = "agent.json"
+
+// ErrNotRunning is returned by Fetch when no agent is reachable
+var ErrNotRunning = errors.New("agent is not running")
+
+// info is the content of agent.json. The token proves the client can read the
+// profile folder, which is what access to the secret is tied to.
+type info struct {
+	Port  int    `json:"port"`
+	Token string `json:"token"`
+	PID   int    `json:"pid"`
+}
+
+// Agent serves a secret to local clients that present the token from agent.json
+type Agent struct {
+	server   *http.Server
+	infoPath string
+}
+
+// Serve starts an agent for secret on a loopback port and publishes its address in dir
+func Serve(dir, secret string) (*Agent, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/secret", func(w http.ResponseWriter, r *http.Request) {
+		presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, secret)
+	})
+
+	a := &Agent{
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+		infoPath: filepath.Join(dir, infoFileName),
+	}
+
+	data, err := json.Marshal(info{Port: listener.Addr().(*net.TCPAddr).Port, Token: token, PID: os.Getpid()})
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	tempPath := a.infoPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tempPath, a.infoPath); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	go func() { _ = a.server.Serve(listener) }()
+	return a, nil
+}
+
+// Close stops the agent and removes agent.json
+func (a *Agent) Close() error {
+	os.Remove(a.infoPath)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return a.server.Shutdown(ctx)
+}
+
+// Fetch asks the agent published in dir for its secret
+func Fetch(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, infoFileName))
+	if os.IsNotExist(err) {
+		return "", ErrNotRunning
+	}
+	if err != nil {
+		return "", err
+	}
+	var i info
+	if err := json.Unmarshal(data, &i); err != nil {
+		return "", fmt.Errorf("parse %s: %w", infoFileName, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/secret", i.Port), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+i.Token)
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// A stale agent.json from an agent that didn't shut down cleanly
+		return "", ErrNotRunning
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("agent refused the request: %s", resp.Status)
+	}
+	secret, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,116 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+// DefaultRefreshInterval is how long a downloaded calendar is reused before fetching it again
+const DefaultRefreshInterval = 5 * time.Minute
+
+// ICSCalendar answers free/busy questions from a published ICS calendar URL
+// (e.g. an Outlook or Google Calendar "secret address")
+type ICSCalendar struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	events    []event
+	fetchedAt time.Time
+}
+
+// NewICSCalendar creates a calendar backed by the ICS feed at url
+func NewICSCalendar(url string, refresh time.Duration) *ICSCalendar {
+	if refresh <= 0 {
+		refresh = DefaultRefreshInterval
+	}
+	return &ICSCalendar{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// BusyUntil reports whether a busy event covers now and, if so, when the
+// last overlapping busy block ends. A failed refresh keeps using the last
+// successfully downloaded events so a flaky network doesn't end a meeting early.
+func (c *ICSCalendar) BusyUntil(now time.Time) (bool, time.Time, error) {
+	c.mu.Lock()
+	due := c.fetchedAt.IsZero() || now.Sub(c.fetchedAt) >= c.refresh
+	if due {
+		// Claimed before fetching, so other callers keep using the cached
+		// events meanwhile, and don't hammer the server after a failure either
+		c.fetchedAt = now
+	}
+	c.mu.Unlock()
+
+	var refreshErr error
+	if due {
+		events, err := c.fetch()
+		c.mu.Lock()
+		if err != nil {
+			refreshErr = err
+			logging.Warnf("ICSCalendar: Failed to refresh calendar, using %d cached events: %v", len(c.events), err)
+		} else {
+			c.events = events
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	events := c.events
+	c.mu.Unlock()
+	busy, until := busyUntil(events, now)
+	return busy, until, refreshErr
+}
+
+func (c *ICSCalendar) fetch() ([]event, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch calendar: unexpected status %s", resp.Status)
+	}
+
+	// Calendars with years of history can be large, but not unbounded
+	return parseICS(io.LimitReader(resp.Body, 16<<20))
+}
+
+// maxChainedEvents bounds how many back-to-back events extend a busy window,
+// so a recurring all-day busy event can't keep us looping forever
+const maxChainedEvents = 50
+
+// busyUntil finds the events covering now and extends the busy window
+// through back-to-back meetings
+func busyUntil(events []event, now time.Time) (bool, time.Time) {
+	busy := false
+	until := now
+	for i := 0; i < maxChainedEvents; i++ {
+		extended := false
+		for _, ev := range events {
+			if ev.transparent || ev.cancelled {
+				continue
+			}
+			_, end, ok := ev.occurrenceAt(until)
+			if !ok {
+				continue
+			}
+			busy = true
+			until = end
+			extended = true
+		}
+		if !extended {
+			break
+		}
+	}
+	return busy, until
+}
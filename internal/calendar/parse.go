@@ -0,0 +1,629 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+// event is a single VEVENT, possibly recurring
+type event struct {
+	uid          string
+	start        time.Time
+	end          time.Time
+	rule         *recurrence
+	exdates      map[int64]bool // unix seconds of excluded occurrence starts
+	recurrenceID time.Time      // set on overrides of a single occurrence
+	transparent  bool           // TRANSP:TRANSPARENT, i.e. shown as free
+	cancelled    bool
+}
+
+// recurrence is the subset of RRULE that published calendars commonly use
+type recurrence struct {
+	freq       string // DAILY, WEEKLY, MONTHLY or YEARLY
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []weekdayNum
+	byMonthDay []int // negative counts from the end of the month
+	byMonth    []time.Month
+}
+
+// weekdayNum is a BYDAY entry such as MO, 1MO (the first Monday) or -1FR (the last Friday)
+type weekdayNum struct {
+	n   int // position in the month or year, 0 for every such day
+	day time.Weekday
+}
+
+// maxOccurrences bounds how many steps of a rule are expanded from where the
+// expansion starts; daily and weekly rules start near the time asked about
+const maxOccurrences = 5000
+
+// occurrenceAt returns the occurrence of ev that covers t, if any
+func (ev event) occurrenceAt(t time.Time) (time.Time, time.Time, bool) {
+	duration := ev.end.Sub(ev.start)
+	if duration <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	if ev.rule == nil {
+		if !ev.start.After(t) && ev.end.After(t) {
+			return ev.start, ev.end, true
+		}
+		return time.Time{}, time.Time{}, false
+	}
+
+	var found bool
+	var start time.Time
+	ev.rule.each(ev.start, t.Add(-duration), func(occ time.Time) bool {
+		if occ.After(t) {
+			return false
+		}
+		if !ev.exdates[occ.Unix()] && occ.Add(duration).After(t) {
+			found = true
+			start = occ
+			return false
+		}
+		return true
+	})
+	if !found {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.Add(duration), true
+}
+
+// each calls fn with occurrence start times in chronological order until fn
+// returns false. The occurrences of daily and weekly rules long before from are
+// skipped, so a series that started years ago still reaches it; monthly and
+// yearly ones get there within maxOccurrences steps anyway.
+func (r *recurrence) each(first, from time.Time, fn func(time.Time) bool) {
+	start, n := r.skip(first, from)
+	emit := func(occ time.Time) bool {
+		if occ.Before(first) {
+			return true
+		}
+		if !r.until.IsZero() && occ.After(r.until) {
+			return false
+		}
+		n++
+		if r.count > 0 && n > r.count {
+			return false
+		}
+		return fn(occ)
+	}
+
+	for k := start; k < start+maxOccurrences; k++ {
+		step := k * r.interval
+		switch r.freq {
+		case "DAILY":
+			day := first.AddDate(0, 0, step)
+			if len(r.byDay) > 0 && !containsWeekday(r.byDay, day.Weekday()) {
+				continue
+			}
+			if !emit(day) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !emit(first.AddDate(0, 0, 7*step)) {
+					return
+				}
+				continue
+			}
+			// Walk the days of the week containing first, shifted by the interval
+			weekStart := first.AddDate(0, 0, 7*step-int(first.Weekday()))
+			for d := 0; d < 7; d++ {
+				day := weekStart.AddDate(0, 0, d)
+				if containsWeekday(r.byDay, day.Weekday()) && !emit(day) {
+					return
+				}
+			}
+		case "MONTHLY":
+			month := first.Month() + time.Month(step)
+			for _, occ := range r.monthDays(first, first.Year(), month) {
+				if !emit(occ) {
+					return
+				}
+			}
+		case "YEARLY":
+			for _, occ := range r.yearDays(first, first.Year()+step) {
+				if !emit(occ) {
+					return
+				}
+			}
+		default:
+			emit(first)
+			return
+		}
+	}
+}
+
+// skip returns the step of a daily or weekly rule to start expanding at to
+// reach from, one early to allow for daylight saving shifts, and how many
+// occurrences the steps before it have, for COUNT
+func (r *recurrence) skip(first, from time.Time) (int, int) {
+	days := int(from.Sub(first).Hours() / 24)
+	var k int
+	switch r.freq {
+	case "DAILY":
+		k = days/r.interval - 1
+	case "WEEKLY":
+		k = days/(7*r.interval) - 1
+	}
+	if k <= 0 {
+		return 0, 0
+	}
+	if len(r.byDay) == 0 {
+		return k, k
+	}
+	if r.freq == "DAILY" {
+		n := 0
+		for j := 0; j < k; j++ {
+			if containsWeekday(r.byDay, time.Weekday((int(first.Weekday())+j*r.interval)%7)) {
+				n++
+			}
+		}
+		return k, n
+	}
+
+	// The first week only has its days from first on; the others have every day of BYDAY
+	weekStart := first.AddDate(0, 0, -int(first.Weekday()))
+	n := 0
+	for d := 0; d < 7; d++ {
+		day := weekStart.AddDate(0, 0, d)
+		if !day.Before(first) && containsWeekday(r.byDay, day.Weekday()) {
+			n++
+		}
+	}
+	perWeek := 0
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		if containsWeekday(r.byDay, wd) {
+			perWeek++
+		}
+	}
+	return k, n + (k-1)*perWeek
+}
+
+// monthDays returns the occurrences of a monthly rule, or a yearly one with BYMONTH,
+// in the given month, at the time of day of first. The month may be out of range;
+// it is normalized like time.Date does.
+func (r *recurrence) monthDays(first time.Time, year int, month time.Month) []time.Time {
+	start := time.Date(year, month, 1, first.Hour(), first.Minute(), first.Second(), first.Nanosecond(), first.Location())
+	n := start.AddDate(0, 1, -1).Day()
+
+	var days []int
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, d := range r.byMonthDay {
+			if d < 0 {
+				d += n + 1
+			}
+			if d >= 1 && d <= n {
+				days = append(days, d)
+			}
+		}
+		slices.Sort(days)
+		days = slices.Compact(days)
+		// BYDAY then only limits the days of BYMONTHDAY
+		if len(r.byDay) > 0 {
+			days = slices.DeleteFunc(days, func(d int) bool {
+				return !matchesWeekday(r.byDay, start.AddDate(0, 0, d-1).Weekday(), d, n)
+			})
+		}
+	case len(r.byDay) > 0:
+		for d := 1; d <= n; d++ {
+			if matchesWeekday(r.byDay, start.AddDate(0, 0, d-1).Weekday(), d, n) {
+				days = append(days, d)
+			}
+		}
+	case first.Day() <= n:
+		// Months too short for the day of first, e.g. February for the 31st, have none
+		days = []int{first.Day()}
+	}
+
+	occs := make([]time.Time, len(days))
+	for i, d := range days {
+		occs[i] = start.AddDate(0, 0, d-1)
+	}
+	return occs
+}
+
+// yearDays returns the occurrences of a yearly rule in the given year
+func (r *recurrence) yearDays(first time.Time, year int) []time.Time {
+	months := r.byMonth
+	switch {
+	case len(months) > 0:
+	case len(r.byDay) > 0 && len(r.byMonthDay) == 0:
+		// BYDAY alone counts its positions in the whole year
+		start := time.Date(year, time.January, 1, first.Hour(), first.Minute(), first.Second(), first.Nanosecond(), first.Location())
+		n := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		var occs []time.Time
+		for d := 1; d <= n; d++ {
+			day := start.AddDate(0, 0, d-1)
+			if matchesWeekday(r.byDay, day.Weekday(), d, n) {
+				occs = append(occs, day)
+			}
+		}
+		return occs
+	case len(r.byMonthDay) > 0:
+		months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	default:
+		months = []time.Month{first.Month()}
+	}
+
+	var occs []time.Time
+	for _, m := range months {
+		occs = append(occs, r.monthDays(first, year, m)...)
+	}
+	return occs
+}
+
+// matchesWeekday reports whether a day with weekday wd, the pos-th of a month or
+// year of n days, is one of days
+func matchesWeekday(days []weekdayNum, wd time.Weekday, pos, n int) bool {
+	for _, day := range days {
+		if day.day != wd {
+			continue
+		}
+		if day.n == 0 || day.n == (pos-1)/7+1 || day.n == -((n-pos)/7+1) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWeekday(days []weekdayNum, d time.Weekday) bool {
+	for _, day := range days {
+		if day.day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// parseICS reads the VEVENTs from an iCalendar stream, leaving out those it
+// can't make sense of
+func parseICS(r io.Reader) ([]event, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []event
+	var cur *event
+	var hasEnd bool
+	var duration time.Duration
+	var allDay bool
+	var bad error // a property of cur that failed to parse
+
+	for _, line := range lines {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			cur = &event{exdates: make(map[int64]bool)}
+			hasEnd, duration, allDay, bad = false, 0, false, nil
+			continue
+		case name == "END" && value == "VEVENT":
+			if cur != nil && bad != nil {
+				// One event a feed's publisher got wrong shouldn't hide the rest
+				logging.Warnf("ICSCalendar: Skipping event %q: %v", cur.uid, bad)
+			} else if cur != nil && !cur.start.IsZero() {
+				if !hasEnd {
+					switch {
+					case duration > 0:
+						cur.end = cur.start.Add(duration)
+					case allDay:
+						cur.end = cur.start.AddDate(0, 0, 1)
+					default:
+						cur.end = cur.start
+					}
+				}
+				events = append(events, *cur)
+			}
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			cur.uid = value
+		case "DTSTART":
+			t, dateOnly, err := parseDateTime(value, params)
+			if err != nil {
+				bad = fmt.Errorf("DTSTART: %w", err)
+				continue
+			}
+			cur.start, allDay = t, dateOnly
+		case "DTEND":
+			t, _, err := parseDateTime(value, params)
+			if err != nil {
+				bad = fmt.Errorf("DTEND: %w", err)
+				continue
+			}
+			cur.end, hasEnd = t, true
+		case "DURATION":
+			d, err := parseDuration(value)
+			if err != nil {
+				bad = fmt.Errorf("DURATION: %w", err)
+				continue
+			}
+			duration = d
+		case "RRULE":
+			rule, err := parseRRule(value, params)
+			if err != nil {
+				bad = fmt.Errorf("RRULE: %w", err)
+				continue
+			}
+			cur.rule = rule
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, _, err := parseDateTime(v, params)
+				if err != nil {
+					bad = fmt.Errorf("EXDATE: %w", err)
+					break
+				}
+				cur.exdates[t.Unix()] = true
+			}
+		case "RECURRENCE-ID":
+			t, _, err := parseDateTime(value, params)
+			if err != nil {
+				bad = fmt.Errorf("RECURRENCE-ID: %w", err)
+				continue
+			}
+			cur.recurrenceID = t
+		case "TRANSP":
+			cur.transparent = value == "TRANSPARENT"
+		case "STATUS":
+			cur.cancelled = value == "CANCELLED"
+		}
+	}
+
+	applyOverrides(events)
+	return events, nil
+}
+
+// applyOverrides excludes occurrences that a RECURRENCE-ID event replaces
+// from the master recurring event with the same UID
+func applyOverrides(events []event) {
+	masters := make(map[string]*event)
+	for i := range events {
+		if events[i].rule != nil && events[i].recurrenceID.IsZero() {
+			masters[events[i].uid] = &events[i]
+		}
+	}
+	for _, ev := range events {
+		if ev.recurrenceID.IsZero() {
+			continue
+		}
+		if master, ok := masters[ev.uid]; ok {
+			master.exdates[ev.recurrenceID.Unix()] = true
+		}
+	}
+}
+
+// unfoldLines joins RFC 5545 continuation lines (starting with a space or tab)
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitProperty splits "NAME;PARAM=x;P2=y:value" into its parts
+func splitProperty(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	head, value := line[:colon], line[colon+1:]
+
+	parts := strings.Split(head, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+// parseDateTime handles UTC, TZID-qualified, floating and date-only values.
+// Unknown time zones (such as Windows zone names) fall back to local time.
+func parseDateTime(value string, params map[string]string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseDuration parses RFC 5545 durations such as PT1H30M or P1D
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	if s == value {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, ch := range s {
+		switch {
+		case ch >= '0' && ch <= '9':
+			num += string(ch)
+			continue
+		case ch == 'T':
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		num = ""
+		switch {
+		case ch == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case ch == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case ch == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case ch == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case ch == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+	return d, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRule(value string, params map[string]string) (*recurrence, error) {
+	r := &recurrence{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", v)
+			}
+			r.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid COUNT %q", v)
+			}
+			r.count = n
+		case "UNTIL":
+			t, _, err := parseDateTime(v, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", v)
+			}
+			r.until = t
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				day, err := parseWeekdayNum(d)
+				if err != nil {
+					return nil, err
+				}
+				r.byDay = append(r.byDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, m := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(m)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("invalid BYMONTH %q", v)
+				}
+				r.byMonth = append(r.byMonth, time.Month(n))
+			}
+			slices.Sort(r.byMonth)
+		case "WKST":
+			// Only matters for weekly rules with an interval and BYDAY; weeks start on Sunday here
+		default:
+			// Expanding without BYSETPOS, BYWEEKNO and the like would give wrong occurrences
+			return nil, fmt.Errorf("unsupported rule part %s", strings.ToUpper(k))
+		}
+	}
+	if r.freq == "" {
+		return nil, fmt.Errorf("missing FREQ in %q", value)
+	}
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// check rejects combinations of rule parts that each doesn't expand
+func (r *recurrence) check() error {
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return fmt.Errorf("unsupported FREQ %s", r.freq)
+	}
+	if r.freq == "DAILY" || r.freq == "WEEKLY" {
+		for _, day := range r.byDay {
+			if day.n != 0 {
+				return fmt.Errorf("BYDAY positions are only valid in monthly and yearly rules")
+			}
+		}
+		if len(r.byMonthDay) > 0 {
+			return fmt.Errorf("BYMONTHDAY is only supported in monthly and yearly rules")
+		}
+	}
+	if len(r.byMonth) > 0 && r.freq != "YEARLY" {
+		return fmt.Errorf("BYMONTH is only supported in yearly rules")
+	}
+	return nil
+}
+
+// parseWeekdayNum parses a BYDAY entry such as MO, 1MO, +2TU or -1FR
+func parseWeekdayNum(value string) (weekdayNum, error) {
+	v := strings.ToUpper(value)
+	if len(v) < 2 {
+		return weekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+	}
+	wd, ok := weekdays[v[len(v)-2:]]
+	if !ok {
+		return weekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+	}
+	day := weekdayNum{day: wd}
+	if pos := v[:len(v)-2]; pos != "" {
+		n, err := strconv.Atoi(pos)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return weekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+		}
+		day.n = n
+	}
+	return day, nil
+}
@@ -0,0 +1,172 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseEvents parses VEVENTs given as their properties, one string per event
+func parseEvents(t *testing.T, events ...string) []event {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	for _, ev := range events {
+		b.WriteString("BEGIN:VEVENT\r\n" + strings.TrimSpace(ev) + "\r\nEND:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	parsed, err := parseICS(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("parseICS: %v", err)
+	}
+	return parsed
+}
+
+func at(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestOccurrenceAt(t *testing.T) {
+	// 2024-01-01 is a Monday
+	const monday = "DTSTART:20240101T090000Z\nDTEND:20240101T100000Z\n"
+	tests := []struct {
+		name  string
+		event string
+		at    string
+		want  string // start of the occurrence covering at, "" for none
+	}{
+		{"single", monday, "2024-01-01 09:30", "2024-01-01 09:00"},
+		{"single after it ends", monday, "2024-01-01 10:00", ""},
+		{"single the day after", monday, "2024-01-02 09:30", ""},
+		{"daily", monday + "RRULE:FREQ=DAILY", "2024-01-05 09:30", "2024-01-05 09:00"},
+		{"daily between occurrences", monday + "RRULE:FREQ=DAILY", "2024-01-05 12:00", ""},
+		{"daily every other day off", monday + "RRULE:FREQ=DAILY;INTERVAL=2", "2024-01-04 09:30", ""},
+		{"daily every other day on", monday + "RRULE:FREQ=DAILY;INTERVAL=2", "2024-01-05 09:30", "2024-01-05 09:00"},
+		{"daily for twenty years", "DTSTART:20040101T090000Z\nDTEND:20040101T100000Z\nRRULE:FREQ=DAILY", "2024-06-03 09:30", "2024-06-03 09:00"},
+		{"daily count last", monday + "RRULE:FREQ=DAILY;COUNT=3", "2024-01-03 09:30", "2024-01-03 09:00"},
+		{"daily count over", monday + "RRULE:FREQ=DAILY;COUNT=3", "2024-01-04 09:30", ""},
+		{"daily count years later", "DTSTART:20040101T090000Z\nDTEND:20040101T100000Z\nRRULE:FREQ=DAILY;COUNT=7000", "2023-03-01 09:30", "2023-03-01 09:00"},
+		{"daily count over years later", "DTSTART:20040101T090000Z\nDTEND:20040101T100000Z\nRRULE:FREQ=DAILY;COUNT=7000", "2023-03-02 09:30", ""},
+		{"daily until last", monday + "RRULE:FREQ=DAILY;UNTIL=20240103T090000Z", "2024-01-03 09:30", "2024-01-03 09:00"},
+		{"daily until over", monday + "RRULE:FREQ=DAILY;UNTIL=20240103T090000Z", "2024-01-04 09:30", ""},
+		{"daily excluded", monday + "RRULE:FREQ=DAILY\nEXDATE:20240102T090000Z", "2024-01-02 09:30", ""},
+		{"weekly", monday + "RRULE:FREQ=WEEKLY", "2024-01-15 09:30", "2024-01-15 09:00"},
+		{"weekly other day", monday + "RRULE:FREQ=WEEKLY", "2024-01-16 09:30", ""},
+		{"weekly every other week off", monday + "RRULE:FREQ=WEEKLY;INTERVAL=2", "2024-01-08 09:30", ""},
+		{"weekly every other week on", monday + "RRULE:FREQ=WEEKLY;INTERVAL=2", "2024-01-15 09:30", "2024-01-15 09:00"},
+		{"byday", monday + "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", "2024-01-17 09:30", "2024-01-17 09:00"},
+		{"byday other day", monday + "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", "2024-01-18 09:30", ""},
+		{"byday for twenty years", "DTSTART:20040105T090000Z\nDTEND:20040105T100000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", "2024-06-05 09:30", "2024-06-05 09:00"},
+		// Starts on a Wednesday, so its first week has two occurrences and the others three
+		{"byday count last", "DTSTART:20200108T090000Z\nDTEND:20200108T100000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=320", "2022-01-21 09:30", "2022-01-21 09:00"},
+		{"byday count over", "DTSTART:20200108T090000Z\nDTEND:20200108T100000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=320", "2022-01-24 09:30", ""},
+		{"byday until", monday + "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20240110T000000Z", "2024-01-10 09:30", ""},
+		{"daily byday", monday + "RRULE:FREQ=DAILY;BYDAY=MO,WE", "2024-01-03 09:30", "2024-01-03 09:00"},
+		{"daily byday other day", monday + "RRULE:FREQ=DAILY;BYDAY=MO,WE", "2024-01-04 09:30", ""},
+		// 150 weeks of two occurrences each
+		{"daily byday count last", "DTSTART:20200106T090000Z\nDTEND:20200106T100000Z\nRRULE:FREQ=DAILY;BYDAY=MO,WE;COUNT=300", "2022-11-16 09:30", "2022-11-16 09:00"},
+		{"daily byday count over", "DTSTART:20200106T090000Z\nDTEND:20200106T100000Z\nRRULE:FREQ=DAILY;BYDAY=MO,WE;COUNT=300", "2022-11-21 09:30", ""},
+		{"monthly", monday + "RRULE:FREQ=MONTHLY", "2024-03-01 09:30", "2024-03-01 09:00"},
+		{"monthly first monday", monday + "RRULE:FREQ=MONTHLY;BYDAY=1MO", "2024-02-05 09:30", "2024-02-05 09:00"},
+		{"monthly first monday other monday", monday + "RRULE:FREQ=MONTHLY;BYDAY=1MO", "2024-02-12 09:30", ""},
+		{"monthly last friday", "DTSTART:20240126T090000Z\nDTEND:20240126T100000Z\nRRULE:FREQ=MONTHLY;BYDAY=-1FR", "2024-03-29 09:30", "2024-03-29 09:00"},
+		{"monthly last day", "DTSTART:20240131T090000Z\nDTEND:20240131T100000Z\nRRULE:FREQ=MONTHLY;BYMONTHDAY=-1", "2024-02-29 09:30", "2024-02-29 09:00"},
+		{"monthly on the 31st skips short months", "DTSTART:20240131T090000Z\nDTEND:20240131T100000Z\nRRULE:FREQ=MONTHLY", "2024-03-02 09:30", ""},
+		{"yearly", monday + "RRULE:FREQ=YEARLY", "2026-01-01 09:30", "2026-01-01 09:00"},
+		{"yearly second sunday of may", "DTSTART:20240512T090000Z\nDTEND:20240512T100000Z\nRRULE:FREQ=YEARLY;BYMONTH=5;BYDAY=2SU", "2025-05-11 09:30", "2025-05-11 09:00"},
+		{"yearly first monday of the year", monday + "RRULE:FREQ=YEARLY;BYDAY=1MO", "2025-01-06 09:30", "2025-01-06 09:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := parseEvents(t, tt.event)
+			if len(events) != 1 {
+				t.Fatalf("parsed %d events, want 1", len(events))
+			}
+			start, _, ok := events[0].occurrenceAt(at(tt.at))
+			switch {
+			case tt.want == "" && ok:
+				t.Errorf("occurrenceAt(%s) = %v, want none", tt.at, start)
+			case tt.want != "" && !ok:
+				t.Errorf("occurrenceAt(%s) found none, want %s", tt.at, tt.want)
+			case tt.want != "" && !start.Equal(at(tt.want)):
+				t.Errorf("occurrenceAt(%s) = %v, want %s", tt.at, start, tt.want)
+			}
+		})
+	}
+}
+
+func TestBusyUntil(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		at     string
+		busy   bool
+		until  string
+	}{
+		{"free", []string{"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z"}, "2024-01-01 10:30", false, ""},
+		{"in a meeting", []string{"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z"}, "2024-01-01 09:30", true, "2024-01-01 10:00"},
+		{"back to back", []string{
+			"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z",
+			"DTSTART:20240101T100000Z\nDTEND:20240101T110000Z",
+		}, "2024-01-01 09:30", true, "2024-01-01 11:00"},
+		{"overlapping", []string{
+			"DTSTART:20240101T090000Z\nDTEND:20240101T103000Z",
+			"DTSTART:20240101T100000Z\nDTEND:20240101T120000Z",
+		}, "2024-01-01 09:30", true, "2024-01-01 12:00"},
+		{"gap after", []string{
+			"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z",
+			"DTSTART:20240101T101500Z\nDTEND:20240101T110000Z",
+		}, "2024-01-01 09:30", true, "2024-01-01 10:00"},
+		{"shown as free", []string{"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nTRANSP:TRANSPARENT"}, "2024-01-01 09:30", false, ""},
+		{"cancelled", []string{"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nSTATUS:CANCELLED"}, "2024-01-01 09:30", false, ""},
+		{"duration", []string{"DTSTART:20240101T090000Z\nDURATION:PT1H30M"}, "2024-01-01 10:15", true, "2024-01-01 10:30"},
+		{"recurring", []string{"DTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nRRULE:FREQ=DAILY"}, "2024-02-01 09:30", true, "2024-02-01 10:00"},
+		{"moved occurrence", []string{
+			"UID:standup\nDTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nRRULE:FREQ=DAILY",
+			"UID:standup\nRECURRENCE-ID:20240102T090000Z\nDTSTART:20240102T140000Z\nDTEND:20240102T150000Z",
+		}, "2024-01-02 09:30", false, ""},
+		{"moved occurrence at its new time", []string{
+			"UID:standup\nDTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nRRULE:FREQ=DAILY",
+			"UID:standup\nRECURRENCE-ID:20240102T090000Z\nDTSTART:20240102T140000Z\nDTEND:20240102T150000Z",
+		}, "2024-01-02 14:30", true, "2024-01-02 15:00"},
+		{"all day every day", []string{"DTSTART;VALUE=DATE:20240101\nRRULE:FREQ=DAILY"}, "2024-01-01 12:00", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := at(tt.at)
+			busy, until := busyUntil(parseEvents(t, tt.events...), now)
+			if busy != tt.busy {
+				t.Fatalf("busyUntil(%s) busy = %v, want %v", tt.at, busy, tt.busy)
+			}
+			if tt.until != "" && !until.Equal(at(tt.until)) {
+				t.Errorf("busyUntil(%s) = %v, want %s", tt.at, until, tt.until)
+			}
+			if busy && !until.After(now) {
+				t.Errorf("busyUntil(%s) = %v, not after now", tt.at, until)
+			}
+		})
+	}
+}
+
+func TestParseICSSkipsMalformedEvents(t *testing.T) {
+	events := parseEvents(t,
+		"UID:good\nDTSTART:20240101T090000Z\nDTEND:20240101T100000Z",
+		"UID:bad start\nDTSTART:2024-01-01\nDTEND:20240101T100000Z",
+		"UID:bad rule\nDTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nRRULE:INTERVAL=2",
+		"UID:bad duration\nDTSTART:20240101T090000Z\nDURATION:1H",
+		"UID:unsupported rule\nDTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nRRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+		"UID:weekly position\nDTSTART:20240101T090000Z\nDTEND:20240101T100000Z\nRRULE:FREQ=WEEKLY;BYDAY=1MO",
+		"UID:also good\nDTSTART:20240102T090000Z\nDTEND:20240102T100000Z",
+	)
+	var uids []string
+	for _, ev := range events {
+		uids = append(uids, ev.uid)
+	}
+	if got := strings.Join(uids, ","); got != "good,also good" {
+		t.Errorf("parsed events %s, want good,also good", got)
+	}
+}
@@ -0,0 +1,226 @@
+// Package control lets n0tif commands talk to the running monitor of the same
+// profile, e.g. to pause it while its data is backed up.
+//
+// The monitor listens on a named pipe on Windows and a Unix socket elsewhere, and
+// publishes its address and a random token in control.json in the profile folder;
+// only processes that can read that file can send commands.
+//
+// Each connection carries one request and one response, both JSON objects:
+//
+//	{"token": "...", "command": "pause", "arg": "30m"}
+//	{"reply": "paused for 30m0s"} or {"error": "invalid duration \"x\""}
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// infoFileName is written to the profile folder while a monitor is running
+const infoFileName = "control.json"
+
+// ErrNotRunning is returned by Call when no monitor is listening for the profile
+var ErrNotRunning = errors.New("n0tif is not running for this profile")
+
+// maxArgSize limits the argument a command accepts
+const maxArgSize = 4096
+
+// requestTimeout bounds how long the server waits for a client to send its request
+const requestTimeout = 5 * time.Second
+
+// Handler runs a command with its optional argument and returns a short reply
+type Handler func(arg string) (string, error)
+
+type info struct {
+	Address string `json:"address"`
+	Token   string `json:"token"`
+	PID     int    `json:"pid"`
+}
+
+// request is what a client sends over the connection
+type request struct {
+	Token   string `json:"token"`
+	Command string `json:"command"`
+	Arg     string `json:"arg,omitempty"`
+}
+
+// response is what the server answers; Error is set when the command failed
+type response struct {
+	Reply string `json:"reply,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// listener accepts connections on the platform's local transport
+type listener interface {
+	Accept() (io.ReadWriteCloser, error)
+	Close() error
+}
+
+// Server answers commands for a running monitor
+type Server struct {
+	listener listener
+	infoPath string
+	token    string
+	commands map[string]Handler
+}
+
+// Serve starts answering the given commands and publishes the server in dir
+func Serve(dir string, commands map[string]Handler) (*Server, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+
+	l, address, err := listen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: l,
+		infoPath: filepath.Join(dir, infoFileName),
+		token:    hex.EncodeToString(tokenBytes),
+		commands: commands,
+	}
+
+	data, err := json.Marshal(info{Address: address, Token: s.token, PID: os.Getpid()})
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	tempPath := s.infoPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tempPath, s.infoPath); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	go s.acceptLoop()
+	return s, nil
+}
+
+// acceptLoop serves connections until the listener is closed
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the single request of a connection
+func (s *Server) handle(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	if d, ok := conn.(interface{ SetDeadline(time.Time) error }); ok {
+		_ = d.SetDeadline(time.Now().Add(requestTimeout))
+	}
+
+	var req request
+	// Leave room for the token and the JSON around the argument
+	if err := json.NewDecoder(io.LimitReader(conn, 2*maxArgSize)).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(response{Error: "malformed request"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.token)) != 1 {
+		json.NewEncoder(conn).Encode(response{Error: "forbidden"})
+		return
+	}
+	handler, ok := s.commands[req.Command]
+	if !ok {
+		json.NewEncoder(conn).Encode(response{Error: "unknown command"})
+		return
+	}
+	if len(req.Arg) > maxArgSize {
+		json.NewEncoder(conn).Encode(response{Error: "argument too long"})
+		return
+	}
+
+	// Handlers such as check-now may take longer than the request deadline
+	if d, ok := conn.(interface{ SetDeadline(time.Time) error }); ok {
+		_ = d.SetDeadline(time.Time{})
+	}
+	reply, err := handler(req.Arg)
+	if err != nil {
+		json.NewEncoder(conn).Encode(response{Error: err.Error()})
+		return
+	}
+	json.NewEncoder(conn).Encode(response{Reply: reply})
+}
+
+// Close stops answering commands and removes control.json
+func (s *Server) Close() error {
+	os.Remove(s.infoPath)
+	return s.listener.Close()
+}
+
+// Call sends a command to the monitor published in dir and returns its reply
+func Call(dir, command string, timeout time.Duration) (string, error) {
+	return CallWithArg(dir, command, "", timeout)
+}
+
+// CallWithArg is like Call but passes an argument to the command
+func CallWithArg(dir, command, arg string, timeout time.Duration) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, infoFileName))
+	if os.IsNotExist(err) {
+		return "", ErrNotRunning
+	}
+	if err != nil {
+		return "", err
+	}
+	var i info
+	if err := json.Unmarshal(data, &i); err != nil {
+		return "", fmt.Errorf("parse %s: %w", infoFileName, err)
+	}
+	if i.Address == "" {
+		return "", fmt.Errorf("%s was written by an older version of n0tif; restart it", infoFileName)
+	}
+
+	deadline := time.Now().Add(timeout)
+	conn, err := dial(i.Address, deadline)
+	if err != nil {
+		return "", err
+	}
+
+	type result struct {
+		resp response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		if r.err = json.NewEncoder(conn).Encode(request{Token: i.Token, Command: command, Arg: arg}); r.err == nil {
+			r.err = json.NewDecoder(conn).Decode(&r.resp)
+		}
+		done <- r
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		conn.Close()
+		if r.err != nil {
+			return "", r.err
+		}
+		if r.resp.Error != "" {
+			return "", fmt.Errorf("%s: %s", command, r.resp.Error)
+		}
+		return r.resp.Reply, nil
+	case <-timer.C:
+		conn.Close()
+		return "", fmt.Errorf("%s: no reply within %v", command, timeout)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package control
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// socketFileName is the Unix socket in the profile folder
+const socketFileName = "control.sock"
+
+// socketListener hands out the connections of a Unix socket
+type socketListener struct {
+	net.Listener
+}
+
+func (l socketListener) Accept() (io.ReadWriteCloser, error) {
+	return l.Listener.Accept()
+}
+
+// listen creates the socket in dir; the folder permissions keep other users out
+func listen(dir string) (listener, string, error) {
+	path := filepath.Join(dir, socketFileName)
+	// A socket left behind by a monitor that didn't shut down cleanly
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, "", err
+	}
+	return socketListener{l}, path, nil
+}
+
+// dial connects to the socket at address
+func dial(address string, deadline time.Time) (io.ReadWriteCloser, error) {
+	conn, err := net.DialTimeout("unix", address, time.Until(deadline))
+	if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+		// control.json left behind by a monitor that didn't shut down cleanly
+		return nil, ErrNotRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(deadline)
+	return conn, nil
+}
@@ -0,0 +1,139 @@
+package control
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the in and out buffer size of each pipe instance
+const pipeBufferSize = 4096
+
+// pipeListener serves a named pipe, keeping one instance waiting for the next client
+type pipeListener struct {
+	name string
+	sa   *windows.SecurityAttributes
+
+	mu     sync.Mutex
+	next   windows.Handle
+	closed bool
+}
+
+// listen creates a named pipe with a random name that only the current user,
+// administrators and the system can open, and refuses clients on other machines
+func listen(string) (listener, string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, "", err
+	}
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, "", err
+	}
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return nil, "", err
+	}
+
+	l := &pipeListener{
+		name: `\\.\pipe\n0tif-` + hex.EncodeToString(suffix),
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+	}
+	if l.next, err = l.createInstance(true); err != nil {
+		return nil, "", err
+	}
+	return l, l.name, nil
+}
+
+// createInstance creates the next instance of the pipe for a client to connect to
+func (l *pipeListener) createInstance(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX)
+	if first {
+		// Fail instead of sharing the name with another process
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	return windows.CreateNamedPipe(name, flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, l.sa)
+}
+
+func (l *pipeListener) Accept() (io.ReadWriteCloser, error) {
+	l.mu.Lock()
+	h := l.next
+	l.mu.Unlock()
+	if h == windows.InvalidHandle {
+		return nil, net.ErrClosed
+	}
+
+	err := windows.ConnectNamedPipe(h, nil)
+	if err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		// Woken up by Close
+		windows.CloseHandle(h)
+		l.next = windows.InvalidHandle
+		return nil, net.ErrClosed
+	}
+	if l.next, err = l.createInstance(false); err != nil {
+		l.next = windows.InvalidHandle
+	}
+	return os.NewFile(uintptr(h), l.name), nil
+}
+
+// Close stops accepting clients. ConnectNamedPipe can't be interrupted, so Close
+// connects to the waiting instance itself to let Accept return.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	waiting := l.next != windows.InvalidHandle
+	l.mu.Unlock()
+
+	if waiting {
+		if f, err := os.OpenFile(l.name, os.O_RDWR, 0); err == nil {
+			f.Close()
+		}
+	}
+	return nil
+}
+
+// dial opens the pipe at address, waiting while all of its instances are busy
+func dial(address string, deadline time.Time) (io.ReadWriteCloser, error) {
+	for {
+		f, err := os.OpenFile(address, os.O_RDWR, 0)
+		if err == nil {
+			return f, nil
+		}
+		if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			// control.json left behind by a monitor that didn't shut down cleanly
+			return nil, ErrNotRunning
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,103 @@
+package email
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrAppPasswordRequired means the provider refused the account's password
+// because mail clients have to log in with an app password. Errors of this
+// class are ErrAuthFailed too.
+var ErrAppPasswordRequired = errors.New("app password required")
+
+// AppPasswordProvider describes how to get an app password from a provider
+type AppPasswordProvider struct {
+	Name  string   // the provider, e.g. Gmail
+	URL   string   // the page that creates app passwords
+	Steps []string // what to do on the page
+	// Always is set for providers that refuse the account password of every
+	// mail client, so that any refused login asks for an app password
+	Always bool
+}
+
+// appPasswordProviders are the providers known to require app passwords, by IMAP server
+var appPasswordProviders = map[string]AppPasswordProvider{
+	"imap.gmail.com": {
+		Name: "Gmail",
+		URL:  "https://myaccount.google.com/apppasswords",
+		Steps: []string{
+			"Turn on 2-Step Verification for the Google account if it isn't on yet.",
+			"Enter a name such as n0tif and click Create.",
+			"Copy the 16-character password; the spaces don't matter.",
+		},
+	},
+	"imap.mail.yahoo.com": {
+		Name: "Yahoo Mail",
+		URL:  "https://login.yahoo.com/account/security/app-passwords",
+		Steps: []string{
+			"Click Generate app password, or Manage app passwords if there are some already.",
+			"Enter n0tif as the app name and click Generate password.",
+			"Copy the password shown.",
+		},
+		Always: true,
+	},
+	"imap.aol.com": {
+		Name: "AOL Mail",
+		URL:  "https://login.aol.com/account/security/app-passwords",
+		Steps: []string{
+			"Click Generate app password.",
+			"Enter n0tif as the app name and click Generate password.",
+			"Copy the password shown.",
+		},
+		Always: true,
+	},
+	"imap.mail.me.com": {
+		Name: "iCloud Mail",
+		URL:  "https://account.apple.com/account/manage",
+		Steps: []string{
+			"Sign in and open Sign-In and Security, then App-Specific Passwords.",
+			"Click Generate an app-specific password and enter n0tif as its name.",
+			"Copy the password shown.",
+		},
+		Always: true,
+	},
+}
+
+// appPasswordMarkers are what providers put into the answers refusing the
+// account password of a mail client, in lower case
+var appPasswordMarkers = []string{
+	"application-specific password required",
+	"app-specific password",
+	"app password",
+}
+
+// AppPasswordGuide returns how to get an app password for the account on the
+// IMAP server, if the provider is known to require one
+func AppPasswordGuide(server string) (AppPasswordProvider, bool) {
+	p, ok := appPasswordProviders[strings.ToLower(server)]
+	return p, ok
+}
+
+// wantsAppPassword reports whether the refused login err on server asks for an app password
+func wantsAppPassword(server string, err error) bool {
+	if p, ok := AppPasswordGuide(server); ok && p.Always {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range appPasswordMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyLogin classifies the error of logging in to server: a refusal that
+// asks for an app password is ErrAppPasswordRequired as well as ErrAuthFailed
+func classifyLogin(server string, err error) error {
+	err = classifyReply(ErrAuthFailed, err)
+	if errors.Is(err, ErrAuthFailed) && wantsAppPassword(server, err) {
+		return classify(ErrAppPasswordRequired, err)
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package email
+
+import (
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connectionWait is how long a connection waits for a free place in the
+// budget of its server before it fails
+const connectionWait = 2 * time.Minute
+
+// defaultConnectionBudgets are how many connections the n0tif processes of all
+// profiles open at once to the servers of providers known to limit them. They
+// stay well below the limits, which count the phones and mail clients of the
+// same accounts too.
+var defaultConnectionBudgets = map[string]int{
+	"imap.gmail.com":        10, // 15 sessions per account
+	"outlook.office365.com": 10, // 20 per mailbox
+	"imap.mail.yahoo.com":   5,
+}
+
+var (
+	budgetsMu         sync.Mutex
+	connectionBudgets = defaultConnectionBudgets
+)
+
+// SetConnectionBudgets changes how many connections may be open at once to an
+// IMAP server, by host name, across all profiles of the machine. They replace
+// the defaults of the servers they name; 0 lifts the limit of a server.
+func SetConnectionBudgets(budgets map[string]int) {
+	merged := maps.Clone(defaultConnectionBudgets)
+	for host, n := range budgets {
+		merged[strings.ToLower(host)] = n
+	}
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+	connectionBudgets = merged
+}
+
+// connectionBudget returns the budget of host; 0 means no limit
+func connectionBudget(host string) int {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+	return connectionBudgets[strings.ToLower(host)]
+}
@@ -0,0 +1,36 @@
+package email
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+)
+
+// imapClient is the part of the go-imap client a check uses. The checker talks
+// to the server through it, so tests can put an in-memory mailbox in its place.
+type imapClient interface {
+	Select(name string, readOnly bool) (*imap.MailboxStatus, error)
+	Search(criteria *imap.SearchCriteria) (seqNums []uint32, err error)
+	Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error
+	UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error
+	Logout() error
+	Terminate() error
+}
+
+// dialFunc connects to the account's server and logs in
+type dialFunc func(cfg config.EmailConfig) (imapClient, error)
+
+// dialServer returns the dialFunc of a real server, connecting through d with
+// tlsConfig; nil means the defaults of Dial. A connection waits up to wait for
+// a place in the connection budget of the server.
+func dialServer(d Dialer, tlsConfig *tls.Config, wait time.Duration) dialFunc {
+	return func(cfg config.EmailConfig) (imapClient, error) {
+		c, conn, err := dialTLS(cfg, d, tlsConfig, wait)
+		if err != nil {
+			return nil, err
+		}
+		return &countedClient{imapClient: c, conn: conn}, nil
+	}
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap/client"
+)
+
+// diagnoseTimeout bounds each network step of Diagnose
+const diagnoseTimeout = 15 * time.Second
+
+// Diagnostic steps, in the order Diagnose runs them
+const (
+	StepDNS    = "DNS lookup"
+	StepTCP    = "TCP connect"
+	StepTLS    = "TLS handshake"
+	StepLogin  = "Login"
+	StepSelect = "Select " + mailboxName
+)
+
+// StepResult is the outcome of one step of Diagnose
+type StepResult struct {
+	Step    string
+	Details []string // what was found, e.g. addresses or certificate fields
+	Err     error
+}
+
+// Diagnose connects to the account step by step and calls report after each step,
+// so a failure can be pinned to name resolution, the network, TLS, the credentials
+// or the mailbox. It stops at the first failing step and returns its error, which
+// wraps ErrNetworkUnreachable, ErrAuthFailed, ErrMailboxNotFound or ErrThrottled.
+func Diagnose(cfg config.EmailConfig, report func(StepResult)) error {
+	run := func(step string, f func() ([]string, error)) error {
+		details, err := f()
+		switch step {
+		case StepLogin:
+			err = classifyLogin(cfg.ImapServer, err)
+		case StepSelect:
+			err = classifyReply(ErrMailboxNotFound, err)
+		case StepTLS:
+			err = classifyHandshake(err)
+		default:
+			err = classify(ErrNetworkUnreachable, err)
+		}
+		report(StepResult{Step: step, Details: details, Err: err})
+		return err
+	}
+
+	var addrs []string
+	err := run(StepDNS, func() ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+		defer cancel()
+		var err error
+		addrs, err = net.DefaultResolver.LookupHost(ctx, cfg.ImapServer)
+		if err != nil {
+			return nil, err
+		}
+		return []string{strings.Join(addrs, ", ")}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	err = run(StepTCP, func() ([]string, error) {
+		var errs []error
+		for _, addr := range addrs {
+			target := net.JoinHostPort(addr, strconv.Itoa(cfg.ImapPort))
+			start := time.Now()
+			c, err := net.DialTimeout("tcp", target, diagnoseTimeout)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			conn = c
+			return []string{fmt.Sprintf("%s in %v", target, time.Since(start).Round(time.Millisecond))}, nil
+		}
+		return nil, errors.Join(errs...)
+	})
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := tlsConfigFor(cfg, &tls.Config{ServerName: cfg.ImapServer})
+	if err != nil {
+		conn.Close()
+		report(StepResult{Step: StepTLS, Err: err})
+		return err
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	err = run(StepTLS, func() ([]string, error) {
+		tlsConn.SetDeadline(time.Now().Add(diagnoseTimeout))
+		defer tlsConn.SetDeadline(time.Time{})
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		return describeTLS(tlsConn.ConnectionState()), nil
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := client.New(tlsConn)
+	if err != nil {
+		err = fmt.Errorf("read server greeting: %w", classify(ErrNetworkUnreachable, err))
+		report(StepResult{Step: StepLogin, Err: err})
+		tlsConn.Close()
+		return err
+	}
+	defer c.Logout()
+
+	err = run(StepLogin, func() ([]string, error) {
+		if err := c.Login(cfg.Username, cfg.Password); err != nil {
+			return nil, err
+		}
+		return []string{"as " + cfg.Username}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return run(StepSelect, func() ([]string, error) {
+		mbox, err := c.Select(mailboxName, true)
+		if err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("%d messages, %d recent", mbox.Messages, mbox.Recent)}, nil
+	})
+}
+
+// describeTLS summarizes the negotiated TLS version and the server certificate
+func describeTLS(state tls.ConnectionState) []string {
+	details := []string{
+		fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)),
+	}
+	if len(state.PeerCertificates) == 0 {
+		return details
+	}
+	cert := state.PeerCertificates[0]
+	details = append(details,
+		"Subject: "+cert.Subject.String(),
+		"Issuer: "+cert.Issuer.String(),
+		fmt.Sprintf("Valid: %s to %s", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02")),
+	)
+	if len(cert.DNSNames) > 0 {
+		details = append(details, "Names: "+strings.Join(cert.DNSNames, ", "))
+	}
+	details = append(details, "Pin (pin_sha256): "+PinOf(cert))
+	return details
+}
@@ -0,0 +1,130 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Classes of failure. The errors of Dial, Diagnose and the checks wrap one of
+// them when the cause is known, so callers can react with errors.Is instead of
+// matching messages.
+var (
+	// ErrAuthFailed means the server refused the username or password
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrNetworkUnreachable means the server couldn't be reached or the connection dropped
+	ErrNetworkUnreachable = errors.New("server unreachable")
+	// ErrMailboxNotFound means the server refused to open the mailbox
+	ErrMailboxNotFound = errors.New("mailbox not found")
+	// ErrThrottled means the provider refused the login or command for too many
+	// connections or requests; it lets up after a while
+	ErrThrottled = errors.New("throttled by provider")
+	// ErrCertificateUntrusted means the server's certificate failed verification,
+	// or doesn't have the key pinned with pin_sha256
+	ErrCertificateUntrusted = errors.New("server certificate not trusted")
+)
+
+// throttleMarkers are what providers put into the answers refusing too many
+// connections or requests, in lower case: Gmail, Outlook and the response codes of RFC 5530
+var throttleMarkers = []string{
+	"too many simultaneous connections",
+	"exceeded command or bandwidth limits",
+	"throttl",
+	"[limit]",
+	"[unavailable]",
+	"rate limit",
+}
+
+// isThrottled reports whether the server's answer err refuses too many connections or requests
+func isThrottled(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, marker := range throttleMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// classError puts an error into a class without changing its message
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() []error {
+	return []error{e.class, e.err}
+}
+
+// classify marks err as being of class; a nil err stays nil
+func classify(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{class: class, err: err}
+}
+
+// classifyReply classifies the error of a command: the connection failing is a
+// network error, a refusal for too many connections or requests is throttling,
+// anything else means the server answered with NO or BAD, which for this
+// command is class.
+func classifyReply(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	if isNetworkError(err) {
+		return classify(ErrNetworkUnreachable, err)
+	}
+	if isThrottled(err) {
+		return classify(ErrThrottled, err)
+	}
+	return classify(class, err)
+}
+
+// classifyTransport classifies the error of a command the server has no reason
+// to refuse, so that only a failing connection or throttling is put into a class
+func classifyTransport(err error) error {
+	if isNetworkError(err) {
+		return classify(ErrNetworkUnreachable, err)
+	}
+	if isThrottled(err) {
+		return classify(ErrThrottled, err)
+	}
+	return err
+}
+
+// isNetworkError reports whether err came from the connection rather than from
+// the server's answer. go-imap returns the text of NO and BAD responses as
+// plain errors, and a closed connection as one too.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		strings.HasPrefix(err.Error(), "imap: connection closed")
+}
+
+// dialFailed and loginFailed wrap the errors of the two stages of connecting
+func dialFailed(err error) error {
+	return fmt.Errorf("connect DialTLS: %w", classifyHandshake(err))
+}
+
+// classifyHandshake classifies the error of connecting: an untrusted certificate,
+// or else the network
+func classifyHandshake(err error) error {
+	if isCertificateError(err) {
+		return classify(ErrCertificateUntrusted, err)
+	}
+	return classify(ErrNetworkUnreachable, err)
+}
+
+func loginFailed(server string, err error) error {
+	return fmt.Errorf("connect Login: %w", classifyLogin(server, err))
+}
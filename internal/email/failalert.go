@@ -0,0 +1,95 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCredentialsChanged marks a refused login of an account that logged in
+// before, e.g. after its password was changed or its app password revoked. The
+// failure handler is told about it together with ErrAuthFailed.
+var ErrCredentialsChanged = errors.New("login refused after working before")
+
+// SetFailureHandler sets a function that is told, on its own goroutine, once checks
+// have failed without a success in between for at least window, and again with a
+// nil error when a check succeeds after that. A zero window disables it, except
+// for ErrCredentialsChanged, which only the user can fix. Call it before
+// StartChecking; SetFailureWindow changes the window later.
+func (ic *ImapChecker) SetFailureHandler(window time.Duration, handler func(since time.Time, err error)) {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	ic.failureWindow = window
+	ic.onFailure = handler
+}
+
+// SetFailureWindow changes how long checks have to fail before the failure handler is told
+func (ic *ImapChecker) SetFailureWindow(window time.Duration) {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	ic.failureWindow = window
+}
+
+// trackFailure follows how long checks have been failing and tells the failure
+// handler when the window is exceeded or checks work again. A refused login is
+// reported right away: retrying won't fix it, and waiting only risks the account
+// being locked. Called with statusMu held.
+func (ic *ImapChecker) trackFailure(err error, now time.Time) {
+	if err == nil {
+		ic.loggedIn = true
+		if ic.failureAlerted && ic.onFailure != nil {
+			go ic.onFailure(ic.failingSince, nil)
+		}
+		ic.failingSince = time.Time{}
+		ic.failureAlerted = false
+		return
+	}
+	if ic.failingSince.IsZero() {
+		ic.failingSince = now
+	}
+	if ic.failureAlerted || ic.onFailure == nil {
+		return
+	}
+	switch {
+	case errors.Is(err, ErrAuthFailed) && ic.loggedIn:
+		err = fmt.Errorf("%w: %w", ErrCredentialsChanged, err)
+	case ic.failureWindow <= 0:
+		return
+	case now.Sub(ic.failingSince) < ic.failureWindow && !errors.Is(err, ErrAuthFailed):
+		return
+	}
+	ic.failureAlerted = true
+	go ic.onFailure(ic.failingSince, err)
+}
+
+// forgetFailures stops failures from counting towards the alert, e.g. while the
+// machine is offline and the user knows why mail isn't arriving
+func (ic *ImapChecker) forgetFailures() {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	if !ic.failureAlerted {
+		ic.failingSince = time.Time{}
+	}
+}
+
+// FailureHint guesses the likely cause of a failed check for a notification
+func FailureHint(err error) string {
+	switch {
+	case errors.Is(err, ErrAppPasswordRequired):
+		return "the provider wants an app password; run 'n0tif app-password'"
+	case errors.Is(err, ErrCredentialsChanged):
+		return "the password was changed or revoked; enter the new one"
+	case errors.Is(err, ErrAuthFailed):
+		return "password expired or changed?"
+	case errors.Is(err, ErrCertificateUntrusted):
+		return "server certificate changed or not trusted; see 'n0tif doctor'"
+	case errors.Is(err, ErrNetworkUnreachable):
+		return "server down or blocked by a firewall?"
+	case errors.Is(err, ErrMailboxNotFound):
+		return "inbox deleted or not accessible?"
+	case errors.Is(err, ErrThrottled):
+		return "the provider limits connections; too many devices or a short check interval?"
+	default:
+		return "see the log for details"
+	}
+}
@@ -0,0 +1,384 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+)
+
+// fakeMailbox is an in-memory IMAP server with a single INBOX. Its dial method
+// takes the place of dialServer, each call opening a new connection.
+type fakeMailbox struct {
+	mu          sync.Mutex
+	uidValidity uint32
+	uidNext     uint32
+	messages    []fakeMessage // in sequence number order
+
+	dialErr  error            // makes connecting fail while set
+	loginErr error            // makes logging in fail while set
+	failNext map[string]error // makes the next call of a command fail, e.g. "search"
+	failAll  map[string]error // makes every call of a command fail while set
+	stall    bool             // makes SELECT hang until the connection is terminated
+	stalled  int              // SELECTs hanging
+	dials    int              // connections opened
+	attempts int              // calls of dial, failed ones included
+	holdFrom int              // dial attempts from this one on hang until hold is closed
+	hold     chan struct{}    // set by holdDials
+	fetches  fetchStats
+	open     map[*fakeConn]bool // connections neither logged out nor terminated
+}
+
+// fetchStats counts what FETCH commands asked for
+type fetchStats struct {
+	commands  int
+	largest   int // most messages asked for at once
+	envelopes int // envelopes sent
+}
+
+type fakeMessage struct {
+	uid     uint32
+	date    time.Time
+	from    *imap.Address
+	subject string
+	seen    bool
+
+	// Threading headers, set by thread
+	messageID  string
+	to         *imap.Address
+	references string
+}
+
+func newFakeMailbox() *fakeMailbox {
+	return &fakeMailbox{
+		uidValidity: 1,
+		uidNext:     1,
+		failNext:    map[string]error{},
+		failAll:     map[string]error{},
+		open:        map[*fakeConn]bool{},
+	}
+}
+
+// deliver adds a message from "Name <user@host>" or "user@host" and returns its UID
+func (m *fakeMailbox) deliver(from, subject string, date time.Time) uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	addr := &imap.Address{}
+	if i := strings.Index(from, " <"); i >= 0 {
+		addr.PersonalName, from = from[:i], strings.TrimSuffix(from[i+2:], ">")
+	}
+	addr.MailboxName, addr.HostName, _ = strings.Cut(from, "@")
+
+	uid := m.uidNext
+	m.uidNext++
+	m.messages = append(m.messages, fakeMessage{uid: uid, date: date, from: addr, subject: subject})
+	return uid
+}
+
+// resetUIDValidity renumbers every message under a new UIDVALIDITY, as servers
+// do when a mailbox is rebuilt
+func (m *fakeMailbox) resetUIDValidity() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uidValidity++
+	m.uidNext = 1
+	for i := range m.messages {
+		m.messages[i].uid = m.uidNext
+		m.uidNext++
+	}
+}
+
+// markSeen sets the \Seen flag of the message with uid, as if it was read elsewhere
+func (m *fakeMailbox) markSeen(uid uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.messages {
+		if m.messages[i].uid == uid {
+			m.messages[i].seen = true
+		}
+	}
+}
+
+// thread gives the message with uid a Message-ID, a recipient and the
+// References header of a reply; empty values are left unset
+func (m *fakeMailbox) thread(uid uint32, messageID, to, references string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.messages {
+		if m.messages[i].uid != uid {
+			continue
+		}
+		m.messages[i].messageID = messageID
+		m.messages[i].references = references
+		if to != "" {
+			addr := &imap.Address{}
+			addr.MailboxName, addr.HostName, _ = strings.Cut(to, "@")
+			m.messages[i].to = addr
+		}
+	}
+}
+
+// failOnce makes the next call of command fail with err, as if the connection dropped
+func (m *fakeMailbox) failOnce(command string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failNext[command] = err
+}
+
+// failAlways makes every call of command fail with err, as on a connection that
+// keeps dropping, until called with a nil err
+func (m *fakeMailbox) failAlways(command string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.failAll, command)
+		return
+	}
+	m.failAll[command] = err
+}
+
+func (m *fakeMailbox) setDialError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dialErr = err
+}
+
+// setLoginError makes logging in fail with err, a refusal by the server unless
+// it is a connection error
+func (m *fakeMailbox) setLoginError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loginErr = err
+}
+
+// setStall makes SELECT hang, as on a server that stopped answering
+func (m *fakeMailbox) setStall(stall bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stall = stall
+}
+
+// stalledCommands returns how many commands hang because of setStall
+func (m *fakeMailbox) stalledCommands() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stalled
+}
+
+// fetchStats returns what the FETCH commands so far asked for
+func (m *fakeMailbox) fetchStats() fetchStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fetches
+}
+
+// stats returns how many connections were opened and how many are still open
+func (m *fakeMailbox) stats() (dials, open int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dials, len(m.open)
+}
+
+// holdDials makes connecting hang after n more connections, as for a server
+// whose connection budget is used up, until release is called
+func (m *fakeMailbox) holdDials(n int) (release func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hold := make(chan struct{})
+	m.hold, m.holdFrom = hold, m.attempts+n+1
+	var once sync.Once
+	return func() { once.Do(func() { close(hold) }) }
+}
+
+func (m *fakeMailbox) dial(cfg config.EmailConfig) (imapClient, error) {
+	m.mu.Lock()
+	m.attempts++
+	if m.hold != nil && m.attempts >= m.holdFrom {
+		hold := m.hold
+		m.mu.Unlock()
+		<-hold
+		m.mu.Lock()
+	}
+	defer m.mu.Unlock()
+	if m.dialErr != nil {
+		return nil, dialFailed(m.dialErr)
+	}
+	if m.loginErr != nil {
+		return nil, loginFailed(cfg.ImapServer, m.loginErr)
+	}
+	m.dials++
+	c := &fakeConn{mbox: m, closed: make(chan struct{})}
+	m.open[c] = true
+	return c, nil
+}
+
+// fakeConn is a connection to a fakeMailbox
+type fakeConn struct {
+	mbox       *fakeMailbox
+	selected   bool
+	closed     chan struct{} // closed by Terminate
+	terminated bool
+}
+
+var errConnClosed = errors.New("imap: connection closed")
+
+// begin starts a command, returning the error it has to fail with if any. mu must be held.
+func (c *fakeConn) begin(command string) error {
+	if !c.mbox.open[c] {
+		return errConnClosed
+	}
+	if err, ok := c.mbox.failNext[command]; ok {
+		delete(c.mbox.failNext, command)
+		delete(c.mbox.open, c)
+		return err
+	}
+	if err, ok := c.mbox.failAll[command]; ok {
+		delete(c.mbox.open, c)
+		return err
+	}
+	return nil
+}
+
+func (c *fakeConn) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	c.mbox.mu.Lock()
+	defer c.mbox.mu.Unlock()
+	if err := c.begin("select"); err != nil {
+		return nil, err
+	}
+	if c.mbox.stall {
+		c.mbox.stalled++
+		c.mbox.mu.Unlock()
+		<-c.closed
+		c.mbox.mu.Lock()
+		c.mbox.stalled--
+		return nil, errConnClosed
+	}
+	if name != mailboxName {
+		return nil, fmt.Errorf("no such mailbox %q", name)
+	}
+	c.selected = true
+	status := imap.NewMailboxStatus(name, nil)
+	status.Messages = uint32(len(c.mbox.messages))
+	status.UidValidity = c.mbox.uidValidity
+	status.UidNext = c.mbox.uidNext
+	return status, nil
+}
+
+// Search supports SINCE, which like on a real server compares dates only
+func (c *fakeConn) Search(criteria *imap.SearchCriteria) ([]uint32, error) {
+	c.mbox.mu.Lock()
+	defer c.mbox.mu.Unlock()
+	if err := c.begin("search"); err != nil {
+		return nil, err
+	}
+	if !c.selected {
+		return nil, errors.New("no mailbox selected")
+	}
+	var seqNums []uint32
+	for i, msg := range c.mbox.messages {
+		if msg.matches(criteria) {
+			seqNums = append(seqNums, uint32(i+1))
+		}
+	}
+	return seqNums, nil
+}
+
+// matches supports the criteria n0tif searches with: SINCE, UNSEEN, the
+// References and In-Reply-To headers and OR of those
+func (msg fakeMessage) matches(criteria *imap.SearchCriteria) bool {
+	if !criteria.Since.IsZero() {
+		y, mo, d := criteria.Since.Date()
+		since := time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+		y, mo, d = msg.date.Date()
+		if time.Date(y, mo, d, 0, 0, 0, 0, time.UTC).Before(since) {
+			return false
+		}
+	}
+	if slices.Contains(criteria.WithoutFlags, imap.SeenFlag) && msg.seen {
+		return false
+	}
+	for name, values := range criteria.Header {
+		for _, v := range values {
+			// Only a reply has these headers, and In-Reply-To names what References ends with
+			if (name != "References" && name != "In-Reply-To") || msg.references == "" || !strings.Contains(msg.references, v) {
+				return false
+			}
+		}
+	}
+	for _, or := range criteria.Or {
+		if !msg.matches(or[0]) && !msg.matches(or[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *fakeConn) Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetch(seqset, items, ch, false)
+}
+
+func (c *fakeConn) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetch(seqset, items, ch, true)
+}
+
+// fetch sends the messages of seqset, sequence numbers or UIDs if byUID
+func (c *fakeConn) fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message, byUID bool) error {
+	defer close(ch)
+	c.mbox.mu.Lock()
+	if err := c.begin("fetch"); err != nil {
+		c.mbox.mu.Unlock()
+		return err
+	}
+	// Like a server, only the items asked for are sent
+	var found []*imap.Message
+	for i, msg := range c.mbox.messages {
+		seqNum := uint32(i + 1)
+		if (byUID && !seqset.Contains(msg.uid)) || (!byUID && !seqset.Contains(seqNum)) {
+			continue
+		}
+		m := &imap.Message{SeqNum: seqNum}
+		for _, item := range items {
+			switch item {
+			case imap.FetchUid:
+				m.Uid = msg.uid
+			case imap.FetchInternalDate:
+				m.InternalDate = msg.date
+			case imap.FetchEnvelope:
+				m.Envelope = &imap.Envelope{Date: msg.date, Subject: msg.subject, From: []*imap.Address{msg.from}, MessageId: msg.messageID}
+				if msg.to != nil {
+					m.Envelope.To = []*imap.Address{msg.to}
+				}
+				c.mbox.fetches.envelopes++
+			}
+		}
+		found = append(found, m)
+	}
+	c.mbox.fetches.commands++
+	c.mbox.fetches.largest = max(c.mbox.fetches.largest, len(found))
+	c.mbox.mu.Unlock()
+
+	for _, msg := range found {
+		ch <- msg
+	}
+	return nil
+}
+
+func (c *fakeConn) Logout() error {
+	return c.Terminate()
+}
+
+func (c *fakeConn) Terminate() error {
+	c.mbox.mu.Lock()
+	defer c.mbox.mu.Unlock()
+	delete(c.mbox.open, c)
+	if !c.terminated {
+		c.terminated = true
+		close(c.closed)
+	}
+	return nil
+}
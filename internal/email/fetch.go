@@ -0,0 +1,70 @@
+package email
+
+import "github.com/emersion/go-imap"
+
+const (
+	// fetchBatchSize caps the messages asked for in one FETCH, so a large backlog
+	// is fetched in steps instead of as one response
+	fetchBatchSize = 200
+	// fetchBuffer is how many fetched messages may wait to be handled
+	fetchBuffer = 16
+)
+
+// fetchStream fetches items of the messages seqNums in batches and hands each
+// message to handle as it arrives, so only a few are held at a time. It stops
+// at the first batch that fails.
+func fetchStream(c imapClient, seqNums []uint32, items []imap.FetchItem, handle func(*imap.Message)) error {
+	for start := 0; start < len(seqNums); start += fetchBatchSize {
+		if err := fetchBatch(c.Fetch, seqNums[start:min(start+fetchBatchSize, len(seqNums))], items, handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchFunc is the Fetch or UidFetch of a client
+type fetchFunc func(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error
+
+// fetchBatch fetches items of the messages nums with one command of fetch and
+// hands each message to handle as it arrives
+func fetchBatch(fetch fetchFunc, nums []uint32, items []imap.FetchItem, handle func(*imap.Message)) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(nums...)
+
+	// Fetch closes messages when it returns
+	messages := make(chan *imap.Message, fetchBuffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- fetch(seqSet, items, messages)
+	}()
+	for msg := range messages {
+		handle(msg)
+	}
+	return <-done
+}
+
+// Progress is how far a check has got with the envelopes of a large backlog
+type Progress struct {
+	Done     int  // envelopes fetched so far
+	Total    int  // envelopes to fetch
+	Finished bool // the last report of the check, whether or not it got them all
+}
+
+// SetProgressHandler sets a function that is told, on the checking goroutine,
+// how a check fetching the envelopes of more new messages than fit one FETCH
+// is getting on: once before the first batch, after each batch and once
+// Finished. Checks of fewer messages report nothing. Call it before StartChecking.
+func (ic *ImapChecker) SetProgressHandler(handler func(Progress)) {
+	ic.onProgress = handler
+}
+
+// progressReporter reports the progress of fetching total envelopes to the
+// handler, if there is one and total spans several batches
+func (ic *ImapChecker) progressReporter(total int) func(done int, finished bool) {
+	if ic.onProgress == nil || total <= fetchBatchSize {
+		return func(int, bool) {}
+	}
+	return func(done int, finished bool) {
+		ic.onProgress(Progress{Done: done, Total: total, Finished: finished})
+	}
+}
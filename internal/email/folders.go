@@ -0,0 +1,47 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+)
+
+// Folder is a mailbox on the server
+type Folder struct {
+	Name       string `json:"name"`
+	Selectable bool   `json:"selectable"` // false for container-only folders that hold no messages
+}
+
+// ListFolders returns every mailbox of the account, sorted by name
+func ListFolders(cfg config.EmailConfig) ([]Folder, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	mailboxes := make(chan *imap.MailboxInfo, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	var folders []Folder
+	for m := range mailboxes {
+		selectable := true
+		for _, attr := range m.Attributes {
+			if attr == imap.NoSelectAttr {
+				selectable = false
+			}
+		}
+		folders = append(folders, Folder{Name: m.Name, Selectable: selectable})
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("list folders: %w", err)
+	}
+
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Name < folders[j].Name })
+	return folders, nil
+}
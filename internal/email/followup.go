@@ -0,0 +1,126 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// ErrNoSentMailbox is returned when the server marks no mailbox as the Sent folder
+var ErrNoSentMailbox = errors.New("no mailbox is marked as Sent; name it in the settings")
+
+// SentMessage is a message found in the Sent folder
+type SentMessage struct {
+	MessageID  string
+	Recipients []string // addresses of To and Cc, in lower case
+	Subject    string
+	Date       time.Time
+}
+
+// SentSince returns the messages of the Sent folder mailbox that were sent on
+// the day of since or later. An empty mailbox finds the folder by its \Sent
+// attribute.
+func SentSince(cfg config.EmailConfig, mailbox string, since time.Time) ([]SentMessage, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if mailbox == "" {
+		if mailbox, err = findSentMailbox(c); err != nil {
+			return nil, err
+		}
+	}
+	return sentSince(c, mailbox, since)
+}
+
+// findSentMailbox names the mailbox the server marks as the Sent folder
+func findSentMailbox(c *client.Client) (string, error) {
+	mailboxes := make(chan *imap.MailboxInfo, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+	var sent string
+	for m := range mailboxes {
+		if sent == "" && slices.Contains(m.Attributes, imap.SentAttr) {
+			sent = m.Name
+		}
+	}
+	if err := <-done; err != nil {
+		return "", fmt.Errorf("list mailboxes: %w", classifyTransport(err))
+	}
+	if sent == "" {
+		return "", ErrNoSentMailbox
+	}
+	return sent, nil
+}
+
+func sentSince(c imapClient, mailbox string, since time.Time) ([]SentMessage, error) {
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+	seqNums, err := c.Search(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("search %s: %w", mailbox, classifyTransport(err))
+	}
+
+	var sent []SentMessage
+	err = fetchStream(c, seqNums, []imap.FetchItem{imap.FetchEnvelope}, func(msg *imap.Message) {
+		e := msg.Envelope
+		if e == nil || e.MessageId == "" {
+			return
+		}
+		m := SentMessage{MessageID: e.MessageId, Subject: e.Subject, Date: e.Date}
+		for _, addr := range append(slices.Clone(e.To), e.Cc...) {
+			if addr != nil && addr.MailboxName != "" {
+				m.Recipients = append(m.Recipients, strings.ToLower(addr.Address()))
+			}
+		}
+		sent = append(sent, m)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetch envelopes: %w", classifyTransport(err))
+	}
+	return sent, nil
+}
+
+// Replied returns which of messageIDs a message of mailbox answers, as told by
+// its References or In-Reply-To header
+func Replied(cfg config.EmailConfig, mailbox string, messageIDs []string) (map[string]bool, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+	return replied(c, mailbox, messageIDs)
+}
+
+func replied(c imapClient, mailbox string, messageIDs []string) (map[string]bool, error) {
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	answered := make(map[string]bool)
+	for _, id := range messageIDs {
+		references := &imap.SearchCriteria{Header: textproto.MIMEHeader{"References": {id}}}
+		inReplyTo := &imap.SearchCriteria{Header: textproto.MIMEHeader{"In-Reply-To": {id}}}
+		seqNums, err := c.Search(&imap.SearchCriteria{Or: [][2]*imap.SearchCriteria{{references, inReplyTo}}})
+		if err != nil {
+			return nil, fmt.Errorf("search replies: %w", classifyTransport(err))
+		}
+		if len(seqNums) > 0 {
+			answered[id] = true
+		}
+	}
+	return answered, nil
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSentSinceListsRecipients(t *testing.T) {
+	mbox := newFakeMailbox()
+	old := mbox.deliver("me@example.com", "last week", base)
+	mbox.thread(old, "<old@example.com>", "alice@example.com", "")
+	recent := mbox.deliver("me@example.com", "Contract", base.Add(7*24*time.Hour))
+	mbox.thread(recent, "<contract@example.com>", "Bob@Example.com", "")
+	mbox.deliver("me@example.com", "draft without an ID", base.Add(7*24*time.Hour))
+
+	c, _ := mbox.dial(testConfig())
+	defer c.Logout()
+	sent, err := sentSince(c, mailboxName, base.Add(6*24*time.Hour))
+	if err != nil {
+		t.Fatalf("sentSince: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sentSince = %+v, want only the recent message", sent)
+	}
+	if m := sent[0]; m.MessageID != "<contract@example.com>" || m.Subject != "Contract" ||
+		len(m.Recipients) != 1 || m.Recipients[0] != "bob@example.com" {
+		t.Errorf("sent message = %+v", m)
+	}
+}
+
+func TestRepliedMatchesReferences(t *testing.T) {
+	mbox := newFakeMailbox()
+	reply := mbox.deliver("bob@example.com", "Re: Contract", base)
+	mbox.thread(reply, "<reply@example.com>", "me@example.com", "<earlier@example.com> <contract@example.com>")
+	mbox.deliver("carol@example.com", "unrelated", base)
+
+	c, _ := mbox.dial(testConfig())
+	defer c.Logout()
+	answered, err := replied(c, mailboxName, []string{"<contract@example.com>", "<invoice@example.com>"})
+	if err != nil {
+		t.Fatalf("replied: %v", err)
+	}
+	if !answered["<contract@example.com>"] || answered["<invoice@example.com>"] {
+		t.Errorf("replied = %v, want only the contract answered", answered)
+	}
+}
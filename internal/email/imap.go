@@ -1,13 +1,21 @@
 package email
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"runtime/debug"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/events"
+	"github.com/byigitt/n0tif/internal/logging"
 	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/byigitt/n0tif/internal/tracing"
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 )
@@ -18,44 +26,142 @@ const mailboxName = "INBOX" // Define as a constant
 type ImapChecker struct {
 	config       config.EmailConfig
 	emailState   *storage.EmailState
-	lastSeenDate time.Time // Date of the last email processed
+	lastSeenDate time.Time             // Date of the last email processed
+	intervalCh   chan int              // Delivers check interval changes to the running check loop
+	passwordCh   chan string           // Delivers a new password to the next connection; see SetPassword
+	checkNowCh   chan chan checkResult // Asks the running check loop for an immediate check
+	onRestart    func(crash error)     // Told when the check loop is restarted after a panic
+	onProgress   func(Progress)        // told how a large backlog is getting on; see SetProgressHandler
+	log          *logging.Logger       // tags lines with the account
+	dial         dialFunc              // connects for each check; dialServer but in tests
+	dialExtra    dialFunc              // dial for the extra connections of a check, which don't wait for the connection budget
+	clock        Clock                 // timestamps of checks and records; see WithClock
+	checkMu      sync.Mutex            // serializes checks made through Check and by the check loop
+	ctx          context.Context       // parent of every check; done once Stop is called
+	stop         context.CancelFunc
+
+	statusMu   sync.Mutex
+	status     CheckStatus
+	pauseTimer *time.Timer // ends a timed pause
+	pauseGen   int         // identifies the current pause, so a stale timer can't end a newer one
+	failures   int         // checks failed in a row
+	throttled  int         // checks the provider throttled in a row
+
+	failingSince   time.Time                        // first failure since the last success
+	failureAlerted bool                             // onFailure was told about the current failures
+	failureWindow  time.Duration                    // how long checks fail before onFailure is told
+	loggedIn       bool                             // a check succeeded before, in this run or an earlier one
+	onFailure      func(since time.Time, err error) // see SetFailureHandler
+
+	events *events.Bus // told about failed checks and pauses; see SetEvents
+	sched  *Scheduler  // runs the checks of the loop; see SetScheduler
+
+	missed    MissedMail                                     // what the loop does with email missed while not running; see SetMissedMail
+	summarize func(context.Context, []storage.MessageRecord) // told about the missed email for MissedSummarize
+	missedDue bool                                           // no check of the loop has succeeded since starting again
 }
 
-// NewImapChecker creates a new IMAP email checker
+// logger tags the lines of the email checking with its component
+var logger = logging.For("imap")
+
+// failureEventThreshold is how many checks in a row have to fail before the
+// failure is reported to the event log; single failures are usually transient
+const failureEventThreshold = 3
+
+// CheckStatus describes the most recent check of a running ImapChecker
+type CheckStatus struct {
+	LastCheck   time.Time // when the last check finished; zero before the first one
+	LastError   string    // error of the last check, empty if it succeeded
+	LastSuccess time.Time // when a check last succeeded; zero before the first success
+	NextCheck   time.Time // when the next scheduled check is due
+	Interval    time.Duration
+
+	Paused      bool      // scheduled checks are skipped
+	PausedUntil time.Time // when checking resumes by itself; zero while paused indefinitely
+
+	Offline string // why scheduled checks wait for the network; empty while online
+
+	Unread      int  // unread messages in the mailbox as of the last check or SetUnread
+	UnreadKnown bool // Unread has been counted
+
+	ThrottledUntil time.Time // scheduled checks wait for the provider until then; zero unless throttled
+
+	Data storage.DataUsage // sent to and received from the server by the last check
+}
+
+// checkResult is the outcome of a check requested through CheckNow
+type checkResult struct {
+	emails []storage.MessageRecord
+	err    error
+}
+
+// ErrStopped is returned by CheckNow once the checker has been stopped
+var ErrStopped = errors.New("checker stopped")
+
+// NewImapChecker creates a new IMAP email checker; it is NewChecker without options
 func NewImapChecker(cfg config.EmailConfig) (*ImapChecker, error) {
-	state, err := storage.LoadEmailState()
+	return NewChecker(cfg)
+}
+
+// NewChecker creates a checker for the INBOX of the account cfg describes,
+// configured by opts
+func NewChecker(cfg config.EmailConfig, opts ...Option) (*ImapChecker, error) {
+	o := options{log: logger, clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dialExtra := o.dial
+	if o.dial == nil {
+		o.dial = dialServer(o.dialer, o.tlsConfig, connectionWait)
+		dialExtra = dialServer(o.dialer, o.tlsConfig, 0)
+	}
+
+	state, err := storage.LoadEmailState(cfg.Username)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load email state: %w", err)
 	}
 
 	lastDate := state.GetLastSeenDate(mailboxName)
-	log.Printf("NewImapChecker: Loaded lastSeenDate from storage: %s", lastDate.Format(time.RFC3339))
+	log := o.log.With("account", cfg.Username)
+	log.With("mailbox", mailboxName).Debugf("NewImapChecker: Loaded lastSeenDate from storage: %s", lastDate.Format(time.RFC3339))
 
+	ctx, stop := context.WithCancel(context.Background())
 	return &ImapChecker{
+		ctx:          ctx,
+		stop:         stop,
 		config:       cfg,
 		emailState:   state,
 		lastSeenDate: lastDate,
+		loggedIn:     !lastDate.IsZero(),
+		intervalCh:   make(chan int, 1),
+		passwordCh:   make(chan string, 1),
+		checkNowCh:   make(chan chan checkResult),
+		log:          log,
+		dial:         o.dial,
+		dialExtra:    dialExtra,
+		clock:        o.clock,
 	}, nil
 }
 
 func (ic *ImapChecker) saveStateWithLogging(operationDesc string) {
 	// Update the state object before saving
 	ic.emailState.UpdateLastSeenDate(mailboxName, ic.lastSeenDate)
-	log.Printf("saveStateWithLogging (%s): Current lastSeenDate for %s before save: %s", operationDesc, mailboxName, ic.lastSeenDate.Format(time.RFC3339))
-	if err := storage.SaveEmailState(ic.emailState); err != nil {
-		log.Printf("saveStateWithLogging (%s): WARNING - Failed to save email state: %v", operationDesc, err)
+	ic.log.Debugf("saveStateWithLogging (%s): Current lastSeenDate for %s before save: %s", operationDesc, mailboxName, ic.lastSeenDate.Format(time.RFC3339))
+	if err := storage.SaveEmailState(ic.config.Username, ic.emailState); err != nil {
+		ic.log.Warnf("saveStateWithLogging (%s): Failed to save email state: %v", operationDesc, err)
 	} else {
-		log.Printf("saveStateWithLogging (%s): Email state (lastSeenDate: %s) saved successfully.", operationDesc, ic.lastSeenDate.Format(time.RFC3339))
+		ic.log.Debugf("saveStateWithLogging (%s): Email state (lastSeenDate: %s) saved successfully.", operationDesc, ic.lastSeenDate.Format(time.RFC3339))
 	}
 }
 
 func (ic *ImapChecker) InitializeEmailTracking() error {
+	log := ic.log.With("mailbox", mailboxName)
 	if !ic.lastSeenDate.IsZero() {
-		log.Printf("InitializeEmailTracking: Using existing lastSeenDate from state: %s", ic.lastSeenDate.Format(time.RFC3339))
+		log.Debugf("InitializeEmailTracking: Using existing lastSeenDate from state: %s", ic.lastSeenDate.Format(time.RFC3339))
 		return nil
 	}
 
-	log.Println("InitializeEmailTracking: No existing lastSeenDate. Establishing new baseline by fetching the most recent email...")
+	log.Infof("InitializeEmailTracking: No existing lastSeenDate. Establishing new baseline by fetching the most recent email...")
 
 	c, err := ic.connect()
 	if err != nil {
@@ -65,11 +171,11 @@ func (ic *ImapChecker) InitializeEmailTracking() error {
 
 	mbox, err := c.Select(mailboxName, false)
 	if err != nil {
-		return fmt.Errorf("InitializeEmailTracking select mailbox: %w", err)
+		return fmt.Errorf("InitializeEmailTracking select mailbox: %w", classifyReply(ErrMailboxNotFound, err))
 	}
 
 	if mbox.Messages == 0 {
-		log.Println("InitializeEmailTracking: No messages in INBOX to initialize baseline from.")
+		log.Infof("InitializeEmailTracking: No messages in INBOX to initialize baseline from.")
 		// lastSeenDate remains zero, will be saved as such if saveStateWithLogging is called.
 		// Or, we can explicitly save a zero date to mark it as checked.
 		ic.saveStateWithLogging("InitializeEmailTracking - no messages, setting zero date")
@@ -84,9 +190,9 @@ func (ic *ImapChecker) InitializeEmailTracking() error {
 	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchUid} // UID for logging
 	messagesChan := make(chan *imap.Message, 1)
 
-	log.Printf("InitializeEmailTracking: Fetching the last message (SeqNum: %d) to establish baseline date.", mbox.Messages)
+	log.Debugf("InitializeEmailTracking: Fetching the last message (SeqNum: %d) to establish baseline date.", mbox.Messages)
 	if err := c.Fetch(seqSet, items, messagesChan); err != nil {
-		return fmt.Errorf("InitializeEmailTracking fetch last message: %w", err)
+		return fmt.Errorf("InitializeEmailTracking fetch last message: %w", classifyTransport(err))
 	}
 
 	// msg := <-messagesChan // This would block if fetch had an error and didn't send.
@@ -97,63 +203,195 @@ func (ic *ImapChecker) InitializeEmailTracking() error {
 	}
 
 	if newestMessage == nil {
-		log.Println("InitializeEmailTracking: No message found when fetching the last message. This is unexpected if mbox.Messages > 0.")
+		log.Warnf("InitializeEmailTracking: No message found when fetching the last message. This is unexpected if mbox.Messages > 0.")
 		// Proceed with zero date, will be saved.
 		ic.saveStateWithLogging("InitializeEmailTracking - last message fetch failed")
 		return nil
 	}
 
 	ic.lastSeenDate = newestMessage.InternalDate
-	log.Printf("InitializeEmailTracking: Baseline established. LastSeenDate set to: %s (from email UID: %d, Subject: '%s')",
+	log.Infof("InitializeEmailTracking: Baseline established. LastSeenDate set to: %s (from email UID: %d, Subject: '%s')",
 		ic.lastSeenDate.Format(time.RFC3339), newestMessage.Uid, newestMessage.Envelope.Subject)
 
 	ic.saveStateWithLogging(fmt.Sprintf("InitializeEmailTracking - baseline date %s set", ic.lastSeenDate.Format(time.RFC3339)))
 	return nil
 }
 
-func (ic *ImapChecker) connect() (*client.Client, error) {
-	serverAddr := fmt.Sprintf("%s:%d", ic.config.ImapServer, ic.config.ImapPort)
-	c, err := client.DialTLS(serverAddr, nil)
+func (ic *ImapChecker) connect() (imapClient, error) {
+	select {
+	case ic.config.Password = <-ic.passwordCh:
+		ic.log.Infof("Logging in with the new password.")
+	default:
+	}
+	c, err := ic.dial(ic.config)
+	if err == nil {
+		connectionsTotal.Inc()
+	}
+	return c, err
+}
+
+// Dial connects to the account's IMAP server over TLS and logs in. Its errors
+// wrap ErrNetworkUnreachable or ErrAuthFailed, and ErrAppPasswordRequired when
+// the provider wants an app password.
+func Dial(cfg config.EmailConfig) (*client.Client, error) {
+	c, _, err := dialTLS(cfg, nil, nil, connectionWait)
+	return c, err
+}
+
+// dialTLS is Dial connecting through d, a plain net.Dialer if nil, with
+// tlsConfig, the default configuration if nil, waiting up to wait for a place in
+// the connection budget. It also returns the connection, which counts the data
+// it moves.
+func dialTLS(cfg config.EmailConfig, d Dialer, tlsConfig *tls.Config, wait time.Duration) (*client.Client, *countingConn, error) {
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	tlsConfig, err := tlsConfigFor(cfg, tlsConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect DialTLS: %w", err)
+	}
+	counting := &countingDialer{Dialer: d, wait: wait}
+	serverAddr := fmt.Sprintf("%s:%d", cfg.ImapServer, cfg.ImapPort)
+	c, err := client.DialWithDialerTLS(counting, serverAddr, tlsConfig)
 	if err != nil {
-		return nil, fmt.Errorf("connect DialTLS: %w", err)
+		// A failed handshake leaves the connection open
+		if counting.conn != nil {
+			counting.conn.Close()
+		}
+		imapErrorsTotal.With("dial").Inc()
+		return nil, nil, dialFailed(err)
 	}
-	if err := c.Login(ic.config.Username, ic.config.Password); err != nil {
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		imapErrorsTotal.With("login").Inc()
 		c.Logout()
-		return nil, fmt.Errorf("connect Login: %w", err)
+		return nil, nil, loginFailed(cfg.ImapServer, err)
 	}
-	return c, nil
+	return c, counting.conn, nil
 }
 
+// CheckForNewEmails connects to the server and returns the subjects of the emails
+// that arrived since the last check, newest first
 func (ic *ImapChecker) CheckForNewEmails() ([]string, error) {
-	log.Println("CheckForNewEmails: Starting check...")
-	newEmailSubjects := []string{}
+	emails, err := ic.Check(context.Background())
+	return Subjects(emails), err
+}
+
+// Check connects to the server and returns the emails that arrived since the last
+// check, newest first. Cancelling ctx closes the connection, ending the check.
+// It is safe to call while StartChecking runs; the checks take turns.
+func (ic *ImapChecker) Check(ctx context.Context) ([]storage.MessageRecord, error) {
+	emails, err := ic.checkForNewEmails(ctx)
+	ic.recordCheck(err, ic.Status().Interval)
+	return emails, err
+}
+
+// Subjects returns the subjects of emails, in the same order
+func Subjects(emails []storage.MessageRecord) []string {
+	subjects := make([]string, len(emails))
+	for i, e := range emails {
+		subjects[i] = e.Subject
+	}
+	return subjects
+}
+
+// checkForNewEmails is the check itself, each stage traced as a child of the
+// span in ctx. A transient failure is tried again over a new connection, up to
+// checkAttempts times, so a blip doesn't cost a whole interval.
+func (ic *ImapChecker) checkForNewEmails(ctx context.Context) ([]storage.MessageRecord, error) {
+	ic.checkMu.Lock()
+	defer ic.checkMu.Unlock()
+
+	start := time.Now()
+	defer func() { checkDuration.Observe(time.Since(start).Seconds()) }()
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		emails, err := ic.checkOnce(ctx, attempt == checkAttempts)
+		if err == nil || attempt == checkAttempts || !isTransient(err) {
+			return emails, err
+		}
+		delay := retryDelay(attempt)
+		ic.log.Infof("CheckForNewEmails: Attempt %d of %d failed (%v), trying again over a new connection in %v.",
+			attempt, checkAttempts, err, delay)
+		checkRetriesTotal.Inc()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// checkOnce is one attempt of a check over a connection of its own. Unless it
+// is the last attempt, a dropped connection while fetching fails it; the last
+// one processes what it got before.
+func (ic *ImapChecker) checkOnce(ctx context.Context, last bool) ([]storage.MessageRecord, error) {
+	log := ic.log.With("mailbox", mailboxName)
+	log.Debugf("CheckForNewEmails: Starting check...")
+	newEmails := []storage.MessageRecord{}
 	stateChanged := false // To track if lastSeenDate is updated
 
+	_, span := tracing.Start(ctx, "connect", "server.address", ic.config.ImapServer, "server.port", ic.config.ImapPort)
 	c, err := ic.connect()
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		return nil, err
 	}
-	defer c.Logout()
+	var extraData storage.DataUsage // moved by the extra connections fetching a large backlog
+	defer func() {
+		c.Logout()
+		data := dataUsage(c)
+		data.Sent += extraData.Sent
+		data.Received += extraData.Received
+		ic.statusMu.Lock()
+		ic.status.Data = data
+		ic.statusMu.Unlock()
+	}()
+	// Terminate closes the connection, making the command in progress fail
+	defer context.AfterFunc(ctx, func() { c.Terminate() })()
 
+	_, span = tracing.Start(ctx, "select", "mailbox", mailboxName)
 	mbox, err := c.Select(mailboxName, false)
+	span.SetError(err)
+	if mbox != nil {
+		span.SetAttributes("messages", mbox.Messages)
+	}
+	span.End()
 	if err != nil {
-		return nil, fmt.Errorf("CheckForNewEmails select mailbox: %w", err)
+		imapErrorsTotal.With("select").Inc()
+		return nil, fmt.Errorf("CheckForNewEmails select mailbox: %w", classifyReply(ErrMailboxNotFound, err))
+	}
+
+	unread := 0
+	if mbox.Messages > 0 {
+		_, span = tracing.Start(ctx, "search unseen")
+		unseen, err := c.Search(&imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}})
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			imapErrorsTotal.With("search").Inc()
+			return nil, fmt.Errorf("CheckForNewEmails count unread: %w", classifyTransport(err))
+		}
+		unread = len(unseen)
 	}
+	ic.SetUnread(unread)
 
 	if mbox.Messages == 0 {
-		log.Println("CheckForNewEmails: No messages in INBOX.")
-		return newEmailSubjects, nil
+		log.Debugf("CheckForNewEmails: No messages in INBOX.")
+		return newEmails, nil
 	}
 
 	// If lastSeenDate is zero, it means we haven't initialized yet or state was reset.
 	if ic.lastSeenDate.IsZero() {
-		log.Println("CheckForNewEmails: lastSeenDate is zero. Initializing email tracking first.")
+		log.Debugf("CheckForNewEmails: lastSeenDate is zero. Initializing email tracking first.")
 		if initErr := ic.InitializeEmailTracking(); initErr != nil {
 			return nil, fmt.Errorf("CheckForNewEmails: failed to initialize email tracking: %w", initErr)
 		}
 		// After initialization, lastSeenDate might still be zero if inbox was empty.
 		// In this case, proceed with the current (potentially still zero) lastSeenDate.
-		log.Printf("CheckForNewEmails: Initialization complete. Current lastSeenDate: %s", ic.lastSeenDate.Format(time.RFC3339))
+		log.Debugf("CheckForNewEmails: Initialization complete. Current lastSeenDate: %s", ic.lastSeenDate.Format(time.RFC3339))
 	}
 
 	criteria := imap.NewSearchCriteria()
@@ -162,14 +400,14 @@ func (ic *ImapChecker) CheckForNewEmails() ([]string, error) {
 	// We will ensure to only process emails strictly AFTER lastSeenDate.
 	if !ic.lastSeenDate.IsZero() {
 		criteria.Since = ic.lastSeenDate
-		log.Printf("CheckForNewEmails: Searching for emails SINCE %s", ic.lastSeenDate.Format(time.RFC3339))
+		log.Debugf("CheckForNewEmails: Searching for emails SINCE %s", ic.lastSeenDate.Format(time.RFC3339))
 	} else {
 		// If lastSeenDate is still zero (e.g., first run, empty inbox during init),
 		// fetch all messages or a recent subset to avoid overwhelming results.
 		// For simplicity, let's try to fetch all. If this is too much, we can limit it.
 		// An empty criteria.SINCE means all messages since epoch, essentially.
 		// Alternatively, use criteria.All = true, but an empty criteria usually means all.
-		log.Println("CheckForNewEmails: lastSeenDate is zero, attempting to search for all messages (or recent ones if server limits).")
+		log.Debugf("CheckForNewEmails: lastSeenDate is zero, attempting to search for all messages (or recent ones if server limits).")
 		// To be safe and avoid fetching thousands of emails on a very old mailbox first run,
 		// let's fetch the last N (e.g., 50) if lastSeenDate is zero.
 		// This requires fetching by sequence numbers first, then filtering.
@@ -179,91 +417,131 @@ func (ic *ImapChecker) CheckForNewEmails() ([]string, error) {
 		// Let's assume a `SINCE zero-date` will effectively give us recent items or all.
 	}
 
+	_, span = tracing.Start(ctx, "search")
 	seqNums, err := c.Search(criteria)
+	span.SetError(err)
+	span.SetAttributes("matches", len(seqNums))
+	span.End()
 	if err != nil {
-		return nil, fmt.Errorf("CheckForNewEmails search: %w", err)
+		imapErrorsTotal.With("search").Inc()
+		return nil, fmt.Errorf("CheckForNewEmails search: %w", classifyTransport(err))
 	}
 
 	if len(seqNums) == 0 {
-		log.Println("CheckForNewEmails: No messages found matching search criteria.")
-		return newEmailSubjects, nil
-	}
-	log.Printf("CheckForNewEmails: Found %d messages matching search criteria. SeqNums: %v", len(seqNums), seqNums)
-
-	seqSet := new(imap.SeqSet)
-	seqSet.AddNum(seqNums...)
-
-	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchUid}
-	messagesChan := make(chan *imap.Message, len(seqNums)) // Buffer for all found messages
-
-	log.Printf("CheckForNewEmails: Fetching details for %d messages.", len(seqNums))
-	if err := c.Fetch(seqSet, items, messagesChan); err != nil {
-		// It's possible Fetch returns an error but still sends some messages.
-		// Log the error and proceed with messages received if any.
-		log.Printf("CheckForNewEmails: Error during Fetch (will process any messages received): %v", err)
-		// Closing messagesChan is implicitly handled by the go-imap library when Fetch finishes or errors.
+		log.Debugf("CheckForNewEmails: No messages found matching search criteria.")
+		return newEmails, nil
 	}
-
-	type EmailDetails struct {
-		Subject string
-		Date    time.Time
-		UID     uint32 // For logging
+	log.Debugf("CheckForNewEmails: Found %d messages matching search criteria. SeqNums: %v", len(seqNums), seqNums)
+
+	// Dates and UIDs first: on a large backlog most matches are usually at or
+	// before lastSeenDate, and those don't need their envelope
+	type candidate struct {
+		uid    uint32
+		date   time.Time
+		record *storage.MessageRecord // set once the envelope is fetched
 	}
-	var fetchedEmails []EmailDetails
-	currentMaxDate := ic.lastSeenDate // Initialize with the current last seen date
-
-	for msg := range messagesChan {
-		log.Printf("CheckForNewEmails: Processing fetched message - UID: %d, Date: %s, Subject: '%s'",
-			msg.Uid, msg.InternalDate.Format(time.RFC3339), msg.Envelope.Subject)
+	var candidates []*candidate
 
+	log.Debugf("CheckForNewEmails: Fetching dates of %d messages.", len(seqNums))
+	_, span = tracing.Start(ctx, "fetch", "messages", len(seqNums))
+	err = fetchStream(c, seqNums, []imap.FetchItem{imap.FetchInternalDate, imap.FetchUid}, func(msg *imap.Message) {
 		// Only consider emails strictly after the lastSeenDate to avoid re-processing
 		// emails that might have the exact same timestamp as lastSeenDate.
-		if msg.InternalDate.After(ic.lastSeenDate) {
-			fetchedEmails = append(fetchedEmails, EmailDetails{
-				Subject: msg.Envelope.Subject,
-				Date:    msg.InternalDate,
-				UID:     msg.Uid,
-			})
-			log.Printf("CheckForNewEmails: Candidate new email - UID: %d, Date: %s", msg.Uid, msg.InternalDate.Format(time.RFC3339))
-		} else {
-			log.Printf("CheckForNewEmails: Skipping email (UID: %d, Date: %s) as it is not strictly after lastSeenDate (%s)",
+		if !msg.InternalDate.After(ic.lastSeenDate) {
+			log.Debugf("CheckForNewEmails: Skipping email (UID: %d, Date: %s) as it is not strictly after lastSeenDate (%s)",
 				msg.Uid, msg.InternalDate.Format(time.RFC3339), ic.lastSeenDate.Format(time.RFC3339))
+			return
+		}
+		log.Debugf("CheckForNewEmails: Candidate new email - UID: %d, Date: %s", msg.Uid, msg.InternalDate.Format(time.RFC3339))
+		candidates = append(candidates, &candidate{uid: msg.Uid, date: msg.InternalDate})
+	})
+	if err == nil && len(candidates) > 0 {
+		// By UID, as the extra connections of a large backlog number the messages on their own
+		byUID := make(map[uint32]*candidate, len(candidates))
+		newUIDs := make([]uint32, len(candidates))
+		for i, cand := range candidates {
+			byUID[cand.uid] = cand
+			newUIDs[i] = cand.uid
 		}
+		log.Debugf("CheckForNewEmails: Fetching envelopes of %d new messages.", len(candidates))
+		seenAt := ic.clock.Now()
+		report := ic.progressReporter(len(candidates))
+		fetched := 0
+		report(0, false)
+		var helpersData storage.DataUsage
+		helpersData, err = ic.fetchParallel(ctx, c, newUIDs, []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope}, func(msg *imap.Message) {
+			cand, ok := byUID[msg.Uid]
+			if !ok || msg.Envelope == nil || cand.record != nil {
+				return
+			}
+			fetched++
+			if fetched%fetchBatchSize == 0 && fetched < len(candidates) {
+				report(fetched, false)
+			}
+			cand.record = &storage.MessageRecord{
+				Account: ic.config.Username,
+				Mailbox: mailboxName,
+				UID:     cand.uid,
+				From:    formatSender(msg.Envelope.From),
+				Subject: msg.Envelope.Subject,
+				Date:    cand.date,
+				SeenAt:  seenAt,
+			}
+		})
+		report(fetched, true)
+		extraData.Sent += helpersData.Sent
+		extraData.Received += helpersData.Received
+	}
+	span.SetError(err)
+	span.End()
+	if err != nil && !last && isNetworkError(err) {
+		imapErrorsTotal.With("fetch").Inc()
+		return nil, fmt.Errorf("CheckForNewEmails fetch: %w", classify(ErrNetworkUnreachable, err))
+	}
+	if err != nil {
+		// Messages fetched before the error are still processed
+		log.Warnf("CheckForNewEmails: Error during Fetch (will process any messages received): %v", err)
+		imapErrorsTotal.With("fetch").Inc()
+	}
+
+	_, span = tracing.Start(ctx, "filter")
+	defer span.End()
 
-		// Track the maximum date encountered in this batch, even if it's not "new" by the strict After check.
-		// This ensures lastSeenDate progresses if new emails have same timestamp as old lastSeenDate.
-		// However, the user said "if any email came at the same time shouldnt be a problem".
-		// So, we should ONLY update lastSeenDate based on emails we actually consider "new".
-		// The `currentMaxDate` will be updated based on successfully processed *new* emails.
+	currentMaxDate := ic.lastSeenDate // Initialize with the current last seen date
+	for _, cand := range candidates {
+		if cand.record == nil {
+			continue
+		}
+		newEmails = append(newEmails, *cand.record)
+		// Update currentMaxDate with the date of the newest email we are processing
+		if cand.date.After(currentMaxDate) {
+			currentMaxDate = cand.date
+		}
 	}
+	candidates = nil
 
-	if len(fetchedEmails) == 0 {
-		log.Println("CheckForNewEmails: No emails found strictly after the lastSeenDate.")
+	span.SetAttributes("new_emails", len(newEmails))
+	if len(newEmails) == 0 {
+		log.Debugf("CheckForNewEmails: No emails found strictly after the lastSeenDate.")
 		// It's possible that SINCE returned emails with the same timestamp as lastSeenDate.
 		// We don't update lastSeenDate here as no *new* emails were processed.
-		return newEmailSubjects, nil
+		return newEmails, nil
 	}
 
-	// Sort the newly identified emails by date, most recent first
-	sort.Slice(fetchedEmails, func(i, j int) bool {
-		return fetchedEmails[i].Date.After(fetchedEmails[j].Date)
+	// Most recent first
+	sort.Slice(newEmails, func(i, j int) bool {
+		return newEmails[i].Date.After(newEmails[j].Date)
 	})
 
-	log.Printf("CheckForNewEmails: Found %d new email(s) after filtering and sorting:", len(fetchedEmails))
-	for i, email := range fetchedEmails {
-		newEmailSubjects = append(newEmailSubjects, email.Subject)
-		log.Printf("CheckForNewEmails: New email #%d: UID %d, Date %s, Subject '%s'",
+	log.Debugf("CheckForNewEmails: Found %d new email(s) after filtering and sorting:", len(newEmails))
+	for i, email := range newEmails {
+		log.Debugf("CheckForNewEmails: New email #%d: UID %d, Date %s, Subject '%s'",
 			i+1, email.UID, email.Date.Format(time.RFC3339), email.Subject)
-
-		// Update currentMaxDate with the date of the newest email we are processing
-		if email.Date.After(currentMaxDate) {
-			currentMaxDate = email.Date
-		}
 	}
 
 	// If we processed new emails, and the newest among them has a date later than our previous lastSeenDate, update it.
 	if currentMaxDate.After(ic.lastSeenDate) {
-		log.Printf("CheckForNewEmails: Updating lastSeenDate from %s to %s",
+		log.Debugf("CheckForNewEmails: Updating lastSeenDate from %s to %s",
 			ic.lastSeenDate.Format(time.RFC3339), currentMaxDate.Format(time.RFC3339))
 		ic.lastSeenDate = currentMaxDate
 		stateChanged = true
@@ -273,64 +551,373 @@ func (ic *ImapChecker) CheckForNewEmails() ([]string, error) {
 		ic.saveStateWithLogging("CheckForNewEmails - new emails processed, lastSeenDate updated")
 	}
 
-	log.Printf("CheckForNewEmails: Finished check. Returning %d new email subjects.", len(newEmailSubjects))
-	return newEmailSubjects, nil
+	if err := storage.RecordMessages(newEmails); err != nil {
+		log.Warnf("CheckForNewEmails: Failed to record message history: %v", err)
+	}
+
+	newEmailsTotal.Add(float64(len(newEmails)))
+	log.Debugf("CheckForNewEmails: Finished check. Returning %d new emails.", len(newEmails))
+	return newEmails, nil
 }
 
-func (ic *ImapChecker) StartChecking(callback func([]string)) {
-	go func() {
-		log.Println("StartChecking: Performing initial email check...")
-		// Initialize if needed on the first actual check
-		if ic.lastSeenDate.IsZero() {
-			log.Println("StartChecking: lastSeenDate is zero, performing initial tracking setup.")
-			if err := ic.InitializeEmailTracking(); err != nil {
-				log.Printf("StartChecking: Error during initial email tracking setup: %v", err)
-				// Depending on severity, might want to stop or retry. For now, log and continue.
+// formatSender renders the first From address as "Name <user@host>"
+func formatSender(from []*imap.Address) string {
+	if len(from) == 0 || from[0] == nil {
+		return ""
+	}
+	addr := from[0]
+	email := addr.MailboxName
+	if addr.HostName != "" {
+		email += "@" + addr.HostName
+	}
+	if addr.PersonalName == "" {
+		return email
+	}
+	return fmt.Sprintf("%s <%s>", addr.PersonalName, email)
+}
+
+// StartChecking checks for new emails in the background, passing them to callback,
+// newest first, until Stop is called. A panic in a check or in callback doesn't end
+// checking; see supervise.
+func (ic *ImapChecker) StartChecking(callback func(ctx context.Context, emails []storage.MessageRecord)) {
+	ic.missedDue = !ic.lastSeenDate.IsZero()
+	go ic.supervise(callback)
+	go ic.watchWake()
+}
+
+// Stop ends the checking started by StartChecking and cancels a check in progress
+func (ic *ImapChecker) Stop() {
+	ic.stop()
+}
+
+// runLoop performs the initial check and then the scheduled and requested ones.
+// It returns nil once the checker is stopped, and after a panic, which it
+// recovers and returns.
+func (ic *ImapChecker) runLoop(callback func(context.Context, []storage.MessageRecord)) (crash error) {
+	var pending chan checkResult // reply of a CheckNow in progress
+	defer func() {
+		if r := recover(); r != nil {
+			ic.log.Errorf("StartChecking: Panic in check loop: %v\n%s", r, debug.Stack())
+			crash = fmt.Errorf("%v", r)
+			if pending != nil {
+				pending <- checkResult{err: fmt.Errorf("check crashed: %w", crash)}
 			}
 		}
+	}()
 
-		newEmails, err := ic.CheckForNewEmails()
-		if err != nil {
-			log.Printf("StartChecking: Error during initial email check: %v", err)
-		} else if len(newEmails) > 0 {
-			log.Printf("StartChecking: Found %d new emails on initial check.", len(newEmails))
-			callback(newEmails)
-		} else {
-			log.Println("StartChecking: No new emails found on initial check.")
+	if !ic.waitForOffset() {
+		return nil
+	}
+	ic.log.Debugf("StartChecking: Performing initial email check...")
+	// Initialize if needed on the first actual check
+	if ic.lastSeenDate.IsZero() {
+		ic.log.Debugf("StartChecking: lastSeenDate is zero, performing initial tracking setup.")
+		if err := ic.InitializeEmailTracking(); err != nil {
+			ic.log.Errorf("StartChecking: Error during initial email tracking setup: %v", err)
+			// Depending on severity, might want to stop or retry. For now, log and continue.
+		}
+	}
+
+	interval := time.Duration(ic.config.CheckInterval) * time.Second
+	ctx, span := ic.startCycle("initial")
+	newEmails, err := ic.runCheck(ctx)
+	ic.recordCheck(err, interval)
+	if err != nil {
+		endCycle(span, nil, err)
+		if !ic.waitIfOffline(err) {
+			ic.log.Errorf("StartChecking: Error during initial email check: %v", err)
 		}
+	} else if len(newEmails) > 0 {
+		ic.log.Infof("StartChecking: Found %d new emails on initial check.", len(newEmails))
+		ic.deliver(ctx, newEmails, callback)
+		endCycle(span, newEmails, nil)
+	} else {
+		ic.log.Debugf("StartChecking: No new emails found on initial check.")
+		ic.deliver(ctx, newEmails, callback)
+		endCycle(span, newEmails, nil)
+	}
 
-		ticker := time.NewTicker(time.Duration(ic.config.CheckInterval) * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			log.Println("StartChecking: Scheduled email check...")
-			newEmails, err := ic.CheckForNewEmails()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ic.ctx.Done():
+			return nil
+		case seconds := <-ic.intervalCh:
+			ic.log.Infof("StartChecking: Check interval changed to %d seconds.", seconds)
+			interval = time.Duration(seconds) * time.Second
+			ic.config.CheckInterval = seconds // kept if the loop is restarted
+			ticker.Reset(interval)
+			ic.statusMu.Lock()
+			ic.status.Interval = interval
+			ic.status.NextCheck = ic.clock.Now().Add(interval)
+			ic.statusMu.Unlock()
+			continue
+		case reply := <-ic.checkNowCh:
+			pending = reply
+			ic.log.Infof("StartChecking: Immediate email check requested...")
+			ctx, span := ic.startCycle("requested")
+			newEmails, err := ic.runCheck(ctx)
+			// The next scheduled check is a full interval after this one
+			ticker.Reset(interval)
+			ic.recordCheck(err, interval)
 			if err != nil {
-				log.Printf("StartChecking: Error checking emails: %v", err)
-				continue
+				endCycle(span, nil, err)
+				if !ic.waitIfOffline(err) {
+					ic.log.Errorf("StartChecking: Error checking emails: %v", err)
+				}
+			} else {
+				if len(newEmails) > 0 {
+					ic.log.Infof("StartChecking: Found %d new emails.", len(newEmails))
+				}
+				ic.deliver(ctx, newEmails, callback)
+				endCycle(span, newEmails, nil)
 			}
+			reply <- checkResult{emails: newEmails, err: err}
+			pending = nil
+			continue
+		case <-ticker.C:
+		}
+
+		if ic.skipScheduled(interval) {
+			continue
+		}
 
-			if len(newEmails) > 0 {
-				log.Printf("StartChecking: Found %d new emails.", len(newEmails))
-				callback(newEmails)
+		ic.log.Debugf("StartChecking: Scheduled email check...")
+		ctx, span := ic.startCycle("scheduled")
+		newEmails, err := ic.runCheck(ctx)
+		ic.recordCheck(err, interval)
+		if err != nil {
+			endCycle(span, nil, err)
+			if !ic.waitIfOffline(err) {
+				ic.log.Errorf("StartChecking: Error checking emails: %v", err)
 			}
+			continue
 		}
-	}()
+
+		if len(newEmails) > 0 {
+			ic.log.Infof("StartChecking: Found %d new emails.", len(newEmails))
+		}
+		ic.deliver(ctx, newEmails, callback)
+		endCycle(span, newEmails, nil)
+	}
+}
+
+// startCycle begins the root span of a check cycle; trigger says why it runs
+// (initial, scheduled or requested). The callback's notify span joins it.
+func (ic *ImapChecker) startCycle(trigger string) (context.Context, *tracing.Span) {
+	return tracing.Start(ic.ctx, "check",
+		"trigger", trigger, "account", ic.config.Username, "mailbox", mailboxName)
+}
+
+// endCycle finishes the span of a check cycle with its outcome
+func endCycle(span *tracing.Span, newEmails []storage.MessageRecord, err error) {
+	span.SetAttributes("new_emails", len(newEmails))
+	span.SetError(err)
+	span.End()
+}
+
+// CheckNow makes the loop started by StartChecking check right away, passing new
+// emails to its callback as usual, and returns the result. It waits for a check
+// that is already in progress to finish first.
+func (ic *ImapChecker) CheckNow() ([]string, error) {
+	reply := make(chan checkResult, 1)
+	select {
+	case ic.checkNowCh <- reply:
+	case <-ic.ctx.Done():
+		return nil, ErrStopped
+	}
+	r := <-reply
+	return Subjects(r.emails), r.err
+}
+
+// Status returns the outcome of the most recent check and when the next one is due.
+// It may be called from any goroutine.
+func (ic *ImapChecker) Status() CheckStatus {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	return ic.status
+}
+
+// SetUnread records the number of unread messages in the mailbox, as counted
+// after marking some read, until the next check counts them again
+func (ic *ImapChecker) SetUnread(n int) {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	ic.status.Unread = n
+	ic.status.UnreadKnown = true
+}
+
+// SetEvents sets the bus told about failed checks and about pausing and resuming.
+// Call it before StartChecking.
+func (ic *ImapChecker) SetEvents(bus *events.Bus) {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	ic.events = bus
+}
+
+// recordCheck stores the outcome of a check for Status and publishes failures
+func (ic *ImapChecker) recordCheck(err error, interval time.Duration) {
+	ic.statusMu.Lock()
+	now := ic.clock.Now()
+	ic.status.LastCheck = now
+	ic.status.LastError = ""
+	if err != nil {
+		if errors.Is(err, ErrThrottled) {
+			checksTotal.With("throttled").Inc()
+		} else {
+			checksTotal.With("error").Inc()
+		}
+		ic.status.LastError = err.Error()
+		ic.failures++
+		if ic.failures == failureEventThreshold {
+			ic.log.Eventf(logging.LevelError, "Checking %s has failed %d times in a row: %v", ic.config.Username, ic.failures, err)
+		}
+	} else {
+		checksTotal.With("success").Inc()
+		ic.status.LastSuccess = now
+		if ic.failures >= failureEventThreshold {
+			ic.log.Eventf(logging.LevelInfo, "Checking %s works again after %d failed attempts.", ic.config.Username, ic.failures)
+		}
+		ic.failures = 0
+	}
+	ic.trackFailure(err, now)
+	ic.status.Interval = interval
+	ic.status.NextCheck = now.Add(interval)
+	ic.trackThrottling(err, now)
+	bus := ic.events
+	ic.statusMu.Unlock()
+
+	if err != nil {
+		bus.Publish(ic.ctx, events.Event{Type: events.CheckFailed, Time: now, Account: ic.config.Username, Err: err})
+	}
+}
+
+// Pause stops scheduled checks until Resume is called or, when d is positive,
+// until d has elapsed. CheckNow still checks while paused.
+func (ic *ImapChecker) Pause(d time.Duration) {
+	ic.statusMu.Lock()
+	if ic.pauseTimer != nil {
+		ic.pauseTimer.Stop()
+		ic.pauseTimer = nil
+	}
+	ic.pauseGen++
+	ic.status.Paused = true
+	ic.status.PausedUntil = time.Time{}
+	if d <= 0 {
+		ic.log.Infof("Pause: Checking paused until resumed.")
+	} else {
+		ic.status.PausedUntil = ic.clock.Now().Add(d)
+		ic.log.Infof("Pause: Checking paused until %s.", ic.status.PausedUntil.Format(time.RFC3339))
+		gen := ic.pauseGen
+		ic.pauseTimer = time.AfterFunc(d, func() {
+			ic.statusMu.Lock()
+			elapsed := ic.pauseGen == gen && ic.status.Paused
+			if elapsed {
+				ic.log.Infof("Pause: Pause elapsed, checking resumed.")
+				ic.endPauseLocked()
+			}
+			bus := ic.events
+			ic.statusMu.Unlock()
+
+			if elapsed {
+				bus.Publish(ic.ctx, events.Event{Type: events.DaemonResumed, Account: ic.config.Username})
+			}
+		})
+	}
+	until, bus := ic.status.PausedUntil, ic.events
+	ic.statusMu.Unlock()
+
+	bus.Publish(ic.ctx, events.Event{Type: events.DaemonPaused, Account: ic.config.Username, Until: until})
+}
+
+// Resume ends a pause started with Pause and reports whether checking was paused
+func (ic *ImapChecker) Resume() bool {
+	ic.statusMu.Lock()
+	if !ic.status.Paused {
+		ic.statusMu.Unlock()
+		return false
+	}
+	ic.log.Infof("Resume: Checking resumed.")
+	ic.endPauseLocked()
+	bus := ic.events
+	ic.statusMu.Unlock()
+
+	bus.Publish(ic.ctx, events.Event{Type: events.DaemonResumed, Account: ic.config.Username})
+	return true
+}
+
+// endPauseLocked clears the pause; statusMu must be held
+func (ic *ImapChecker) endPauseLocked() {
+	if ic.pauseTimer != nil {
+		ic.pauseTimer.Stop()
+		ic.pauseTimer = nil
+	}
+	ic.pauseGen++
+	ic.status.Paused = false
+	ic.status.PausedUntil = time.Time{}
+}
+
+// skipScheduled reports whether a scheduled check has to be skipped because checking
+// is paused or the machine is offline, and if so moves the next check on by an interval
+func (ic *ImapChecker) skipScheduled(interval time.Duration) bool {
+	ic.statusMu.Lock()
+	defer ic.statusMu.Unlock()
+	now := ic.clock.Now()
+	switch {
+	case now.Before(ic.status.ThrottledUntil):
+		ic.log.Debugf("StartChecking: Throttled by the provider until %s, skipping scheduled check.", ic.status.ThrottledUntil.Format(time.Kitchen))
+		return true
+	case ic.status.Paused:
+		ic.log.Debugf("StartChecking: Checking is paused, skipping scheduled check.")
+	case ic.status.Offline != "":
+		ic.log.Debugf("StartChecking: Offline (%s), skipping scheduled check.", ic.status.Offline)
+	default:
+		return false
+	}
+	ic.status.NextCheck = now.Add(interval)
+	return true
+}
+
+// SetCheckInterval changes how often the running check loop polls the server.
+// It takes effect from the next tick and may be called from any goroutine.
+func (ic *ImapChecker) SetCheckInterval(seconds int) {
+	if seconds <= 0 {
+		return
+	}
+	// Drop a pending change that the loop hasn't picked up yet; the newest value wins
+	select {
+	case <-ic.intervalCh:
+	default:
+	}
+	ic.intervalCh <- seconds
+}
+
+// SetPassword changes the password the checker logs in with, from its next
+// connection on. It may be called from any goroutine.
+func (ic *ImapChecker) SetPassword(password string) {
+	// Drop a password that no connection has used yet; the newest one wins
+	select {
+	case <-ic.passwordCh:
+	default:
+	}
+	ic.passwordCh <- password
 }
 
 // ResetState clears the tracked last seen date for debugging
 func (ic *ImapChecker) ResetState() {
-	log.Println("ResetState: Clearing lastSeenDate.")
+	ic.log.Debugf("ResetState: Clearing lastSeenDate.")
 	ic.lastSeenDate = time.Time{} // Set to zero time
 
 	// Save the reset state (zero date)
 	ic.saveStateWithLogging("ResetState - cleared lastSeenDate")
 
 	// Reinitialize tracking. This will fetch the latest email and set its date.
-	log.Println("ResetState: Re-initializing email tracking to establish a new baseline date.")
+	ic.log.Debugf("ResetState: Re-initializing email tracking to establish a new baseline date.")
 	err := ic.InitializeEmailTracking()
 	if err != nil {
-		log.Printf("Warning: Failed to initialize email tracking after reset: %v", err)
+		ic.log.Warnf("Failed to initialize email tracking after reset: %v", err)
 	} else {
-		log.Println("Email tracking re-initialized successfully after reset. New lastSeenDate should be set.")
+		ic.log.Infof("Email tracking re-initialized successfully after reset. New lastSeenDate should be set.")
 	}
 }
@@ -0,0 +1,847 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	if err := storage.OpenBackend(config.StorageJSON); err != nil {
+		panic(err)
+	}
+	checkRetryDelay = time.Millisecond
+	code := m.Run()
+	storage.CloseBackend()
+	os.Exit(code)
+}
+
+// base is the arrival time of the first message of a test mailbox
+var base = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// newTestChecker returns a checker connected to mbox, keeping its state in a
+// data folder of the test's own
+func newTestChecker(t *testing.T, mbox *fakeMailbox) *ImapChecker {
+	t.Helper()
+	if err := storage.SetDataFolder(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	ic, err := NewChecker(testConfig(), withDial(mbox.dial))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	t.Cleanup(ic.Stop)
+	return ic
+}
+
+// testConfig is the account the tests check
+func testConfig() config.EmailConfig {
+	return config.EmailConfig{
+		ImapServer:    "imap.example.com",
+		ImapPort:      993,
+		Username:      "user@example.com",
+		Password:      "secret",
+		CheckInterval: 3600,
+	}
+}
+
+func check(t *testing.T, ic *ImapChecker) []storage.MessageRecord {
+	t.Helper()
+	emails, err := ic.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return emails
+}
+
+func subjectsOf(emails []storage.MessageRecord) []string {
+	return Subjects(emails)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestInitializeSetsBaselineToNewestMessage(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old 1", base)
+	mbox.deliver("b@example.com", "old 2", base.Add(2*time.Hour))
+	mbox.deliver("c@example.com", "old 3", base.Add(time.Hour)) // sequence order is not date order
+
+	ic := newTestChecker(t, mbox)
+	if err := ic.InitializeEmailTracking(); err != nil {
+		t.Fatalf("InitializeEmailTracking: %v", err)
+	}
+	// The baseline comes from the last message by sequence number
+	if want := base.Add(time.Hour); !ic.lastSeenDate.Equal(want) {
+		t.Errorf("lastSeenDate = %v, want %v", ic.lastSeenDate, want)
+	}
+
+	// A checker started later resumes from the saved baseline without connecting
+	again, err := NewChecker(ic.config, withDial(mbox.dial))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	dials, _ := mbox.stats()
+	if err := again.InitializeEmailTracking(); err != nil {
+		t.Fatalf("InitializeEmailTracking: %v", err)
+	}
+	if !again.lastSeenDate.Equal(ic.lastSeenDate) {
+		t.Errorf("reloaded lastSeenDate = %v, want %v", again.lastSeenDate, ic.lastSeenDate)
+	}
+	if d, _ := mbox.stats(); d != dials {
+		t.Errorf("initializing from saved state connected %d time(s)", d-dials)
+	}
+}
+
+func TestInitializeEmptyMailbox(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	if err := ic.InitializeEmailTracking(); err != nil {
+		t.Fatalf("InitializeEmailTracking: %v", err)
+	}
+	if !ic.lastSeenDate.IsZero() {
+		t.Errorf("lastSeenDate = %v, want zero", ic.lastSeenDate)
+	}
+	if emails := check(t, ic); len(emails) != 0 {
+		t.Errorf("Check of an empty mailbox = %v", subjectsOf(emails))
+	}
+}
+
+func TestFirstCheckDoesNotReportExistingMail(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old 1", base)
+	mbox.deliver("b@example.com", "old 2", base.Add(time.Minute))
+
+	ic := newTestChecker(t, mbox)
+	if emails := check(t, ic); len(emails) != 0 {
+		t.Errorf("first Check = %v, want nothing", subjectsOf(emails))
+	}
+}
+
+func TestCheckReportsNewMailNewestFirst(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	uid1 := mbox.deliver("Alice Example <alice@example.com>", "first", base.Add(time.Minute))
+	mbox.deliver("bob@example.com", "second", base.Add(2*time.Minute))
+
+	emails := check(t, ic)
+	if got, want := subjectsOf(emails), []string{"second", "first"}; !equalStrings(got, want) {
+		t.Fatalf("Check = %v, want %v", got, want)
+	}
+	first := emails[1]
+	if first.UID != uid1 || first.Mailbox != mailboxName || first.Account != ic.config.Username {
+		t.Errorf("record = %+v", first)
+	}
+	if first.From != "Alice Example <alice@example.com>" || emails[0].From != "bob@example.com" {
+		t.Errorf("senders = %q, %q", first.From, emails[0].From)
+	}
+	if !first.Date.Equal(base.Add(time.Minute)) || first.SeenAt.IsZero() {
+		t.Errorf("dates = %v, seen %v", first.Date, first.SeenAt)
+	}
+
+	if emails := check(t, ic); len(emails) != 0 {
+		t.Errorf("second Check = %v, want nothing", subjectsOf(emails))
+	}
+}
+
+func TestCheckSkipsMailAtTheBaselineTime(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "baseline", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	mbox.deliver("b@example.com", "same second", base)
+	mbox.deliver("c@example.com", "later", base.Add(time.Second))
+	if got, want := subjectsOf(check(t, ic)), []string{"later"}; !equalStrings(got, want) {
+		t.Errorf("Check = %v, want %v", got, want)
+	}
+}
+
+func TestCheckFindsMailOnLaterDays(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	mbox.deliver("b@example.com", "next week", base.AddDate(0, 0, 7))
+	if got, want := subjectsOf(check(t, ic)), []string{"next week"}; !equalStrings(got, want) {
+		t.Errorf("Check = %v, want %v", got, want)
+	}
+}
+
+func TestUIDValidityResetDoesNotRenotify(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old 1", base)
+	mbox.deliver("b@example.com", "old 2", base.Add(time.Minute))
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	mbox.resetUIDValidity()
+	if emails := check(t, ic); len(emails) != 0 {
+		t.Errorf("Check after UIDVALIDITY reset = %v, want nothing", subjectsOf(emails))
+	}
+
+	uid := mbox.deliver("c@example.com", "new", base.Add(2*time.Minute))
+	emails := check(t, ic)
+	if len(emails) != 1 || emails[0].Subject != "new" || emails[0].UID != uid {
+		t.Errorf("Check = %+v, want the new message with UID %d", emails, uid)
+	}
+}
+
+func TestCheckFetchesLargeBacklogInBatches(t *testing.T) {
+	mbox := newFakeMailbox()
+	const seen, arrived = 450, 250
+	for i := 0; i < seen; i++ {
+		mbox.deliver("a@example.com", "old", base.Add(time.Duration(i)*time.Second))
+	}
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+	before := mbox.fetchStats()
+
+	// All of them arrived the same day, so SEARCH SINCE matches the old ones too
+	for i := 0; i < arrived; i++ {
+		mbox.deliver("b@example.com", fmt.Sprintf("new %d", i), base.Add(time.Hour+time.Duration(i)*time.Second))
+	}
+	emails := check(t, ic)
+	if len(emails) != arrived {
+		t.Fatalf("Check found %d emails, want %d", len(emails), arrived)
+	}
+	if emails[0].Subject != fmt.Sprintf("new %d", arrived-1) || emails[arrived-1].Subject != "new 0" {
+		t.Errorf("Check = %q ... %q, want newest first", emails[0].Subject, emails[arrived-1].Subject)
+	}
+
+	stats := mbox.fetchStats()
+	if stats.largest > fetchBatchSize {
+		t.Errorf("a FETCH asked for %d messages, want at most %d", stats.largest, fetchBatchSize)
+	}
+	if got := stats.envelopes - before.envelopes; got != arrived {
+		t.Errorf("fetched %d envelopes, want only the %d of new messages", got, arrived)
+	}
+}
+
+func TestCheckFetchesLargeBacklogOverSeveralConnections(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+	dialsBefore, _ := mbox.stats()
+	before := mbox.fetchStats()
+
+	arrived := fetchWorkers*fetchBatchSize + 10
+	for i := 0; i < arrived; i++ {
+		mbox.deliver("b@example.com", fmt.Sprintf("new %d", i), base.Add(time.Hour+time.Duration(i)*time.Second))
+	}
+	emails := check(t, ic)
+	if len(emails) != arrived {
+		t.Fatalf("Check found %d emails, want %d", len(emails), arrived)
+	}
+	if got := mbox.fetchStats().envelopes - before.envelopes; got != arrived {
+		t.Errorf("fetched %d envelopes, want each of the %d new messages once", got, arrived)
+	}
+	dials, open := mbox.stats()
+	if got := dials - dialsBefore; got != fetchWorkers {
+		t.Errorf("check connected %d time(s), want %d", got, fetchWorkers)
+	}
+	if open != 0 {
+		t.Errorf("%d connection(s) left open", open)
+	}
+}
+
+func TestCheckDoesNotWaitForExtraConnections(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	arrived := fetchWorkers*fetchBatchSize + 10
+	for i := 0; i < arrived; i++ {
+		mbox.deliver("b@example.com", fmt.Sprintf("new %d", i), base.Add(time.Hour+time.Duration(i)*time.Second))
+	}
+	// The check's own connection gets through; the extra ones hang
+	release := mbox.holdDials(1)
+	defer release()
+	done := make(chan int, 1)
+	go func() {
+		emails, err := ic.Check(context.Background())
+		if err != nil {
+			t.Errorf("Check: %v", err)
+		}
+		done <- len(emails)
+	}()
+	select {
+	case n := <-done:
+		if n != arrived {
+			t.Errorf("Check found %d emails, want %d", n, arrived)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("check waited for extra connections that couldn't connect")
+	}
+
+	// Connecting after the work is done, they log out again right away
+	release()
+	deadline := time.Now().Add(time.Second)
+	for _, open := mbox.stats(); open != 0; _, open = mbox.stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d late connection(s) left open", open)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCheckFetchesSmallBacklogOverOneConnection(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+	dialsBefore, _ := mbox.stats()
+
+	for i := 0; i < fetchBatchSize; i++ {
+		mbox.deliver("b@example.com", fmt.Sprintf("new %d", i), base.Add(time.Hour+time.Duration(i)*time.Second))
+	}
+	if emails := check(t, ic); len(emails) != fetchBatchSize {
+		t.Fatalf("Check found %d emails, want %d", len(emails), fetchBatchSize)
+	}
+	if dials, _ := mbox.stats(); dials-dialsBefore != 1 {
+		t.Errorf("check connected %d time(s), want 1", dials-dialsBefore)
+	}
+}
+
+func TestCheckReportsBacklogProgress(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+	var reports []Progress
+	ic.SetProgressHandler(func(p Progress) { reports = append(reports, p) })
+
+	// A few new emails fit one FETCH and aren't reported
+	mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+	check(t, ic)
+	if len(reports) != 0 {
+		t.Fatalf("a small check reported %v", reports)
+	}
+
+	const arrived = 450
+	for i := 0; i < arrived; i++ {
+		mbox.deliver("c@example.com", fmt.Sprintf("backlog %d", i), base.Add(time.Hour+time.Duration(i)*time.Second))
+	}
+	check(t, ic)
+	want := []Progress{
+		{Done: 0, Total: arrived},
+		{Done: fetchBatchSize, Total: arrived},
+		{Done: 2 * fetchBatchSize, Total: arrived},
+		{Done: arrived, Total: arrived, Finished: true},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("reports = %v, want %v", reports, want)
+	}
+	for i := range want {
+		if reports[i] != want[i] {
+			t.Errorf("report %d = %+v, want %+v", i, reports[i], want[i])
+		}
+	}
+}
+
+func TestCheckCountsUnread(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	if s := ic.Status(); s.UnreadKnown {
+		t.Errorf("Status before the first check = %+v, want the unread count unknown", s)
+	}
+	check(t, ic)
+	if s := ic.Status(); !s.UnreadKnown || s.Unread != 0 {
+		t.Errorf("unread of an empty mailbox = %d (known %v), want 0", s.Unread, s.UnreadKnown)
+	}
+
+	first := mbox.deliver("a@example.com", "first", base)
+	mbox.deliver("b@example.com", "second", base.Add(time.Minute))
+	mbox.deliver("c@example.com", "third", base.Add(2*time.Minute))
+	mbox.markSeen(first)
+	check(t, ic)
+	if got := ic.Status().Unread; got != 2 {
+		t.Errorf("unread = %d, want 2", got)
+	}
+
+	ic.SetUnread(0)
+	if got := ic.Status().Unread; got != 0 {
+		t.Errorf("unread after SetUnread(0) = %d", got)
+	}
+}
+
+func TestCheckReconnectsAfterFailure(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	mbox.setDialError(errors.New("connection refused"))
+	if _, err := ic.Check(context.Background()); err == nil {
+		t.Fatal("Check succeeded while the server was down")
+	}
+	if s := ic.Status(); s.LastError == "" {
+		t.Error("Status has no error after a failed check")
+	}
+
+	// Mail that arrived during the outage is found once the server is back
+	mbox.deliver("b@example.com", "during outage", base.Add(time.Minute))
+	mbox.setDialError(nil)
+	if got, want := subjectsOf(check(t, ic)), []string{"during outage"}; !equalStrings(got, want) {
+		t.Errorf("Check = %v, want %v", got, want)
+	}
+	if s := ic.Status(); s.LastError != "" || s.LastSuccess.IsZero() {
+		t.Errorf("Status after recovery = %+v", s)
+	}
+}
+
+func TestCheckRecoversFromDroppedConnection(t *testing.T) {
+	for _, command := range []string{"select", "search"} {
+		t.Run(command, func(t *testing.T) {
+			mbox := newFakeMailbox()
+			mbox.deliver("a@example.com", "old", base)
+			ic := newTestChecker(t, mbox)
+			check(t, ic)
+
+			mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+			mbox.failAlways(command, errConnClosed)
+			if _, err := ic.Check(context.Background()); !errors.Is(err, errConnClosed) {
+				t.Fatalf("Check = %v, want the dropped connection", err)
+			}
+			// The failed check must not have moved the baseline past the new message
+			mbox.failAlways(command, nil)
+			if got, want := subjectsOf(check(t, ic)), []string{"new"}; !equalStrings(got, want) {
+				t.Errorf("Check = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckRetriesDroppedConnection(t *testing.T) {
+	for _, command := range []string{"select", "search", "fetch"} {
+		t.Run(command, func(t *testing.T) {
+			mbox := newFakeMailbox()
+			mbox.deliver("a@example.com", "old", base)
+			ic := newTestChecker(t, mbox)
+			check(t, ic)
+			before, _ := mbox.stats()
+
+			mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+			mbox.failOnce(command, errConnClosed)
+			if got, want := subjectsOf(check(t, ic)), []string{"new"}; !equalStrings(got, want) {
+				t.Errorf("Check = %v, want %v", got, want)
+			}
+			if dials, _ := mbox.stats(); dials != before+2 {
+				t.Errorf("check connected %d time(s), want 2", dials-before)
+			}
+		})
+	}
+}
+
+func TestCheckDoesNotRetryRefusals(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+	before, _ := mbox.stats()
+
+	mbox.failOnce("select", errors.New("Mailbox doesn't exist"))
+	if _, err := ic.Check(context.Background()); !errors.Is(err, ErrMailboxNotFound) {
+		t.Fatalf("Check = %v, want ErrMailboxNotFound", err)
+	}
+	if dials, _ := mbox.stats(); dials != before+1 {
+		t.Errorf("check connected %d time(s), want 1", dials-before)
+	}
+}
+
+func TestCheckClassifiesFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   func(mbox *fakeMailbox)
+		want   error
+		unwant error
+	}{
+		{"server down", func(m *fakeMailbox) { m.setDialError(errors.New("connection refused")) }, ErrNetworkUnreachable, nil},
+		{"login refused", func(m *fakeMailbox) { m.setLoginError(errors.New("[AUTHENTICATIONFAILED] Invalid credentials")) }, ErrAuthFailed, nil},
+		{"dropped during login", func(m *fakeMailbox) { m.setLoginError(errConnClosed) }, ErrNetworkUnreachable, ErrAuthFailed},
+		{"inbox refused", func(m *fakeMailbox) { m.failOnce("select", errors.New("Mailbox doesn't exist")) }, ErrMailboxNotFound, nil},
+		{"dropped during select", func(m *fakeMailbox) { m.failAlways("select", errConnClosed) }, ErrNetworkUnreachable, ErrMailboxNotFound},
+		{"dropped during search", func(m *fakeMailbox) { m.failAlways("search", errConnClosed) }, ErrNetworkUnreachable, nil},
+		{"too many connections", func(m *fakeMailbox) { m.setLoginError(errors.New("Too many simultaneous connections.")) }, ErrThrottled, ErrAuthFailed},
+		{"app password wanted", func(m *fakeMailbox) {
+			m.setLoginError(errors.New("[ALERT] Application-specific password required: https://support.google.com/accounts/answer/185833 (Failure)"))
+		}, ErrAppPasswordRequired, nil},
+		{"search throttled", func(m *fakeMailbox) { m.failOnce("search", errors.New("Request is throttled")) }, ErrThrottled, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mbox := newFakeMailbox()
+			mbox.deliver("a@example.com", "old", base)
+			ic := newTestChecker(t, mbox)
+			check(t, ic)
+
+			tt.fail(mbox)
+			_, err := ic.Check(context.Background())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Check = %v, want %v", err, tt.want)
+			}
+			if tt.unwant != nil && errors.Is(err, tt.unwant) {
+				t.Errorf("Check = %v, classified as %v too", err, tt.unwant)
+			}
+		})
+	}
+}
+
+func TestRefusedLoginAlertsRightAway(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	alerts := make(chan error, 1)
+	ic.SetFailureHandler(time.Hour, func(since time.Time, err error) { alerts <- err })
+
+	mbox.setDialError(errors.New("connection refused"))
+	ic.Check(context.Background())
+	select {
+	case err := <-alerts:
+		t.Fatalf("alert for an unreachable server before the window: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mbox.setDialError(nil)
+	mbox.setLoginError(errors.New("Invalid credentials"))
+	ic.Check(context.Background())
+	select {
+	case err := <-alerts:
+		if got, want := FailureHint(err), "password expired or changed?"; got != want {
+			t.Errorf("FailureHint = %q, want %q", got, want)
+		}
+		if errors.Is(err, ErrCredentialsChanged) {
+			t.Errorf("alert = %v, want no ErrCredentialsChanged for an account that never logged in", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert for a refused login")
+	}
+}
+
+func TestRefusedLoginAfterWorkingAlertsAsChangedCredentials(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	alerts := make(chan error, 1)
+	ic.SetFailureHandler(time.Hour, func(since time.Time, err error) { alerts <- err })
+	check(t, ic)
+
+	mbox.setLoginError(errors.New("[AUTHENTICATIONFAILED] Invalid credentials"))
+	ic.Check(context.Background())
+	select {
+	case err := <-alerts:
+		if !errors.Is(err, ErrCredentialsChanged) || !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("alert = %v, want ErrCredentialsChanged and ErrAuthFailed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert for a refused login")
+	}
+
+	mbox.setLoginError(nil)
+	check(t, ic)
+	select {
+	case err := <-alerts:
+		if err != nil {
+			t.Errorf("alert = %v after logging in again, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no all-clear after logging in again")
+	}
+}
+
+func TestChangedCredentialsAlertWithoutFailureWindow(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	alerts := make(chan error, 1)
+	ic.SetFailureHandler(0, func(since time.Time, err error) { alerts <- err })
+	check(t, ic)
+
+	mbox.setLoginError(errors.New("[AUTHENTICATIONFAILED] Invalid credentials"))
+	ic.Check(context.Background())
+	select {
+	case err := <-alerts:
+		if !errors.Is(err, ErrCredentialsChanged) {
+			t.Errorf("alert = %v, want ErrCredentialsChanged", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert for a refused login with failure alerts off")
+	}
+}
+
+func TestSetPasswordAppliesToTheNextLogin(t *testing.T) {
+	mbox := newFakeMailbox()
+	if err := storage.SetDataFolder(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var passwords []string
+	ic, err := NewChecker(testConfig(), withDial(func(cfg config.EmailConfig) (imapClient, error) {
+		mu.Lock()
+		passwords = append(passwords, cfg.Password)
+		mu.Unlock()
+		return mbox.dial(cfg)
+	}))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	t.Cleanup(ic.Stop)
+
+	check(t, ic)
+	ic.SetPassword("first")
+	ic.SetPassword("second")
+	check(t, ic)
+	check(t, ic)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(passwords, ","); got != "secret,second,second" {
+		t.Errorf("logged in with %s, want secret,second,second", got)
+	}
+}
+
+func TestThrottledCheckHoldsBackScheduledOnes(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	mbox.setLoginError(errors.New("[UNAVAILABLE] Too many simultaneous connections"))
+	ic.Check(context.Background())
+	s := ic.Status()
+	if wait := time.Until(s.ThrottledUntil); wait < throttleBackoffMin*4/5 || wait > throttleBackoffMin*6/5 {
+		t.Fatalf("ThrottledUntil in %v, want about %v", wait, throttleBackoffMin)
+	}
+	if !s.NextCheck.Equal(s.ThrottledUntil) {
+		t.Errorf("NextCheck = %v, want the end of the throttling %v", s.NextCheck, s.ThrottledUntil)
+	}
+	if !ic.skipScheduled(time.Minute) {
+		t.Error("scheduled check made while throttled")
+	}
+
+	mbox.setLoginError(nil)
+	check(t, ic)
+	if s := ic.Status(); !s.ThrottledUntil.IsZero() {
+		t.Errorf("ThrottledUntil = %v after a successful check, want zero", s.ThrottledUntil)
+	}
+	if ic.skipScheduled(time.Minute) {
+		t.Error("scheduled check skipped after the throttling ended")
+	}
+}
+
+func TestThrottleBackoffGrows(t *testing.T) {
+	for n, want := range map[int]time.Duration{1: 5 * time.Minute, 2: 10 * time.Minute, 4: 40 * time.Minute, 9: time.Hour} {
+		if got := throttleBackoff(n); got < want*4/5 || got >= want*6/5 {
+			t.Errorf("throttleBackoff(%d) = %v, want %v give or take a fifth", n, got, want)
+		}
+	}
+}
+
+func TestCheckClosesEveryConnection(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	for i := 0; i < 3; i++ {
+		check(t, ic)
+	}
+	mbox.failOnce("search", errConnClosed)
+	ic.Check(context.Background())
+
+	dials, open := mbox.stats()
+	if dials < 4 {
+		t.Errorf("%d connection(s) for 4 checks; each check connects anew", dials)
+	}
+	if open != 0 {
+		t.Errorf("%d connection(s) left open", open)
+	}
+}
+
+func TestCheckWithCancelledContext(t *testing.T) {
+	mbox := newFakeMailbox()
+	ic := newTestChecker(t, mbox)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ic.Check(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Check = %v, want context.Canceled", err)
+	}
+	if dials, _ := mbox.stats(); dials != 0 {
+		t.Errorf("cancelled check connected %d time(s)", dials)
+	}
+}
+
+func TestResetStateEstablishesNewBaseline(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	mbox.deliver("b@example.com", "unseen", base.Add(time.Minute))
+	ic.ResetState()
+	if want := base.Add(time.Minute); !ic.lastSeenDate.Equal(want) {
+		t.Errorf("lastSeenDate after reset = %v, want %v", ic.lastSeenDate, want)
+	}
+}
+
+func TestStartCheckingDeliversNewMail(t *testing.T) {
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	got := make(chan []string, 4)
+	ic.StartChecking(func(_ context.Context, emails []storage.MessageRecord) {
+		got <- subjectsOf(emails)
+	})
+	expect := func(want ...string) {
+		t.Helper()
+		select {
+		case s := <-got:
+			if !equalStrings(s, want) {
+				t.Errorf("callback got %v, want %v", s, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("callback not called for %v", want)
+		}
+	}
+
+	// The new message is found by the loop's first check or else by the
+	// requested one, which waits for the first to finish
+	mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+	if _, err := ic.CheckNow(); err != nil {
+		t.Fatalf("CheckNow: %v", err)
+	}
+	expect("new")
+
+	mbox.deliver("c@example.com", "newer", base.Add(2*time.Minute))
+	subjects, err := ic.CheckNow()
+	if err != nil {
+		t.Fatalf("CheckNow: %v", err)
+	}
+	if want := []string{"newer"}; !equalStrings(subjects, want) {
+		t.Errorf("CheckNow = %v, want %v", subjects, want)
+	}
+	expect("newer")
+
+	ic.Stop()
+	if _, err := ic.CheckNow(); !errors.Is(err, ErrStopped) {
+		t.Errorf("CheckNow after Stop = %v, want ErrStopped", err)
+	}
+}
+
+func TestStartCheckingHandlesMissedMail(t *testing.T) {
+	tests := []struct {
+		mode       MissedMail
+		summarized []string
+	}{
+		{MissedSummarize, []string{"missed 2", "missed 1"}},
+		{MissedSkip, nil},
+	}
+	for _, tt := range tests {
+		mbox := newFakeMailbox()
+		mbox.deliver("a@example.com", "old", base)
+		ic := newTestChecker(t, mbox)
+		check(t, ic)
+
+		// Mail arrives while n0tif isn't running
+		mbox.deliver("b@example.com", "missed 1", base.Add(time.Minute))
+		mbox.deliver("b@example.com", "missed 2", base.Add(2*time.Minute))
+		var summarized []string
+		ic.SetMissedMail(tt.mode, func(_ context.Context, emails []storage.MessageRecord) {
+			summarized = subjectsOf(emails)
+		})
+		got := make(chan []string, 4)
+		ic.StartChecking(func(_ context.Context, emails []storage.MessageRecord) {
+			got <- subjectsOf(emails)
+		})
+		// A requested check waits for the loop's first one
+		if _, err := ic.CheckNow(); err != nil {
+			t.Fatalf("CheckNow: %v", err)
+		}
+		if !equalStrings(summarized, tt.summarized) {
+			t.Errorf("mode %d: summarized %v, want %v", tt.mode, summarized, tt.summarized)
+		}
+
+		// Later mail is notified of as usual
+		mbox.deliver("c@example.com", "new", base.Add(3*time.Minute))
+		if _, err := ic.CheckNow(); err != nil {
+			t.Fatalf("CheckNow: %v", err)
+		}
+		select {
+		case s := <-got:
+			if want := []string{"new"}; !equalStrings(s, want) {
+				t.Errorf("mode %d: callback got %v, want %v", tt.mode, s, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("mode %d: callback not called", tt.mode)
+		}
+		ic.Stop()
+	}
+}
+
+func TestCheckLoopRestartsAfterPanic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the restart delay")
+	}
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+
+	// The first check of the loop finds the new message and the callback panics on it
+	mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+	restarted := make(chan error, 1)
+	ic.SetRestartHandler(func(crash error) { restarted <- crash })
+	ic.StartChecking(func(context.Context, []storage.MessageRecord) { panic("callback bug") })
+
+	// Until the restart, Status reports the crash
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if strings.Contains(ic.Status().LastError, "callback bug") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Status does not report the crash: %+v", ic.Status())
+		}
+	}
+
+	select {
+	case crash := <-restarted:
+		if crash.Error() != "callback bug" {
+			t.Errorf("crash = %v", crash)
+		}
+	case <-time.After(minRestartDelay + 5*time.Second):
+		t.Fatal("check loop not restarted")
+	}
+
+	// The restarted loop answers again
+	done := make(chan error, 1)
+	go func() {
+		_, err := ic.CheckNow()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("CheckNow after restart: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("restarted loop does not answer CheckNow")
+	}
+}
@@ -0,0 +1,149 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+)
+
+// MarkRead sets the \Seen flag on a message, identified by its UID in mailbox
+func MarkRead(cfg config.EmailConfig, mailbox string, uid uint32) error {
+	c, err := Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		return fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(seqSet, item, []interface{}{imap.SeenFlag}, nil); err != nil {
+		return fmt.Errorf("mark UID %d read: %w", uid, err)
+	}
+	return nil
+}
+
+// MarkAllRead sets the \Seen flag on the messages uids of mailbox with a single command
+func MarkAllRead(cfg config.EmailConfig, mailbox string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	c, err := Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		return fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(seqSet, item, []interface{}{imap.SeenFlag}, nil); err != nil {
+		return fmt.Errorf("mark %d message(s) read: %w", len(uids), classifyTransport(err))
+	}
+	return nil
+}
+
+// Unseen returns which of the messages uids of mailbox are still unread. It opens
+// the mailbox read-only, so nothing is marked as read; messages no longer in the
+// mailbox are left out.
+func Unseen(cfg config.EmailConfig, mailbox string, uids []uint32) (map[uint32]bool, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	messages := make(chan *imap.Message, fetchBuffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, messages)
+	}()
+
+	unseen := make(map[uint32]bool)
+	for msg := range messages {
+		if !slices.Contains(msg.Flags, imap.SeenFlag) {
+			unseen[msg.Uid] = true
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch flags: %w", classifyTransport(err))
+	}
+	return unseen, nil
+}
+
+// UnreadCount returns how many messages of mailbox are unread, without opening it
+func UnreadCount(cfg config.EmailConfig, mailbox string) (int, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Logout()
+
+	status, err := c.Status(mailbox, []imap.StatusItem{imap.StatusUnseen})
+	if err != nil {
+		return 0, fmt.Errorf("status %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	return int(status.Unseen), nil
+}
+
+// ErrImportanceUnsupported means the server doesn't tell which messages are important
+var ErrImportanceUnsupported = errors.New("server has no importance labels")
+
+// gmailLabels is the fetch item of Gmail's labels, one of its IMAP extensions
+const gmailLabels imap.FetchItem = "X-GM-LABELS"
+
+// Important returns which of the messages uids of mailbox the provider marked as
+// important. Only Gmail does over IMAP, with its \Important label; other servers
+// return ErrImportanceUnsupported.
+func Important(cfg config.EmailConfig, mailbox string, uids []uint32) (map[uint32]bool, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if ok, err := c.Support("X-GM-EXT-1"); err != nil {
+		return nil, fmt.Errorf("capabilities: %w", classifyTransport(err))
+	} else if !ok {
+		return nil, ErrImportanceUnsupported
+	}
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	messages := make(chan *imap.Message, fetchBuffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, gmailLabels}, messages)
+	}()
+
+	important := make(map[uint32]bool)
+	for msg := range messages {
+		labels, _ := msg.Items[gmailLabels].([]interface{})
+		for _, l := range labels {
+			if s, _ := imap.ParseString(l); strings.EqualFold(s, `\Important`) {
+				important[msg.Uid] = true
+			}
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch labels: %w", classifyTransport(err))
+	}
+	return important, nil
+}
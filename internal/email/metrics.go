@@ -0,0 +1,21 @@
+package email
+
+import "github.com/byigitt/n0tif/internal/metrics"
+
+var (
+	checksTotal = metrics.NewCounter("n0tif_checks_total",
+		"Checks for new email by result (success, error or throttled).", "result")
+	checkDuration = metrics.NewHistogram("n0tif_check_duration_seconds",
+		"Time a check takes, from connecting to the server to logging out.",
+		[]float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60})
+	newEmailsTotal = metrics.NewCounter("n0tif_new_emails_total",
+		"New emails found by checks.", "")
+	checkRetriesTotal = metrics.NewCounter("n0tif_check_retries_total",
+		"Checks tried again over a new connection after a transient failure.", "")
+	imapErrorsTotal = metrics.NewCounter("n0tif_imap_errors_total",
+		"Failed IMAP operations by stage (dial, login, select, search or fetch).", "stage")
+	connectionsTotal = metrics.NewCounter("n0tif_imap_connections_total",
+		"Successful logins to the IMAP server; n0tif reconnects for every check.", "")
+	bytesTotal = metrics.NewCounter("n0tif_imap_bytes_total",
+		"Bytes exchanged with the IMAP server by direction (sent or received), TLS included.", "direction")
+)
@@ -0,0 +1,63 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// MissedMail is what the checking started by StartChecking does with the email
+// that arrived while n0tif wasn't running, which its first successful check finds
+type MissedMail int
+
+const (
+	// MissedNotify passes the missed email to the callback like any new email
+	MissedNotify MissedMail = iota
+	// MissedSummarize passes the missed email to the summary handler instead
+	MissedSummarize
+	// MissedSkip moves the baseline past the missed email without fetching it
+	MissedSkip
+)
+
+// SetMissedMail sets what happens to the email that arrived while n0tif wasn't
+// running. Only an account checked before has any; summarize is called with it,
+// on the checking goroutine, for MissedSummarize. Call it before StartChecking.
+func (ic *ImapChecker) SetMissedMail(m MissedMail, summarize func(context.Context, []storage.MessageRecord)) {
+	ic.missed = m
+	ic.summarize = summarize
+}
+
+// beforeMissedCheck moves the baseline to the newest message on the server for
+// MissedSkip, while no check has succeeded since starting
+func (ic *ImapChecker) beforeMissedCheck() error {
+	if !ic.missedDue || ic.missed != MissedSkip || ic.lastSeenDate.IsZero() {
+		return nil
+	}
+	previous := ic.lastSeenDate
+	ic.lastSeenDate = time.Time{}
+	if err := ic.InitializeEmailTracking(); err != nil {
+		ic.lastSeenDate = previous
+		return fmt.Errorf("skip email missed while not running: %w", err)
+	}
+	ic.log.Infof("StartChecking: Skipped the email that arrived since %s while n0tif wasn't running.", previous.Format(time.RFC3339))
+	return nil
+}
+
+// deliver hands the new emails of a successful check made by the loop to
+// callback, or those of the first one since starting to the summary handler
+// when SetMissedMail asked for it
+func (ic *ImapChecker) deliver(ctx context.Context, emails []storage.MessageRecord, callback func(context.Context, []storage.MessageRecord)) {
+	missed := ic.missedDue
+	ic.missedDue = false
+	if len(emails) == 0 {
+		return
+	}
+	if missed && ic.missed == MissedSummarize && ic.summarize != nil {
+		ic.log.Infof("StartChecking: Summarizing %d email(s) that arrived while n0tif wasn't running.", len(emails))
+		ic.summarize(ctx, emails)
+		return
+	}
+	callback(ctx, emails)
+}
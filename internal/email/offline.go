@@ -0,0 +1,63 @@
+package email
+
+import (
+	"errors"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/network"
+)
+
+// offlinePollInterval is how often connectivity is probed while the machine is offline
+const offlinePollInterval = 15 * time.Second
+
+// waitIfOffline is called after a failed check. If the machine turns out to be offline
+// or behind a captive portal, scheduled checks are skipped until the network is back,
+// and a check is made right away then. It reports whether the failure was caused by
+// being offline, so the caller doesn't have to log it as an error. Failures the
+// server answered, such as a refused login, are not probed for.
+func (ic *ImapChecker) waitIfOffline(checkErr error) bool {
+	if errors.Is(checkErr, ErrAuthFailed) || errors.Is(checkErr, ErrMailboxNotFound) || errors.Is(checkErr, ErrThrottled) {
+		return false
+	}
+	state := network.Probe(ic.config.ImapServer, ic.config.ImapPort)
+	if state == network.Online {
+		return false
+	}
+
+	ic.statusMu.Lock()
+	watching := ic.status.Offline != ""
+	ic.status.Offline = state.String()
+	ic.statusMu.Unlock()
+	ic.forgetFailures()
+	if !watching {
+		ic.log.Warnf("StartChecking: Check failed while offline (%s): %v. Waiting for the network.", state, checkErr)
+		go ic.watchNetwork()
+	}
+	return true
+}
+
+// watchNetwork probes connectivity until the machine is online again and then checks
+func (ic *ImapChecker) watchNetwork() {
+	ticker := time.NewTicker(offlinePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ic.ctx.Done():
+			return
+		}
+		state := network.Probe(ic.config.ImapServer, ic.config.ImapPort)
+		ic.statusMu.Lock()
+		if state != network.Online {
+			ic.status.Offline = state.String()
+			ic.statusMu.Unlock()
+			continue
+		}
+		ic.status.Offline = ""
+		ic.statusMu.Unlock()
+
+		ic.log.Infof("StartChecking: Network is back, checking now.")
+		ic.CheckNow()
+		return
+	}
+}
@@ -0,0 +1,66 @@
+package email
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+// Option configures a checker made by NewChecker
+type Option func(*options)
+
+type options struct {
+	tlsConfig *tls.Config
+	dialer    Dialer
+	dial      dialFunc
+	clock     Clock
+	log       *logging.Logger
+}
+
+// Dialer opens the network connection to the server; *net.Dialer is one, and
+// so are the dialers of proxy packages
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// Clock tells the time
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of the machine
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// WithTLSConfig sets the TLS configuration of the connections, e.g. to trust a
+// private CA; nil, the default, verifies the server against the system roots
+func WithTLSConfig(c *tls.Config) Option {
+	return func(o *options) { o.tlsConfig = c }
+}
+
+// WithDialer makes the checker connect through d, e.g. a SOCKS proxy, rather
+// than directly
+func WithDialer(d Dialer) Option {
+	return func(o *options) { o.dialer = d }
+}
+
+// WithClock sets the clock of the timestamps the checker records and reports:
+// the times in Status and when new email was seen. Intervals and timeouts
+// still run on the machine's clock.
+func WithClock(c Clock) Option {
+	return func(o *options) { o.clock = c }
+}
+
+// WithLogger makes the checker log through l instead of the "imap" component
+// logger. Its lines are still tagged with the account.
+func WithLogger(l *logging.Logger) Option {
+	return func(o *options) { o.log = l }
+}
+
+// withDial replaces connecting to a server altogether, for tests
+func withDial(dial dialFunc) Option {
+	return func(o *options) { o.dial = dial }
+}
@@ -0,0 +1,102 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// fixedClock always tells the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestWithClockStampsStatusAndRecords(t *testing.T) {
+	if err := storage.SetDataFolder(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	now := base.Add(24 * time.Hour)
+	ic, err := NewChecker(testConfig(), withDial(mbox.dial), WithClock(fixedClock(now)))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	t.Cleanup(ic.Stop)
+	check(t, ic)
+
+	mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+	emails := check(t, ic)
+	if len(emails) != 1 || !emails[0].SeenAt.Equal(now) {
+		t.Errorf("Check = %+v, want one email seen at %v", emails, now)
+	}
+	if s := ic.Status(); !s.LastCheck.Equal(now) || !s.LastSuccess.Equal(now) {
+		t.Errorf("Status = %+v, want checks at %v", s, now)
+	}
+}
+
+// recordingDialer fails every connection, remembering where it was asked to connect
+type recordingDialer struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (d *recordingDialer) Dial(network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addrs = append(d.addrs, network+" "+addr)
+	return nil, errors.New("proxy refused the connection")
+}
+
+func TestWithDialerConnectsThroughIt(t *testing.T) {
+	if err := storage.SetDataFolder(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	d := &recordingDialer{}
+	ic, err := NewChecker(testConfig(), WithDialer(d), WithTLSConfig(&tls.Config{ServerName: "imap.example.com"}))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	_, err = ic.Check(context.Background())
+	if !errors.Is(err, ErrNetworkUnreachable) || !strings.Contains(err.Error(), "proxy refused") {
+		t.Errorf("Check = %v, want the dialer's error", err)
+	}
+	// A refused connection is tried again, through the dialer each time
+	want := make([]string, checkAttempts)
+	for i := range want {
+		want[i] = "tcp imap.example.com:993"
+	}
+	if !equalStrings(d.addrs, want) {
+		t.Errorf("dialed %v, want %v", d.addrs, want)
+	}
+}
+
+func TestWithLoggerTagsAccount(t *testing.T) {
+	if err := storage.SetDataFolder(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logging.SetOutput(&buf, logging.FormatText)
+	t.Cleanup(func() { logging.SetOutput(os.Stderr, logging.FormatText) })
+
+	mbox := newFakeMailbox()
+	ic, err := NewChecker(testConfig(), withDial(mbox.dial), WithLogger(logging.For("mywatcher")))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	ic.log.Infof("hello")
+	line := buf.String()
+	if !strings.Contains(line, "component=mywatcher") || !strings.Contains(line, "account=user@example.com") {
+		t.Errorf("log line = %q, want the logger's component and the account", line)
+	}
+}
@@ -0,0 +1,79 @@
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/byigitt/n0tif/config"
+)
+
+// errPinMismatch is the handshake failing because the server's key isn't the pinned one
+var errPinMismatch = errors.New("server certificate doesn't have the key pinned with pin_sha256")
+
+// PinOf returns the pin of cert for pin_sha256: the base64 SHA-256 hash of its public key
+func PinOf(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// tlsConfigFor returns the TLS configuration of connections to the server of
+// cfg, starting from base, the defaults if nil. With pin_sha256 set, only a
+// certificate with the pinned key is accepted, in place of the checks of its
+// issuer and host name, which a self-signed certificate can't pass.
+func tlsConfigFor(cfg config.EmailConfig, base *tls.Config) (*tls.Config, error) {
+	pin, err := cfg.Pin()
+	if err != nil {
+		return nil, fmt.Errorf("pin_sha256: %w", err)
+	}
+	if pin == nil {
+		return base, nil
+	}
+	tlsConfig := &tls.Config{}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errPinMismatch
+		}
+		leaf := state.PeerCertificates[0]
+		hash := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		if !bytes.Equal(hash[:], pin) {
+			return fmt.Errorf("%w: it has %s", errPinMismatch, PinOf(leaf))
+		}
+		return nil
+	}
+	return tlsConfig, nil
+}
+
+// ServerCertificate connects to the server of cfg and returns its certificate
+// without verifying it, so its pin can be shown to be checked and trusted
+func ServerCertificate(cfg config.EmailConfig) (*x509.Certificate, error) {
+	d := &net.Dialer{Timeout: diagnoseTimeout}
+	addr := net.JoinHostPort(cfg.ImapServer, strconv.Itoa(cfg.ImapPort))
+	conn, err := tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: cfg.ImapServer, InsecureSkipVerify: true})
+	if err != nil {
+		return nil, classify(ErrNetworkUnreachable, err)
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("the server sent no certificate")
+	}
+	return certs[0], nil
+}
+
+// isCertificateError reports whether the handshake failed because the server's
+// certificate isn't trusted, which no retry fixes
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	return errors.As(err, &verifyErr) || errors.Is(err, errPinMismatch)
+}
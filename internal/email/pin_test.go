@@ -0,0 +1,130 @@
+package email
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+)
+
+// selfSignedServer serves just enough IMAP over TLS with a self-signed
+// certificate to log in, and returns the account to connect with and the certificate
+func selfSignedServer(t *testing.T) (config.EmailConfig, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mail.internal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"mail.internal"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveLogin(conn)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	cfg := testConfig()
+	cfg.ImapServer = "127.0.0.1"
+	cfg.ImapPort = addr.Port
+	return cfg, cert
+}
+
+// serveLogin answers every command with OK until LOGOUT
+func serveLogin(conn net.Conn) {
+	defer conn.Close()
+	conn.Write([]byte("* OK [CAPABILITY IMAP4rev1] ready\r\n"))
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		command, _, _ = strings.Cut(strings.ToUpper(command), " ")
+		switch command {
+		case "CAPABILITY":
+			conn.Write([]byte("* CAPABILITY IMAP4rev1\r\n"))
+		case "LOGOUT":
+			conn.Write([]byte("* BYE\r\n" + tag + " OK done\r\n"))
+			return
+		}
+		conn.Write([]byte(tag + " OK done\r\n"))
+	}
+}
+
+func TestDialRefusesSelfSignedCertificate(t *testing.T) {
+	cfg, _ := selfSignedServer(t)
+	_, err := Dial(cfg)
+	if !errors.Is(err, ErrCertificateUntrusted) {
+		t.Fatalf("Dial = %v, want ErrCertificateUntrusted", err)
+	}
+	if errors.Is(err, ErrNetworkUnreachable) {
+		t.Errorf("Dial = %v, classified as a network failure too", err)
+	}
+}
+
+func TestDialTrustsPinnedCertificate(t *testing.T) {
+	cfg, cert := selfSignedServer(t)
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	for _, pin := range []string{PinOf(cert), "sha256//" + PinOf(cert), hex.EncodeToString(hash[:])} {
+		cfg.PinSHA256 = pin
+		c, err := Dial(cfg)
+		if err != nil {
+			t.Errorf("Dial with pin %q = %v", pin, err)
+			continue
+		}
+		c.Logout()
+	}
+}
+
+func TestDialRefusesOtherKeyThanPinned(t *testing.T) {
+	cfg, cert := selfSignedServer(t)
+	other := sha256.Sum256([]byte("another key"))
+	cfg.PinSHA256 = hex.EncodeToString(other[:])
+	_, err := Dial(cfg)
+	if !errors.Is(err, ErrCertificateUntrusted) {
+		t.Fatalf("Dial = %v, want ErrCertificateUntrusted", err)
+	}
+	if !strings.Contains(err.Error(), PinOf(cert)) {
+		t.Errorf("Dial = %v, want it to name the server's pin %s", err, PinOf(cert))
+	}
+
+	cfg.PinSHA256 = "not a pin"
+	if _, err := Dial(cfg); err == nil || !strings.Contains(err.Error(), "pin_sha256") {
+		t.Errorf("Dial with an invalid pin = %v", err)
+	}
+}
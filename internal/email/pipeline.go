@@ -0,0 +1,148 @@
+package email
+
+import (
+	"context"
+	"sync"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/storage"
+	"github.com/emersion/go-imap"
+)
+
+// fetchWorkers is how many connections fetch the envelopes of a backlog of
+// several batches at once, the check's own included. The extra ones keep to
+// the connection budget of the server like any other.
+const fetchWorkers = 3
+
+// fetchParallel fetches items of the messages uids, by UID, and hands each
+// message to handle on the calling goroutine as it arrives. A backlog of
+// several batches is shared out between c and up to fetchWorkers-1 more
+// connections, each taking the next batch left as it finishes one. A helper
+// only connects while batches are left and doesn't wait for a place in the
+// connection budget; one that can't connect, or connects after the work is
+// done, just leaves it to the others, and the check never waits for it.
+// Batches a connection failed on are fetched again over c at the end. It
+// returns the data the extra connections moved and the error of c, if it failed.
+func (ic *ImapChecker) fetchParallel(ctx context.Context, c imapClient, uids []uint32, items []imap.FetchItem, handle func(*imap.Message)) (storage.DataUsage, error) {
+	var batches [][]uint32
+	for start := 0; start < len(uids); start += fetchBatchSize {
+		batches = append(batches, uids[start:min(start+fetchBatchSize, len(uids))])
+	}
+	queue := make(chan []uint32, len(batches))
+	for _, batch := range batches {
+		queue <- batch
+	}
+	close(queue)
+
+	var (
+		mu      sync.Mutex
+		failed  [][]uint32 // batches to fetch again over c
+		primary error      // the error of c
+		usage   storage.DataUsage
+		// fetching counts the connections taking batches; messages is closed
+		// once the last one stops, after which no helper may join
+		fetching = 1
+	)
+	messages := make(chan *imap.Message, fetchBuffer)
+	forward := func(msg *imap.Message) { messages <- msg }
+	// work fetches batches over conn until none are left or one fails
+	work := func(conn imapClient) error {
+		for batch := range queue {
+			if err := fetchBatch(conn.UidFetch, batch, items, forward); err != nil {
+				mu.Lock()
+				failed = append(failed, batch)
+				mu.Unlock()
+				return err
+			}
+		}
+		return nil
+	}
+	// join lets a helper take batches, unless the others are done already
+	join := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if fetching == 0 || len(queue) == 0 || ctx.Err() != nil {
+			return false
+		}
+		fetching++
+		return true
+	}
+	leave := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if fetching--; fetching == 0 {
+			close(messages)
+		}
+	}
+
+	go func() {
+		defer leave()
+		if err := work(c); err != nil {
+			mu.Lock()
+			primary = err
+			mu.Unlock()
+		}
+	}()
+	// Helpers may still be connecting after the check is over
+	cfg := ic.config
+	for i := 0; i < min(fetchWorkers-1, len(batches)-1); i++ {
+		go func() {
+			if len(queue) == 0 || ctx.Err() != nil {
+				return
+			}
+			helper, err := ic.connectSelected(cfg)
+			if err != nil {
+				ic.log.Debugf("CheckForNewEmails: No extra connection for fetching: %v", err)
+				return
+			}
+			defer helper.Logout()
+			if !join() {
+				return
+			}
+			stop := context.AfterFunc(ctx, func() { helper.Terminate() })
+			if err := work(helper); err != nil {
+				ic.log.Debugf("CheckForNewEmails: Extra connection failed fetching, leaving its batch to the check's own: %v", err)
+			}
+			stop()
+			u := dataUsage(helper)
+			mu.Lock()
+			usage.Sent += u.Sent
+			usage.Received += u.Received
+			mu.Unlock()
+			leave()
+		}()
+	}
+	for msg := range messages {
+		handle(msg)
+	}
+
+	// Batches nobody got to, because every connection failed, are left in the
+	// queue. Once messages is closed no connection takes or fails any more.
+	for batch := range queue {
+		failed = append(failed, batch)
+	}
+	if primary != nil {
+		return usage, primary
+	}
+	for _, batch := range failed {
+		if err := fetchBatch(c.UidFetch, batch, items, handle); err != nil {
+			return usage, err
+		}
+	}
+	return usage, nil
+}
+
+// connectSelected connects and opens the mailbox read-only, for an extra
+// connection of a check, as the account cfg. It doesn't wait for a place in the connection budget.
+func (ic *ImapChecker) connectSelected(cfg config.EmailConfig) (imapClient, error) {
+	c, err := ic.dialExtra(cfg)
+	if err != nil {
+		return nil, err
+	}
+	connectionsTotal.Inc()
+	if _, err := c.Select(mailboxName, true); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,177 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime/quotedprintable"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+)
+
+const (
+	// previewBytes is how much of the text part of a message is fetched for its preview
+	previewBytes = 4096
+	// previewLength caps a preview, in characters
+	previewLength = 160
+)
+
+var (
+	// htmlHidden matches the elements of an HTML part that aren't text
+	htmlHidden = regexp.MustCompile(`(?is)<(head|style|script)\b.*?(</(head|style|script)>|$)`)
+	// htmlTag matches a tag, or what is left of one cut off at the end
+	htmlTag = regexp.MustCompile(`(?s)<[^>]*(>|$)`)
+)
+
+// Previews returns the beginning of the text of the messages uids of mailbox,
+// by UID, for notifications that show it. Of each message only the start of its
+// plain text part, or failing that its HTML part, is fetched, and only once it
+// is known to be notified of, so the checks themselves stay with the headers.
+// Messages without a text part, or in a character set other than UTF-8 or
+// Latin-1, have none.
+func Previews(cfg config.EmailConfig, mailbox string, uids []uint32) (map[uint32]string, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+
+	// First which part holds the text, then that part of all messages keeping it in the same place
+	type textPart struct {
+		path     []int
+		encoding string
+		charset  string
+		html     bool
+	}
+	parts := make(map[uint32]textPart)
+	err = fetchBatch(c.UidFetch, uids, []imap.FetchItem{imap.FetchUid, imap.FetchBodyStructure}, func(msg *imap.Message) {
+		if msg.BodyStructure == nil {
+			return
+		}
+		var found *textPart
+		msg.BodyStructure.Walk(func(path []int, part *imap.BodyStructure) bool {
+			if !strings.EqualFold(part.MIMEType, "text") || strings.EqualFold(part.Disposition, "attachment") {
+				return true
+			}
+			html := strings.EqualFold(part.MIMESubType, "html")
+			if !html && !strings.EqualFold(part.MIMESubType, "plain") {
+				return true
+			}
+			if found == nil || (found.html && !html) {
+				found = &textPart{path: path, encoding: part.Encoding, charset: param(part.Params, "charset"), html: html}
+			}
+			return true
+		})
+		if found != nil {
+			parts[msg.Uid] = *found
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetch structure: %w", classifyTransport(err))
+	}
+
+	byPath := make(map[string][]uint32)
+	for uid, part := range parts {
+		key := formatPath(part.path)
+		byPath[key] = append(byPath[key], uid)
+	}
+	previews := make(map[uint32]string, len(parts))
+	for _, list := range byPath {
+		section := &imap.BodySectionName{
+			BodyPartName: imap.BodyPartName{Path: parts[list[0]].path},
+			Peek:         true,
+			Partial:      []int{0, previewBytes},
+		}
+		err := fetchBatch(c.UidFetch, list, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, func(msg *imap.Message) {
+			part, ok := parts[msg.Uid]
+			body := msg.GetBody(section)
+			if !ok || body == nil {
+				return
+			}
+			data, _ := io.ReadAll(body)
+			if text := previewText(data, part.encoding, part.charset, part.html); text != "" {
+				previews[msg.Uid] = text
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fetch text: %w", classifyTransport(err))
+		}
+	}
+	return previews, nil
+}
+
+// param returns the MIME parameter name of params, whatever its case
+func param(params map[string]string, name string) string {
+	for k, v := range params {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// previewText turns the start of a text part, as fetched, into a single line of
+// at most previewLength characters; "" if it can't be read
+func previewText(data []byte, encoding, charset string, isHTML bool) string {
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		// The part is cut off, so a broken escape at the end is expected
+		data, _ = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+	case "base64":
+		clean := bytes.Join(bytes.Fields(data), nil)
+		clean = clean[:len(clean)/4*4]
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(clean)))
+		n, err := base64.StdEncoding.Decode(decoded, clean)
+		if err != nil {
+			return ""
+		}
+		data = decoded[:n]
+	}
+
+	var text string
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		// Also drops a character cut in two at the end
+		text = strings.ToValidUTF8(string(data), "")
+	case "iso-8859-1", "latin1", "windows-1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	default:
+		return ""
+	}
+
+	if isHTML {
+		text = htmlHidden.ReplaceAllString(text, " ")
+		text = htmlTag.ReplaceAllString(text, " ")
+		text = html.UnescapeString(text)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > previewLength {
+		runes := []rune(text)
+		text = strings.TrimSpace(string(runes[:previewLength-1])) + "…"
+	}
+	return text
+}
+
+// formatPath renders a part path as in a BODY section, e.g. "1.2"
+func formatPath(path []int) string {
+	parts := make([]string, len(path))
+	for i, n := range path {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
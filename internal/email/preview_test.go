@@ -0,0 +1,44 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPreviewTextDecodesPart(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		encoding string
+		charset  string
+		html     bool
+		want     string
+	}{
+		{"plain", "Hi Bob,\r\n\r\nthe contract  is attached.", "7bit", "utf-8", false, "Hi Bob, the contract is attached."},
+		{"quoted-printable", "Gr=C3=BC=C3=9Fe aus =\r\nBerlin=", "quoted-printable", "UTF-8", false, "Grüße aus Berlin"},
+		{"base64 cut off", "SGVsbG8gd29y\r\nbGQh", "BASE64", "", false, "Hello world!"},
+		{"latin-1", "Caf\xe9", "8bit", "ISO-8859-1", false, "Café"},
+		{"html", "<html><head><style>p{}</style></head><body><p>Meeting &amp; lunch</p><p>at noon</p>", "7bit", "utf-8", true, "Meeting & lunch at noon"},
+		{"html cut in a tag", "<p>Hello</p><a href=\"https://exa", "7bit", "utf-8", true, "Hello"},
+		{"utf-8 cut in a character", "Gr\xc3\xbc\xc3", "8bit", "utf-8", false, "Grü"},
+		{"unknown charset", "\x82\xa0", "8bit", "shift_jis", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previewText([]byte(tt.data), tt.encoding, tt.charset, tt.html); got != tt.want {
+				t.Errorf("previewText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewTextIsCapped(t *testing.T) {
+	got := previewText([]byte(strings.Repeat("word ", 100)), "7bit", "utf-8", false)
+	if n := utf8.RuneCountInString(got); n > previewLength {
+		t.Errorf("preview of %d characters, want at most %d", n, previewLength)
+	}
+	if !strings.HasSuffix(got, "…") {
+		t.Errorf("preview %q doesn't show it was cut", got)
+	}
+}
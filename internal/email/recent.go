@@ -0,0 +1,91 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/emersion/go-imap"
+)
+
+// Message summarizes a message on the server
+type Message struct {
+	SeqNum  uint32    `json:"seq_num"`
+	UID     uint32    `json:"uid"`
+	Date    time.Time `json:"date"` // server arrival (INTERNALDATE)
+	From    string    `json:"from"`
+	Subject string    `json:"subject"`
+	Flags   []string  `json:"flags"`
+	Seen    bool      `json:"seen"`
+	Recent  bool      `json:"recent"`
+}
+
+// RecentMessages returns the last n messages of mailbox, newest first. It opens
+// the mailbox read-only, so nothing is marked as read.
+func RecentMessages(cfg config.EmailConfig, mailbox string, n int) ([]Message, error) {
+	c, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	mbox, err := c.Select(mailbox, true)
+	if err != nil {
+		return nil, fmt.Errorf("select %s: %w", mailbox, classifyReply(ErrMailboxNotFound, err))
+	}
+	if mbox.Messages == 0 || n <= 0 {
+		return nil, nil
+	}
+
+	from := uint32(1)
+	if mbox.Messages > uint32(n) {
+		from = mbox.Messages - uint32(n) + 1
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddRange(from, mbox.Messages)
+
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchFlags}
+	messages := make(chan *imap.Message, n)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqSet, items, messages)
+	}()
+
+	var result []Message
+	for msg := range messages {
+		m := Message{
+			SeqNum: msg.SeqNum,
+			UID:    msg.Uid,
+			Date:   msg.InternalDate,
+			From:   "Unknown",
+			Flags:  msg.Flags,
+		}
+		if msg.Envelope != nil {
+			m.Subject = msg.Envelope.Subject
+			if len(msg.Envelope.From) > 0 {
+				addr := msg.Envelope.From[0]
+				if addr.PersonalName != "" {
+					m.From = addr.PersonalName
+				} else if addr.MailboxName != "" && addr.HostName != "" {
+					m.From = fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
+				}
+			}
+		}
+		for _, flag := range msg.Flags {
+			switch flag {
+			case imap.SeenFlag:
+				m.Seen = true
+			case imap.RecentFlag:
+				m.Recent = true
+			}
+		}
+		result = append(result, m)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch messages: %w", classifyTransport(err))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Date.After(result[j].Date) })
+	return result, nil
+}
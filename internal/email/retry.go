@@ -0,0 +1,29 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// checkAttempts is how often one check tries, each time over a new connection,
+// before it fails and the next chance is the next interval
+const checkAttempts = 3
+
+// checkRetryDelay is the pause before the second attempt of a check, doubled
+// before each further one. A variable so the tests don't wait.
+var checkRetryDelay = 2 * time.Second
+
+// isTransient reports whether a check that failed with err is worth trying
+// again right away: the connection couldn't be made, was reset or the server
+// said BYE. Throttling isn't, as another connection only makes it worse, and
+// neither is a refusal by the server.
+func isTransient(err error) bool {
+	return errors.Is(err, ErrNetworkUnreachable) && !errors.Is(err, ErrThrottled) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryDelay is the pause after the failed attempt of a check, counting from 1
+func retryDelay(attempt int) time.Duration {
+	return checkRetryDelay << (attempt - 1)
+}
@@ -0,0 +1,130 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// Scheduler coordinates the checks of the checkers sharing it, e.g. several
+// accounts monitored by one process. At most a fixed number of checks run at
+// once; each account starts at an offset of its own within the jitter window, so
+// the accounts don't all log in at the same moment; and a check running longer
+// than the timeout is cancelled, so a server that hangs only holds up its own
+// account. A nil *Scheduler runs checks right away without a timeout.
+type Scheduler struct {
+	workers chan struct{} // one token per check running
+
+	mu      sync.Mutex
+	jitter  time.Duration
+	timeout time.Duration
+}
+
+// DefaultWorkers is the number of checks a Scheduler runs at once when asked for none
+const DefaultWorkers = 4
+
+// NewScheduler returns a scheduler running up to workers checks at once (DefaultWorkers
+// if workers is not positive). Jitter and timeout are as for SetTiming.
+func NewScheduler(workers int, jitter, timeout time.Duration) *Scheduler {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	s := &Scheduler{workers: make(chan struct{}, workers)}
+	s.SetTiming(jitter, timeout)
+	return s
+}
+
+// SetTiming changes the jitter window and the check timeout; zero disables either.
+// Offsets already waited out are kept.
+func (s *Scheduler) SetTiming(jitter, timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jitter = max(jitter, 0)
+	s.timeout = max(timeout, 0)
+}
+
+// Offset is how long after starting account's first check waits. It is derived
+// from the account name, so every account keeps its place in the window across
+// restarts and the scheduled checks that follow stay spread out too.
+func (s *Scheduler) Offset(account string) time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	jitter := s.jitter
+	s.mu.Unlock()
+	if jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(account))
+	return time.Duration(h.Sum64() % uint64(jitter))
+}
+
+// run makes check once a worker is free, cancelling its context when the timeout
+// passes. Waiting for a worker ends with ctx.
+func (s *Scheduler) run(ctx context.Context, check func(context.Context) ([]storage.MessageRecord, error)) ([]storage.MessageRecord, error) {
+	if s == nil {
+		return check(ctx)
+	}
+	select {
+	case s.workers <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.workers }()
+
+	s.mu.Lock()
+	timeout := s.timeout
+	s.mu.Unlock()
+	if timeout <= 0 {
+		return check(ctx)
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	emails, err := check(checkCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("check timed out after %v: %w", timeout, classify(ErrNetworkUnreachable, err))
+	}
+	return emails, err
+}
+
+// SetScheduler makes the check loop run its checks through s, which other
+// checkers may share. Call it before StartChecking.
+func (ic *ImapChecker) SetScheduler(s *Scheduler) {
+	ic.sched = s
+}
+
+// runCheck is a check of the check loop, made through the scheduler
+func (ic *ImapChecker) runCheck(ctx context.Context) ([]storage.MessageRecord, error) {
+	return ic.sched.run(ctx, func(ctx context.Context) ([]storage.MessageRecord, error) {
+		if err := ic.beforeMissedCheck(); err != nil {
+			return nil, err
+		}
+		return ic.checkForNewEmails(ctx)
+	})
+}
+
+// waitForOffset delays the first check of the loop by the account's offset.
+// It reports false if the checker was stopped meanwhile.
+func (ic *ImapChecker) waitForOffset() bool {
+	offset := ic.sched.Offset(ic.config.Username)
+	if offset <= 0 {
+		return true
+	}
+	ic.log.Debugf("StartChecking: First check in %v to spread logins.", offset.Round(time.Millisecond))
+	ic.statusMu.Lock()
+	ic.status.NextCheck = ic.clock.Now().Add(offset)
+	ic.statusMu.Unlock()
+	select {
+	case <-time.After(offset):
+		return true
+	case <-ic.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,139 @@
+package email
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+func TestSchedulerOffset(t *testing.T) {
+	var none *Scheduler
+	if d := none.Offset("a@example.com"); d != 0 {
+		t.Errorf("nil scheduler offset = %v, want 0", d)
+	}
+	if d := NewScheduler(1, 0, 0).Offset("a@example.com"); d != 0 {
+		t.Errorf("offset without jitter = %v, want 0", d)
+	}
+
+	const jitter = time.Minute
+	s := NewScheduler(1, jitter, 0)
+	seen := map[time.Duration]bool{}
+	for _, account := range []string{"a@example.com", "b@example.com", "c@example.org"} {
+		d := s.Offset(account)
+		if d < 0 || d >= jitter {
+			t.Errorf("offset of %s = %v, want within [0, %v)", account, d, jitter)
+		}
+		if again := s.Offset(account); again != d {
+			t.Errorf("offset of %s changed from %v to %v", account, d, again)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Error("accounts share one offset")
+	}
+}
+
+func TestSchedulerBoundsConcurrentChecks(t *testing.T) {
+	s := NewScheduler(2, 0, 0)
+	var mu sync.Mutex
+	running, most := 0, 0
+	release := make(chan struct{})
+	check := func(context.Context) ([]storage.MessageRecord, error) {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run(context.Background(), check)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if most != 2 {
+		t.Errorf("%d checks ran at once, want 2", most)
+	}
+}
+
+func TestSchedulerWaitEndsWithContext(t *testing.T) {
+	s := NewScheduler(1, 0, 0)
+	block := make(chan struct{})
+	defer close(block)
+	go s.run(context.Background(), func(context.Context) ([]storage.MessageRecord, error) {
+		<-block
+		return nil, nil
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	called := false
+	_, err := s.run(ctx, func(context.Context) ([]storage.MessageRecord, error) {
+		called = true
+		return nil, nil
+	})
+	if err != context.DeadlineExceeded || called {
+		t.Errorf("run while every worker is busy = %v (check called: %v), want to give up", err, called)
+	}
+}
+
+func TestStuckAccountDoesNotHoldUpOthers(t *testing.T) {
+	sched := NewScheduler(1, 0, 200*time.Millisecond)
+
+	stuckBox := newFakeMailbox()
+	stuckBox.deliver("a@example.com", "old", base)
+	stuck := newTestChecker(t, stuckBox)
+	check(t, stuck)
+	stuck.SetScheduler(sched)
+	stuckBox.setStall(true)
+	stuck.StartChecking(func(context.Context, []storage.MessageRecord) {})
+	for stuckBox.stalledCommands() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mbox := newFakeMailbox()
+	mbox.deliver("a@example.com", "old", base)
+	ic := newTestChecker(t, mbox)
+	check(t, ic)
+	ic.SetScheduler(sched)
+	mbox.deliver("b@example.com", "new", base.Add(time.Minute))
+	got := make(chan []string, 1)
+	ic.StartChecking(func(_ context.Context, emails []storage.MessageRecord) {
+		got <- subjectsOf(emails)
+	})
+
+	select {
+	case s := <-got:
+		if want := []string{"new"}; !equalStrings(s, want) {
+			t.Errorf("callback got %v, want %v", s, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stuck account kept the other one from being checked")
+	}
+	// The stuck check records its outcome once it gave up the worker
+	deadline := time.Now().Add(time.Second)
+	for stuck.Status().LastError == "" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s := stuck.Status(); !strings.Contains(s.LastError, "timed out") {
+		t.Errorf("stuck account's last error = %q, want a timeout", s.LastError)
+	}
+	if n := stuckBox.stalledCommands(); n != 0 {
+		t.Errorf("%d command(s) still hanging after the timeout", n)
+	}
+}
@@ -0,0 +1,60 @@
+package email
+
+import (
+	"context"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// Backoff between restarts of a check loop that keeps panicking
+const (
+	minRestartDelay = 5 * time.Second
+	maxRestartDelay = 5 * time.Minute
+	// stableRunTime without a panic resets the backoff, so a rare crash is retried quickly
+	stableRunTime = 10 * time.Minute
+)
+
+// SetRestartHandler sets a function that is called, on the checking goroutine, each time
+// the check loop is restarted after a panic. Call it before StartChecking.
+func (ic *ImapChecker) SetRestartHandler(handler func(crash error)) {
+	ic.onRestart = handler
+}
+
+// supervise runs the check loop and restarts it whenever it panics, waiting longer
+// after each crash in a row so a check that always panics doesn't spin
+func (ic *ImapChecker) supervise(callback func(context.Context, []storage.MessageRecord)) {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		crash := ic.runLoop(callback)
+		if crash == nil {
+			return
+		}
+		if time.Since(started) >= stableRunTime {
+			delay = minRestartDelay
+		}
+
+		ic.statusMu.Lock()
+		ic.status.LastError = "check loop crashed: " + crash.Error()
+		ic.status.NextCheck = ic.clock.Now().Add(delay)
+		ic.statusMu.Unlock()
+
+		ic.log.Eventf(logging.LevelError, "Checking crashed, restarting in %v: %v", delay, crash)
+		select {
+		case <-time.After(delay):
+		case <-ic.ctx.Done():
+			return
+		}
+		ic.log.Infof("StartChecking: Restarting check loop after crash.")
+		if ic.onRestart != nil {
+			ic.onRestart(crash)
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
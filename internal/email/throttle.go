@@ -0,0 +1,44 @@
+package email
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// throttleBackoffMin is how long scheduled checks wait after the first throttled one
+	throttleBackoffMin = 5 * time.Minute
+	// throttleBackoffMax caps the wait, however often the provider throttled in a row
+	throttleBackoffMax = time.Hour
+)
+
+// throttleBackoff returns how long scheduled checks wait after the provider
+// throttled n checks in a row: doubling from throttleBackoffMin up to
+// throttleBackoffMax, give or take a fifth at random, so the accounts
+// throttled together don't all try again at the same moment
+func throttleBackoff(n int) time.Duration {
+	d := min(throttleBackoffMin<<min(n-1, 8), throttleBackoffMax)
+	spread := d / 5
+	return d - spread + rand.N(2*spread)
+}
+
+// trackThrottling holds back the scheduled checks after one the provider
+// throttled, and lets them go on after any other outcome. The caller holds statusMu.
+func (ic *ImapChecker) trackThrottling(err error, now time.Time) {
+	if !errors.Is(err, ErrThrottled) {
+		if ic.throttled > 0 {
+			ic.log.Infof("StartChecking: No longer throttled by the provider.")
+		}
+		ic.throttled = 0
+		ic.status.ThrottledUntil = time.Time{}
+		return
+	}
+	ic.throttled++
+	ic.status.ThrottledUntil = now.Add(throttleBackoff(ic.throttled))
+	if ic.status.ThrottledUntil.After(ic.status.NextCheck) {
+		ic.status.NextCheck = ic.status.ThrottledUntil
+	}
+	ic.log.Warnf("StartChecking: Throttled by the provider (%d in a row); next check at %s.",
+		ic.throttled, ic.status.ThrottledUntil.Format(time.Kitchen))
+}
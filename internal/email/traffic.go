@@ -0,0 +1,94 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// countingDialer is a Dialer whose connections count the data they move and
+// keep to the connection budget of their server
+type countingDialer struct {
+	Dialer
+	wait time.Duration // for a place in the budget; zero fails at once when there is none
+	conn *countingConn // the last connection made
+}
+
+func (d *countingDialer) Dial(network, addr string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	var slot *storage.Slot
+	if limit := connectionBudget(host); limit > 0 {
+		var err error
+		if slot, err = storage.AcquireSlot("imap-"+strings.ToLower(host), limit, d.wait); err != nil {
+			return nil, fmt.Errorf("connection budget of %s: %w", host, err)
+		}
+	}
+	c, err := d.Dialer.Dial(network, addr)
+	if err != nil {
+		slot.Release()
+		return nil, err
+	}
+	d.conn = &countingConn{Conn: c, slot: slot}
+	return d.conn, nil
+}
+
+// countingConn counts the bytes sent and received over a connection to the
+// server, TLS included. The metrics follow as they move; the day's data usage
+// of the profile is recorded when the connection is closed, which also frees
+// its place in the connection budget.
+type countingConn struct {
+	net.Conn
+	slot           *storage.Slot // nil for a server without a budget
+	sent, received atomic.Int64
+	closeOnce      sync.Once
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Add(int64(n))
+	bytesTotal.With("received").Add(float64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.Add(int64(n))
+	bytesTotal.With("sent").Add(float64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.slot.Release()
+		if err := storage.RecordDataUsage(time.Now(), c.usage()); err != nil {
+			logger.Warnf("Failed to record data usage: %v", err)
+		}
+	})
+	return err
+}
+
+// usage returns the data moved so far
+func (c *countingConn) usage() storage.DataUsage {
+	return storage.DataUsage{Sent: c.sent.Load(), Received: c.received.Load()}
+}
+
+// countedClient is a client whose connection counts its data, so a check can
+// tell how much it moved
+type countedClient struct {
+	imapClient
+	conn *countingConn
+}
+
+// dataUsage returns the data c has moved, if it counts it; the clients of tests don't
+func dataUsage(c imapClient) storage.DataUsage {
+	if cc, ok := c.(*countedClient); ok && cc.conn != nil {
+		return cc.conn.usage()
+	}
+	return storage.DataUsage{}
+}
@@ -0,0 +1,45 @@
+package email
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+func TestCountingConnRecordsDataUsage(t *testing.T) {
+	if err := storage.SetDataFolder(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 5)
+		io.ReadFull(server, buf)
+		server.Write([]byte("* OK"))
+	}()
+
+	conn := &countingConn{Conn: client}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	conn.Close()
+	conn.Close()
+
+	want := storage.DataUsage{Sent: 5, Received: 4}
+	if got := conn.usage(); got != want {
+		t.Errorf("usage = %+v, want %+v", got, want)
+	}
+	recorded, err := storage.DataUsageSince(time.Now())
+	if err != nil {
+		t.Fatalf("DataUsageSince: %v", err)
+	}
+	if recorded != want {
+		t.Errorf("recorded %+v, want %+v once", recorded, want)
+	}
+}
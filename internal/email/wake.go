@@ -0,0 +1,47 @@
+package email
+
+import (
+	"time"
+)
+
+const (
+	// wakeTick is how often watchWake looks at the clock
+	wakeTick = 10 * time.Second
+	// wakeGap is how much longer than wakeTick a tick may take before it counts as sleep
+	wakeGap = 30 * time.Second
+)
+
+// watchWake checks right away when the machine wakes from sleep or hibernation, rather
+// than waiting out an interval that started before it went to sleep. Nothing runs
+// while the machine sleeps, so the wall clock jumping ahead between two ticks gives
+// the wake-up away on every platform without subscribing to power events.
+func (ic *ImapChecker) watchWake() {
+	ticker := time.NewTicker(wakeTick)
+	defer ticker.Stop()
+	// Round(0) drops the monotonic reading, which doesn't advance during sleep on every platform
+	last := time.Now().Round(0)
+	for {
+		select {
+		case <-ticker.C:
+		case <-ic.ctx.Done():
+			return
+		}
+		now := time.Now().Round(0)
+		slept := now.Sub(last) - wakeTick
+		last = now
+		if slept < wakeGap {
+			continue
+		}
+
+		status := ic.Status()
+		if status.Paused || status.Offline != "" {
+			// A paused check stays paused; the network watcher checks once the network is back
+			ic.log.Infof("StartChecking: Woke up after about %v asleep.", slept.Round(time.Second))
+			continue
+		}
+		// Each check opens a new connection, so none left over from before the sleep is reused
+		ic.log.Infof("StartChecking: Woke up after about %v asleep, checking now.", slept.Round(time.Second))
+		ic.CheckNow()
+		last = time.Now().Round(0)
+	}
+}
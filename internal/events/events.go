@@ -0,0 +1,120 @@
+// Package events is the event bus of a running monitor. The checker and the
+// notification code publish what happens; features such as hooks, history and
+// additional notifiers subscribe to the events they need instead of being
+// called one by one from the monitor.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// Type names a kind of event
+type Type string
+
+// Event types
+const (
+	EmailReceived    Type = "email-received"    // a check found new email
+	CheckFailed      Type = "check-failed"      // a check failed
+	NotificationSent Type = "notification-sent" // a notification was shown
+	DaemonPaused     Type = "daemon-paused"     // scheduled checks were paused
+	DaemonResumed    Type = "daemon-resumed"    // scheduled checks were resumed
+)
+
+// Event is something that happened in the monitor. Which fields are set depends on the type.
+type Event struct {
+	Type    Type
+	Time    time.Time
+	Account string
+
+	Emails  []storage.MessageRecord // EmailReceived, and NotificationSent for email; newest first
+	Err     error                   // CheckFailed
+	Title   string                  // NotificationSent
+	Message string                  // NotificationSent
+	Until   time.Time               // DaemonPaused; zero while paused until resumed
+}
+
+// Handler is told about an event
+type Handler func(ctx context.Context, e Event)
+
+// Bus delivers events to the subscribers of their type. The zero value is not
+// usable; a nil *Bus drops what is published to it.
+type Bus struct {
+	log *logging.Logger
+
+	mu     sync.RWMutex
+	nextID int
+	subs   []subscription
+}
+
+type subscription struct {
+	id      int
+	name    string // for the log
+	typ     Type
+	handler Handler
+}
+
+// New returns an empty bus
+func New() *Bus {
+	return &Bus{log: logging.For("events")}
+}
+
+// Subscribe calls handler for every event of type t; name identifies the
+// subscriber in the log. Subscribers are called in the order they subscribed.
+// Call the returned function to unsubscribe.
+func (b *Bus) Subscribe(name string, t Type, handler Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := b.nextID
+	b.subs = append(b.subs, subscription{id: id, name: name, typ: t, handler: handler})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s.id == id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers e to the subscribers of its type and returns once they all
+// have handled it. A subscriber that panics is logged and the others still run.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	var subs []subscription
+	for _, s := range b.subs {
+		if s.typ == e.Type {
+			subs = append(subs, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	b.log.Debugf("Event %s for %s, %d subscriber(s)", e.Type, e.Account, len(subs))
+	for _, s := range subs {
+		b.deliver(ctx, s, e)
+	}
+}
+
+func (b *Bus) deliver(ctx context.Context, s subscription, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.Errorf("Subscriber %s panicked on %s: %v", s.name, e.Type, r)
+		}
+	}()
+	s.handler(ctx, e)
+}
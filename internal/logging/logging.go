@@ -0,0 +1,262 @@
+// Package logging writes n0tif's log through log/slog, as text or JSON, with levels
+// so the detailed tracing of every check can be switched on when needed and stays
+// quiet otherwise.
+//
+// Components log through their own Logger (see For), which tags every line with the
+// component and can carry further fields such as the account, so logs can be
+// filtered by them. The package-level functions log without a component.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level orders log messages by importance
+type Level int32
+
+// Levels, from most to least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name used by ParseLevel
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error"
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %q: use debug, info, warn or error", s)
+}
+
+// slogLevel maps a level to its log/slog counterpart
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Log formats
+const (
+	FormatText = "text" // key=value pairs
+	FormatJSON = "json" // one JSON object per line
+)
+
+var (
+	minLevel slog.LevelVar
+
+	handlerMu sync.RWMutex
+	handler   slog.Handler
+)
+
+func init() {
+	SetOutput(os.Stderr, FormatText)
+}
+
+// SetOutput writes the log to w in the given format, FormatText or FormatJSON
+func SetOutput(w io.Writer, format string) error {
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       &minLevel,
+		ReplaceAttr: shortSource,
+	}
+	var h slog.Handler
+	switch format {
+	case FormatText, "":
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: use %s or %s", format, FormatText, FormatJSON)
+	}
+	handlerMu.Lock()
+	defer handlerMu.Unlock()
+	handler = h
+	return nil
+}
+
+// shortSource reduces the source of a line to the file name and line number
+func shortSource(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.SourceKey && len(groups) == 0 {
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+		}
+	}
+	return a
+}
+
+// SetLevel sets the least important level that is still written
+func SetLevel(l Level) {
+	minLevel.Set(l.slogLevel())
+}
+
+// CurrentLevel returns the least important level that is written
+func CurrentLevel() Level {
+	switch l := minLevel.Level(); {
+	case l <= slog.LevelDebug:
+		return LevelDebug
+	case l <= slog.LevelInfo:
+		return LevelInfo
+	case l <= slog.LevelWarn:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// Enabled reports whether messages of level l are written
+func Enabled(l Level) bool {
+	return l.slogLevel() >= minLevel.Level()
+}
+
+// Logger logs with fields, such as the component and the account, attached to every line
+type Logger struct {
+	attrs []slog.Attr
+}
+
+// root is the logger of the package-level functions
+var root = &Logger{}
+
+// For returns the logger of a component, e.g. "imap", "storage" or "service"
+func For(component string) *Logger {
+	return &Logger{attrs: []slog.Attr{slog.String("component", component)}}
+}
+
+// With returns a logger that adds the given key-value pairs to every line
+func (l *Logger) With(args ...interface{}) *Logger {
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	attrs := append([]slog.Attr(nil), l.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return &Logger{attrs: attrs}
+}
+
+// Debugf logs detailed tracing, written only at the debug level
+func (l *Logger) Debugf(format string, args ...interface{}) { l.output(LevelDebug, format, args...) }
+
+// Infof logs normal operation
+func (l *Logger) Infof(format string, args ...interface{}) { l.output(LevelInfo, format, args...) }
+
+// Warnf logs a problem n0tif works around
+func (l *Logger) Warnf(format string, args ...interface{}) { l.output(LevelWarn, format, args...) }
+
+// Errorf logs a failed operation
+func (l *Logger) Errorf(format string, args ...interface{}) { l.output(LevelError, format, args...) }
+
+// Eventf is Eventf of the package with the logger's fields in the log file
+func (l *Logger) Eventf(level Level, format string, args ...interface{}) {
+	l.output(level, format, args...)
+	recordEvent(level, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) output(level Level, format string, args ...interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	// Skip Callers, output and the level method so the source is the caller
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level.slogLevel(), fmt.Sprintf(format, args...), pcs[0])
+	r.AddAttrs(l.attrs...)
+
+	handlerMu.RLock()
+	h := handler
+	handlerMu.RUnlock()
+	_ = h.Handle(context.Background(), r)
+}
+
+// Debugf logs detailed tracing, written only at the debug level
+func Debugf(format string, args ...interface{}) { root.output(LevelDebug, format, args...) }
+
+// Infof logs normal operation
+func Infof(format string, args ...interface{}) { root.output(LevelInfo, format, args...) }
+
+// Warnf logs a problem n0tif works around
+func Warnf(format string, args ...interface{}) { root.output(LevelWarn, format, args...) }
+
+// Errorf logs a failed operation
+func Errorf(format string, args ...interface{}) { root.output(LevelError, format, args...) }
+
+// EventLog is a system event log, such as the Windows Event Log. The logger of
+// a github.com/kardianos/service service satisfies it.
+type EventLog interface {
+	Error(v ...interface{}) error
+	Warning(v ...interface{}) error
+	Info(v ...interface{}) error
+}
+
+var (
+	eventLogMu sync.Mutex
+	eventLog   EventLog
+)
+
+// SetEventLog makes Eventf record its messages in l as well; nil stops that
+func SetEventLog(l EventLog) {
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	eventLog = l
+}
+
+// Eventf logs something administrators monitoring the system event log should see,
+// such as the service starting or stopping and failures that need attention.
+// It goes to the event log set with SetEventLog regardless of the log level.
+func Eventf(l Level, format string, args ...interface{}) {
+	root.output(l, format, args...)
+	recordEvent(l, fmt.Sprintf(format, args...))
+}
+
+// recordEvent writes msg to the event log set with SetEventLog, if any
+func recordEvent(l Level, msg string) {
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	if eventLog == nil {
+		return
+	}
+	var err error
+	switch {
+	case l >= LevelError:
+		err = eventLog.Error(msg)
+	case l == LevelWarn:
+		err = eventLog.Warning(msg)
+	default:
+		err = eventLog.Info(msg)
+	}
+	if err != nil {
+		root.output(LevelWarn, "Failed to write to the event log: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Rotation decides when a RotatingFile starts over and how many old files it keeps.
+// A zero MaxSize or MaxAge disables that trigger.
+type Rotation struct {
+	MaxSize int64         // rotate once the file has grown to this many bytes
+	MaxAge  time.Duration // rotate once the first line in the file is this old
+	Keep    int           // rotated files kept as path.1 (newest) to path.<Keep>
+}
+
+// rotateRetryDelay is how long a failed rotation waits before it is tried again,
+// e.g. while another program holds the file open on Windows
+const rotateRetryDelay = time.Minute
+
+// legacyTimestampLayout is how lines written by the standard logger, before the log
+// went through log/slog, start
+const legacyTimestampLayout = "2006/01/02 15:04:05"
+
+// lineTimestamp finds the RFC 3339 time near the start of a text or JSON log line
+var lineTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+
+// RotatingFile is an append-only log file that is renamed to path.1, shifting older
+// files up and deleting the oldest, when it gets too large or too old. It is safe
+// for concurrent use and meant to be passed to SetOutput.
+type RotatingFile struct {
+	path string
+
+	mu       sync.Mutex
+	rotation Rotation
+	f        *os.File
+	size     int64
+	started  time.Time // time of the first line in the file
+	retryAt  time.Time // a failed rotation isn't attempted again before this
+}
+
+// OpenRotating opens the log file at path for appending
+func OpenRotating(path string, rotation Rotation) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, rotation: rotation}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file and works out its size and age
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	r.started = time.Now()
+	if r.size > 0 {
+		// The file doesn't record when it was created, but its first line does
+		head := make([]byte, 64)
+		n, _ := io.ReadFull(io.NewSectionReader(f, 0, int64(len(head))), head)
+		if t, ok := firstLineTime(string(head[:n])); ok {
+			r.started = t
+		}
+	}
+	return nil
+}
+
+// firstLineTime parses the time a log line starts with
+func firstLineTime(head string) (time.Time, bool) {
+	if m := lineTimestamp.FindString(head); m != "" {
+		if t, err := time.Parse(time.RFC3339Nano, m); err == nil {
+			return t, true
+		}
+	}
+	if len(head) >= len(legacyTimestampLayout) {
+		if t, err := time.ParseInLocation(legacyTimestampLayout, head[:len(legacyTimestampLayout)], time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// SetRotation changes the rotation settings; they apply from the next write
+func (r *RotatingFile) SetRotation(rotation Rotation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rotation = rotation
+}
+
+// Write appends p to the file, rotating it first if it is due
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil && r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the current file and try again a little later
+			r.retryAt = time.Now().Add(rotateRetryDelay)
+			if r.f != nil {
+				// Logged once this write has released the file
+				go Warnf("Log rotation failed: %v", err)
+			}
+		}
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file has to be rotated before writing n more bytes
+func (r *RotatingFile) due(n int64) bool {
+	if r.size == 0 || time.Now().Before(r.retryAt) {
+		return false
+	}
+	if r.rotation.MaxSize > 0 && r.size+n > r.rotation.MaxSize {
+		return true
+	}
+	return r.rotation.MaxAge > 0 && time.Since(r.started) >= r.rotation.MaxAge
+}
+
+// rotate shifts the old files up, moves the current file to path.1 and starts a new one.
+// The file is closed while it is renamed, since Windows can't rename an open file.
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+
+	var renameErr error
+	if r.rotation.Keep <= 0 {
+		renameErr = os.Remove(r.path)
+	} else {
+		os.Remove(r.rotatedPath(r.rotation.Keep))
+		for i := r.rotation.Keep - 1; i >= 1; i-- {
+			if err := os.Rename(r.rotatedPath(i), r.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+				renameErr = err
+			}
+		}
+		if err := os.Rename(r.path, r.rotatedPath(1)); err != nil {
+			renameErr = err
+		}
+	}
+
+	// Reopen even if renaming failed, appending to the old file
+	if err := r.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+// rotatedPath returns the name of the i-th newest rotated file
+func (r *RotatingFile) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close closes the file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,172 @@
+// Package metrics keeps the counters of a running monitor and renders them in the
+// Prometheus text format, without pulling in the Prometheus client library.
+//
+// Metrics register themselves when created, normally as package variables of the
+// package that updates them, and WriteText writes all of them.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is anything WriteText can render
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// WriteText writes every registered metric in the Prometheus text exposition format
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	all := append([]metric(nil), registry...)
+	registryMu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].name() < all[j].name() })
+	for _, m := range all {
+		m.write(w)
+	}
+}
+
+// Counter counts events, optionally split by the values of one label
+type Counter struct {
+	metricName string
+	help       string
+	label      string
+
+	mu     sync.Mutex
+	values map[string]float64 // by label value; "" without a label
+}
+
+// NewCounter creates and registers a counter. With a label, the counter is
+// updated through With and each label value becomes its own series.
+func NewCounter(name, help, label string) *Counter {
+	c := &Counter{metricName: name, help: help, label: label, values: make(map[string]float64)}
+	if label == "" {
+		c.values[""] = 0 // show the series before the first event
+	}
+	register(c)
+	return c
+}
+
+// Inc counts one event
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add counts n events
+func (c *Counter) Add(n float64) { c.add("", n) }
+
+// With returns the series of the counter for a label value
+func (c *Counter) With(value string) *LabeledCounter {
+	return &LabeledCounter{counter: c, value: value}
+}
+
+func (c *Counter) add(value string, n float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value] += n
+}
+
+func (c *Counter) name() string { return c.metricName }
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.metricName, c.help, c.metricName)
+	values := make([]string, 0, len(c.values))
+	for v := range c.values {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		if c.label == "" {
+			fmt.Fprintf(w, "%s %s\n", c.metricName, formatValue(c.values[v]))
+		} else {
+			fmt.Fprintf(w, "%s{%s=%s} %s\n", c.metricName, c.label, quoteLabel(v), formatValue(c.values[v]))
+		}
+	}
+}
+
+// LabeledCounter is one series of a counter with a label
+type LabeledCounter struct {
+	counter *Counter
+	value   string
+}
+
+// Inc counts one event
+func (l *LabeledCounter) Inc() { l.counter.add(l.value, 1) }
+
+// Add counts n events
+func (l *LabeledCounter) Add(n float64) { l.counter.add(l.value, n) }
+
+// Histogram counts observations, such as durations in seconds, in cumulative buckets
+type Histogram struct {
+	metricName string
+	help       string
+	bounds     []float64 // upper bounds of the buckets, ascending
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	total  uint64
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper bounds
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	h := &Histogram{metricName: name, help: help, bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+	register(h)
+	return h
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.total++
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.metricName, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.metricName, h.total)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.metricName, formatValue(h.sum), h.metricName, h.total)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// quoteLabel quotes a label value as the text format requires
+func quoteLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
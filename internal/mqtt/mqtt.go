@@ -0,0 +1,319 @@
+// Package mqtt is a minimal MQTT 3.1.1 client that publishes messages at QoS 0,
+// which is all n0tif needs to report to Home Assistant. It keeps n0tif free of
+// a full client library, like the OTLP exporter of package tracing.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types, shifted into the high nibble of the first byte
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetPingreq    = 12 << 4
+	packetDisconnect = 14 << 4
+)
+
+// Connect flags
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+const dialTimeout = 15 * time.Second
+
+// Message is published to a topic; a retained message is also handed to every
+// later subscriber of the topic
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure a connection
+type Options struct {
+	// Broker is mqtt://host[:1883] or mqtts://host[:8883], with the user name and
+	// password of the broker, if it needs them, as user info
+	Broker    string
+	ClientID  string
+	KeepAlive time.Duration // how often the connection is checked; 0 means a minute
+	Will      *Message      // published by the broker when the connection is lost
+}
+
+// Client is a connection to a broker
+type Client struct {
+	conn net.Conn
+	mu   sync.Mutex // serializes writes
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+// Connect connects to the broker of opts
+func Connect(ctx context.Context, opts Options) (*Client, error) {
+	u, err := url.Parse(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	var useTLS bool
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl":
+		useTLS = true
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q: use mqtt or mqtts", u.Scheme)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if useTLS {
+			port = "8883"
+		}
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = time.Minute
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if useTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	password, hasPassword := u.User.Password()
+	if _, err := conn.Write(connectPacket(opts.ClientID, u.User.Username(), password, hasPassword, keepAlive, opts.Will)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	kind, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no answer from the broker: %w", err)
+	}
+	if kind != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, errors.New("the broker answered with something other than CONNACK")
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return nil, connackError(code)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Client{conn: conn, done: make(chan struct{})}
+	go c.read(r, keepAlive)
+	go c.ping(keepAlive)
+	return c, nil
+}
+
+// Publish sends m at QoS 0, so it isn't known whether the broker got it; a lost
+// connection shows in Done
+func (c *Client) Publish(m Message) error {
+	var packet []byte
+	header := byte(packetPublish)
+	if m.Retain {
+		header |= 0x01
+	}
+	packet = appendString(packet, m.Topic)
+	packet = append(packet, m.Payload...)
+	return c.write(header, packet)
+}
+
+// Done is closed when the connection is lost or closed; Err then says why
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil while it is up
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close disconnects cleanly, so the broker doesn't publish the will
+func (c *Client) Close() error {
+	err := c.write(packetDisconnect, nil)
+	c.fail(errors.New("connection closed"))
+	return err
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	packet := append([]byte{header}, remainingLength(len(body))...)
+	packet = append(packet, body...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	if _, err := c.conn.Write(packet); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// read takes the broker's answers, which are only PINGRESPs for a client that
+// publishes at QoS 0, and notices when it goes quiet
+func (c *Client) read(r *bufio.Reader, keepAlive time.Duration) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		if _, _, err := readPacket(r); err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+// ping keeps the connection alive while nothing is published
+func (c *Client) ping(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(packetPingreq, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// connectPacket builds the CONNECT packet, asking for a clean session
+func connectPacket(clientID, username, password string, hasPassword bool, keepAlive time.Duration, will *Message) []byte {
+	flags := byte(flagCleanSession)
+	var payload []byte
+	payload = appendString(payload, clientID)
+	if will != nil {
+		flags |= flagWill
+		if will.Retain {
+			flags |= flagWillRetain
+		}
+		payload = appendString(payload, will.Topic)
+		payload = appendBytes(payload, will.Payload)
+	}
+	if username != "" {
+		flags |= flagUsername
+		payload = appendString(payload, username)
+		if hasPassword {
+			flags |= flagPassword
+			payload = appendString(payload, password)
+		}
+	}
+
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	body = append(body, payload...)
+
+	packet := append([]byte{packetConnect}, remainingLength(len(body))...)
+	return append(packet, body...)
+}
+
+// readPacket reads one packet, returning its type and its body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed packet length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+// remainingLength encodes the length of a packet body
+func remainingLength(n int) []byte {
+	var encoded []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		encoded = append(encoded, b)
+		if n == 0 {
+			return encoded
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// connackError explains the return code of a refused connection
+func connackError(code byte) error {
+	switch code {
+	case 1:
+		return errors.New("the broker doesn't support MQTT 3.1.1")
+	case 2:
+		return errors.New("the broker rejected the client ID")
+	case 3:
+		return errors.New("the broker is unavailable")
+	case 4:
+		return errors.New("the broker rejected the user name or password")
+	case 5:
+		return errors.New("the broker refused the connection: not authorized")
+	default:
+		return fmt.Errorf("the broker refused the connection with code %d", code)
+	}
+}
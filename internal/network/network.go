@@ -0,0 +1,88 @@
+// Package network tells a mail server that is down apart from a machine that is
+// offline, so checks can wait for the network instead of failing every interval.
+package network
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State is the connectivity of the machine
+type State int
+
+// Connectivity states
+const (
+	Online        State = iota
+	Offline             // no route to the internet
+	CaptivePortal       // behind a hotspot login page that intercepts all traffic
+)
+
+// String describes the state for status output and logs
+func (s State) String() string {
+	switch s {
+	case Online:
+		return "online"
+	case Offline:
+		return "no network connection"
+	case CaptivePortal:
+		return "network login required (captive portal)"
+	}
+	return "unknown"
+}
+
+// The probe Windows itself uses to detect connectivity (NCSI); a captive portal
+// answers it with its login page instead of the expected text
+const (
+	probeURL      = "http://www.msftconnecttest.com/connecttest.txt"
+	probeExpected = "Microsoft Connect Test"
+)
+
+// probeTimeout bounds each step of Probe
+const probeTimeout = 5 * time.Second
+
+// Probe works out whether the machine is online. Being able to connect to the mail
+// server is proof enough; otherwise the connectivity test URL decides, so a server
+// that is down or blocked while the internet works still counts as online.
+func Probe(server string, port int) State {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(server, strconv.Itoa(port)), probeTimeout)
+	if err == nil {
+		conn.Close()
+		return Online
+	}
+
+	client := &http.Client{
+		Timeout: probeTimeout,
+		// A portal usually redirects to its login page; the redirect alone gives it away
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(probeURL)
+	if err != nil {
+		return Offline
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return Offline
+	}
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != probeExpected {
+		return CaptivePortal
+	}
+	return Online
+}
+
+// WaitOnline probes every interval until the machine is online or timeout has
+// passed, and returns the last state seen
+func WaitOnline(server string, port int, timeout, interval time.Duration) State {
+	deadline := time.Now().Add(timeout)
+	for {
+		state := Probe(server, port)
+		if state == Online || time.Now().Add(interval).After(deadline) {
+			return state
+		}
+		time.Sleep(interval)
+	}
+}
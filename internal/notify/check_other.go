@@ -0,0 +1,31 @@
+//go:build !windows
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// ErrToastsDisabled is returned by CheckToasts when notifications are turned off in Windows settings
+var ErrToastsDisabled = errors.New("notifications are turned off in Windows settings")
+
+// CheckToasts reports whether notifications can be shown for the identity
+// without showing one: outside macOS notify-send must be available, and a
+// custom icon must exist
+func CheckToasts(id Identity) error {
+	if runtime.GOOS != "darwin" {
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return fmt.Errorf("notify-send, used to show notifications, was not found: %w", err)
+		}
+	}
+	if id.Icon != "" {
+		if _, err := os.Stat(id.Icon); err != nil {
+			return fmt.Errorf("notification icon: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// ErrToastsDisabled is returned by CheckToasts when notifications are turned off in Windows settings
+var ErrToastsDisabled = errors.New("notifications are turned off in Windows settings")
+
+// CheckToasts reports whether toasts can be shown for the identity without
+// actually showing one: PowerShell must be available, since toasts are pushed
+// through it, notifications must be enabled, and a custom icon must exist
+func CheckToasts(id Identity) error {
+	if _, err := exec.LookPath("powershell.exe"); err != nil {
+		return fmt.Errorf("PowerShell, used to show notifications, was not found: %w", err)
+	}
+
+	k, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\PushNotifications`, registry.QUERY_VALUE)
+	if err == nil {
+		enabled, _, err := k.GetIntegerValue("ToastEnabled")
+		k.Close()
+		// A missing value means the default, which is enabled
+		if err == nil && enabled == 0 {
+			return ErrToastsDisabled
+		}
+	}
+
+	if id.Icon != "" {
+		if _, err := os.Stat(id.Icon); err != nil {
+			return fmt.Errorf("notification icon: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// show hands the toast to Notification Center through osascript. Buttons,
+// icons, tags and progress bars have no equivalent there, so only the text is
+// kept, with appID as the subtitle.
+func (t *toast) show(appID string) error {
+	title, body := toastText(t)
+	script := fmt.Sprintf("display notification %s with title %s subtitle %s",
+		asQuote(body), asQuote(title), asQuote(appID))
+	if t.Audio.Src == soundMail {
+		script += ` sound name "Glass"`
+	}
+	if out, err := exec.Command("osascript", "-e", script).CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// asQuote makes s an AppleScript string literal
+func asQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,42 @@
+//go:build !windows && !darwin
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// show hands the toast to the desktop's notification server through
+// notify-send. Buttons, tags and progress bars have no equivalent there, so
+// only the text, the icon and how long it stays are kept.
+func (t *toast) show(appID string) error {
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return fmt.Errorf("notify-send, used to show notifications, was not found: %w", err)
+	}
+
+	args := []string{"--app-name", appID}
+	for _, img := range t.Binding.Images {
+		if img.Placement == "appLogoOverride" {
+			args = append(args, "--icon", img.Src)
+		}
+	}
+	// A scenario other than the default keeps a toast until dismissed, as critical does here
+	if t.Scenario != "" && t.Scenario != "default" {
+		args = append(args, "--urgency", "critical")
+	} else if t.Duration == "long" {
+		args = append(args, "--expire-time", "25000")
+	}
+	title, body := toastText(t)
+	args = append(args, "--", title, body)
+
+	if out, err := exec.Command(path, args...).CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const iconSize = 64
+
+// Size of a generated hero image, the 2:1 banner Windows shows across the top of a toast
+const (
+	heroWidth  = 364
+	heroHeight = 182
+)
+
+// ColorIcon returns the path of a solid circle icon in the given hex color,
+// generating it inside dir on first use. Toasts need an image file on disk,
+// so this lets an account pick a color without having to supply an icon.
+func ColorIcon(dir, hexColor string) (string, error) {
+	c, err := parseHexColor(hexColor)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("icon-%02x%02x%02x.png", c.R, c.G, c.B)
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return path, savePNG(path, circleImage(c, iconSize))
+}
+
+// ColorHero returns the path of a banner in the given hex color for the top of
+// a toast, generating it inside dir on first use
+func ColorHero(dir, hexColor string) (string, error) {
+	c, err := parseHexColor(hexColor)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("hero-%02x%02x%02x.png", c.R, c.G, c.B)
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, heroWidth, heroHeight))
+	for y := 0; y < heroHeight; y++ {
+		for x := 0; x < heroWidth; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return path, savePNG(path, img)
+}
+
+// savePNG writes img to path, through a temporary file so a half-written image is never used
+func savePNG(path string, img image.Image) error {
+	tempFile := path + ".tmp"
+	f, err := os.Create(tempFile)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return os.Rename(tempFile, path)
+}
+
+// ColorIconICO returns a solid circle in the given hex color as ICO file data,
+// the format the notification area expects for tray icons
+func ColorIconICO(hexColor string) ([]byte, error) {
+	return BadgeIconICO(hexColor, 0)
+}
+
+// BadgeIconICO is ColorIconICO with count drawn as a badge in the corner, for
+// the unread count on the tray icon; counts above 99 show as "99+" and 0 shows
+// no badge
+func BadgeIconICO(hexColor string, count int) ([]byte, error) {
+	c, err := parseHexColor(hexColor)
+	if err != nil {
+		return nil, err
+	}
+
+	const size = 32
+	img := circleImage(c, size)
+	if count > 0 {
+		label := strconv.Itoa(count)
+		if count > 99 {
+			label = "99+"
+		}
+		drawBadge(img, label)
+	}
+	var payload bytes.Buffer
+	if err := png.Encode(&payload, img); err != nil {
+		return nil, err
+	}
+
+	// ICONDIR followed by a single ICONDIRENTRY pointing at the PNG data,
+	// which Windows accepts in place of a bitmap since Vista
+	const headerSize = 6 + 16
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, struct {
+		Reserved, Type, Count uint16
+	}{0, 1, 1})
+	binary.Write(&ico, binary.LittleEndian, struct {
+		Width, Height, Colors, Reserved uint8
+		Planes, BitCount                uint16
+		Size, Offset                    uint32
+	}{size, size, 0, 0, 1, 32, uint32(payload.Len()), headerSize})
+	ico.Write(payload.Bytes())
+	return ico.Bytes(), nil
+}
+
+// badgeGlyphs is a 3x5 pixel font of the characters a badge shows, a row per
+// string with '#' for a lit pixel
+var badgeGlyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'+': {"...", ".#.", "###", ".#.", "..."},
+}
+
+// Badge colors: white text on a dark red that stands out from every account color
+var (
+	badgeBackground = color.NRGBA{R: 0xB0, G: 0x10, B: 0x1C, A: 0xff}
+	badgeText       = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// drawBadge draws label in the bottom right corner of img, at twice the size
+// of the font so it stays legible in the notification area
+func drawBadge(img *image.NRGBA, label string) {
+	const scale, pad = 2, 1
+	glyphs := []rune(label)
+	width := len(glyphs)*(3+1)*scale - scale + 2*pad
+	height := 5*scale + 2*pad
+	bounds := img.Bounds()
+	left, top := bounds.Max.X-width, bounds.Max.Y-height
+	for y := top; y < bounds.Max.Y; y++ {
+		for x := left; x < bounds.Max.X; x++ {
+			img.SetNRGBA(x, y, badgeBackground)
+		}
+	}
+	for i, r := range glyphs {
+		glyph := badgeGlyphs[r]
+		x0 := left + pad + i*(3+1)*scale
+		for row, line := range glyph {
+			for col, pixel := range line {
+				if pixel != '#' {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						img.SetNRGBA(x0+col*scale+dx, top+pad+row*scale+dy, badgeText)
+					}
+				}
+			}
+		}
+	}
+}
+
+// circleImage draws a filled circle of color c on a transparent square
+func circleImage(c color.NRGBA, size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	center := float64(size-1) / 2
+	radius := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)-center, float64(y)-center
+			if dx*dx+dy*dy <= radius*radius {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+// parseHexColor parses colors in the "#RRGGBB" or "RRGGBB" form
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: expected #RRGGBB", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
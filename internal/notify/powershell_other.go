@@ -0,0 +1,13 @@
+//go:build !windows
+
+package notify
+
+import "errors"
+
+// errNoPowerShell is returned where toasts would be pushed through PowerShell
+var errNoPowerShell = errors.New("toast notifications are only available on Windows")
+
+// runPowerShell fails; the toast API it reaches only exists on Windows
+func runPowerShell(script string) error {
+	return errNoPowerShell
+}
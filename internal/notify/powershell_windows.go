@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// show hands the toast to Windows through PowerShell, which can reach the
+// notification API without a registered app
+func (t *toast) show(appID string) error {
+	data, err := xml.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	// Single-quoted here-strings and literals keep PowerShell from expanding
+	// anything in them; the escaped XML can't contain the '@ that ends one
+	var script strings.Builder
+	script.WriteString(scriptPreamble)
+	script.WriteString("[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null\n")
+	script.WriteString("$xml = New-Object Windows.Data.Xml.Dom.XmlDocument\n")
+	fmt.Fprintf(&script, "$xml.LoadXml(@'\n%s\n'@)\n", data)
+	script.WriteString("$toast = New-Object Windows.UI.Notifications.ToastNotification $xml\n")
+	if t.suppressPopup {
+		script.WriteString("$toast.SuppressPopup = $true\n")
+	}
+	if t.tag != "" {
+		fmt.Fprintf(&script, "$toast.Tag = %s\n$toast.Group = %s\n", psQuote(t.tag), psQuote(toastGroup))
+	}
+	if t.data != nil {
+		writeNotificationData(&script, t.data, 1)
+		script.WriteString("$toast.Data = $data\n")
+	}
+	fmt.Fprintf(&script, "[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(%s).Show($toast)\n", psQuote(appID))
+
+	return runPowerShell(script.String())
+}
+
+// runPowerShell runs script from a temporary file without showing a window
+func runPowerShell(script string) error {
+	f, err := os.CreateTemp("", "n0tif-toast-*.ps1")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	// The byte order mark makes PowerShell read the script as UTF-8
+	_, err = f.WriteString("\ufeff" + script)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("PowerShell", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", f.Name())
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ProgressToast is a notification with a progress bar that is updated in place,
+// e.g. while a large backlog is fetched, instead of showing a new one each time
+type ProgressToast struct {
+	appID string
+	tag   string
+
+	mu  sync.Mutex
+	seq uint32 // of the last update; Windows ignores updates older than the shown one
+}
+
+// ShowProgress shows a silent notification with title and a progress bar at done
+// of total, described by status. tag identifies it; showing another one with the
+// same tag replaces it.
+func ShowProgress(id Identity, tag, title, status string, done, total int) (*ProgressToast, error) {
+	appID := id.AppID
+	if appID == "" {
+		appID = DefaultAppID
+	}
+	t := toast{
+		ActivationType: "protocol",
+		Binding: toastBinding{
+			Template: "ToastGeneric",
+			Text:     []string{title},
+			Progress: &toastProgress{
+				Value:       "{progressValue}",
+				ValueString: "{progressValueString}",
+				Status:      "{progressStatus}",
+			},
+		},
+		Audio: toastAudio{Silent: true},
+		tag:   tag,
+		data:  progressData(status, done, total),
+	}
+	if id.Icon != "" {
+		t.Binding.Images = append(t.Binding.Images, toastImage{Placement: "appLogoOverride", Src: id.Icon})
+	}
+	if err := t.show(appID); err != nil {
+		return nil, err
+	}
+	return &ProgressToast{appID: appID, tag: tag, seq: 1}, nil
+}
+
+// Update moves the progress bar to done of total and changes its status
+func (p *ProgressToast) Update(status string, done, total int) error {
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.mu.Unlock()
+
+	var script strings.Builder
+	script.WriteString(scriptPreamble)
+	writeNotificationData(&script, progressData(status, done, total), seq)
+	fmt.Fprintf(&script, "[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(%s).Update($data, %s, %s) | Out-Null\n",
+		psQuote(p.appID), psQuote(p.tag), psQuote(toastGroup))
+	return runPowerShell(script.String())
+}
+
+// Remove takes the notification off the screen and out of the Action Center
+func (p *ProgressToast) Remove() error {
+	return removeToast(p.appID, p.tag)
+}
+
+// removeToast takes the toast of appID with tag out of the Action Center
+func removeToast(appID, tag string) error {
+	script := scriptPreamble + fmt.Sprintf("[Windows.UI.Notifications.ToastNotificationManager]::History.Remove(%s, %s, %s)\n",
+		psQuote(tag), psQuote(toastGroup), psQuote(appID))
+	return runPowerShell(script)
+}
+
+// progressData is the values of the progress bar bindings for done of total
+func progressData(status string, done, total int) map[string]string {
+	value, text := "0", ""
+	if total > 0 {
+		value = fmt.Sprintf("%.3f", float64(min(done, total))/float64(total))
+		text = fmt.Sprintf("%d/%d", done, total)
+	}
+	return map[string]string{
+		"progressValue":       value,
+		"progressValueString": text,
+		"progressStatus":      status,
+	}
+}
@@ -1,27 +1,226 @@
 package notify
 
 import (
-	"github.com/go-toast/toast"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
 )
 
+// DefaultAppID is the toast source name used when an account doesn't set its own
+const DefaultAppID = "N0tif Email Alert"
+
+// Identity describes where an account's notifications appear to come from
+type Identity struct {
+	AppID string // shown as the notification source and used to group toasts
+	Icon  string // absolute path to an image shown next to the toast text
+}
+
+// Style is how a notification is shown; the zero value shows it the usual way
+type Style struct {
+	Duration      string // "short" (about 7 seconds) or "long" (about 25); empty for the default
+	Scenario      string // "default", "reminder", "alarm" or "incomingCall"; the last three stay until dismissed
+	SuppressPopup bool   // put the notification in the Action Center without showing it
+	Hero          string // absolute path to a banner image shown across the top; empty for none
+}
+
+// Toast sounds
+const (
+	soundDefault = "ms-winsoundevent:Notification.Default"
+	soundMail    = "ms-winsoundevent:Notification.Mail"
+)
+
+// toast is the XML Windows renders a notification from
+type toast struct {
+	XMLName        xml.Name      `xml:"toast"`
+	ActivationType string        `xml:"activationType,attr"`
+	Launch         string        `xml:"launch,attr,omitempty"`
+	Duration       string        `xml:"duration,attr,omitempty"`
+	Scenario       string        `xml:"scenario,attr,omitempty"`
+	Binding        toastBinding  `xml:"visual>binding"`
+	Audio          toastAudio    `xml:"audio"`
+	Actions        *toastActions `xml:"actions"`
+
+	// Set on the notification object, not in the XML
+	suppressPopup bool
+	tag           string            // with toastGroup, identifies a toast to update or remove
+	data          map[string]string // values of the {bindings} in the XML, which updates replace
+}
+
+type toastBinding struct {
+	Template string         `xml:"template,attr"`
+	Images   []toastImage   `xml:"image"`
+	Text     []string       `xml:"text"`
+	Progress *toastProgress `xml:"progress,omitempty"`
+}
+
+type toastProgress struct {
+	Value       string `xml:"value,attr"`
+	ValueString string `xml:"valueStringOverride,attr,omitempty"`
+	Status      string `xml:"status,attr"`
+}
+
+type toastImage struct {
+	Placement string `xml:"placement,attr"`
+	Src       string `xml:"src,attr"`
+}
+
+type toastAudio struct {
+	Src    string `xml:"src,attr,omitempty"`
+	Loop   bool   `xml:"loop,attr,omitempty"`
+	Silent bool   `xml:"silent,attr,omitempty"`
+}
+
+type toastActions struct {
+	Action []toastAction `xml:"action"`
+}
+
+type toastAction struct {
+	ActivationType string `xml:"activationType,attr"`
+	Content        string `xml:"content,attr"`
+	Arguments      string `xml:"arguments,attr"`
+}
+
+// Option adjusts a single notification
+type Option func(*toast)
+
+// WithLaunch makes a click on the notification or its button open url instead
+// of the mail client, e.g. to learn which notifications get clicked
+func WithLaunch(url string) Option {
+	return func(t *toast) {
+		t.Launch = url
+		if t.Actions != nil {
+			for i := range t.Actions.Action {
+				t.Actions.Action[i].Arguments = url
+			}
+		}
+	}
+}
+
+// WithAction makes a click on the notification open url and replaces its button
+// by one labelled content that does the same, e.g. to fix what it reports
+func WithAction(content, url string) Option {
+	return func(t *toast) {
+		t.Launch = url
+		t.Actions = &toastActions{Action: []toastAction{
+			{ActivationType: "protocol", Content: content, Arguments: url},
+		}}
+	}
+}
+
+// WithTag identifies the notification by tag: showing another one with the same
+// tag replaces it, and RemoveTagged takes it away
+func WithTag(tag string) Option {
+	return func(t *toast) {
+		t.tag = tag
+	}
+}
+
+// RemoveTagged takes the notification shown with WithTag(tag) off the screen
+// and out of the Action Center
+func RemoveTagged(id Identity, tag string) error {
+	appID := id.AppID
+	if appID == "" {
+		appID = DefaultAppID
+	}
+	return removeToast(appID, tag)
+}
+
+// WithBody adds text as a third line below the message, e.g. the beginning of an email
+func WithBody(text string) Option {
+	return func(t *toast) {
+		if text != "" {
+			t.Binding.Text = append(t.Binding.Text, text)
+		}
+	}
+}
+
+// WithStyle shows the notification in style, overriding the duration a high
+// priority notification gets
+func WithStyle(s Style) Option {
+	return func(t *toast) {
+		if s.Duration != "" {
+			t.Duration = s.Duration
+		}
+		if s.Scenario != "" {
+			t.Scenario = s.Scenario
+		}
+		t.suppressPopup = s.SuppressPopup
+		if s.Hero != "" {
+			t.Binding.Images = append(t.Binding.Images, toastImage{Placement: "hero", Src: s.Hero})
+		}
+	}
+}
+
 // SendWindowsNotification sends a high priority Windows toast notification
-func SendWindowsNotification(title, message string, isHighPriority bool) error {
-	notification := toast.Notification{
-		AppID:   "N0tif Email Alert",
-		Title:   title,
-		Message: message,
-		Actions: []toast.Action{
-			{Type: "protocol", Label: "Open Email Client", Arguments: "mailto:"},
-		},
+func SendWindowsNotification(id Identity, title, message string, isHighPriority bool, opts ...Option) error {
+	appID := id.AppID
+	if appID == "" {
+		appID = DefaultAppID
+	}
+
+	t := toast{
+		ActivationType: "protocol",
+		Duration:       "short",
+		Binding:        toastBinding{Template: "ToastGeneric"},
+		Audio:          toastAudio{Src: soundDefault},
+		Actions: &toastActions{Action: []toastAction{
+			{ActivationType: "protocol", Content: "Open Email Client", Arguments: "mailto:"},
+		}},
+	}
+	if id.Icon != "" {
+		t.Binding.Images = append(t.Binding.Images, toastImage{Placement: "appLogoOverride", Src: id.Icon})
+	}
+	for _, text := range []string{title, message} {
+		if text != "" {
+			t.Binding.Text = append(t.Binding.Text, text)
+		}
 	}
 
 	// Set high priority options if requested
 	if isHighPriority {
-		notification.ActivationType = "protocol"
-		notification.Duration = "long"
-		notification.Audio = toast.Mail
-		notification.Loop = false
+		t.Duration = "long"
+		t.Audio.Src = soundMail
+	}
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t.show(appID)
+}
+
+// toastText is the first line of t, its title, and the others joined as the body,
+// for notification systems that only take those two
+func toastText(t *toast) (string, string) {
+	if len(t.Binding.Text) == 0 {
+		return "", ""
 	}
+	return t.Binding.Text[0], strings.Join(t.Binding.Text[1:], "\n")
+}
+
+// scriptPreamble loads the notification API into a PowerShell script
+const scriptPreamble = "[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null\n" +
+	"[Windows.UI.Notifications.ToastNotification, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null\n"
+
+// toastGroup groups the toasts n0tif updates or removes by tag
+const toastGroup = "n0tif"
+
+// writeNotificationData adds a script line building $data, which sets the
+// {bindings} of a toast to values, seq telling Windows the newest update
+func writeNotificationData(script *strings.Builder, values map[string]string, seq uint32) {
+	script.WriteString("$data = New-Object Windows.UI.Notifications.NotificationData\n")
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(script, "$data.Values[%s] = %s\n", psQuote(k), psQuote(values[k]))
+	}
+	fmt.Fprintf(script, "$data.SequenceNumber = %d\n", seq)
+}
 
-	return notification.Push()
+// psQuote makes s a single-quoted PowerShell string, in which nothing is expanded
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
 }
@@ -0,0 +1,33 @@
+// Package power tells whether the machine runs on battery, so checks can be
+// made less often when the battery is what they cost
+package power
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported is returned by Read where the power state can't be read
+var ErrUnsupported = errors.New("the power state can't be read on this platform")
+
+// State is the power supply of the machine
+type State struct {
+	OnBattery bool // not plugged in
+	Percent   int  // charge left, 0 to 100; -1 if unknown or there is no battery
+	Saver     bool // the battery or power saver is on
+}
+
+// String describes the state for status output and logs, e.g. "on battery, 45%"
+func (s State) String() string {
+	if !s.OnBattery {
+		return "plugged in"
+	}
+	desc := "on battery"
+	if s.Percent >= 0 {
+		desc += fmt.Sprintf(", %d%%", s.Percent)
+	}
+	if s.Saver {
+		desc += ", saver on"
+	}
+	return desc
+}
@@ -0,0 +1,51 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// supplyDir holds a directory per power supply, each describing itself in small files
+const supplyDir = "/sys/class/power_supply"
+
+// Read returns the current power state. The machine counts as on battery when
+// it has a battery and no power supply of another kind is online; Linux has no
+// battery saver flag of its own.
+func Read() (State, error) {
+	supplies, err := os.ReadDir(supplyDir)
+	if err != nil {
+		return State{}, err
+	}
+	state := State{Percent: -1}
+	hasBattery, plugged := false, false
+	for _, s := range supplies {
+		dir := filepath.Join(supplyDir, s.Name())
+		switch readValue(dir, "type") {
+		case "Battery":
+			if readValue(dir, "scope") == "Device" {
+				continue // the battery of a mouse or headset
+			}
+			hasBattery = true
+			if p, err := strconv.Atoi(readValue(dir, "capacity")); err == nil && state.Percent < 0 {
+				state.Percent = p
+			}
+		default:
+			if readValue(dir, "online") == "1" {
+				plugged = true
+			}
+		}
+	}
+	state.OnBattery = hasBattery && !plugged
+	return state, nil
+}
+
+// readValue returns the trimmed content of the file name of dir, or "" if it can't be read
+func readValue(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,8 @@
+//go:build !windows && !linux
+
+package power
+
+// Read returns ErrUnsupported
+func Read() (State, error) {
+	return State{}, ErrUnsupported
+}
@@ -0,0 +1,35 @@
+package power
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32              = windows.NewLazySystemDLL("kernel32.dll")
+	procGetSystemPowerStatus = modkernel32.NewProc("GetSystemPowerStatus")
+)
+
+// systemPowerStatus mirrors the Win32 SYSTEM_POWER_STATUS structure
+type systemPowerStatus struct {
+	acLineStatus        byte // 0 offline, 1 online, 255 unknown
+	batteryFlag         byte // 128 means no system battery
+	batteryLifePercent  byte // 255 if unknown
+	systemStatusFlag    byte // 1 while battery saver is on
+	batteryLifeTime     uint32
+	batteryFullLifeTime uint32
+}
+
+// Read returns the current power state
+func Read() (State, error) {
+	var s systemPowerStatus
+	if r, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s))); r == 0 {
+		return State{}, err
+	}
+	state := State{OnBattery: s.acLineStatus == 0, Percent: -1, Saver: s.systemStatusFlag == 1}
+	if s.batteryFlag&128 == 0 && s.batteryLifePercent <= 100 {
+		state.Percent = int(s.batteryLifePercent)
+	}
+	return state, nil
+}
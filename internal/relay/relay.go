@@ -0,0 +1,322 @@
+// Package relay forwards the notifications of one n0tif instance, the hub, to
+// instances on other machines, so only the hub has to hold mail credentials.
+//
+// Connections use TLS 1.3 with a certificate the hub generates for itself. Rather
+// than a certificate authority, a key shared by the hub and its clients decides
+// who is who: each side proves it holds the key with an HMAC over keying material
+// exported from the TLS session. A machine in the middle has a session of its own
+// with each side, so it can neither pass as the hub nor replay a client's proof.
+package relay
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+// DefaultPort is the port the hub listens on when the address doesn't name one
+const DefaultPort = "7674"
+
+const (
+	exporterLabel    = "EXPORTER-n0tif-relay"
+	serverProofLabel = "n0tif relay hub"
+	clientProofLabel = "n0tif relay client"
+
+	handshakeTimeout = 15 * time.Second
+	pingInterval     = 30 * time.Second
+	// readTimeout is how long a client waits for a line before it takes the hub for gone
+	readTimeout = 3 * pingInterval
+	// queueSize is how many notifications a client may fall behind before it is dropped
+	queueSize = 64
+)
+
+// ErrRejected is returned by Follow when the hub closes the connection instead of
+// proving it holds the key, which it does when the client's key is wrong
+var ErrRejected = errors.New("the hub rejected the connection; check that both machines have the same relay key")
+
+// Notification is a notification shown by the hub
+type Notification struct {
+	Account string    `json:"account"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Sent    time.Time `json:"sent"`
+}
+
+// frame is one line the hub sends; a frame without a notification is a ping
+type frame struct {
+	Notification *Notification `json:"notification,omitempty"`
+}
+
+// Server is the hub's end of the relay
+type Server struct {
+	ln  net.Listener
+	key string
+	log *logging.Logger
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+}
+
+// client is a machine connected to the hub
+type client struct {
+	conn  net.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// Listen starts relaying to the clients that connect to address and hold key,
+// presenting cert to them
+func Listen(address, key string, cert tls.Certificate) (*Server, error) {
+	ln, err := tls.Listen("tcp", address, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		key:     key,
+		log:     logging.For("relay"),
+		clients: make(map[*client]struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the hub listens on
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Clients returns how many clients are connected
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Publish sends n to every connected client. It doesn't wait for them; a client
+// too far behind to take it is disconnected and catches up by reconnecting.
+func (s *Server) Publish(n Notification) {
+	line, err := json.Marshal(frame{Notification: &n})
+	if err != nil {
+		s.log.Errorf("Failed to encode notification: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c.queue <- line:
+		default:
+			s.log.Warnf("Disconnecting %s, which stopped reading notifications.", c.conn.RemoteAddr())
+			c.close()
+		}
+	}
+}
+
+// Close stops listening and disconnects every client
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.clients {
+		c.close()
+	}
+	s.mu.Unlock()
+	return s.ln.Close()
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if !closed {
+				s.log.Errorf("Relay stopped accepting connections: %v", err)
+			}
+			return
+		}
+		go s.serve(conn.(*tls.Conn))
+	}
+}
+
+// serve authenticates conn and then sends it notifications and pings until it goes away
+func (s *Server) serve(conn *tls.Conn) {
+	remote := conn.RemoteAddr()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.log.Debugf("TLS handshake with %s failed: %v", remote, err)
+		conn.Close()
+		return
+	}
+	r := bufio.NewReader(conn)
+	clientProof, err := r.ReadString('\n')
+	if err != nil {
+		s.log.Debugf("No proof of the key from %s: %v", remote, err)
+		conn.Close()
+		return
+	}
+	if !checkProof(conn, s.key, clientProofLabel, clientProof) {
+		s.log.Warnf("Rejected %s, which doesn't hold the relay key.", remote)
+		conn.Close()
+		return
+	}
+	if _, err := fmt.Fprintln(conn, proof(conn, s.key, serverProofLabel)); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &client{conn: conn, queue: make(chan []byte, queueSize), done: make(chan struct{})}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	s.log.Infof("Relaying notifications to %s.", remote)
+
+	// Clients send nothing after their proof, so a read ending means they hung up
+	go func() {
+		r.Discard(r.Buffered())
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				c.close()
+				return
+			}
+		}
+	}()
+
+	ping, _ := json.Marshal(frame{})
+	ping = append(ping, '\n')
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		var line []byte
+		select {
+		case line = <-c.queue:
+		case <-ticker.C:
+			line = ping
+		case <-c.done:
+		}
+		if line == nil {
+			break
+		}
+		conn.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+		if _, err := conn.Write(line); err != nil {
+			c.close()
+			break
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+	s.log.Infof("%s disconnected from the relay.", remote)
+}
+
+// Follow connects to the hub at address, proving it holds key, and calls handle
+// with each notification the hub relays. It returns when the connection ends,
+// always with an error, or when ctx is done.
+func Follow(ctx context.Context, address, key string, handle func(Notification)) error {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: handshakeTimeout},
+		// The hub's certificate is its own; the proofs below are what authenticate it
+		Config: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13},
+	}
+	nc, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	conn := nc.(*tls.Conn)
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if _, err := fmt.Fprintln(conn, proof(conn, key, clientProofLabel)); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	hubProof, err := r.ReadString('\n')
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrRejected
+	}
+	if !checkProof(conn, key, serverProofLabel, hubProof) {
+		return fmt.Errorf("%s doesn't hold the relay key; it is not your hub", address)
+	}
+	logging.For("relay").Infof("Connected to the hub at %s.", address)
+
+	for {
+		conn.SetDeadline(time.Now().Add(readTimeout))
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var f frame
+		if err := json.Unmarshal(line, &f); err != nil {
+			return fmt.Errorf("unreadable line from the hub: %w", err)
+		}
+		if f.Notification != nil {
+			handle(*f.Notification)
+		}
+	}
+}
+
+// proof is the hex HMAC of label and the keying material of conn's session under key
+func proof(conn *tls.Conn, key, label string) string {
+	state := conn.ConnectionState()
+	material, err := state.ExportKeyingMaterial(exporterLabel, nil, 32)
+	if err != nil {
+		// Only possible before the handshake completed; no proof will match
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(label))
+	mac.Write(material)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkProof reports whether line, as read from conn, is the proof for label
+func checkProof(conn *tls.Conn, key, label, line string) bool {
+	want := proof(conn, key, label)
+	got := line
+	if n := len(got); n > 0 && got[n-1] == '\n' {
+		got = got[:n-1]
+	}
+	return want != "" && hmac.Equal([]byte(got), []byte(want))
+}
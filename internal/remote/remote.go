@@ -0,0 +1,106 @@
+// Package remote keeps centrally managed settings up to date for fleet deployments.
+// The settings are published as a signed document at an https URL; each verified
+// copy is cached locally so managed settings also apply while offline.
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+// maxDocumentSize bounds the downloaded document; settings are a few hundred bytes
+const maxDocumentSize = 1 << 20
+
+// Fetch downloads the signed settings document and verifies it
+func Fetch(client *http.Client, r config.RemoteConfig) ([]byte, *config.Settings, error) {
+	resp, err := client.Get(r.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch remote settings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetch remote settings: unexpected status %s", resp.Status)
+	}
+	document, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch remote settings: %w", err)
+	}
+
+	settings, err := config.VerifySettings(r, document)
+	if err != nil {
+		return nil, nil, err
+	}
+	return document, settings, nil
+}
+
+// LoadCached returns the settings from the cached document, verified again so a
+// tampered cache is ignored. It returns nil settings when nothing is cached yet.
+func LoadCached(path string, r config.RemoteConfig) (*config.Settings, error) {
+	document, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config.VerifySettings(r, document)
+}
+
+// Watch fetches the remote settings now and then every refresh interval. When a
+// verified document differs from the cached one, it replaces the cache and calls
+// onChange. Failures are logged and the cached settings stay in effect.
+// Call the returned function to stop watching.
+func Watch(r config.RemoteConfig, cachePath string, onChange func()) (stop func()) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(r.Refresh())
+		defer ticker.Stop()
+		for {
+			if changed, err := refresh(client, r, cachePath); err != nil {
+				logging.Warnf("Keeping cached remote settings: %v", err)
+			} else if changed {
+				logging.Infof("Remote settings from %s changed.", r.URL)
+				onChange()
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// refresh downloads the document and updates the cache, reporting whether it changed
+func refresh(client *http.Client, r config.RemoteConfig, cachePath string) (bool, error) {
+	document, _, err := Fetch(client, r)
+	if err != nil {
+		return false, err
+	}
+	cached, err := os.ReadFile(cachePath)
+	if err == nil && bytes.Equal(cached, document) {
+		return false, nil
+	}
+
+	tempFile := cachePath + ".tmp"
+	if err := os.WriteFile(tempFile, document, 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tempFile, cachePath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
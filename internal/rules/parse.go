@@ -0,0 +1,505 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Error is a problem in an expression, at a 1-based character position
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos, e.Msg)
+}
+
+// kind is the static type of a node
+type kind int
+
+const (
+	kindBool kind = iota
+	kindInt
+	kindString
+	kindList
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int"
+	case kindString:
+		return "string"
+	default:
+		return "list"
+	}
+}
+
+// node is a type checked part of an expression. eval returns a bool, int64,
+// string or, for lists, []any whose elements are of kind elem.
+type node struct {
+	kind    kind
+	elem    kind
+	eval    func(*Email) any
+	literal bool // eval does not depend on the email
+}
+
+func constant(k kind, v any) node {
+	return node{kind: k, eval: func(*Email) any { return v }, literal: true}
+}
+
+// token types
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokInt
+	tokPunct
+)
+
+type token struct {
+	typ  int
+	text string // identifier or punctuation; the value of a string literal
+	num  int64
+	pos  int
+}
+
+// lex splits src into tokens
+func lex(src string) ([]token, error) {
+	var toks []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(rs) && (rs[j] == '_' || unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+			toks = append(toks, token{typ: tokIdent, text: string(rs[i:j]), pos: pos})
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			n, err := strconv.ParseInt(string(rs[i:j]), 10, 64)
+			if err != nil {
+				return nil, &Error{Pos: pos, Msg: "number out of range"}
+			}
+			toks = append(toks, token{typ: tokInt, num: n, pos: pos})
+			i = j
+		case r == '"' || r == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+					switch rs[j] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						// \\, \" and \' stand for themselves; so does the backslash
+						// of a regular expression escape such as \d
+						if rs[j] != '\\' && rs[j] != '"' && rs[j] != '\'' {
+							sb.WriteRune('\\')
+						}
+						sb.WriteRune(rs[j])
+					}
+					continue
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, &Error{Pos: pos, Msg: "unterminated string"}
+			}
+			toks = append(toks, token{typ: tokString, text: sb.String(), pos: pos})
+			i = j + 1
+		default:
+			two := ""
+			if i+1 < len(rs) {
+				two = string(rs[i : i+2])
+			}
+			switch two {
+			case "&&", "||", "==", "!=", "<=", ">=":
+				toks = append(toks, token{typ: tokPunct, text: two, pos: pos})
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("()[],.!<>", r) {
+				return nil, &Error{Pos: pos, Msg: fmt.Sprintf("unexpected %q", r)}
+			}
+			toks = append(toks, token{typ: tokPunct, text: string(r), pos: pos})
+			i++
+		}
+	}
+	return append(toks, token{typ: tokEOF, pos: len(rs) + 1}), nil
+}
+
+// parser is a recursive descent parser that type checks as it goes
+type parser struct {
+	toks []token
+	i    int
+}
+
+func newParser(src string) (*parser, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{toks: toks}, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.typ != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the punctuation or keyword s if it comes next
+func (p *parser) accept(s string) bool {
+	t := p.peek()
+	if (t.typ == tokPunct || t.typ == tokIdent) && t.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf(p.peek(), "expected %q", s)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if t.typ == tokEOF {
+		msg += " at the end"
+	}
+	return &Error{Pos: t.pos, Msg: msg}
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.or()
+	if err != nil {
+		return node{}, err
+	}
+	if t := p.peek(); t.typ != tokEOF {
+		return node{}, p.errorf(t, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil {
+		t := p.peek()
+		if !p.accept("||") {
+			break
+		}
+		var right node
+		if right, err = p.and(); err != nil {
+			break
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return node{}, p.errorf(t, "|| needs conditions on both sides, got %s and %s", left.kind, right.kind)
+		}
+		l, r := left.eval, right.eval
+		left = node{kind: kindBool, eval: func(e *Email) any { return l(e).(bool) || r(e).(bool) }}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	for err == nil {
+		t := p.peek()
+		if !p.accept("&&") {
+			break
+		}
+		var right node
+		if right, err = p.unary(); err != nil {
+			break
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return node{}, p.errorf(t, "&& needs conditions on both sides, got %s and %s", left.kind, right.kind)
+		}
+		l, r := left.eval, right.eval
+		left = node{kind: kindBool, eval: func(e *Email) any { return l(e).(bool) && r(e).(bool) }}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if !p.accept("!") {
+		return p.comparison()
+	}
+	x, err := p.unary()
+	if err != nil {
+		return node{}, err
+	}
+	if x.kind != kindBool {
+		return node{}, p.errorf(t, "! needs a condition, got %s", x.kind)
+	}
+	f := x.eval
+	return node{kind: kindBool, eval: func(e *Email) any { return !f(e).(bool) }}, nil
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.postfix()
+	if err != nil {
+		return node{}, err
+	}
+	t := p.peek()
+	var op string
+	for _, o := range []string{"==", "!=", "<", "<=", ">", ">=", "in"} {
+		if p.accept(o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return left, nil
+	}
+	right, err := p.postfix()
+	if err != nil {
+		return node{}, err
+	}
+	l, r := left.eval, right.eval
+
+	switch op {
+	case "in":
+		if right.kind != kindList || right.elem != left.kind {
+			return node{}, p.errorf(t, "in needs a list of %s on the right, got %s", left.kind, describe(right))
+		}
+		return node{kind: kindBool, eval: func(e *Email) any {
+			v := l(e)
+			for _, item := range r(e).([]any) {
+				if item == v {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	case "==", "!=":
+		if left.kind != right.kind || left.kind == kindList {
+			return node{}, p.errorf(t, "cannot compare %s with %s", describe(left), describe(right))
+		}
+		equal := op == "=="
+		return node{kind: kindBool, eval: func(e *Email) any { return (l(e) == r(e)) == equal }}, nil
+	}
+
+	if left.kind != right.kind || (left.kind != kindInt && left.kind != kindString) {
+		return node{}, p.errorf(t, "%s needs two ints or two strings, got %s and %s", op, left.kind, right.kind)
+	}
+	return node{kind: kindBool, eval: func(e *Email) any {
+		c := compare(l(e), r(e))
+		switch op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}}, nil
+}
+
+func describe(n node) string {
+	if n.kind == kindList {
+		return "list of " + n.elem.String()
+	}
+	return n.kind.String()
+}
+
+// compare orders two ints or two strings
+func compare(a, b any) int {
+	if x, ok := a.(int64); ok {
+		y := b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	for err == nil && p.accept(".") {
+		name := p.next()
+		if name.typ != tokIdent {
+			return node{}, p.errorf(name, "expected a method name")
+		}
+		if err = p.expect("("); err != nil {
+			break
+		}
+		var args []node
+		for err == nil && !p.accept(")") {
+			if len(args) > 0 {
+				if err = p.expect(","); err != nil {
+					break
+				}
+			}
+			var arg node
+			if arg, err = p.or(); err == nil {
+				args = append(args, arg)
+			}
+		}
+		if err == nil {
+			x, err = p.method(name, x, args)
+		}
+	}
+	return x, err
+}
+
+// method type checks a call of a string method
+func (p *parser) method(name token, recv node, args []node) (node, error) {
+	if recv.kind != kindString {
+		return node{}, p.errorf(name, "%s has no method %s", describe(recv), name.text)
+	}
+	s := recv.eval
+
+	switch name.text {
+	case "lower", "upper", "size":
+		if len(args) != 0 {
+			return node{}, p.errorf(name, "%s takes no arguments", name.text)
+		}
+		switch name.text {
+		case "lower":
+			return node{kind: kindString, eval: func(e *Email) any { return strings.ToLower(s(e).(string)) }}, nil
+		case "upper":
+			return node{kind: kindString, eval: func(e *Email) any { return strings.ToUpper(s(e).(string)) }}, nil
+		default:
+			return node{kind: kindInt, eval: func(e *Email) any { return int64(len([]rune(s(e).(string)))) }}, nil
+		}
+	case "contains", "startsWith", "endsWith", "matches":
+	default:
+		return node{}, p.errorf(name, "unknown method %s", name.text)
+	}
+
+	if len(args) != 1 || args[0].kind != kindString {
+		return node{}, p.errorf(name, "%s takes one string", name.text)
+	}
+	a := args[0].eval
+	var test func(string, string) bool
+	switch name.text {
+	case "contains":
+		test = strings.Contains
+	case "startsWith":
+		test = strings.HasPrefix
+	case "endsWith":
+		test = strings.HasSuffix
+	case "matches":
+		// The pattern is compiled once, here, so it has to be a literal
+		if !args[0].literal {
+			return node{}, p.errorf(name, "matches takes a literal pattern")
+		}
+		re, err := regexp.Compile(a(nil).(string))
+		if err != nil {
+			return node{}, p.errorf(name, "invalid pattern: %v", err)
+		}
+		return node{kind: kindBool, eval: func(e *Email) any { return re.MatchString(s(e).(string)) }}, nil
+	}
+	return node{kind: kindBool, eval: func(e *Email) any { return test(s(e).(string), a(e).(string)) }}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.typ {
+	case tokString:
+		return constant(kindString, t.text), nil
+	case tokInt:
+		return constant(kindInt, t.num), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return constant(kindBool, true), nil
+		case "false":
+			return constant(kindBool, false), nil
+		}
+		f, ok := fields[t.text]
+		if !ok {
+			return node{}, p.errorf(t, "unknown field %q; fields are %s", t.text, strings.Join(Fields(), ", "))
+		}
+		return f, nil
+	case tokPunct:
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return node{}, err
+			}
+			return x, p.expect(")")
+		case "[":
+			return p.list(t)
+		}
+	}
+	if t.typ == tokEOF {
+		return node{}, p.errorf(t, "expression ends early")
+	}
+	return node{}, p.errorf(t, "unexpected %q", t.text)
+}
+
+// list parses the items of a list literal after its opening bracket
+func (p *parser) list(open token) (node, error) {
+	var items []node
+	for !p.accept("]") {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return node{}, err
+			}
+		}
+		t := p.peek()
+		item, err := p.or()
+		if err != nil {
+			return node{}, err
+		}
+		if item.kind == kindList {
+			return node{}, p.errorf(t, "lists cannot hold lists")
+		}
+		if len(items) > 0 && item.kind != items[0].kind {
+			return node{}, p.errorf(t, "list mixes %s and %s", items[0].kind, item.kind)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return node{}, p.errorf(open, "empty list")
+	}
+	evals := make([]func(*Email) any, len(items))
+	literal := true
+	for i, item := range items {
+		evals[i] = item.eval
+		literal = literal && item.literal
+	}
+	return node{kind: kindList, elem: items[0].kind, literal: literal, eval: func(e *Email) any {
+		vs := make([]any, len(evals))
+		for i, f := range evals {
+			vs[i] = f(e)
+		}
+		return vs
+	}}, nil
+}
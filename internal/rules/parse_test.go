@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var bankAlert = Email{
+	Account: "me@example.com",
+	Mailbox: "INBOX",
+	UID:     42,
+	From:    "alerts@bank.com",
+	Name:    "My Bank",
+	Subject: "Security alert: new sign-in",
+	Date:    time.Date(2024, 1, 1, 9, 30, 0, 0, time.Local), // a Monday
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"example", `from.endsWith("@bank.com") && subject.contains("alert")`, true},
+		{"example other sender", `from.endsWith("@shop.com") && subject.contains("alert")`, false},
+
+		{"and", `true && false`, false},
+		{"or", `false || true`, true},
+		{"not", `!false`, true},
+		{"double not", `!!true`, true},
+		{"not binds tighter than and", `!false && false`, false},
+		{"and binds tighter than or", `true || true && false`, true},
+		{"and binds tighter than or on the left", `false && true || true`, true},
+		{"parentheses", `(true || true) && false`, false},
+		{"comparison binds tighter than and", `uid == 42 && hour < 10`, true},
+		{"not of a comparison", `!(uid == 7)`, true},
+
+		{"equal", `mailbox == "INBOX"`, true},
+		{"not equal", `name != "My Bank"`, false},
+		{"int order", `uid >= 42 && uid < 43`, true},
+		{"string order", `"a" < "b"`, true},
+		{"in", `weekday in ["Saturday", "Sunday"]`, false},
+		{"in ints", `hour in [8, 9, 10]`, true},
+
+		{"contains", `subject.contains("alert")`, true},
+		{"contains is case sensitive", `subject.contains("ALERT")`, false},
+		{"lower", `subject.lower().contains("security")`, true},
+		{"upper", `name.upper() == "MY BANK"`, true},
+		{"starts with", `from.startsWith("alerts@")`, true},
+		{"size", `account.size() == 14`, true},
+		{"contains is not a pattern", `subject.contains("a.*t")`, false},
+		{"matches", `subject.matches("a.*t")`, true},
+		{"matches anchored", `subject.matches("^alert")`, false},
+		{"matches escape", `subject.matches('sign-\w+$')`, true},
+		{"escaped quote", `"say \"hi\"".contains("\"")`, true},
+		{"single quotes", `from == 'alerts@bank.com'`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile(%s): %v", tt.expr, err)
+			}
+			if got := x.Match(bankAlert); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		pos  int
+		msg  string // part of the message
+	}{
+		{"empty", ``, 1, "ends early"},
+		{"unterminated string", `subject.contains("alert`, 18, "unterminated string"},
+		{"dangling and", `subject.contains("alert") &&`, 29, "ends early"},
+		{"dangling or", `|| true`, 1, `unexpected "||"`},
+		{"dangling not", `!`, 2, "ends early"},
+		{"dangling comparison", `uid ==`, 7, "ends early"},
+		{"unknown field", `sender == "x"`, 1, `unknown field "sender"`},
+		{"unknown method", `from.includes("x")`, 6, "unknown method includes"},
+		{"unclosed parenthesis", `(true`, 6, `expected ")"`},
+		{"unclosed call", `from.contains("x"`, 18, `expected ","`},
+		{"unclosed list", `uid in [1, 2`, 13, `expected ","`},
+		{"empty list", `uid in []`, 8, "empty list"},
+		{"mixed list", `uid in [1, "2"]`, 12, "list mixes int and string"},
+		{"trailing token", `true false`, 6, `unexpected "false"`},
+		{"unexpected character", `uid = 1`, 5, `unexpected '='`},
+		{"not a condition", `subject`, 1, "not a condition"},
+		{"and of strings", `from && subject`, 6, "&& needs conditions"},
+		{"compare mixed", `uid == "42"`, 5, "cannot compare int with string"},
+		{"method on int", `uid.contains("4")`, 5, "int has no method contains"},
+		{"pattern not literal", `subject.matches(from)`, 9, "literal pattern"},
+		{"invalid pattern", `subject.matches("(")`, 9, "invalid pattern"},
+		{"number out of range", `uid == 99999999999999999999`, 8, "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			var perr *Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("Compile(%s) = %v, want an *Error", tt.expr, err)
+			}
+			if perr.Pos != tt.pos || !strings.Contains(perr.Msg, tt.msg) {
+				t.Errorf("Compile(%s) = %v, want column %d: ...%s...", tt.expr, err, tt.pos, tt.msg)
+			}
+		})
+	}
+}
+
+// Every prefix of a valid expression is malformed input the parser has to reject
+// without panicking
+func TestCompileTruncated(t *testing.T) {
+	const expr = `!(from.endsWith("@bank.com") || name in ["A", 'B']) && subject.lower().matches("x\\d") && uid >= 1`
+	if _, err := Compile(expr); err != nil {
+		t.Fatalf("Compile(%s): %v", expr, err)
+	}
+	for i := range len(expr) {
+		if x, err := Compile(expr[:i]); err == nil {
+			x.Match(bankAlert)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package rules compiles and evaluates the condition expressions of the rules
+// in the settings file, such as
+//
+//	from.endsWith("@bank.com") && subject.contains("alert")
+//
+// The language is a small, CEL-like subset: string, integer and boolean
+// literals, lists in brackets, the fields of Email, the operators
+// ! && || == != < <= > >= and in, parentheses, and the string methods
+// contains, startsWith, endsWith, matches, lower, upper and size.
+// Expressions are type checked when compiled, so evaluating one cannot fail.
+package rules
+
+import "time"
+
+// Email is what an expression is evaluated against
+type Email struct {
+	Account string
+	Mailbox string
+	UID     uint32
+	From    string // address of the sender, e.g. alerts@bank.com
+	Name    string // display name of the sender, if any
+	Subject string
+	Date    time.Time // arrival on the server
+}
+
+// Expr is a compiled condition
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses and type checks src, which has to be a condition
+func Compile(src string) (*Expr, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != kindBool {
+		return nil, &Error{Pos: 1, Msg: "expression is a " + root.kind.String() + ", not a condition"}
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Match reports whether the condition holds for e
+func (x *Expr) Match(e Email) bool {
+	return x.root.eval(&e).(bool)
+}
+
+// String returns the source of the expression
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Fields lists the names of the fields an expression can use, for help texts
+func Fields() []string {
+	return []string{"account", "mailbox", "uid", "from", "name", "subject", "hour", "weekday"}
+}
+
+// fields maps the names an expression can use to the value in Email
+var fields = map[string]node{
+	"account": {kind: kindString, eval: func(e *Email) any { return e.Account }},
+	"mailbox": {kind: kindString, eval: func(e *Email) any { return e.Mailbox }},
+	"uid":     {kind: kindInt, eval: func(e *Email) any { return int64(e.UID) }},
+	"from":    {kind: kindString, eval: func(e *Email) any { return e.From }},
+	"name":    {kind: kindString, eval: func(e *Email) any { return e.Name }},
+	"subject": {kind: kindString, eval: func(e *Email) any { return e.Subject }},
+	// hour (0-23) and weekday ("Monday") of the arrival, in local time
+	"hour":    {kind: kindInt, eval: func(e *Email) any { return int64(e.Date.Local().Hour()) }},
+	"weekday": {kind: kindString, eval: func(e *Email) any { return e.Date.Local().Weekday().String() }},
+}
@@ -0,0 +1,72 @@
+// Package schema upgrades versioned JSON files written by older n0tif releases.
+//
+// Every file carries a "schema_version" field; files written before versioning
+// was introduced have none and count as version 0. A file is brought up to date
+// by running the migrations between its version and the current one, so format
+// changes upgrade old files in place instead of failing to unmarshal.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// VersionField is the JSON field holding a file's schema version
+const VersionField = "schema_version"
+
+// ErrTooNew is returned for files written by a newer n0tif than this one
+var ErrTooNew = errors.New("file was written by a newer version of n0tif; please upgrade n0tif")
+
+// Migration upgrades a decoded JSON object by exactly one version, in place
+type Migration func(doc map[string]json.RawMessage) error
+
+// Current returns the version a file is at after all migrations have run
+func Current(migrations []Migration) int {
+	return len(migrations)
+}
+
+// Upgrade runs migrations[v:] on data, where v is the version data was written with,
+// and stamps the result with the current version. It also returns v, so callers can
+// tell whether anything changed. Data from a newer release is rejected rather than
+// being silently misread.
+func Upgrade(data []byte, migrations []Migration) ([]byte, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	version := 0
+	if raw, ok := doc[VersionField]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("invalid %s: %w", VersionField, err)
+		}
+	}
+
+	current := Current(migrations)
+	if version > current {
+		return nil, version, fmt.Errorf("schema version %d, supported up to %d: %w", version, current, ErrTooNew)
+	}
+	if version == current {
+		return data, version, nil
+	}
+
+	for v := version; v < current; v++ {
+		if err := migrations[v](doc); err != nil {
+			return nil, version, fmt.Errorf("migrate schema version %d to %d: %w", v, v+1, err)
+		}
+	}
+	doc[VersionField] = json.RawMessage(fmt.Sprint(current))
+
+	upgraded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, version, err
+	}
+	return upgraded, version, nil
+}
+
+// Stamp is the migration that introduces versioning: the layout is unchanged,
+// only the version field is added
+func Stamp(doc map[string]json.RawMessage) error {
+	return nil
+}
@@ -0,0 +1,256 @@
+// Package scripting runs the Lua scripts of the scripts folder on new email.
+// A script defines a global function on_email(email) which gets a table with
+// the fields account, mailbox, uid, from, name, subject and date (RFC 3339) and
+// returns nothing to leave the email alone, or a table with
+//
+//	suppress = true            -- no notification for the email
+//	title = "...", message = "..." -- a notification of its own with this text
+//
+// Scripts can call n0tif.log(message) and
+// n0tif.http(method, url [, body [, headers]]), which returns the status code
+// and body of the response, or nil and an error. The io and os libraries are
+// not available.
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/storage"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// callTimeout bounds one call of on_email, including the HTTP requests it makes
+	callTimeout = 5 * time.Second
+	// httpBodyLimit caps the response body handed back to a script
+	httpBodyLimit = 1 << 20
+)
+
+// Decision is what the scripts made of an email
+type Decision struct {
+	Suppress bool
+	Title    string // with Message, the text of a notification of its own; empty for the usual one
+	Message  string
+}
+
+// Engine holds the loaded scripts
+type Engine struct {
+	scripts []*script
+}
+
+// script is one loaded file. A Lua state is not safe for concurrent use, so calls take mu.
+type script struct {
+	name    string
+	mu      sync.Mutex
+	state   *lua.LState
+	onEmail lua.LValue
+}
+
+// Load loads the *.lua files of dir in name order. A missing folder means no
+// scripts. Scripts that fail to load are left out and returned as an error
+// together; the engine still runs the others.
+func Load(dir string, log *logging.Logger) (*Engine, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	e := &Engine{}
+	var problems []error
+	for _, path := range paths {
+		s, err := loadScript(path, log)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+		e.scripts = append(e.scripts, s)
+	}
+	return e, errors.Join(problems...)
+}
+
+// Check loads the scripts of dir without keeping them, for config check
+func Check(dir string) error {
+	e, err := Load(dir, logging.For("scripts"))
+	if e != nil {
+		e.Close()
+	}
+	return err
+}
+
+func loadScript(path string, log *logging.Logger) (*script, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".lua")
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// The base library can still read files
+	for _, unsafe := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(unsafe, lua.LNil)
+	}
+	L.SetGlobal("n0tif", newModule(L, log.With("script", name)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	err := L.DoFile(path)
+	L.RemoveContext()
+	if err != nil {
+		L.Close()
+		return nil, err
+	}
+
+	onEmail := L.GetGlobal("on_email")
+	if onEmail.Type() != lua.LTFunction {
+		L.Close()
+		return nil, errors.New("no on_email function defined")
+	}
+	return &script{name: name, state: L, onEmail: onEmail}, nil
+}
+
+// newModule builds the n0tif table scripts call into
+func newModule(L *lua.LState, log *logging.Logger) *lua.LTable {
+	client := &http.Client{}
+	return L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"log": func(L *lua.LState) int {
+			log.Infof("%s", L.CheckString(1))
+			return 0
+		},
+		"http": func(L *lua.LState) int {
+			method, url := strings.ToUpper(L.CheckString(1)), L.CheckString(2)
+			body := L.OptString(3, "")
+			headers := L.OptTable(4, nil)
+
+			ctx := L.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			if headers != nil {
+				headers.ForEach(func(k, v lua.LValue) {
+					req.Header.Set(k.String(), v.String())
+				})
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(io.LimitReader(resp.Body, httpBodyLimit))
+			L.Push(lua.LNumber(resp.StatusCode))
+			L.Push(lua.LString(data))
+			return 2
+		},
+	})
+}
+
+// Len returns the number of scripts loaded
+func (e *Engine) Len() int {
+	return len(e.scripts)
+}
+
+// OnEmail runs the scripts for m in order until one of them returns a decision.
+// Scripts failing or running out of time are skipped and reported in the error.
+func (e *Engine) OnEmail(ctx context.Context, m storage.MessageRecord) (Decision, error) {
+	var problems []error
+	for _, s := range e.scripts {
+		d, ok, err := s.call(ctx, m)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("script %s: %w", s.name, err))
+			continue
+		}
+		if ok {
+			return d, errors.Join(problems...)
+		}
+	}
+	return Decision{}, errors.Join(problems...)
+}
+
+func (s *script) call(ctx context.Context, m storage.MessageRecord) (Decision, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		return Decision{}, false, errors.New("unloaded")
+	}
+	L := s.state
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	err := L.CallByParam(lua.P{Fn: s.onEmail, NRet: 1, Protect: true}, emailTable(L, m))
+	if err != nil {
+		return Decision{}, false, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	t, ok := ret.(*lua.LTable)
+	if !ok {
+		return Decision{}, false, nil
+	}
+	d := Decision{Suppress: lua.LVAsBool(t.RawGetString("suppress"))}
+	if v, ok := t.RawGetString("title").(lua.LString); ok {
+		d.Title = string(v)
+	}
+	if v, ok := t.RawGetString("message").(lua.LString); ok {
+		d.Message = string(v)
+	}
+	return d, true, nil
+}
+
+// emailTable is the argument of on_email
+func emailTable(L *lua.LState, m storage.MessageRecord) *lua.LTable {
+	from, name := strings.TrimSpace(m.From), ""
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		from, name = addr.Address, addr.Name
+	}
+	t := L.NewTable()
+	t.RawSetString("account", lua.LString(m.Account))
+	t.RawSetString("mailbox", lua.LString(m.Mailbox))
+	t.RawSetString("uid", lua.LNumber(m.UID))
+	t.RawSetString("from", lua.LString(from))
+	t.RawSetString("name", lua.LString(name))
+	t.RawSetString("subject", lua.LString(m.Subject))
+	t.RawSetString("date", lua.LString(m.Date.Format(time.RFC3339)))
+	return t
+}
+
+// Close releases the scripts, waiting for calls in progress
+func (e *Engine) Close() {
+	for _, s := range e.scripts {
+		s.mu.Lock()
+		s.state.Close()
+		s.state = nil
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const apiTokenFileName = "api_token"
+
+// APIToken returns the token clients present to the HTTP API of the active profile,
+// generating one on first use. With rotate a new token replaces the old one.
+func APIToken(rotate bool) (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(appFolder, apiTokenFileName)
+
+	if !rotate {
+		data, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return strings.TrimSpace(string(data)), nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	tokenBytes := make([]byte, 24)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const auditFileName = "audit.jsonl"
+
+// Audit results
+const (
+	AuditOK     = "ok"
+	AuditFailed = "failed"
+)
+
+// AuditRecord is one action n0tif took on request, e.g. marking a message read
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`           // e.g. "mark-read", "pause"
+	Trigger string    `json:"trigger"`          // what asked for it, e.g. "control", "api"
+	Target  string    `json:"target,omitempty"` // what it acted on, e.g. "INBOX/1234"
+	Result  string    `json:"result"`           // AuditOK or AuditFailed
+	Error   string    `json:"error,omitempty"`
+}
+
+// GetAuditPath returns the path to the audit log of the active profile
+func GetAuditPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, auditFileName), nil
+}
+
+// AppendAudit adds rec to the audit log. The log is append-only: retention
+// and compaction never touch it, so every action stays traceable.
+func AppendAudit(rec AuditRecord) error {
+	path, err := GetAuditPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return withFileLock(path, func() error {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// ReadAudit returns up to limit audit records, newest first, whose action
+// equals action; an empty action matches every record
+func ReadAudit(action string, limit int) ([]AuditRecord, error) {
+	path, err := GetAuditPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec AuditRecord
+		// Skip a torn last line from an interrupted write, as searchHistory does
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		if action != "" && !strings.EqualFold(rec.Action, action) {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The file is in time order; keep the newest limit records, newest first
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
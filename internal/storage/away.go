@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const awayFileName = "away.json"
+
+// Away modes set with "n0tif away"
+const (
+	AwayOn  = "on"  // away, whatever the schedule says
+	AwayOff = "off" // present, whatever the schedule says
+)
+
+// AwayState is away.json: the away mode set by hand and the email that arrived
+// while away, waiting for the next summary. It is kept apart from the settings
+// as "n0tif away" and the monitor both change it.
+type AwayState struct {
+	Mode  string    `json:"mode,omitempty"`  // AwayOn, AwayOff or empty to follow the schedule
+	Until time.Time `json:"until,omitempty"` // when Mode lapses; zero keeps it until changed
+
+	Since      time.Time       `json:"since,omitempty"`      // when the current absence began, as noticed by the monitor
+	Total      int             `json:"total"`                // email arrived since then
+	Pending    []MessageRecord `json:"pending"`              // email not summed up yet, newest first
+	Summarized time.Time       `json:"summarized,omitempty"` // when the last summary went out
+}
+
+// ManualMode returns the away mode set by hand that applies at now, or "" if
+// the schedule decides
+func (s *AwayState) ManualMode(now time.Time) string {
+	if s.Mode == "" || (!s.Until.IsZero() && !now.Before(s.Until)) {
+		return ""
+	}
+	return s.Mode
+}
+
+// GetAwayPath returns the path to the away state of the active profile
+func GetAwayPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, awayFileName), nil
+}
+
+func readAwayFile(path string) (*AwayState, error) {
+	s := &AwayState{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadAway returns the away state; an empty one if there is no file yet
+func LoadAway() (*AwayState, error) {
+	path, err := GetAwayPath()
+	if err != nil {
+		return nil, err
+	}
+	return readAwayFile(path)
+}
+
+// UpdateAway applies change to away.json under its lock, writing it atomically
+func UpdateAway(change func(s *AwayState)) error {
+	path, err := GetAwayPath()
+	if err != nil {
+		return err
+	}
+	return withFileLock(path, func() error {
+		s, err := readAwayFile(path)
+		if err != nil {
+			return err
+		}
+		change(s)
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(func() (string, error) { return path, nil }, data, 0644)
+	})
+}
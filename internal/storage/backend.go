@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+)
+
+// NotificationRecord is a notification that was shown to the user
+type NotificationRecord struct {
+	Account string
+	SentAt  time.Time
+	Title   string
+	Message string
+}
+
+// MessageRecord is the metadata of a message n0tif has seen arrive
+type MessageRecord struct {
+	Account string    `json:"account"`
+	Mailbox string    `json:"mailbox"`
+	UID     uint32    `json:"uid"`
+	From    string    `json:"from"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`    // server arrival (INTERNALDATE)
+	SeenAt  time.Time `json:"seen_at"` // when n0tif first saw it
+}
+
+// Backend persists email tracking state, the metadata of seen messages and,
+// where supported, notification history and statistics
+type Backend interface {
+	Name() string
+	LoadEmailState(account string) (*EmailState, error)
+	SaveEmailState(account string, state *EmailState) error
+	RecordMessages(msgs []MessageRecord) error
+	SearchMessages(query string, limit int) ([]MessageRecord, error)
+	RecordNotification(rec NotificationRecord) error
+	// Usage sums the emails that arrived from the local day of since on
+	Usage(since time.Time) (*UsageStats, error)
+	// Prune drops history beyond the retention limits and returns how many records were removed
+	Prune(policy config.RetentionConfig, now time.Time) (int, error)
+	Close() error
+}
+
+var (
+	backendMu     sync.Mutex
+	activeBackend Backend = jsonBackend{}
+)
+
+// OpenBackend switches storage to the named backend (config.StorageJSON or config.StorageSQLite)
+// for the active profile, closing the previously open one
+func OpenBackend(name string) error {
+	var b Backend
+	switch name {
+	case "", config.StorageJSON:
+		b = jsonBackend{}
+	case config.StorageSQLite:
+		db, err := openSQLiteBackend()
+		if err != nil {
+			return fmt.Errorf("open sqlite storage: %w", err)
+		}
+		b = db
+	default:
+		return fmt.Errorf("unknown storage backend %q", name)
+	}
+
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	old := activeBackend
+	activeBackend = b
+	return old.Close()
+}
+
+// CloseBackend closes the active backend and falls back to the JSON files
+func CloseBackend() error {
+	return OpenBackend(config.StorageJSON)
+}
+
+func currentBackend() Backend {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	return activeBackend
+}
+
+// LoadEmailState loads the email state of an account from the active backend
+func LoadEmailState(account string) (*EmailState, error) {
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	return currentBackend().LoadEmailState(account)
+}
+
+// SaveEmailState saves the email state of an account to the active backend
+func SaveEmailState(account string, state *EmailState) error {
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	return currentBackend().SaveEmailState(account, state)
+}
+
+// RecordMessages adds the metadata of newly seen messages to the arrival history
+func RecordMessages(msgs []MessageRecord) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	return currentBackend().RecordMessages(msgs)
+}
+
+// SearchMessages returns up to limit messages, newest first, whose sender or
+// subject contains query (case-insensitive). An empty query matches everything.
+func SearchMessages(query string, limit int) ([]MessageRecord, error) {
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	return currentBackend().SearchMessages(query, limit)
+}
+
+// RecordNotification adds a shown notification to the history
+func RecordNotification(rec NotificationRecord) error {
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	return currentBackend().RecordNotification(rec)
+}
+
+// Prune applies the retention policy to the active backend and drops the click
+// statistics and data usage older than the usage statistics
+func Prune(policy config.RetentionConfig) (int, error) {
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	now := time.Now()
+	removed, err := currentBackend().Prune(policy, now)
+	if err != nil {
+		return removed, err
+	}
+	days, err := pruneClicks(now)
+	if err != nil {
+		return removed + days, err
+	}
+	trafficDays, err := pruneTraffic(now)
+	return removed + days + trafficDays, err
+}
+
+// jsonBackend is the original storage: one email_state.json per profile, plus an
+// append-only history.jsonl of message metadata. It keeps no notification history.
+type jsonBackend struct{}
+
+func (jsonBackend) Name() string { return config.StorageJSON }
+
+// LoadEmailState ignores the account: the JSON file already belongs to a single profile
+func (jsonBackend) LoadEmailState(account string) (*EmailState, error) {
+	return loadJSONEmailState()
+}
+
+func (jsonBackend) SaveEmailState(account string, state *EmailState) error {
+	return saveJSONEmailState(state)
+}
+
+func (jsonBackend) RecordMessages(msgs []MessageRecord) error {
+	if err := appendHistory(msgs); err != nil {
+		return err
+	}
+	return recordJSONUsage(msgs)
+}
+
+func (jsonBackend) SearchMessages(query string, limit int) ([]MessageRecord, error) {
+	return searchHistory(query, limit)
+}
+
+func (jsonBackend) RecordNotification(rec NotificationRecord) error { return nil }
+
+func (jsonBackend) Usage(since time.Time) (*UsageStats, error) {
+	return jsonUsage(since)
+}
+
+func (jsonBackend) Prune(policy config.RetentionConfig, now time.Time) (int, error) {
+	removed, err := pruneHistory(policy, now)
+	if err != nil {
+		return removed, err
+	}
+	days, err := pruneJSONUsage(now)
+	return removed + days, err
+}
+
+func (jsonBackend) Close() error { return nil }
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// backupManifestName is the first entry of every backup archive
+	backupManifestName = "n0tif-backup.json"
+	backupFormat       = "n0tif-backup"
+	backupVersion      = 1
+)
+
+// backupManifest identifies a backup archive and records where it came from
+type backupManifest struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Profile string    `json:"profile,omitempty"`
+}
+
+// BackupSummary describes a backup archive
+type BackupSummary struct {
+	Created time.Time
+	Profile string
+	Files   []string
+}
+
+// backupFiles lists the data files of the active profile, relative to its folder.
+// Runtime files (locks, logs, temporaries, IPC endpoints) and other profiles are left out.
+func backupFiles(appFolder string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(appFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(appFolder, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if profileName == "" && rel == profilesFolderName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isRuntimeFile(d.Name()) {
+			return nil
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// isRuntimeFile reports whether a file in the profile folder only matters to a running process
+func isRuntimeFile(name string) bool {
+	for _, suffix := range []string{".lock", ".tmp", ".log", "-shm"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return name == "agent.json" || name == "control.json" || name == "control.sock" || name == pidFileName ||
+		strings.HasPrefix(name, logFileName+".") || strings.Contains(name, ".corrupt-")
+}
+
+// CreateBackup writes a zip snapshot of the active profile's data to path.
+// The archive is written through a temporary file, so path is either the old
+// file or the complete new backup. Callers make sure nothing writes the data
+// meanwhile (see Suspend).
+func CreateBackup(dest string) (*BackupSummary, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return nil, err
+	}
+	files, err := backupFiles(appFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	tempFile := dest + ".tmp"
+	f, err := os.OpenFile(tempFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	summary := &BackupSummary{Created: time.Now(), Profile: profileName, Files: files}
+	if err := writeBackupArchive(f, appFolder, summary); err != nil {
+		f.Close()
+		os.Remove(tempFile)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+	if err := os.Rename(tempFile, dest); err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+	return summary, nil
+}
+
+func writeBackupArchive(w io.Writer, appFolder string, summary *BackupSummary) error {
+	zw := zip.NewWriter(w)
+
+	manifest, err := json.MarshalIndent(backupManifest{
+		Format:  backupFormat,
+		Version: backupVersion,
+		Created: summary.Created,
+		Profile: summary.Profile,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	mw, err := zw.Create(backupManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, name := range summary.Files {
+		if err := addFileToZip(zw, filepath.Join(appFolder, filepath.FromSlash(name)), name); err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func addFileToZip(zw *zip.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// RestoreBackup replaces the active profile's data with the contents of a backup
+// archive. Data files that aren't in the backup are removed, so the profile ends
+// up exactly as it was when the backup was taken. Callers make sure nothing
+// uses the data meanwhile (see Suspend).
+func RestoreBackup(src string) (*BackupSummary, error) {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("open backup: %w", err)
+	}
+	defer zr.Close()
+
+	manifest, err := readBackupManifest(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := backupFiles(appFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &BackupSummary{Created: manifest.Created, Profile: manifest.Profile}
+	restored := make(map[string]bool)
+	for _, entry := range zr.File {
+		if entry.Name == backupManifestName || entry.FileInfo().IsDir() {
+			continue
+		}
+		// Refuse entries that would land outside the profile folder
+		clean := path.Clean(entry.Name)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, ":") {
+			return summary, fmt.Errorf("backup contains an invalid path %q", entry.Name)
+		}
+		if err := extractZipEntry(entry, filepath.Join(appFolder, filepath.FromSlash(clean))); err != nil {
+			return summary, fmt.Errorf("restore %s: %w", clean, err)
+		}
+		restored[clean] = true
+		summary.Files = append(summary.Files, clean)
+	}
+
+	for _, name := range existing {
+		if !restored[name] {
+			if err := os.Remove(filepath.Join(appFolder, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+				return summary, fmt.Errorf("remove %s: %w", name, err)
+			}
+		}
+	}
+	return summary, nil
+}
+
+func readBackupManifest(zr *zip.Reader) (*backupManifest, error) {
+	for _, entry := range zr.File {
+		if entry.Name != backupManifestName {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		var m backupManifest
+		if err := json.NewDecoder(rc).Decode(&m); err != nil {
+			return nil, fmt.Errorf("read backup manifest: %w", err)
+		}
+		if m.Format != backupFormat {
+			return nil, errors.New("not an n0tif backup")
+		}
+		if m.Version > backupVersion {
+			return nil, fmt.Errorf("backup format version %d is newer than this n0tif supports (%d)", m.Version, backupVersion)
+		}
+		return &m, nil
+	}
+	return nil, errors.New("not an n0tif backup: manifest missing")
+}
+
+// extractZipEntry writes one archive entry to dest through a temporary file
+func extractZipEntry(entry *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tempFile := dest + ".tmp"
+	f, err := os.OpenFile(tempFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entry.Mode().Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return os.Rename(tempFile, dest)
+}
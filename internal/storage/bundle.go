@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/schema"
+)
+
+const (
+	bundleFormat = "n0tif-export"
+	// bundleVersion 2 reads state through the storage backend and adds the arrival history
+	bundleVersion = 2
+)
+
+// maxExportedMessages bounds the arrival history an export carries
+const maxExportedMessages = 1000000
+
+// bundleEnvelope is the on-disk form of an export file; only the KDF parameters are readable
+type bundleEnvelope struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	KDF        KDFParams `json:"kdf"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// bundlePayload is everything n0tif knows about a profile, in plaintext form
+type bundlePayload struct {
+	Created     time.Time           `json:"created"`
+	Credentials *config.EmailConfig `json:"credentials,omitempty"`
+	State       json.RawMessage     `json:"state,omitempty"`
+	History     []MessageRecord     `json:"history,omitempty"`
+	Settings    json.RawMessage     `json:"settings,omitempty"`
+}
+
+// BundleSummary describes what an export bundle contained
+type BundleSummary struct {
+	Created        time.Time
+	HasCredentials bool
+	HasState       bool
+	Messages       int // arrival history records imported
+	HasSettings    bool
+}
+
+// ExportBundle packs the active profile's credentials, state, arrival history and
+// settings into a single file encrypted with the passphrase, for moving to another
+// machine. State and history are read from the active storage backend. The password
+// is decrypted first, since machine-bound encryption wouldn't survive the move.
+func ExportBundle(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("a passphrase is required")
+	}
+
+	payload := bundlePayload{Created: time.Now()}
+
+	// The JSON backend keeps one state per profile; the others key it by account
+	account := ""
+	if CredentialsExist() {
+		creds, err := LoadCredentials()
+		if err != nil {
+			return nil, fmt.Errorf("load credentials: %w", err)
+		}
+		payload.Credentials = creds
+		account = creds.Username
+	}
+
+	state, err := LoadEmailState(account)
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	if len(state.LastSeenDates) > 0 {
+		if payload.State, err = json.Marshal(state); err != nil {
+			return nil, err
+		}
+	}
+	if payload.History, err = SearchMessages("", maxExportedMessages); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	if payload.Settings, err = readOptionalFile(GetConfigPath); err != nil {
+		return nil, fmt.Errorf("read settings: %w", err)
+	}
+
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := NewKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := sealWithPassphrase(params, passphrase, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(bundleEnvelope{
+		Format:     bundleFormat,
+		Version:    bundleVersion,
+		KDF:        params,
+		Ciphertext: ciphertext,
+	}, "", "  ")
+}
+
+// ImportBundle decrypts an export bundle and writes its contents into the active
+// profile, replacing existing data. Credentials are re-encrypted for this machine,
+// and state and history go into the active storage backend.
+func ImportBundle(data []byte, passphrase string) (*BundleSummary, error) {
+	var env bundleEnvelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Format != bundleFormat {
+		return nil, errors.New("not an n0tif export file")
+	}
+	if env.Version > bundleVersion {
+		return nil, fmt.Errorf("export file version %d is newer than this n0tif supports (%d)", env.Version, bundleVersion)
+	}
+	if err := env.KDF.validate(); err != nil {
+		return nil, fmt.Errorf("parse export file: %w", err)
+	}
+
+	plaintext, err := openWithPassphrase(env.KDF, passphrase, env.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload bundlePayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("parse export contents: %w", err)
+	}
+
+	summary := &BundleSummary{Created: payload.Created}
+	account := ""
+	if payload.Credentials != nil {
+		if err := SaveCredentials(*payload.Credentials); err != nil {
+			return nil, fmt.Errorf("save credentials: %w", err)
+		}
+		summary.HasCredentials = true
+		account = payload.Credentials.Username
+	} else if saved, err := SavedAccount(); err == nil {
+		account = saved.Username
+	}
+	if len(payload.State) > 0 {
+		// Version 1 exports carry email_state.json as it was, possibly of an older schema
+		upgraded, _, err := schema.Upgrade(payload.State, stateMigrations)
+		if err != nil {
+			return nil, fmt.Errorf("read exported state: %w", err)
+		}
+		state := NewEmailState()
+		if err := json.Unmarshal(upgraded, state); err != nil {
+			return nil, fmt.Errorf("read exported state: %w", err)
+		}
+		if state.LastSeenDates == nil {
+			state.LastSeenDates = make(map[string]time.Time)
+		}
+		if err := SaveEmailState(account, state); err != nil {
+			return nil, fmt.Errorf("write state: %w", err)
+		}
+		summary.HasState = true
+	}
+	if len(payload.History) > 0 {
+		n, err := importHistory(payload.History)
+		if err != nil {
+			return nil, fmt.Errorf("write history: %w", err)
+		}
+		summary.Messages = n
+	}
+	if len(payload.Settings) > 0 {
+		if err := writeFileAtomic(GetConfigPath, payload.Settings, 0644); err != nil {
+			return nil, fmt.Errorf("write settings: %w", err)
+		}
+		summary.HasSettings = true
+	}
+	return summary, nil
+}
+
+// importHistory records the messages of msgs the active backend doesn't know yet,
+// so importing twice doesn't duplicate them in the JSON history, and returns how many
+func importHistory(msgs []MessageRecord) (int, error) {
+	type key struct {
+		account, mailbox string
+		uid              uint32
+	}
+	existing, err := SearchMessages("", maxExportedMessages)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[key]bool, len(existing))
+	for _, m := range existing {
+		known[key{m.Account, m.Mailbox, m.UID}] = true
+	}
+	var missing []MessageRecord
+	for _, m := range msgs {
+		if k := (key{m.Account, m.Mailbox, m.UID}); !known[k] {
+			known[k] = true
+			missing = append(missing, m)
+		}
+	}
+	return len(missing), RecordMessages(missing)
+}
+
+// readOptionalFile returns the contents of the file at the resolved path, or nil if it doesn't exist
+func readOptionalFile(pathFn func() (string, error)) ([]byte, error) {
+	path, err := pathFn()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// writeFileAtomic writes data to the resolved path through a temporary file
+func writeFileAtomic(pathFn func() (string, error), data []byte, perm os.FileMode) error {
+	path, err := pathFn()
+	if err != nil {
+		return err
+	}
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, path)
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const clicksFileName = "clicks.json"
+
+// SenderClicks is how many notifications of one sender's email were shown and
+// how many of them were clicked; the rest were dismissed or expired unopened
+type SenderClicks struct {
+	Sender  string `json:"sender"`
+	Shown   int    `json:"shown"`
+	Clicked int    `json:"clicked"`
+}
+
+// clicksFile is clicks.json: per local calendar day, the counts of each sender.
+// It is kept for both backends, as the click is recorded by a process of its own
+// that Windows starts, which shouldn't have to open the database.
+type clicksFile struct {
+	Days map[string]map[string]*SenderClicks `json:"days"`
+}
+
+// GetClicksPath returns the path to the notification click statistics of the active profile
+func GetClicksPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, clicksFileName), nil
+}
+
+func readClicksFile(path string) (*clicksFile, error) {
+	c := &clicksFile{Days: make(map[string]map[string]*SenderClicks)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if c.Days == nil {
+		c.Days = make(map[string]map[string]*SenderClicks)
+	}
+	return c, nil
+}
+
+// updateClicksFile applies change to clicks.json under its lock, writing it atomically
+func updateClicksFile(change func(c *clicksFile)) error {
+	path, err := GetClicksPath()
+	if err != nil {
+		return err
+	}
+	return withFileLock(path, func() error {
+		c, err := readClicksFile(path)
+		if err != nil {
+			return err
+		}
+		change(c)
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		tempFile := path + ".tmp"
+		if err := os.WriteFile(tempFile, data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tempFile, path)
+	})
+}
+
+// countClicks adds shown and clicked to each of senders on the local day of at
+func countClicks(at time.Time, senders []string, shown, clicked int) error {
+	if len(senders) == 0 {
+		return nil
+	}
+	day := at.Local().Format(dayLayout)
+	return updateClicksFile(func(c *clicksFile) {
+		d := c.Days[day]
+		if d == nil {
+			d = make(map[string]*SenderClicks)
+			c.Days[day] = d
+		}
+		for _, sender := range senders {
+			s := d[sender]
+			if s == nil {
+				s = &SenderClicks{Sender: sender}
+				d[sender] = s
+			}
+			s.Shown += shown
+			s.Clicked += clicked
+		}
+	})
+}
+
+// RecordNotificationShown counts a notification of email from senders, as named by SenderName
+func RecordNotificationShown(at time.Time, senders []string) error {
+	return countClicks(at, senders, 1, 0)
+}
+
+// RecordNotificationClicked counts a click on a notification of email from senders.
+// It is counted on the day of the click, which is nearly always that of the notification.
+func RecordNotificationClicked(at time.Time, senders []string) error {
+	return countClicks(at, senders, 0, 1)
+}
+
+// Clicks returns the click statistics since the start of the local day of since,
+// most shown sender first
+func Clicks(since time.Time) ([]SenderClicks, error) {
+	path, err := GetClicksPath()
+	if err != nil {
+		return nil, err
+	}
+	c, err := readClicksFile(path)
+	if err != nil {
+		return nil, err
+	}
+	first := since.Local().Format(dayLayout)
+	totals := make(map[string]*SenderClicks)
+	for day, d := range c.Days {
+		if day < first {
+			continue
+		}
+		for sender, s := range d {
+			t := totals[sender]
+			if t == nil {
+				t = &SenderClicks{Sender: sender}
+				totals[sender] = t
+			}
+			t.Shown += s.Shown
+			t.Clicked += s.Clicked
+		}
+	}
+
+	result := []SenderClicks{}
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Shown != result[j].Shown {
+			return result[i].Shown > result[j].Shown
+		}
+		return result[i].Sender < result[j].Sender
+	})
+	return result, nil
+}
+
+// pruneClicks drops the days of clicks.json older than usageRetention
+func pruneClicks(now time.Time) (int, error) {
+	path, err := GetClicksPath()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	cutoff := now.Add(-usageRetention).Format(dayLayout)
+	removed := 0
+	err = updateClicksFile(func(c *clicksFile) {
+		for day := range c.Days {
+			if day < cutoff {
+				delete(c.Days, day)
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+)
+
+// DefaultCompactionInterval is how often the compaction job prunes history
+const DefaultCompactionInterval = 6 * time.Hour
+
+// Compactor periodically prunes the active backend to its retention policy
+type Compactor struct {
+	mu     sync.Mutex
+	policy config.RetentionConfig
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// StartCompaction prunes history right away and then every interval until Stop is called
+func StartCompaction(policy config.RetentionConfig, interval time.Duration) *Compactor {
+	c := &Compactor{policy: policy, stop: make(chan struct{})}
+	go c.run(interval)
+	return c
+}
+
+// SetPolicy changes the retention policy used from the next run on
+func (c *Compactor) SetPolicy(policy config.RetentionConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+}
+
+// Stop ends the compaction job
+func (c *Compactor) Stop() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+func (c *Compactor) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.compact()
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Compactor) compact() {
+	c.mu.Lock()
+	policy := c.policy
+	c.mu.Unlock()
+
+	removed, err := Prune(policy)
+	if err != nil {
+		logger.Warnf("History compaction failed: %v", err)
+		return
+	}
+	if removed > 0 {
+		logger.Infof("History compaction removed %d record(s) outside the retention policy.", removed)
+	}
+}
@@ -8,55 +8,115 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/schema"
 )
 
 const (
 	credsFileName = "credentials.json"
 )
 
+// Password encryption schemes recorded in the credentials file
+const (
+	// EncryptionMachineKey is the original AES-GCM scheme keyed from hostname and username.
+	// Files written before the scheme was recorded use it implicitly.
+	EncryptionMachineKey = "machine-key"
+	// EncryptionDPAPI uses the Windows Data Protection API, bound to the current Windows user
+	EncryptionDPAPI = "dpapi"
+)
+
+// credentialsMigrations upgrade credentials.json; see package schema
+var credentialsMigrations = []schema.Migration{
+	// 0 -> 1: introduce schema_version and record the implicit machine-key scheme
+	func(doc map[string]json.RawMessage) error {
+		if raw, ok := doc["encryption"]; !ok || string(raw) == `""` {
+			doc["encryption"] = json.RawMessage(`"` + EncryptionMachineKey + `"`)
+		}
+		return nil
+	},
+}
+
 // Credentials stores encrypted email credentials
 type Credentials struct {
+	SchemaVersion int    `json:"schema_version"`
+	Name          string `json:"name,omitempty"`
 	ImapServer    string `json:"imap_server"`
 	ImapPort      int    `json:"imap_port"`
 	Username      string `json:"username"`
 	Password      string `json:"password"` // Encrypted password
 	CheckInterval int    `json:"check_interval"`
+	AppID         string `json:"app_id,omitempty"`
+	Icon          string `json:"icon,omitempty"`
+	Color         string `json:"color,omitempty"`
+	PinSHA256     string `json:"pin_sha256,omitempty"`
+	Encryption    string `json:"encryption,omitempty"` // Password encryption scheme, empty means machine-key
 }
 
 // GetCredentialsPath returns the path to the credentials file
 func GetCredentialsPath() (string, error) {
-	appData, err := os.UserConfigDir()
+	appFolder, err := GetAppFolder()
 	if err != nil {
 		return "", err
 	}
 
-	appFolder := filepath.Join(appData, appFolderName)
-	if err := os.MkdirAll(appFolder, 0755); err != nil {
-		return "", err
-	}
-
 	return filepath.Join(appFolder, credsFileName), nil
 }
 
 // SaveCredentials encrypts and saves the email credentials to disk using an atomic write operation.
+// The password goes to the most secure secret backend available on this machine,
+// unless the existing file is protected by a master password or the TPM, which is kept.
 func SaveCredentials(cfg config.EmailConfig) error {
-	// Encrypt password
-	encryptedPass, err := encryptPassword(cfg.Password)
+	if existing, err := CredentialsEncryption(); err == nil && (existing == EncryptionMasterPassword || existing == EncryptionTPM) {
+		return SaveCredentialsWithBackend(cfg, existing)
+	}
+
+	backend := PreferredSecretBackend()
+	encryptedPass, err := backend.Store(cfg.Username, SecretPassword, cfg.Password)
+	if err != nil && backend.Name() == EncryptionKeyring {
+		// The keyring can refuse writes even when it answered the probe (e.g. a locked collection)
+		logger.Warnf("Failed to store password in keyring, falling back to file encryption: %v", err)
+		backend = fileFallbackBackend()
+		encryptedPass, err = backend.Store(cfg.Username, SecretPassword, cfg.Password)
+	}
 	if err != nil {
 		return err
 	}
+	return writeCredentials(cfg, backend.Name(), encryptedPass)
+}
 
+// SaveCredentialsWithBackend saves the credentials with the password stored by the named secret backend
+func SaveCredentialsWithBackend(cfg config.EmailConfig, backendName string) error {
+	backend, err := GetSecretBackend(backendName)
+	if err != nil {
+		return err
+	}
+	encryptedPass, err := backend.Store(cfg.Username, SecretPassword, cfg.Password)
+	if err != nil {
+		return err
+	}
+	return writeCredentials(cfg, backend.Name(), encryptedPass)
+}
+
+// writeCredentials writes the credentials file with an already encrypted password reference
+func writeCredentials(cfg config.EmailConfig, scheme, encryptedPass string) error {
 	creds := Credentials{
+		SchemaVersion: schema.Current(credentialsMigrations),
+		Name:          cfg.Name,
 		ImapServer:    cfg.ImapServer,
 		ImapPort:      cfg.ImapPort,
 		Username:      cfg.Username,
 		Password:      encryptedPass,
 		CheckInterval: cfg.CheckInterval,
+		AppID:         cfg.Notification.AppID,
+		Icon:          cfg.Notification.Icon,
+		Color:         cfg.Notification.Color,
+		PinSHA256:     cfg.PinSHA256,
+		Encryption:    scheme,
 	}
 
 	// Convert to JSON
@@ -81,8 +141,8 @@ func SaveCredentials(cfg config.EmailConfig) error {
 	return os.Rename(tempFile, path)
 }
 
-// LoadCredentials loads and decrypts the email credentials from disk
-func LoadCredentials() (*config.EmailConfig, error) {
+// readCredentialsFile reads the credentials file without decrypting the password
+func readCredentialsFile() (*Credentials, error) {
 	path, err := GetCredentialsPath()
 	if err != nil {
 		return nil, err
@@ -99,26 +159,85 @@ func LoadCredentials() (*config.EmailConfig, error) {
 		return nil, err
 	}
 
+	// Bring files from older releases up to date
+	upgraded, version, err := schema.Upgrade(data, credentialsMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if version < schema.Current(credentialsMigrations) {
+		if err := writeFileAtomic(GetCredentialsPath, upgraded, 0600); err != nil {
+			logger.Warnf("Failed to upgrade %s in place: %v", path, err)
+		}
+	}
+
 	// Parse JSON
 	var creds Credentials
-	if err := json.Unmarshal(data, &creds); err != nil {
+	if err := json.Unmarshal(upgraded, &creds); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// CredentialsEncryption returns the secret backend protecting the saved password
+func CredentialsEncryption() (string, error) {
+	creds, err := readCredentialsFile()
+	if err != nil {
+		return "", err
+	}
+	return creds.Encryption, nil
+}
+
+// LoadCredentials loads and decrypts the email credentials from disk
+func LoadCredentials() (*config.EmailConfig, error) {
+	creds, err := readCredentialsFile()
+	if err != nil {
 		return nil, err
 	}
 
 	// Decrypt password
-	decryptedPass, err := decryptPassword(creds.Password)
+	scheme := creds.Encryption
+	backend, err := GetSecretBackend(scheme)
 	if err != nil {
 		return nil, err
 	}
+	decryptedPass, err := backend.Load(creds.Username, SecretPassword, creds.Password)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt password (%s): %w", scheme, err)
+	}
+	cfg := creds.emailConfig(decryptedPass)
+
+	// Transparently move passwords kept in the file to a better backend once one is
+	// available, e.g. machine-key to DPAPI or DPAPI to the keyring; deliberate
+	// choices such as a master password are left alone
+	if _, inFile := backend.(fileBackend); inFile {
+		if preferred := PreferredSecretBackend().Name(); scheme != preferred {
+			if err := SaveCredentials(*cfg); err != nil {
+				logger.Warnf("Failed to migrate credentials from %s to %s encryption: %v", scheme, preferred, err)
+			} else if migrated, err := CredentialsEncryption(); err == nil && migrated != scheme {
+				logger.Infof("Migrated saved credentials from %s to %s encryption.", scheme, migrated)
+			}
+		}
+	}
 
-	// Return config
+	return cfg, nil
+}
+
+// emailConfig combines the stored settings with the decrypted password
+func (creds *Credentials) emailConfig(password string) *config.EmailConfig {
 	return &config.EmailConfig{
+		Name:          creds.Name,
 		ImapServer:    creds.ImapServer,
 		ImapPort:      creds.ImapPort,
 		Username:      creds.Username,
-		Password:      decryptedPass,
+		Password:      password,
 		CheckInterval: creds.CheckInterval,
-	}, nil
+		Notification: config.NotificationIdentity{
+			AppID: creds.AppID,
+			Icon:  creds.Icon,
+			Color: creds.Color,
+		},
+		PinSHA256: creds.PinSHA256,
+	}
 }
 
 // CredentialsExist checks if credentials file exists
@@ -131,10 +250,50 @@ func CredentialsExist() bool {
 	return !os.IsNotExist(err)
 }
 
+// SavedAccount returns the saved account settings of the active profile without
+// decrypting the password, which is left empty
+func SavedAccount() (*config.EmailConfig, error) {
+	creds, err := readCredentialsFile()
+	if err != nil {
+		return nil, err
+	}
+	return creds.emailConfig(""), nil
+}
+
+// DeleteCredentials removes the saved credentials of the active profile, including
+// a password kept in the system keyring outside the profile folder
+func DeleteCredentials() error {
+	creds, err := readCredentialsFile()
+	if err != nil {
+		if !CredentialsExist() {
+			return nil
+		}
+		return err
+	}
+	if backend, err := GetSecretBackend(creds.Encryption); err == nil {
+		if err := backend.Delete(creds.Username, SecretPassword); err != nil {
+			return fmt.Errorf("remove password from %s: %w", creds.Encryption, err)
+		}
+	}
+	path, err := GetCredentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // generateEncryptionKey derives an encryption key from the machine-specific information
 func generateEncryptionKey() []byte {
 	// Use machine-specific values to create a stable key
 	hostname, _ := os.Hostname()
+	return machineKeyFor(hostname)
+}
+
+// machineKeyFor derives the machine-key scheme's key as it would be on a machine with the given hostname
+func machineKeyFor(hostname string) []byte {
 	username := os.Getenv("USERNAME") // Windows username
 
 	// Create a hash using these values
@@ -175,7 +334,11 @@ func encryptPassword(password string) (string, error) {
 
 // decryptPassword decrypts the password using machine-specific decryption
 func decryptPassword(encryptedPassword string) (string, error) {
-	key := generateEncryptionKey()
+	return decryptPasswordWithKey(encryptedPassword, generateEncryptionKey())
+}
+
+// decryptPasswordWithKey decrypts a machine-key password with an explicit key
+func decryptPasswordWithKey(encryptedPassword string, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package storage
+
+import "errors"
+
+const dpapiAvailable = false
+
+var errDPAPIUnavailable = errors.New("DPAPI is only available on Windows")
+
+func dpapiProtect(plaintext []byte) ([]byte, error) {
+	return nil, errDPAPIUnavailable
+}
+
+func dpapiUnprotect(ciphertext []byte) ([]byte, error) {
+	return nil, errDPAPIUnavailable
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapiEntropy keeps our blobs apart from other DPAPI data of the same user. It
+// is not a security boundary: it is no secret, and any program running as that
+// user can pass it to CryptUnprotectData too.
+var dpapiEntropy = []byte("n0tif-credentials")
+
+func newDataBlob(b []byte) *windows.DataBlob {
+	if len(b) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(b)), Data: &b[0]}
+}
+
+// blobBytes copies the data DPAPI allocated for b and frees it
+func blobBytes(b windows.DataBlob) []byte {
+	if b.Data == nil {
+		return nil
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(b.Data)))
+	out := make([]byte, b.Size)
+	copy(out, unsafe.Slice(b.Data, b.Size))
+	return out
+}
+
+const dpapiAvailable = true
+
+// dpapiProtect encrypts data with the current Windows user's DPAPI key. UI is
+// forbidden so it fails instead of prompting in daemon and service processes
+// without a desktop.
+func dpapiProtect(plaintext []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptProtectData(newDataBlob(plaintext), nil, newDataBlob(dpapiEntropy), 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, fmt.Errorf("CryptProtectData: %w", err)
+	}
+	return blobBytes(out), nil
+}
+
+// dpapiUnprotect decrypts data encrypted by dpapiProtect for the same Windows user
+func dpapiUnprotect(ciphertext []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(newDataBlob(ciphertext), nil, newDataBlob(dpapiEntropy), 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, fmt.Errorf("CryptUnprotectData: %w", err)
+	}
+	return blobBytes(out), nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const followUpsFileName = "followups.json"
+
+// FollowUp is sent email waiting for a reply
+type FollowUp struct {
+	MessageID string    `json:"message_id"`
+	To        string    `json:"to"` // the watched recipient
+	Subject   string    `json:"subject"`
+	Sent      time.Time `json:"sent"`
+	Due       time.Time `json:"due"` // when the missing reply is notified of
+}
+
+// FollowUps is how far the Sent folder has been read and the email waiting for replies
+type FollowUps struct {
+	Scanned time.Time  `json:"scanned"` // date of the newest sent email seen
+	Pending []FollowUp `json:"pending"`
+}
+
+// GetFollowUpsPath returns the path to the follow-up state of the active profile
+func GetFollowUpsPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, followUpsFileName), nil
+}
+
+// LoadFollowUps returns the follow-up state; an empty one if there is no file yet
+func LoadFollowUps() (*FollowUps, error) {
+	path, err := GetFollowUpsPath()
+	if err != nil {
+		return nil, err
+	}
+	f := &FollowUps{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SaveFollowUps replaces the follow-up state
+func SaveFollowUps(f *FollowUps) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(GetFollowUpsPath, data, 0644)
+}
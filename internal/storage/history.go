@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+)
+
+const historyFileName = "history.jsonl"
+
+// GetHistoryPath returns the path to the message history file of the active profile
+func GetHistoryPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appFolder, historyFileName), nil
+}
+
+// appendHistory adds one JSON line per message to the history file.
+// It holds the history lock so a concurrent prune can't drop the new lines.
+func appendHistory(msgs []MessageRecord) error {
+	path, err := GetHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	return withFileLock(path, func() error {
+		return appendHistoryLines(path, msgs)
+	})
+}
+
+func appendHistoryLines(path string, msgs []MessageRecord) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// searchHistory scans the history file for messages whose sender or subject contains query
+func searchHistory(query string, limit int) ([]MessageRecord, error) {
+	path, err := GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	query = strings.ToLower(query)
+	var matches []MessageRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var m MessageRecord
+		// Skip a torn last line from an interrupted write rather than failing the search
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			continue
+		}
+		if strings.Contains(strings.ToLower(m.From), query) || strings.Contains(strings.ToLower(m.Subject), query) {
+			matches = append(matches, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Date.After(matches[j].Date)
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// pruneHistory rewrites the history file without the messages that fall outside the
+// retention policy: those seen more than HistoryDays ago, and all but the newest
+// MessagesPerMailbox of each mailbox
+func pruneHistory(policy config.RetentionConfig, now time.Time) (int, error) {
+	if policy.HistoryDays <= 0 && policy.MessagesPerMailbox <= 0 {
+		return 0, nil
+	}
+	path, err := GetHistoryPath()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	err = withFileLock(path, func() error {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msgs []MessageRecord
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var m MessageRecord
+			// Torn lines from interrupted writes are dropped as well
+			if err := json.Unmarshal(line, &m); err != nil {
+				removed++
+				continue
+			}
+			msgs = append(msgs, m)
+		}
+
+		kept := retainMessages(msgs, policy, now)
+		removed += len(msgs) - len(kept)
+		if removed == 0 {
+			return nil
+		}
+
+		tempFile := path + ".tmp"
+		os.Remove(tempFile)
+		if len(kept) > 0 {
+			if err := appendHistoryLines(tempFile, kept); err != nil {
+				return err
+			}
+		} else if err := os.WriteFile(tempFile, nil, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tempFile, path)
+	})
+	return removed, err
+}
+
+// retainMessages returns the messages the policy keeps, in their original order
+func retainMessages(msgs []MessageRecord, policy config.RetentionConfig, now time.Time) []MessageRecord {
+	var cutoff time.Time
+	if policy.HistoryDays > 0 {
+		cutoff = now.AddDate(0, 0, -policy.HistoryDays)
+	}
+
+	// Rank each mailbox's messages newest first to apply the per-mailbox cap
+	keep := make([]bool, len(msgs))
+	byMailbox := make(map[[2]string][]int)
+	for i, m := range msgs {
+		if !cutoff.IsZero() && m.SeenAt.Before(cutoff) {
+			continue
+		}
+		keep[i] = true
+		key := [2]string{m.Account, m.Mailbox}
+		byMailbox[key] = append(byMailbox[key], i)
+	}
+	if policy.MessagesPerMailbox > 0 {
+		for _, idx := range byMailbox {
+			if len(idx) <= policy.MessagesPerMailbox {
+				continue
+			}
+			sort.Slice(idx, func(a, b int) bool {
+				return msgs[idx[a]].Date.After(msgs[idx[b]].Date)
+			})
+			for _, i := range idx[policy.MessagesPerMailbox:] {
+				keep[i] = false
+			}
+		}
+	}
+
+	var kept []MessageRecord
+	for i, m := range msgs {
+		if keep[i] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
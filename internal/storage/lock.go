@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockTimeout bounds how long we wait for another n0tif process to release a lock
+const lockTimeout = 10 * time.Second
+
+// withFileLock runs fn while holding an exclusive cross-process lock for path.
+// The lock is taken on a separate path+".lock" file because the data file
+// itself is replaced by rename on every save.
+func withFileLock(path string, fn func() error) error {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("open lock file: %w", err)
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("lock %s: timed out waiting for another n0tif process: %w", path, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
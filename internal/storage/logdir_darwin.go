@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// logRoot returns the folder holding the logs of all profiles: ~/Library/Logs/n0tif,
+// where Console.app finds them
+func logRoot() (string, error) {
+	if portableRoot != "" {
+		return portableRoot, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Logs", appFolderName), nil
+}
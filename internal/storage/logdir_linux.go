@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// logRoot returns the folder holding the logs of all profiles. Following the XDG
+// base directory spec, logs are state rather than configuration: they go to
+// $XDG_STATE_HOME/n0tif, by default ~/.local/state/n0tif.
+func logRoot() (string, error) {
+	if portableRoot != "" {
+		return portableRoot, nil
+	}
+	if state := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(state) {
+		return filepath.Join(state, appFolderName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", appFolderName), nil
+}
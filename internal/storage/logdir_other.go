@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package storage
+
+// logRoot returns the folder holding the logs of all profiles: the data folder
+func logRoot() (string, error) {
+	return rootFolder()
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KDFParams are the Argon2id parameters used to turn a passphrase into a key.
+// They are stored next to the ciphertext so they can be raised later without
+// breaking files written with the old values.
+type KDFParams struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // in KiB
+	Threads uint8  `json:"threads"`
+}
+
+// ErrWrongPassphrase is returned when data can't be decrypted with the given passphrase
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted data")
+
+// NewKDFParams returns the current default Argon2id parameters with a fresh random salt
+func NewKDFParams() (KDFParams, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return KDFParams{}, err
+	}
+	return KDFParams{Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+}
+
+// Upper bounds on the parameters read from a file, well above the defaults, so
+// a crafted or corrupted one can't make the derivation exhaust memory or time
+const (
+	maxKDFTime    = 10
+	maxKDFMemory  = 1024 * 1024 // KiB, i.e. 1 GiB
+	maxKDFThreads = 16
+)
+
+// validate checks that the parameters are usable and within the bounds
+func (p KDFParams) validate() error {
+	switch {
+	case len(p.Salt) == 0 || p.Time == 0 || p.Memory == 0 || p.Threads == 0:
+		return errors.New("invalid key derivation parameters")
+	case p.Time > maxKDFTime:
+		return fmt.Errorf("invalid key derivation parameters: time %d exceeds %d", p.Time, maxKDFTime)
+	case p.Memory > maxKDFMemory:
+		return fmt.Errorf("invalid key derivation parameters: memory %d KiB exceeds %d KiB", p.Memory, maxKDFMemory)
+	case p.Threads > maxKDFThreads:
+		return fmt.Errorf("invalid key derivation parameters: %d threads exceed %d", p.Threads, maxKDFThreads)
+	}
+	return nil
+}
+
+// deriveKey derives a 256-bit key from the passphrase
+func (p KDFParams) deriveKey(passphrase string) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, 32), nil
+}
+
+// sealWithPassphrase encrypts plaintext with AES-256-GCM under a passphrase-derived key.
+// The nonce is prepended to the returned ciphertext.
+func sealWithPassphrase(params KDFParams, passphrase string, plaintext []byte) ([]byte, error) {
+	key, err := params.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aesGCM.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openWithPassphrase decrypts data produced by sealWithPassphrase
+func openWithPassphrase(params KDFParams, passphrase string, ciphertext []byte) ([]byte, error) {
+	key, err := params.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aesGCM.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
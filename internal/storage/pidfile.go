@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const pidFileName = "n0tif.pid"
+
+// ErrNoPIDFile is returned by ReadPIDFile when no monitor has recorded its PID
+var ErrNoPIDFile = errors.New("no PID file")
+
+// GetPIDPath returns the path of the file holding the running monitor's process ID
+func GetPIDPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appFolder, pidFileName), nil
+}
+
+// WritePIDFile records the current process as the running monitor of the profile.
+// The returned function removes the file again, unless another process has taken it over.
+func WritePIDFile() (remove func(), err error) {
+	path, err := GetPIDPath()
+	if err != nil {
+		return nil, err
+	}
+	pid := os.Getpid()
+	if err := os.WriteFile(path, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return nil, err
+	}
+	return func() {
+		if recorded, err := ReadPIDFile(); err == nil && recorded == pid {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// ReadPIDFile returns the process ID recorded by the running monitor of the profile.
+// The process may have died without removing the file; callers check it is still alive.
+func ReadPIDFile() (int, error) {
+	path, err := GetPIDPath()
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, ErrNoPIDFile
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
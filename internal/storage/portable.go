@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	// portableMarkerName next to the executable turns on portable mode without a flag
+	portableMarkerName = "portable.ini"
+	// portableFolderName holds the data of a portable install, next to the executable
+	portableFolderName = "n0tif-data"
+)
+
+// portableRoot replaces the per-user data folder when portable mode is on
+var portableRoot string
+
+// executableDir returns the folder containing the running executable
+func executableDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Dir(exe), nil
+}
+
+// PortableMarkerExists reports whether a portable.ini sits next to the executable
+func PortableMarkerExists() bool {
+	dir, err := executableDir()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(dir, portableMarkerName))
+	return err == nil
+}
+
+// EnablePortable keeps all data (settings, credentials, state and logs) in a
+// folder next to the executable instead of the user's profile, so n0tif can run
+// from a USB stick or where the user profile isn't writable
+func EnablePortable() error {
+	dir, err := executableDir()
+	if err != nil {
+		return err
+	}
+	portableRoot = filepath.Join(dir, portableFolderName)
+	return nil
+}
+
+// Portable reports whether portable mode is on
+func Portable() bool {
+	return portableRoot != ""
+}
+
+// SetDataFolder keeps all data in dir instead of the user's profile, like
+// portable mode does with the folder next to the executable. Programs that
+// embed the checker use it so their state doesn't mix with the n0tif command's.
+func SetDataFolder(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	portableRoot = abs
+	return nil
+}
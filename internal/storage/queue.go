@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const notificationQueueFileName = "notification_queue.json"
+
+// GetNotificationQueuePath returns the path to the email of the active profile
+// found but not notified of yet
+func GetNotificationQueuePath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, notificationQueueFileName), nil
+}
+
+// LoadNotificationQueue returns the email waiting for its notification, newest
+// first; none if there is no file yet
+func LoadNotificationQueue() ([]MessageRecord, error) {
+	path, err := GetNotificationQueuePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var emails []MessageRecord
+	if err := json.Unmarshal(data, &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// SaveNotificationQueue replaces the email waiting for its notification, so it
+// outlives a restart
+func SaveNotificationQueue(emails []MessageRecord) error {
+	if emails == nil {
+		emails = []MessageRecord{}
+	}
+	data, err := json.Marshal(emails)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(GetNotificationQueuePath, data, 0644)
+}
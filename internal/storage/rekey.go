@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// RekeyOptions controls how RekeyCredentials re-encrypts the saved password
+type RekeyOptions struct {
+	// Backend is the secret backend to move the password to; empty means the preferred one
+	Backend string
+	// OldHostname decrypts machine-key credentials written before the machine was renamed
+	OldHostname string
+	// NewMasterPassword replaces the master password when moving to EncryptionMasterPassword
+	NewMasterPassword string
+}
+
+// RekeyResult describes a completed re-encryption
+type RekeyResult struct {
+	From string
+	To   string
+}
+
+// RekeyCredentials decrypts the saved password with the scheme it was written with
+// and encrypts it again with the chosen backend
+func RekeyCredentials(opts RekeyOptions) (*RekeyResult, error) {
+	creds, err := readCredentialsFile()
+	if err != nil {
+		return nil, err
+	}
+	oldBackend, err := GetSecretBackend(creds.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	var password string
+	if opts.OldHostname != "" {
+		if creds.Encryption != EncryptionMachineKey {
+			return nil, fmt.Errorf("an old hostname only applies to %s credentials, these use %s", EncryptionMachineKey, creds.Encryption)
+		}
+		password, err = decryptPasswordWithKey(creds.Password, machineKeyFor(opts.OldHostname))
+	} else {
+		password, err = oldBackend.Load(creds.Username, SecretPassword, creds.Password)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decrypt password (%s): %w", creds.Encryption, err)
+	}
+
+	target := opts.Backend
+	if target == "" {
+		target = PreferredSecretBackend().Name()
+	}
+	if opts.NewMasterPassword != "" {
+		SetMasterPassword(opts.NewMasterPassword)
+	}
+	if err := SaveCredentialsWithBackend(*creds.emailConfig(password), target); err != nil {
+		return nil, fmt.Errorf("encrypt password (%s): %w", target, err)
+	}
+
+	// Leave no copy behind in the old backend once the new one holds the secret
+	if creds.Encryption != target {
+		if err := oldBackend.Delete(creds.Username, SecretPassword); err != nil {
+			logger.Warnf("Failed to remove password from %s: %v", creds.Encryption, err)
+		}
+	}
+	return &RekeyResult{From: creds.Encryption, To: target}, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	relayKeyFileName  = "relay_key"
+	relayCertFileName = "relay_cert.pem"
+)
+
+// ErrNoRelayKey is returned by LoadRelayKey when no relay key has been set
+var ErrNoRelayKey = errors.New("no relay key set")
+
+// GetRelayCertPath returns the path to the certificate the relay hub of the active profile presents
+func GetRelayCertPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, relayCertFileName), nil
+}
+
+func relayKeyPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, relayKeyFileName), nil
+}
+
+// RelayKey returns the key shared by the relay hub and its clients, generating
+// one on first use. With rotate a new key replaces the old one.
+func RelayKey(rotate bool) (string, error) {
+	if !rotate {
+		key, err := LoadRelayKey()
+		if err == nil || !errors.Is(err, ErrNoRelayKey) {
+			return key, err
+		}
+	}
+
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(keyBytes)
+	return key, SetRelayKey(key)
+}
+
+// LoadRelayKey returns the relay key of the active profile, or ErrNoRelayKey
+func LoadRelayKey() (string, error) {
+	path, err := relayKeyPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", ErrNoRelayKey
+	}
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", ErrNoRelayKey
+	}
+	return key, nil
+}
+
+// SetRelayKey saves key, as copied from the hub, as the relay key of the active profile
+func SetRelayKey(key string) error {
+	path, err := relayKeyPath()
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(key+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const remindersFileName = "reminders.json"
+
+// Reminder is an email to notify of again if it is still unread when it is due
+type Reminder struct {
+	Mailbox string    `json:"mailbox"`
+	UID     uint32    `json:"uid"`
+	From    string    `json:"from"`
+	Subject string    `json:"subject"`
+	Due     time.Time `json:"due"`
+}
+
+// GetRemindersPath returns the path to the pending aging reminders of the active profile
+func GetRemindersPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, remindersFileName), nil
+}
+
+// LoadReminders returns the pending reminders; none if there is no file yet
+func LoadReminders() ([]Reminder, error) {
+	path, err := GetRemindersPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reminders []Reminder
+	if err := json.Unmarshal(data, &reminders); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// SaveReminders replaces the pending reminders, so they outlive a restart
+func SaveReminders(reminders []Reminder) error {
+	if reminders == nil {
+		reminders = []Reminder{}
+	}
+	data, err := json.Marshal(reminders)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(GetRemindersPath, data, 0644)
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Secret kinds stored per account
+const (
+	SecretPassword   = "password"
+	SecretOAuthToken = "oauth-token"
+)
+
+// EncryptionKeyring keeps secrets in the platform keyring (Windows Credential Manager,
+// macOS Keychain or the Secret Service) instead of the credentials file
+const EncryptionKeyring = "keyring"
+
+// keyringService is the service name secrets are filed under in the platform keyring
+const keyringService = "n0tif"
+
+// SecretBackend stores account secrets such as passwords and OAuth tokens.
+// Store returns the reference to keep in the credentials file: the ciphertext
+// itself for file-based backends, empty for backends that hold the secret elsewhere.
+type SecretBackend interface {
+	Name() string
+	Available() bool
+	Store(account, kind, secret string) (string, error)
+	Load(account, kind, ref string) (string, error)
+	Delete(account, kind string) error
+}
+
+// secretBackends lists the backends from most to least preferred.
+// The TPM and master password backends are never picked automatically; they are opt-in.
+var secretBackends = []SecretBackend{
+	keyringBackend{},
+	fileBackend{scheme: EncryptionDPAPI, available: dpapiAvailable},
+	fileBackend{scheme: EncryptionMachineKey, available: true},
+	tpmBackend{},
+	masterPasswordBackend{},
+}
+
+// GetSecretBackend returns the backend registered under name
+func GetSecretBackend(name string) (SecretBackend, error) {
+	for _, b := range secretBackends {
+		if b.Name() == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown secret backend %q", name)
+}
+
+// PreferredSecretBackend returns the most secure backend usable on this machine,
+// falling back to file encryption only when no keyring is available
+func PreferredSecretBackend() SecretBackend {
+	for _, b := range secretBackends {
+		if b.Available() {
+			return b
+		}
+	}
+	return secretBackends[len(secretBackends)-1]
+}
+
+// fileFallbackBackend returns the best backend that keeps the secret in the credentials file
+func fileFallbackBackend() SecretBackend {
+	if dpapiAvailable {
+		return fileBackend{scheme: EncryptionDPAPI, available: true}
+	}
+	return fileBackend{scheme: EncryptionMachineKey, available: true}
+}
+
+// keyringBackend stores secrets in the platform keyring
+type keyringBackend struct{}
+
+var (
+	keyringProbeOnce sync.Once
+	keyringUsable    bool
+)
+
+func (keyringBackend) Name() string { return EncryptionKeyring }
+
+// Available probes the keyring once; a lookup that reports "not found" proves it works
+func (keyringBackend) Available() bool {
+	keyringProbeOnce.Do(func() {
+		_, err := keyring.Get(keyringService, "availability-probe")
+		keyringUsable = err == nil || errors.Is(err, keyring.ErrNotFound)
+	})
+	return keyringUsable
+}
+
+func (keyringBackend) Store(account, kind, secret string) (string, error) {
+	if err := keyring.Set(keyringService, keyringUser(account, kind), secret); err != nil {
+		return "", fmt.Errorf("keyring store: %w", err)
+	}
+	return "", nil
+}
+
+func (keyringBackend) Load(account, kind, ref string) (string, error) {
+	user := keyringUser(account, kind)
+	secret, err := keyring.Get(keyringService, user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		secret, err = migrateKeyringSecret(account, kind, user)
+	}
+	if err != nil {
+		return "", fmt.Errorf("keyring load: %w", err)
+	}
+	return secret, nil
+}
+
+func (keyringBackend) Delete(account, kind string) error {
+	user := keyringUser(account, kind)
+	secret, getErr := keyring.Get(keyringService, user)
+	err := keyring.Delete(keyringService, user)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("keyring delete: %w", err)
+	}
+	// The legacy entry this one was migrated from would keep the secret behind
+	legacy := legacyKeyringUser(account, kind)
+	if old, err := keyring.Get(keyringService, legacy); getErr == nil && err == nil && old == secret {
+		if err := keyring.Delete(keyringService, legacy); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("keyring delete: %w", err)
+		}
+	}
+	return nil
+}
+
+// keyringUser names the keyring entry of a secret. The entries of all profiles and
+// data folders share one service, so the name includes the profile and a hash of
+// the data folder; otherwise two profiles with the same account, or a portable and
+// an installed copy, would overwrite each other's secret.
+func keyringUser(account, kind string) string {
+	profile := profileName
+	if profile == "" {
+		profile = "default"
+	}
+	root, err := rootFolder()
+	if err != nil {
+		root = ""
+	}
+	sum := sha256.Sum256([]byte(root))
+	return kind + ":" + account + ":" + profile + ":" + hex.EncodeToString(sum[:4])
+}
+
+// legacyKeyringUser is the entry name used before keyringUser included the
+// profile and data folder
+func legacyKeyringUser(account, kind string) string {
+	return kind + ":" + account
+}
+
+// migrateKeyringSecret copies a secret saved under its legacy entry name to user.
+// The legacy entry is kept for other profiles or copies that shared it; Delete
+// removes it together with an entry that holds the same secret.
+func migrateKeyringSecret(account, kind, user string) (string, error) {
+	secret, err := keyring.Get(keyringService, legacyKeyringUser(account, kind))
+	if err != nil {
+		return "", err
+	}
+	if err := keyring.Set(keyringService, user, secret); err != nil {
+		logger.Warnf("Failed to move the keyring %s of %s to this profile's entry: %v", kind, account, err)
+	}
+	return secret, nil
+}
+
+// fileBackend keeps the encrypted secret inline in the credentials file
+type fileBackend struct {
+	scheme    string
+	available bool
+}
+
+func (b fileBackend) Name() string    { return b.scheme }
+func (b fileBackend) Available() bool { return b.available }
+
+func (b fileBackend) Store(account, kind, secret string) (string, error) {
+	switch b.scheme {
+	case EncryptionDPAPI:
+		ciphertext, err := dpapiProtect([]byte(secret))
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(ciphertext), nil
+	default:
+		return encryptPassword(secret)
+	}
+}
+
+func (b fileBackend) Load(account, kind, ref string) (string, error) {
+	switch b.scheme {
+	case EncryptionDPAPI:
+		ciphertext, err := hex.DecodeString(ref)
+		if err != nil {
+			return "", err
+		}
+		plaintext, err := dpapiUnprotect(ciphertext)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	default:
+		return decryptPassword(ref)
+	}
+}
+
+// Delete is a no-op: the secret lives in the credentials file itself
+func (fileBackend) Delete(account, kind string) error { return nil }
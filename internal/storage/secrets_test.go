@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// useScope selects a profile and data folder for the rest of the test
+func useScope(t *testing.T, dataFolder, profile string) {
+	t.Helper()
+	oldRoot, oldProfile := portableRoot, profileName
+	t.Cleanup(func() { portableRoot, profileName = oldRoot, oldProfile })
+	if err := SetDataFolder(dataFolder); err != nil {
+		t.Fatalf("SetDataFolder: %v", err)
+	}
+	if err := SetProfile(profile); err != nil {
+		t.Fatalf("SetProfile: %v", err)
+	}
+}
+
+func TestKeyringSecretsAreKeptApart(t *testing.T) {
+	installed, portable := t.TempDir(), t.TempDir()
+	scopes := []struct {
+		name       string
+		dataFolder string
+		profile    string
+	}{
+		{"default profile", installed, ""},
+		{"work profile", installed, "work"},
+		{"home profile", installed, "home"},
+		{"portable copy", portable, ""},
+	}
+
+	keyring.MockInit()
+	b := keyringBackend{}
+	for _, s := range scopes {
+		useScope(t, s.dataFolder, s.profile)
+		if _, err := b.Store("me@example.com", SecretPassword, "secret of "+s.name); err != nil {
+			t.Fatalf("%s: Store: %v", s.name, err)
+		}
+	}
+	for _, s := range scopes {
+		useScope(t, s.dataFolder, s.profile)
+		got, err := b.Load("me@example.com", SecretPassword, "")
+		if err != nil {
+			t.Fatalf("%s: Load: %v", s.name, err)
+		}
+		if want := "secret of " + s.name; got != want {
+			t.Errorf("%s: Load = %q, want %q", s.name, got, want)
+		}
+	}
+
+	// Deleting one profile's secret leaves the others alone
+	useScope(t, installed, "work")
+	if err := b.Delete("me@example.com", SecretPassword); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Load("me@example.com", SecretPassword, ""); err == nil {
+		t.Errorf("Load after Delete succeeded, want an error")
+	}
+	useScope(t, installed, "home")
+	if got, err := b.Load("me@example.com", SecretPassword, ""); err != nil || got != "secret of home profile" {
+		t.Errorf("home profile after deleting work: Load = %q, %v", got, err)
+	}
+}
+
+func TestKeyringMigratesLegacyEntries(t *testing.T) {
+	keyring.MockInit()
+	if err := keyring.Set(keyringService, legacyKeyringUser("me@example.com", SecretPassword), "old secret"); err != nil {
+		t.Fatalf("keyring.Set: %v", err)
+	}
+	useScope(t, t.TempDir(), "work")
+
+	b := keyringBackend{}
+	got, err := b.Load("me@example.com", SecretPassword, "")
+	if err != nil || got != "old secret" {
+		t.Fatalf("Load = %q, %v, want the legacy secret", got, err)
+	}
+	migrated, err := keyring.Get(keyringService, keyringUser("me@example.com", SecretPassword))
+	if err != nil || migrated != "old secret" {
+		t.Errorf("profile entry after migration = %q, %v, want the legacy secret", migrated, err)
+	}
+
+	if err := b.Delete("me@example.com", SecretPassword); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := keyring.Get(keyringService, legacyKeyringUser("me@example.com", SecretPassword)); err == nil {
+		t.Errorf("legacy entry still there after Delete")
+	}
+}
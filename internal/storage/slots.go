@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const slotsFolderName = "slots"
+
+// slotRetry is how often a full set of slots is tried again
+const slotRetry = 100 * time.Millisecond
+
+// Slot is one of a limited number of places shared by the n0tif processes of
+// every profile on the machine. It is a lock file held until Release; the
+// operating system frees the slots of a process that ends.
+type Slot struct {
+	f *os.File
+}
+
+// AcquireSlot takes one of the limit slots called name, waiting up to wait for
+// one to be free
+func AcquireSlot(name string, limit int, wait time.Duration) (*Slot, error) {
+	root, err := rootFolder()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, slotsFolderName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		for i := range limit {
+			f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%s-%d.lock", name, i)), os.O_CREATE|os.O_RDWR, 0644)
+			if err != nil {
+				return nil, err
+			}
+			if tryLockFile(f) == nil {
+				return &Slot{f: f}, nil
+			}
+			f.Close()
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("all %d slots of %s are in use", limit, name)
+		}
+		time.Sleep(slotRetry)
+	}
+}
+
+// Release frees the slot; a nil slot is left alone
+func (s *Slot) Release() {
+	if s == nil {
+		return
+	}
+	unlockFile(s.f)
+	s.f.Close()
+}
@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/schema"
+	_ "modernc.org/sqlite" // pure Go driver, so Windows builds need no cgo toolchain
+)
+
+const (
+	dbFileName = "n0tif.db"
+
+	// migratedSuffix is appended to JSON files once their contents live in the database
+	migratedSuffix = ".migrated"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS mailbox_state (
+	account        TEXT NOT NULL,
+	mailbox        TEXT NOT NULL,
+	last_seen_date TEXT NOT NULL,
+	PRIMARY KEY (account, mailbox)
+);
+CREATE TABLE IF NOT EXISTS messages (
+	account TEXT    NOT NULL,
+	mailbox TEXT    NOT NULL,
+	uid     INTEGER NOT NULL,
+	sender  TEXT    NOT NULL DEFAULT '',
+	subject TEXT    NOT NULL DEFAULT '',
+	date    TEXT    NOT NULL DEFAULT '',
+	seen_at TEXT    NOT NULL,
+	PRIMARY KEY (account, mailbox, uid)
+);
+CREATE INDEX IF NOT EXISTS messages_date ON messages (date);
+CREATE TABLE IF NOT EXISTS notification_history (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	account TEXT NOT NULL,
+	sent_at TEXT NOT NULL,
+	title   TEXT NOT NULL,
+	message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS notification_history_sent_at ON notification_history (sent_at);
+CREATE TABLE IF NOT EXISTS daily_stats (
+	day                TEXT    NOT NULL,
+	account            TEXT    NOT NULL,
+	emails_seen        INTEGER NOT NULL DEFAULT 0,
+	notifications_sent INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (day, account)
+);
+`
+
+// sqliteBackend keeps everything in a single n0tif.db per profile
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// GetDatabasePath returns the path to the SQLite database of the active profile
+func GetDatabasePath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, dbFileName), nil
+}
+
+func openSQLiteBackend() (*sqliteBackend, error) {
+	path, err := GetDatabasePath()
+	if err != nil {
+		return nil, err
+	}
+
+	// WAL lets the CLI read history while the daemon writes; busy_timeout covers short lock waits
+	dsn := "file:" + filepath.ToSlash(path) + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteBackend{db: db}, nil
+}
+
+// sqliteMigrations upgrade the database one version at a time; sqliteMigrations[i]
+// takes it from version i to i+1. The version is kept in PRAGMA user_version,
+// which is 0 for new databases and for those created before versioning.
+var sqliteMigrations = []func(tx *sql.Tx) error{
+	// 0 -> 1: the initial schema, folding the UID-only seen_uids table of early databases into messages
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(sqliteSchema); err != nil {
+			return err
+		}
+		var n int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'seen_uids'`).Scan(&n)
+		if err != nil || n == 0 {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO messages (account, mailbox, uid, seen_at)
+			SELECT account, mailbox, uid, seen_at FROM seen_uids`); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DROP TABLE seen_uids`)
+		return err
+	},
+	// 1 -> 2: per-hour, per-sender arrival counts for n0tif stats
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS usage_stats (
+			day     TEXT    NOT NULL,
+			hour    INTEGER NOT NULL,
+			sender  TEXT    NOT NULL,
+			account TEXT    NOT NULL,
+			emails  INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (day, hour, sender, account)
+		)`)
+		return err
+	},
+}
+
+// migrateSQLite brings the database up to the current schema version
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d, supported up to %d: %w", version, len(sqliteMigrations), schema.ErrTooNew)
+	}
+
+	for v := version; v < len(sqliteMigrations); v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := sqliteMigrations[v](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate database schema version %d to %d: %w", v, v+1, err)
+		}
+		// PRAGMA doesn't take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		logger.Infof("Upgraded database schema from version %d to %d", v, v+1)
+	}
+	return nil
+}
+
+func (b *sqliteBackend) Name() string { return config.StorageSQLite }
+
+func (b *sqliteBackend) LoadEmailState(account string) (*EmailState, error) {
+	rows, err := b.db.Query(`SELECT mailbox, last_seen_date FROM mailbox_state WHERE account = ?`, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	state := NewEmailState()
+	for rows.Next() {
+		var mailbox, date string
+		if err := rows.Scan(&mailbox, &date); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, date)
+		if err != nil {
+			return nil, fmt.Errorf("mailbox %s: %w", mailbox, err)
+		}
+		state.LastSeenDates[mailbox] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(state.LastSeenDates) == 0 {
+		return b.migrateJSONState(account, state)
+	}
+	return state, nil
+}
+
+// migrateJSONState imports an existing email_state.json into the database the
+// first time an account is loaded, then renames the file so it isn't imported twice
+func (b *sqliteBackend) migrateJSONState(account string, empty *EmailState) (*EmailState, error) {
+	path, err := GetStoragePath()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return empty, nil
+	}
+
+	state, err := loadJSONEmailState()
+	if err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	if err := b.SaveEmailState(account, state); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	if err := os.Rename(path, path+migratedSuffix); err != nil {
+		logger.Warnf("Migrated %s into the database but could not rename it: %v", path, err)
+	} else {
+		logger.Infof("Migrated email state from %s into the database.", path)
+	}
+	return state, nil
+}
+
+func (b *sqliteBackend) SaveEmailState(account string, state *EmailState) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for mailbox, date := range state.LastSeenDates {
+		_, err := tx.Exec(`INSERT INTO mailbox_state (account, mailbox, last_seen_date) VALUES (?, ?, ?)
+			ON CONFLICT (account, mailbox) DO UPDATE SET last_seen_date = excluded.last_seen_date`,
+			account, mailbox, date.Format(time.RFC3339Nano))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) RecordMessages(msgs []MessageRecord) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range msgs {
+		res, err := tx.Exec(`INSERT OR IGNORE INTO messages (account, mailbox, uid, sender, subject, date, seen_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			m.Account, m.Mailbox, m.UID, m.From, m.Subject, m.Date.Format(time.RFC3339Nano), m.SeenAt.Format(time.RFC3339Nano))
+		if err != nil {
+			return err
+		}
+		// Only count messages that weren't recorded before
+		if n, _ := res.RowsAffected(); n > 0 {
+			if err := bumpDailyStats(tx, m.SeenAt, m.Account, 1, 0); err != nil {
+				return err
+			}
+			if err := bumpUsageStats(tx, m); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) SearchMessages(query string, limit int) ([]MessageRecord, error) {
+	pattern := "%" + escapeLike(query) + "%"
+	rows, err := b.db.Query(`SELECT account, mailbox, uid, sender, subject, date, seen_at FROM messages
+		WHERE sender LIKE ? ESCAPE '\' OR subject LIKE ? ESCAPE '\'
+		ORDER BY date DESC LIMIT ?`, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []MessageRecord
+	for rows.Next() {
+		var m MessageRecord
+		var date, seenAt string
+		if err := rows.Scan(&m.Account, &m.Mailbox, &m.UID, &m.From, &m.Subject, &date, &seenAt); err != nil {
+			return nil, err
+		}
+		// Rows migrated from seen_uids have no date; leave it zero
+		m.Date, _ = time.Parse(time.RFC3339Nano, date)
+		m.SeenAt, _ = time.Parse(time.RFC3339Nano, seenAt)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (b *sqliteBackend) RecordNotification(rec NotificationRecord) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO notification_history (account, sent_at, title, message) VALUES (?, ?, ?, ?)`,
+		rec.Account, rec.SentAt.Format(time.RFC3339Nano), rec.Title, rec.Message)
+	if err != nil {
+		return err
+	}
+	if err := bumpDailyStats(tx, rec.SentAt, rec.Account, 0, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) Usage(since time.Time) (*UsageStats, error) {
+	rows, err := b.db.Query(`SELECT day, hour, sender, SUM(emails) FROM usage_stats
+		WHERE day >= ? GROUP BY day, hour, sender`, since.Local().Format(dayLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	u := newUsageBuilder()
+	for rows.Next() {
+		var day, sender string
+		var hour, emails int
+		if err := rows.Scan(&day, &hour, &sender, &emails); err != nil {
+			return nil, err
+		}
+		u.add(day, hour, sender, emails)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return u.result(), nil
+}
+
+// Prune deletes messages and notifications outside the retention policy.
+// Daily statistics are kept: they are small and are what history is summarized into.
+// Usage statistics are kept for a year.
+func (b *sqliteBackend) Prune(policy config.RetentionConfig, now time.Time) (int, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	removed := 0
+	exec := func(query string, args ...interface{}) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		removed += int(n)
+		return nil
+	}
+
+	if policy.HistoryDays > 0 {
+		// julianday compares the stored RFC 3339 times correctly across UTC offsets
+		cutoff := now.AddDate(0, 0, -policy.HistoryDays).Format(time.RFC3339Nano)
+		if err := exec(`DELETE FROM messages WHERE julianday(seen_at) < julianday(?)`, cutoff); err != nil {
+			return 0, err
+		}
+		if err := exec(`DELETE FROM notification_history WHERE julianday(sent_at) < julianday(?)`, cutoff); err != nil {
+			return 0, err
+		}
+	}
+	if policy.MessagesPerMailbox > 0 {
+		err := exec(`DELETE FROM messages WHERE rowid IN (
+			SELECT rowid FROM (
+				SELECT rowid, ROW_NUMBER() OVER (PARTITION BY account, mailbox ORDER BY julianday(date) DESC, uid DESC) AS rank
+				FROM messages
+			) WHERE rank > ?)`, policy.MessagesPerMailbox)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := exec(`DELETE FROM usage_stats WHERE day < ?`, now.Add(-usageRetention).Local().Format(dayLayout)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// bumpDailyStats adds to the per-day counters of an account
+func bumpDailyStats(tx *sql.Tx, at time.Time, account string, emails, notifications int) error {
+	if emails == 0 && notifications == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO daily_stats (day, account, emails_seen, notifications_sent) VALUES (?, ?, ?, ?)
+		ON CONFLICT (day, account) DO UPDATE SET
+			emails_seen = emails_seen + excluded.emails_seen,
+			notifications_sent = notifications_sent + excluded.notifications_sent`,
+		at.Local().Format("2006-01-02"), account, emails, notifications)
+	return err
+}
+
+// bumpUsageStats counts a newly recorded message by its arrival hour and sender
+func bumpUsageStats(tx *sql.Tx, m MessageRecord) error {
+	day, hour, sender := usageSlot(m)
+	_, err := tx.Exec(`INSERT INTO usage_stats (day, hour, sender, account, emails) VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT (day, hour, sender, account) DO UPDATE SET emails = emails + 1`,
+		day, hour, sender, m.Account)
+	return err
+}
+
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
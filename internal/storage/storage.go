@@ -2,88 +2,384 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/internal/schema"
 )
 
+// logger tags the lines of the storage layer with its component
+var logger = logging.For("storage")
+
 const (
-	appFolderName = "n0tif"
-	stateFileName = "email_state.json"
+	appFolderName        = "n0tif"
+	profilesFolderName   = "profiles"
+	stateFileName        = "email_state.json"
+	configFileName       = "config.json"
+	remoteConfigFileName = "remote-config.json"
+	scriptsFolderName    = "scripts"
+	logFileName          = "n0tif.log"
 )
 
+// profileName selects the profile whose data is used; empty means the default profile
+var profileName string
+
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// stateMigrations upgrade email_state.json; see package schema
+var stateMigrations = []schema.Migration{
+	schema.Stamp, // 0 -> 1: introduce schema_version
+}
+
+// ErrStateCorrupt is returned for an email state file whose content can't be read,
+// e.g. after a crash truncated it
+var ErrStateCorrupt = errors.New("email state is corrupt")
+
 // EmailState stores information about previously seen emails
 type EmailState struct {
+	SchemaVersion int                  `json:"schema_version"`
 	LastSeenDates map[string]time.Time `json:"last_seen_dates"` // Maps mailbox to the InternalDate of the last seen email
 }
 
 // NewEmailState creates a new email state
 func NewEmailState() *EmailState {
 	return &EmailState{
+		SchemaVersion: schema.Current(stateMigrations),
 		LastSeenDates: make(map[string]time.Time),
 	}
 }
 
-// GetStoragePath returns the path to the application data folder
-func GetStoragePath() (string, error) {
+// SetProfile selects a named profile. Each profile keeps its credentials,
+// state and logs in its own subfolder. An empty name selects the default profile.
+func SetProfile(name string) error {
+	if name != "" && !validProfileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '-' and '_'", name)
+	}
+	profileName = name
+	return nil
+}
+
+// Profile returns the active profile name, empty for the default profile
+func Profile() string {
+	return profileName
+}
+
+// rootFolder returns the data folder of the default profile, which holds the named profiles
+func rootFolder() (string, error) {
+	if portableRoot != "" {
+		return portableRoot, nil
+	}
 	appData, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
 	}
+	return filepath.Join(appData, appFolderName), nil
+}
 
-	appFolder := filepath.Join(appData, appFolderName)
+// ListProfiles returns the names of the named profiles that have data, sorted by name
+func ListProfiles() ([]string, error) {
+	root, err := rootFolder()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(root, profilesFolderName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && validProfileName.MatchString(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// RemoveAllData deletes the data folder with every profile in it, and the log folder
+// where that is kept separately, and returns the path of the data folder.
+// Passwords kept in the system keyring have to be removed first, see DeleteCredentials.
+func RemoveAllData() (string, error) {
+	root, err := rootFolder()
+	if err != nil {
+		return "", err
+	}
+	if logs, err := logRoot(); err == nil && logs != root {
+		if err := os.RemoveAll(logs); err != nil {
+			return logs, err
+		}
+	}
+	return root, os.RemoveAll(root)
+}
+
+// RemoveProfile deletes the data folder and the logs of a named profile
+func RemoveProfile(name string) error {
+	if !validProfileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	root, err := rootFolder()
+	if err != nil {
+		return err
+	}
+	if logs, err := logRoot(); err == nil && logs != root {
+		if err := os.RemoveAll(filepath.Join(logs, profilesFolderName, name)); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(root, profilesFolderName, name))
+}
+
+// GetAppFolder returns the data folder of the active profile, creating it if needed
+func GetAppFolder() (string, error) {
+	appFolder, err := rootFolder()
+	if err != nil {
+		return "", err
+	}
+	if profileName != "" {
+		appFolder = filepath.Join(appFolder, profilesFolderName, profileName)
+	}
 	if err := os.MkdirAll(appFolder, 0755); err != nil {
 		return "", err
 	}
 
+	return appFolder, nil
+}
+
+// GetStoragePath returns the path to the email state file
+func GetStoragePath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+
 	return filepath.Join(appFolder, stateFileName), nil
 }
 
-// LoadEmailState loads the email state from disk
-func LoadEmailState() (*EmailState, error) {
+// GetConfigPath returns the path to the settings file of the active profile
+func GetConfigPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appFolder, configFileName), nil
+}
+
+// GetRemoteConfigPath returns the path where the last verified remotely managed settings are cached
+func GetRemoteConfigPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appFolder, remoteConfigFileName), nil
+}
+
+// GetScriptsFolder returns the folder of the Lua scripts of the active profile. It is not created.
+func GetScriptsFolder() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appFolder, scriptsFolderName), nil
+}
+
+// GetLogFolder returns the folder of the log files of the active profile, creating it if needed.
+// It is the data folder except where the platform keeps logs elsewhere.
+func GetLogFolder() (string, error) {
+	folder, err := logRoot()
+	if err != nil {
+		return "", err
+	}
+	if profileName != "" {
+		folder = filepath.Join(folder, profilesFolderName, profileName)
+	}
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return "", err
+	}
+	return folder, nil
+}
+
+// GetLogPath returns the path to the log file of the active profile
+func GetLogPath() (string, error) {
+	logFolder, err := GetLogFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(logFolder, logFileName), nil
+}
+
+// backupSuffix names the copy of the last good state written on every save
+const backupSuffix = ".bak"
+
+// loadJSONEmailState loads the email state from disk.
+// It holds the state lock so a concurrent save can't be read half-written,
+// and falls back to the backup copy if the file is truncated or corrupt.
+func loadJSONEmailState() (*EmailState, error) {
 	path, err := GetStoragePath()
 	if err != nil {
 		return nil, err
 	}
 
-	// If the file doesn't exist, return a new state
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	var state *EmailState
+	err = withFileLock(path, func() error {
+		state, err = readStateWithRecovery(path)
+		return err
+	})
+	return state, err
+}
+
+// readStateWithRecovery reads the state file, recovering from the backup when needed.
+// If neither copy is usable, the corrupt file is moved aside and a fresh state is
+// returned, so tracking restarts from a new baseline instead of refusing to start.
+func readStateWithRecovery(path string) (*EmailState, error) {
+	state, err := readStateFile(path)
+	if err == nil {
+		return state, nil
+	}
+	if errors.Is(err, schema.ErrTooNew) {
+		// Not corrupt: moving it aside would throw away a newer release's state
+		return nil, fmt.Errorf("email state %s: %w", path, err)
+	}
+	if os.IsNotExist(err) {
+		// No state yet, unless a crash happened between writing the backup and the rename
+		if backup, bakErr := readStateFile(path + backupSuffix); bakErr == nil {
+			logger.Infof("Email state file missing, restored from backup %s", path+backupSuffix)
+			return backup, nil
+		}
+		return NewEmailState(), nil
+	}
+	if !errors.Is(err, ErrStateCorrupt) {
+		// E.g. no permission: the file may well be fine, so leave it alone
+		return nil, fmt.Errorf("email state %s: %w", path, err)
+	}
+
+	logger.Warnf("Email state file %s is corrupt (%v), trying backup...", path, err)
+	backup, bakErr := readStateFile(path + backupSuffix)
+
+	corruptPath := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if renameErr := os.Rename(path, corruptPath); renameErr != nil {
+		logger.Warnf("Could not move corrupt state file aside: %v", renameErr)
+	} else {
+		logger.Infof("Corrupt state file kept as %s", corruptPath)
+	}
+
+	if bakErr != nil {
+		logger.Warnf("Backup state is unusable too (%v), starting with a fresh state.", bakErr)
 		return NewEmailState(), nil
 	}
 
+	logger.Infof("Recovered email state from backup %s", path+backupSuffix)
+	if err := writeStateFiles(path, backup); err != nil {
+		logger.Warnf("Failed to restore state file from backup: %v", err)
+	}
+	return backup, nil
+}
+
+// readStateFile parses a single state file, treating empty or truncated JSON as
+// corrupt (ErrStateCorrupt). Files in an older format are upgraded in place;
+// callers hold the state lock.
+func readStateFile(path string) (*EmailState, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrStateCorrupt)
+	}
 
-	var state EmailState
-	if err := json.Unmarshal(data, &state); err != nil {
+	upgraded, version, err := schema.Upgrade(data, stateMigrations)
+	if errors.Is(err, schema.ErrTooNew) {
 		return nil, err
 	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStateCorrupt, err)
+	}
+	if version < schema.Current(stateMigrations) {
+		if err := writeFileAtomic(func() (string, error) { return path, nil }, upgraded, 0644); err != nil {
+			logger.Warnf("Failed to upgrade %s in place: %v", path, err)
+		} else {
+			logger.Infof("Upgraded %s from schema version %d to %d", path, version, schema.Current(stateMigrations))
+		}
+	}
 
+	var state EmailState
+	if err := json.Unmarshal(upgraded, &state); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStateCorrupt, err)
+	}
+	if state.LastSeenDates == nil {
+		state.LastSeenDates = make(map[string]time.Time)
+	}
 	return &state, nil
 }
 
-// SaveEmailState saves the email state to disk using an atomic write operation.
-func SaveEmailState(state *EmailState) error {
+// CheckEmailState reads the email state file and its backup without recovering
+// either, for doctor. Missing files are fine; a damaged one is reported with an
+// error wrapping ErrStateCorrupt.
+func CheckEmailState() error {
 	path, err := GetStoragePath()
 	if err != nil {
 		return err
 	}
+	return withFileLock(path, func() error {
+		for _, p := range []string{path, path + backupSuffix} {
+			if _, err := readStateFile(p); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+		}
+		return nil
+	})
+}
 
-	data, err := json.MarshalIndent(state, "", "  ")
+// saveJSONEmailState saves the email state to disk using an atomic write operation.
+// Under the state lock it first merges in dates another process saved in the
+// meantime, so concurrent daemon and foreground runs don't move the baseline backwards.
+func saveJSONEmailState(state *EmailState) error {
+	path, err := GetStoragePath()
 	if err != nil {
 		return err
 	}
 
-	// Write to a temporary file first
-	tempFile := path + ".tmp"
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+	return withFileLock(path, func() error {
+		if onDisk, err := readStateFile(path); err == nil {
+			for mailbox, date := range onDisk.LastSeenDates {
+				state.UpdateLastSeenDate(mailbox, date)
+			}
+		}
+		return writeStateFiles(path, state)
+	})
+}
+
+// writeStateFiles atomically writes the state to path and then to its backup copy
+func writeStateFiles(path string, state *EmailState) error {
+	state.SchemaVersion = schema.Current(stateMigrations)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
 		return err
 	}
 
-	// Rename the temporary file to the actual file (atomic operation)
-	return os.Rename(tempFile, path)
+	for _, target := range []string{path, path + backupSuffix} {
+		// Write to a temporary file first
+		tempFile := target + ".tmp"
+		if err := os.WriteFile(tempFile, data, 0644); err != nil {
+			return err
+		}
+
+		// Rename the temporary file to the actual file (atomic operation)
+		if err := os.Rename(tempFile, target); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // UpdateLastSeenDate updates the last seen date for a mailbox.
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"sync"
+)
+
+var (
+	// suspendMu is held for reading by every storage operation and for writing
+	// while storage is suspended, so a suspension waits for operations in flight
+	// and blocks new ones until Resume
+	suspendMu sync.RWMutex
+
+	suspendStateMu   sync.Mutex
+	suspended        bool
+	suspendedBackend string
+)
+
+// Suspend waits for storage operations in progress, closes the active backend so
+// its files are complete and unlocked on disk, and blocks further operations until
+// Resume. It lets another process copy or replace the data files safely.
+func Suspend() error {
+	suspendStateMu.Lock()
+	defer suspendStateMu.Unlock()
+	if suspended {
+		return nil
+	}
+
+	suspendMu.Lock()
+	suspendedBackend = currentBackend().Name()
+	if err := CloseBackend(); err != nil {
+		logger.Warnf("Failed to close %s storage for suspension: %v", suspendedBackend, err)
+	}
+	suspended = true
+	return nil
+}
+
+// Resume reopens the backend closed by Suspend and lets storage operations continue
+func Resume() error {
+	suspendStateMu.Lock()
+	defer suspendStateMu.Unlock()
+	if !suspended {
+		return nil
+	}
+
+	err := OpenBackend(suspendedBackend)
+	suspended = false
+	suspendMu.Unlock()
+	return err
+}
+
+// Suspended reports whether storage is currently suspended
+func Suspended() bool {
+	suspendStateMu.Lock()
+	defer suspendStateMu.Unlock()
+	return suspended
+}
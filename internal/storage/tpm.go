@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EncryptionTPM encrypts secrets with a random key that is itself encrypted by a
+// key kept inside the machine's TPM, so a copy of the credentials file can't be
+// decrypted on any other machine
+const EncryptionTPM = "tpm"
+
+// tpmSealedSecret is the reference stored in the credentials file: the data key
+// as wrapped by the TPM, and the secret encrypted with it
+type tpmSealedSecret struct {
+	WrappedKey []byte `json:"wrapped_key"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// TPMAvailable reports whether secrets can be bound to a TPM on this machine
+func TPMAvailable() bool {
+	return tpmAvailable()
+}
+
+// tpmBackend keeps the secret in the credentials file, encrypted under a TPM-wrapped key
+type tpmBackend struct{}
+
+func (tpmBackend) Name() string { return EncryptionTPM }
+
+// Available is false so the backend is never chosen automatically; it has to be
+// requested, since a reinstalled Windows or a cleared TPM loses the secret for good
+func (tpmBackend) Available() bool { return false }
+
+func (tpmBackend) Store(account, kind, secret string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	wrapped, err := tpmWrapKey(key)
+	if err != nil {
+		return "", err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(tpmSealedSecret{
+		WrappedKey: wrapped,
+		Ciphertext: aesGCM.Seal(nonce, nonce, []byte(secret), nil),
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func (tpmBackend) Load(account, kind, ref string) (string, error) {
+	data, err := hex.DecodeString(ref)
+	if err != nil {
+		return "", err
+	}
+	var sealed tpmSealedSecret
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return "", fmt.Errorf("parse sealed secret: %w", err)
+	}
+	key, err := tpmUnwrapKey(sealed.WrappedKey)
+	if err != nil {
+		return "", err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonceSize := aesGCM.NonceSize()
+	if len(sealed.Ciphertext) < nonceSize {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed.Ciphertext[:nonceSize], sealed.Ciphertext[nonceSize:]
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Delete is a no-op: the secret lives in the credentials file itself, and the
+// TPM key is shared by all profiles of the Windows user
+func (tpmBackend) Delete(account, kind string) error { return nil }
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package storage
+
+import "errors"
+
+var errTPMUnavailable = errors.New("TPM-bound credentials are only available on Windows")
+
+func tpmAvailable() bool { return false }
+
+func tpmWrapKey(key []byte) ([]byte, error) {
+	return nil, errTPMUnavailable
+}
+
+func tpmUnwrapKey(wrapped []byte) ([]byte, error) {
+	return nil, errTPMUnavailable
+}
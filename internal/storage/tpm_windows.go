@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modncrypt                     = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptOpenStorageProvider = modncrypt.NewProc("NCryptOpenStorageProvider")
+	procNCryptOpenKey             = modncrypt.NewProc("NCryptOpenKey")
+	procNCryptCreatePersistedKey  = modncrypt.NewProc("NCryptCreatePersistedKey")
+	procNCryptSetProperty         = modncrypt.NewProc("NCryptSetProperty")
+	procNCryptFinalizeKey         = modncrypt.NewProc("NCryptFinalizeKey")
+	procNCryptEncrypt             = modncrypt.NewProc("NCryptEncrypt")
+	procNCryptDecrypt             = modncrypt.NewProc("NCryptDecrypt")
+	procNCryptFreeObject          = modncrypt.NewProc("NCryptFreeObject")
+)
+
+const (
+	// tpmProvider is the key storage provider backed by the TPM
+	tpmProvider = "Microsoft Platform Crypto Provider"
+	// tpmKeyName names the RSA key n0tif keeps in the TPM for the Windows user
+	tpmKeyName = "n0tif-credentials"
+
+	ncryptSilentFlag       = 0x40       // fail instead of showing a prompt
+	ncryptPadOAEPFlag      = 0x4        // NCRYPT_PAD_OAEP_FLAG
+	ncryptAllowDecrypt     = 0x1        // NCRYPT_ALLOW_DECRYPT_FLAG
+	nteBadKeyset           = 0x80090016 // the key doesn't exist yet
+	ncryptKeyUsageProperty = "Key Usage"
+)
+
+// oaepPaddingInfo mirrors the Win32 BCRYPT_OAEP_PADDING_INFO structure
+type oaepPaddingInfo struct {
+	algID     *uint16
+	label     *byte
+	labelSize uint32
+}
+
+var (
+	tpmProbeOnce sync.Once
+	tpmUsable    bool
+)
+
+// tpmAvailable probes the TPM key storage provider once
+func tpmAvailable() bool {
+	tpmProbeOnce.Do(func() {
+		prov, err := openTPMProvider()
+		if err == nil {
+			ncryptFree(prov)
+			tpmUsable = true
+		}
+	})
+	return tpmUsable
+}
+
+// ncryptError turns a failed SECURITY_STATUS into an error
+func ncryptError(fn string, status uintptr) error {
+	return fmt.Errorf("%s: %w", fn, windows.Errno(status))
+}
+
+func ncryptFree(h uintptr) {
+	procNCryptFreeObject.Call(h)
+}
+
+func openTPMProvider() (uintptr, error) {
+	var prov uintptr
+	if r, _, _ := procNCryptOpenStorageProvider.Call(
+		uintptr(unsafe.Pointer(&prov)),
+		uintptr(unsafe.Pointer(windows.StringToUTF16Ptr(tpmProvider))),
+		0,
+	); r != 0 {
+		return 0, ncryptError("NCryptOpenStorageProvider", r)
+	}
+	return prov, nil
+}
+
+// openTPMKey opens n0tif's key in the TPM, creating it first when create is set
+func openTPMKey(create bool) (uintptr, error) {
+	prov, err := openTPMProvider()
+	if err != nil {
+		return 0, err
+	}
+	defer ncryptFree(prov)
+
+	name := windows.StringToUTF16Ptr(tpmKeyName)
+	var key uintptr
+	r, _, _ := procNCryptOpenKey.Call(prov, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(name)), 0, ncryptSilentFlag)
+	if r == 0 {
+		return key, nil
+	}
+	if uint32(r) != nteBadKeyset || !create {
+		return 0, ncryptError("NCryptOpenKey", r)
+	}
+
+	if r, _, _ := procNCryptCreatePersistedKey.Call(
+		prov,
+		uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(windows.StringToUTF16Ptr("RSA"))),
+		uintptr(unsafe.Pointer(name)),
+		0,
+		0,
+	); r != 0 {
+		return 0, ncryptError("NCryptCreatePersistedKey", r)
+	}
+	usage := uint32(ncryptAllowDecrypt)
+	if r, _, _ := procNCryptSetProperty.Call(
+		key,
+		uintptr(unsafe.Pointer(windows.StringToUTF16Ptr(ncryptKeyUsageProperty))),
+		uintptr(unsafe.Pointer(&usage)),
+		unsafe.Sizeof(usage),
+		0,
+	); r != 0 {
+		ncryptFree(key)
+		return 0, ncryptError("NCryptSetProperty", r)
+	}
+	if r, _, _ := procNCryptFinalizeKey.Call(key, ncryptSilentFlag); r != 0 {
+		ncryptFree(key)
+		return 0, ncryptError("NCryptFinalizeKey", r)
+	}
+	return key, nil
+}
+
+// ncryptCrypt runs NCryptEncrypt or NCryptDecrypt with OAEP padding, asking for
+// the output size first
+func ncryptCrypt(proc *windows.LazyProc, key uintptr, input []byte) ([]byte, error) {
+	padding := oaepPaddingInfo{algID: windows.StringToUTF16Ptr("SHA1")}
+	call := func(out []byte) (uint32, uintptr) {
+		var size uint32
+		var outPtr *byte
+		if len(out) > 0 {
+			outPtr = &out[0]
+		}
+		r, _, _ := proc.Call(
+			key,
+			uintptr(unsafe.Pointer(&input[0])),
+			uintptr(len(input)),
+			uintptr(unsafe.Pointer(&padding)),
+			uintptr(unsafe.Pointer(outPtr)),
+			uintptr(len(out)),
+			uintptr(unsafe.Pointer(&size)),
+			ncryptPadOAEPFlag|ncryptSilentFlag,
+		)
+		return size, r
+	}
+	size, r := call(nil)
+	if r != 0 {
+		return nil, ncryptError(proc.Name, r)
+	}
+	out := make([]byte, size)
+	size, r = call(out)
+	if r != 0 {
+		return nil, ncryptError(proc.Name, r)
+	}
+	return out[:size], nil
+}
+
+// tpmWrapKey encrypts a data key with n0tif's TPM key, creating it on first use
+func tpmWrapKey(dataKey []byte) ([]byte, error) {
+	key, err := openTPMKey(true)
+	if err != nil {
+		return nil, err
+	}
+	defer ncryptFree(key)
+	return ncryptCrypt(procNCryptEncrypt, key, dataKey)
+}
+
+// tpmUnwrapKey decrypts a data key wrapped by tpmWrapKey on this machine
+func tpmUnwrapKey(wrapped []byte) ([]byte, error) {
+	if len(wrapped) == 0 {
+		return nil, fmt.Errorf("no wrapped key")
+	}
+	key, err := openTPMKey(false)
+	if err != nil {
+		return nil, fmt.Errorf("%w (credentials bound to another machine's TPM?)", err)
+	}
+	defer ncryptFree(key)
+	return ncryptCrypt(procNCryptDecrypt, key, wrapped)
+}
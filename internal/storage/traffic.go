@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const trafficFileName = "traffic.json"
+
+// monthLayout names a local calendar month
+const monthLayout = "2006-01"
+
+// DataUsage is the data exchanged with the mail server, in bytes
+type DataUsage struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+// Total returns the bytes sent and received
+func (u DataUsage) Total() int64 { return u.Sent + u.Received }
+
+// trafficFile is traffic.json: per local calendar day, the data usage of every
+// connection of the profile, the monitor's and those of commands alike
+type trafficFile struct {
+	Days   map[string]DataUsage `json:"days"`
+	Warned string               `json:"warned,omitempty"` // the month whose cap was warned of, as "2006-01"
+}
+
+// GetTrafficPath returns the path to the data usage of the active profile
+func GetTrafficPath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, trafficFileName), nil
+}
+
+func readTrafficFile(path string) (*trafficFile, error) {
+	t := &trafficFile{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, t); err != nil {
+			return nil, err
+		}
+	}
+	if t.Days == nil {
+		t.Days = make(map[string]DataUsage)
+	}
+	return t, nil
+}
+
+// updateTrafficFile applies change to traffic.json under its lock, writing it atomically
+func updateTrafficFile(change func(t *trafficFile)) error {
+	path, err := GetTrafficPath()
+	if err != nil {
+		return err
+	}
+	return withFileLock(path, func() error {
+		t, err := readTrafficFile(path)
+		if err != nil {
+			return err
+		}
+		change(t)
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(func() (string, error) { return path, nil }, data, 0644)
+	})
+}
+
+// RecordDataUsage adds u to the local day of at
+func RecordDataUsage(at time.Time, u DataUsage) error {
+	if u.Total() == 0 {
+		return nil
+	}
+	day := at.Local().Format(dayLayout)
+	return updateTrafficFile(func(t *trafficFile) {
+		d := t.Days[day]
+		d.Sent += u.Sent
+		d.Received += u.Received
+		t.Days[day] = d
+	})
+}
+
+// DataUsageSince returns the data usage since the start of the local day of since
+func DataUsageSince(since time.Time) (DataUsage, error) {
+	path, err := GetTrafficPath()
+	if err != nil {
+		return DataUsage{}, err
+	}
+	t, err := readTrafficFile(path)
+	if err != nil {
+		return DataUsage{}, err
+	}
+	first := since.Local().Format(dayLayout)
+	var total DataUsage
+	for day, u := range t.Days {
+		if day >= first {
+			total.Sent += u.Sent
+			total.Received += u.Received
+		}
+	}
+	return total, nil
+}
+
+// MarkDataCapWarned records that the monthly cap of the local month of at was
+// warned of, reporting false if it already had been
+func MarkDataCapWarned(at time.Time) (bool, error) {
+	month := at.Local().Format(monthLayout)
+	first := false
+	err := updateTrafficFile(func(t *trafficFile) {
+		first = t.Warned != month
+		t.Warned = month
+	})
+	return first, err
+}
+
+// pruneTraffic drops the days of traffic.json older than usageRetention
+func pruneTraffic(now time.Time) (int, error) {
+	path, err := GetTrafficPath()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	cutoff := now.Add(-usageRetention).Format(dayLayout)
+	removed := 0
+	err = updateTrafficFile(func(t *trafficFile) {
+		for day := range t.Days {
+			if day < cutoff {
+				delete(t.Days, day)
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
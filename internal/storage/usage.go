@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const usageFileName = "usage.json"
+
+// usageRetention is how long the per-day usage statistics are kept. They are
+// small, so they outlive the message history they are counted from.
+const usageRetention = 366 * 24 * time.Hour
+
+// dayLayout names a local calendar day in the statistics
+const dayLayout = "2006-01-02"
+
+// UsageStats summarizes the emails that arrived during a period
+type UsageStats struct {
+	Total   int           `json:"total"`
+	Days    []DayUsage    `json:"days"`    // days with email, oldest first
+	Hours   [24]int       `json:"hours"`   // emails by local hour of arrival
+	Senders []SenderUsage `json:"senders"` // busiest first
+}
+
+// DayUsage is the number of emails that arrived on a local calendar day
+type DayUsage struct {
+	Day    string `json:"day"` // YYYY-MM-DD
+	Emails int    `json:"emails"`
+}
+
+// SenderUsage is the number of emails from one sender
+type SenderUsage struct {
+	Sender string `json:"sender"`
+	Emails int    `json:"emails"`
+}
+
+// Usage returns the statistics of the emails that arrived since the start of the
+// local day of since. They are counted as messages are recorded and survive the
+// pruning of the message history for a year.
+func Usage(since time.Time) (*UsageStats, error) {
+	suspendMu.RLock()
+	defer suspendMu.RUnlock()
+	return currentBackend().Usage(since)
+}
+
+// usageSlot is where a message counts: its local arrival day and hour, and its sender
+func usageSlot(m MessageRecord) (day string, hour int, sender string) {
+	at := m.Date
+	if at.IsZero() {
+		at = m.SeenAt
+	}
+	at = at.Local()
+	return at.Format(dayLayout), at.Hour(), SenderName(m.From)
+}
+
+// SenderName shortens a From header to what people call the sender: the display
+// name if there is one, otherwise the address
+func SenderName(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if addr.Name != "" {
+			return addr.Name
+		}
+		return addr.Address
+	}
+	if from = strings.TrimSpace(from); from != "" {
+		return from
+	}
+	return "(unknown)"
+}
+
+// usageBuilder adds up usage rows into UsageStats
+type usageBuilder struct {
+	stats   UsageStats
+	days    map[string]int
+	senders map[string]int
+}
+
+func newUsageBuilder() *usageBuilder {
+	return &usageBuilder{days: make(map[string]int), senders: make(map[string]int)}
+}
+
+func (b *usageBuilder) add(day string, hour int, sender string, emails int) {
+	b.stats.Total += emails
+	b.days[day] += emails
+	if hour >= 0 && hour < 24 {
+		b.stats.Hours[hour] += emails
+	}
+	b.senders[sender] += emails
+}
+
+func (b *usageBuilder) result() *UsageStats {
+	b.stats.Days = []DayUsage{}
+	for day, n := range b.days {
+		b.stats.Days = append(b.stats.Days, DayUsage{Day: day, Emails: n})
+	}
+	sort.Slice(b.stats.Days, func(i, j int) bool { return b.stats.Days[i].Day < b.stats.Days[j].Day })
+
+	b.stats.Senders = []SenderUsage{}
+	for sender, n := range b.senders {
+		b.stats.Senders = append(b.stats.Senders, SenderUsage{Sender: sender, Emails: n})
+	}
+	sort.Slice(b.stats.Senders, func(i, j int) bool {
+		if b.stats.Senders[i].Emails != b.stats.Senders[j].Emails {
+			return b.stats.Senders[i].Emails > b.stats.Senders[j].Emails
+		}
+		return b.stats.Senders[i].Sender < b.stats.Senders[j].Sender
+	})
+	return &b.stats
+}
+
+// usageFile is usage.json, the statistics of the JSON backend
+type usageFile struct {
+	Days map[string]*usageDay `json:"days"`
+}
+
+// usageDay holds the counts of one local calendar day
+type usageDay struct {
+	Hours   [24]int        `json:"hours"`
+	Senders map[string]int `json:"senders"`
+}
+
+// GetUsagePath returns the path to the usage statistics file of the active profile
+func GetUsagePath() (string, error) {
+	appFolder, err := GetAppFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appFolder, usageFileName), nil
+}
+
+func readUsageFile(path string) (*usageFile, error) {
+	u := &usageFile{Days: make(map[string]*usageDay)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, err
+	}
+	if u.Days == nil {
+		u.Days = make(map[string]*usageDay)
+	}
+	return u, nil
+}
+
+// updateUsageFile applies change to usage.json under its lock, writing it atomically
+func updateUsageFile(change func(u *usageFile)) error {
+	path, err := GetUsagePath()
+	if err != nil {
+		return err
+	}
+	return withFileLock(path, func() error {
+		u, err := readUsageFile(path)
+		if err != nil {
+			return err
+		}
+		change(u)
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		tempFile := path + ".tmp"
+		if err := os.WriteFile(tempFile, data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tempFile, path)
+	})
+}
+
+// recordJSONUsage counts messages in usage.json
+func recordJSONUsage(msgs []MessageRecord) error {
+	return updateUsageFile(func(u *usageFile) {
+		for _, m := range msgs {
+			day, hour, sender := usageSlot(m)
+			d := u.Days[day]
+			if d == nil {
+				d = &usageDay{Senders: make(map[string]int)}
+				u.Days[day] = d
+			}
+			d.Hours[hour]++
+			d.Senders[sender]++
+		}
+	})
+}
+
+// jsonUsage sums usage.json from the day of since on
+func jsonUsage(since time.Time) (*UsageStats, error) {
+	path, err := GetUsagePath()
+	if err != nil {
+		return nil, err
+	}
+	u, err := readUsageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	first := since.Local().Format(dayLayout)
+	b := newUsageBuilder()
+	for day, d := range u.Days {
+		if day < first {
+			continue
+		}
+		for hour, n := range d.Hours {
+			b.stats.Hours[hour] += n
+		}
+		for sender, n := range d.Senders {
+			b.stats.Total += n
+			b.days[day] += n
+			b.senders[sender] += n
+		}
+	}
+	return b.result(), nil
+}
+
+// pruneJSONUsage drops the days of usage.json older than usageRetention
+func pruneJSONUsage(now time.Time) (int, error) {
+	path, err := GetUsagePath()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	cutoff := now.Add(-usageRetention).Format(dayLayout)
+	removed := 0
+	err = updateUsageFile(func(u *usageFile) {
+		for day := range u.Days {
+			if day < cutoff {
+				delete(u.Days, day)
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
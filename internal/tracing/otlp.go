@@ -0,0 +1,251 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; newer spans are dropped when it is full
+	queueSize = 2048
+	// batchSize is how many spans are sent at most in one request
+	batchSize = 256
+	// flushInterval is how long a finished span waits at most before it is sent
+	flushInterval = 5 * time.Second
+	// exportTimeout bounds one request to the collector
+	exportTimeout = 10 * time.Second
+)
+
+var logger = logging.For("tracing")
+
+// finishedSpan is an ended span waiting for export
+type finishedSpan struct {
+	traceID, spanID, parentID string
+	name                      string
+	start, end                time.Time
+	attrs                     []attribute
+	err                       error
+}
+
+// exporter sends finished spans to one collector in batches
+type exporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	queue       chan finishedSpan
+	done        chan struct{} // closed to stop the export loop
+	stopped     chan struct{} // closed once the loop has flushed and returned
+	stopOnce    sync.Once
+
+	mu      sync.Mutex
+	dropped int // spans lost to a full queue since the last warning
+}
+
+func newExporter(endpoint, serviceName string) *exporter {
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	e := &exporter{
+		url:         url,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		queue:       make(chan finishedSpan, queueSize),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go e.run()
+	logger.Infof("Exporting traces to %s.", url)
+	return e
+}
+
+func (e *exporter) enqueue(s finishedSpan) {
+	select {
+	case e.queue <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// run sends a batch whenever one is full or flushInterval has passed, until shutdown
+func (e *exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []finishedSpan
+	flush := func() {
+		if len(batch) > 0 {
+			e.send(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown flushes the queue, waiting until ctx is done at most
+func (e *exporter) shutdown(ctx context.Context) {
+	e.stopOnce.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+	}
+}
+
+// send posts one batch to the collector. Failures are logged and the batch is
+// dropped: traces are diagnostics, not worth holding up or retrying checks for.
+func (e *exporter) send(batch []finishedSpan) {
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		logger.Warnf("Dropped %d span(s), the export queue was full.", dropped)
+	}
+
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		logger.Warnf("Failed to encode %d span(s): %v", len(batch), err)
+		return
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Warnf("Failed to export %d span(s): %v", len(batch), err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		logger.Warnf("Failed to export %d span(s): collector answered %s", len(batch), resp.Status)
+		return
+	}
+	logger.Debugf("Exported %d span(s).", len(batch))
+}
+
+// The OTLP/HTTP JSON request body; see opentelemetry-proto's trace service.
+// IDs are hex strings and 64-bit integers are decimal strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// OTLP span kind and status codes
+const (
+	spanKindInternal = 1
+	statusUnset      = 0
+	statusError      = 2
+)
+
+func (e *exporter) request(batch []finishedSpan) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: statusUnset},
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, otlpAttr(a.key, a.value))
+		}
+		if s.err != nil {
+			span.Status = otlpStatus{Code: statusError, Message: s.err.Error()}
+		}
+		spans = append(spans, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{otlpAttr("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/byigitt/n0tif"},
+			Spans: spans,
+		}},
+	}}}
+}
+
+func otlpAttr(key string, value interface{}) otlpAttribute {
+	var v map[string]interface{}
+	switch x := value.(type) {
+	case bool:
+		v = map[string]interface{}{"boolValue": x}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": x}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
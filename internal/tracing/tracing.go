@@ -0,0 +1,160 @@
+// Package tracing records the stages of a check cycle as spans and exports them
+// to an OpenTelemetry collector over OTLP/HTTP with JSON encoding, without
+// pulling in the OpenTelemetry SDK.
+//
+// Spans are only recorded while an endpoint is set; otherwise Start returns a
+// nil *Span, whose methods do nothing, so instrumented code costs next to nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Span is one timed operation. A nil Span is valid and records nothing.
+type Span struct {
+	exp      *exporter
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // zero for the root span of a trace
+	name     string
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs []attribute
+	err   error
+	ended bool
+}
+
+type attribute struct {
+	key   string
+	value interface{} // string, int64, float64 or bool
+}
+
+type spanKey struct{}
+
+var (
+	exporterMu sync.RWMutex
+	current    *exporter // nil while tracing is off
+)
+
+// SetEndpoint starts exporting spans to the OTLP/HTTP endpoint of a collector,
+// e.g. http://localhost:4318, replacing the previous endpoint. An empty endpoint
+// turns tracing off. Spans still queued for the previous endpoint are flushed.
+func SetEndpoint(endpoint, serviceName string) {
+	var next *exporter
+	if endpoint != "" {
+		next = newExporter(endpoint, serviceName)
+	}
+
+	exporterMu.Lock()
+	previous := current
+	current = next
+	exporterMu.Unlock()
+
+	if previous != nil {
+		go previous.shutdown(context.Background())
+	}
+}
+
+// Shutdown flushes the queued spans and turns tracing off, waiting until ctx is done at most
+func Shutdown(ctx context.Context) {
+	exporterMu.Lock()
+	previous := current
+	current = nil
+	exporterMu.Unlock()
+
+	if previous != nil {
+		previous.shutdown(ctx)
+	}
+}
+
+// Start begins a span named name as a child of the span in ctx, or as the root
+// of a new trace, and returns a context carrying it. attrs are key, value pairs.
+func Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, *Span) {
+	exporterMu.RLock()
+	exp := current
+	exporterMu.RUnlock()
+	if exp == nil {
+		return ctx, nil
+	}
+
+	s := &Span{exp: exp, name: name, start: time.Now()}
+	if parent, _ := ctx.Value(spanKey{}).(*Span); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttributes adds key, value pairs to the span. Values other than strings,
+// integers, floats and booleans are recorded as their fmt.Sprint text.
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var value interface{}
+		switch v := kv[i+1].(type) {
+		case string, bool, float64, int64:
+			value = v
+		case int:
+			value = int64(v)
+		case uint32:
+			value = int64(v)
+		case time.Duration:
+			value = v.Seconds()
+		default:
+			value = fmt.Sprint(v)
+		}
+		s.attrs = append(s.attrs, attribute{key: key, value: value})
+	}
+}
+
+// SetError marks the span as failed with err; a nil err is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	finished := finishedSpan{
+		traceID: hex.EncodeToString(s.traceID[:]),
+		spanID:  hex.EncodeToString(s.spanID[:]),
+		name:    s.name,
+		start:   s.start,
+		end:     time.Now(),
+		attrs:   s.attrs,
+		err:     s.err,
+	}
+	if s.parentID != [8]byte{} {
+		finished.parentID = hex.EncodeToString(s.parentID[:])
+	}
+	s.mu.Unlock()
+	s.exp.enqueue(finished)
+}
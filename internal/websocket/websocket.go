@@ -0,0 +1,236 @@
+// Package websocket is a minimal RFC 6455 server that sends text messages to
+// browsers, which is all the browser extension companion needs. Like package
+// mqtt, it keeps n0tif free of a full library.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes of the frames n0tif handles
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// acceptGUID is appended to the client's key to prove the server speaks WebSocket
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	// pingInterval is how often the connection is checked while nothing is sent
+	pingInterval = 30 * time.Second
+	// readTimeout drops a browser that stopped answering pings
+	readTimeout  = 3 * pingInterval
+	writeTimeout = 10 * time.Second
+	// maxFrame limits what a browser may send; n0tif only expects control frames
+	maxFrame = 4 << 10
+)
+
+// Conn is a WebSocket connection to a browser
+type Conn struct {
+	conn net.Conn
+	mu   sync.Mutex // serializes writes
+	done chan struct{}
+	once sync.Once
+}
+
+// Upgrade answers the WebSocket handshake of r and takes over its connection.
+// On failure it has already answered the request with an error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		http.Error(w, "WebSocket needs GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("not a GET request")
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket upgrade")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	case key == "":
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("response can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Conn{conn: conn, done: make(chan struct{})}
+	go c.read(rw.Reader)
+	go c.ping()
+	return c, nil
+}
+
+// WriteText sends data as a text message
+func (c *Conn) WriteText(data []byte) error {
+	return c.write(opText, data)
+}
+
+// Done is closed when the browser disconnects or the connection is closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close ends the connection with a normal closure
+func (c *Conn) Close() error {
+	err := c.write(opClose, binary.BigEndian.AppendUint16(nil, 1000))
+	c.fail()
+	return err
+}
+
+// write sends a single unfragmented frame; frames from servers are not masked
+func (c *Conn) write(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		c.fail()
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) fail() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// read answers the browser's pings and close, ignoring the messages it sends
+func (c *Conn) read(r *bufio.Reader) {
+	defer c.fail()
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		opcode, payload, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			if c.write(opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			// Echo the status code, as the protocol asks
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.write(opClose, payload)
+			return
+		}
+	}
+}
+
+// ping keeps the connection alive, and readTimeout drops it once the browser stops answering
+func (c *Conn) ping() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if c.write(opPing, nil) != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// readFrame reads one frame from a browser, unmasking its payload
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked frame from client")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	if length > maxFrame {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", length)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// headerContains reports whether the comma separated header name lists token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+// Package checker watches an IMAP mailbox for new email. It is the engine of the
+// n0tif command, for Go programs that want mailbox watching without running it:
+//
+//	c, err := checker.New("imap.example.com", "me@example.com", password,
+//		checker.WithInterval(time.Minute),
+//		checker.WithDataDir(dir))
+//	if err != nil {
+//		return err
+//	}
+//	err = c.Watch(ctx, func(ctx context.Context, emails []checker.Email) {
+//		for _, e := range emails {
+//			fmt.Println(e.From, e.Subject)
+//		}
+//	})
+//
+// Only email that arrives after the first check is reported; the state that
+// remembers what was seen is kept in the data folder between runs.
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/byigitt/n0tif/config"
+	"github.com/byigitt/n0tif/internal/email"
+	"github.com/byigitt/n0tif/internal/storage"
+)
+
+// ErrAlreadyWatching is returned by Watch when the checker is, or was, already watching
+var ErrAlreadyWatching = errors.New("checker: Watch was already called")
+
+// Email is a newly arrived message
+type Email struct {
+	Mailbox string
+	UID     uint32
+	From    string // "Name <user@host>" or the bare address
+	Subject string
+	Date    time.Time // when the server received it
+}
+
+// Status describes the most recent check
+type Status struct {
+	LastCheck   time.Time // zero before the first check
+	LastSuccess time.Time // zero before the first successful check
+	LastError   string    // error of the last check, empty if it succeeded
+	NextCheck   time.Time // when Watch checks next
+}
+
+// Checker watches one mailbox of one account
+type Checker interface {
+	// Check looks for new email once and returns it, newest first. Cancelling ctx
+	// aborts the check by closing the connection.
+	Check(ctx context.Context) ([]Email, error)
+	// Watch checks right away and then every interval, calling handle with each
+	// batch of new email, until ctx is done; it then returns ctx.Err(). Failed
+	// checks are retried at the next interval. Watch may be called only once.
+	Watch(ctx context.Context, handle func(ctx context.Context, emails []Email)) error
+	// Status reports the outcome of the most recent check
+	Status() Status
+}
+
+// Option configures a Checker
+type Option func(*options)
+
+type options struct {
+	port      int
+	interval  time.Duration
+	name      string
+	dataDir   string
+	scheduler *Scheduler
+	email     []email.Option
+}
+
+// WithPort sets the IMAPS port; the default is 993
+func WithPort(port int) Option {
+	return func(o *options) { o.port = port }
+}
+
+// WithInterval sets how often Watch checks; the default is one minute
+func WithInterval(d time.Duration) Option {
+	return func(o *options) { o.interval = d }
+}
+
+// WithName sets a display name for the account, used in logs
+func WithName(name string) Option {
+	return func(o *options) { o.name = name }
+}
+
+// WithDataDir keeps the seen-email state in dir rather than in the n0tif folder
+// of the user's profile, which the n0tif command uses. The setting applies to
+// the whole process.
+func WithDataDir(dir string) Option {
+	return func(o *options) { o.dataDir = dir }
+}
+
+// WithTLSConfig sets the TLS configuration of the connections, e.g. to trust a
+// private CA; by default the server is verified against the system roots
+func WithTLSConfig(c *tls.Config) Option {
+	return func(o *options) { o.email = append(o.email, email.WithTLSConfig(c)) }
+}
+
+// WithDialer makes the checker connect through dial, e.g. the Dial method of a
+// SOCKS proxy dialer, rather than directly
+func WithDialer(dial func(network, addr string) (net.Conn, error)) Option {
+	return func(o *options) { o.email = append(o.email, email.WithDialer(dialerFunc(dial))) }
+}
+
+// dialerFunc adapts a function to email.Dialer
+type dialerFunc func(network, addr string) (net.Conn, error)
+
+func (f dialerFunc) Dial(network, addr string) (net.Conn, error) { return f(network, addr) }
+
+// Scheduler is shared by the checkers of several accounts watched by one program.
+// It runs at most a fixed number of their checks at once, starts each account at
+// an offset of its own so they don't all log in together, and cancels checks that
+// take too long, so a server that hangs doesn't hold up the other accounts.
+type Scheduler struct {
+	s *email.Scheduler
+}
+
+// NewScheduler returns a scheduler running up to workers checks at once (4 if
+// workers is not positive). Each account's first check waits up to jitter, at an
+// offset derived from the username; checks taking longer than timeout fail.
+// Zero disables the jitter or the timeout.
+func NewScheduler(workers int, jitter, timeout time.Duration) *Scheduler {
+	return &Scheduler{s: email.NewScheduler(workers, jitter, timeout)}
+}
+
+// WithScheduler makes Watch run its checks through s; see Scheduler. Check is
+// not affected.
+func WithScheduler(s *Scheduler) Option {
+	return func(o *options) { o.scheduler = s }
+}
+
+// New creates a checker for the INBOX of username on server, connecting over TLS
+func New(server, username, password string, opts ...Option) (Checker, error) {
+	o := options{port: 993, interval: time.Minute}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if server == "" || username == "" {
+		return nil, errors.New("checker: server and username are required")
+	}
+	if o.interval < time.Second {
+		return nil, fmt.Errorf("checker: interval must be at least a second, got %v", o.interval)
+	}
+	if o.dataDir != "" {
+		if err := storage.SetDataFolder(o.dataDir); err != nil {
+			return nil, fmt.Errorf("checker: data folder: %w", err)
+		}
+	}
+
+	ic, err := email.NewChecker(config.EmailConfig{
+		Name:          o.name,
+		ImapServer:    server,
+		ImapPort:      o.port,
+		Username:      username,
+		Password:      password,
+		CheckInterval: int(o.interval / time.Second),
+	}, o.email...)
+	if err != nil {
+		return nil, fmt.Errorf("checker: %w", err)
+	}
+	if o.scheduler != nil {
+		ic.SetScheduler(o.scheduler.s)
+	}
+	return &imapChecker{ic: ic}, nil
+}
+
+// imapChecker adapts the checker of the n0tif command to Checker
+type imapChecker struct {
+	ic       *email.ImapChecker
+	watching atomic.Bool
+}
+
+func (c *imapChecker) Check(ctx context.Context) ([]Email, error) {
+	records, err := c.ic.Check(ctx)
+	return toEmails(records), err
+}
+
+func (c *imapChecker) Watch(ctx context.Context, handle func(ctx context.Context, emails []Email)) error {
+	if !c.watching.CompareAndSwap(false, true) {
+		return ErrAlreadyWatching
+	}
+	c.ic.StartChecking(func(ctx context.Context, records []storage.MessageRecord) {
+		handle(ctx, toEmails(records))
+	})
+	<-ctx.Done()
+	c.ic.Stop()
+	return ctx.Err()
+}
+
+func (c *imapChecker) Status() Status {
+	s := c.ic.Status()
+	return Status{
+		LastCheck:   s.LastCheck,
+		LastSuccess: s.LastSuccess,
+		LastError:   s.LastError,
+		NextCheck:   s.NextCheck,
+	}
+}
+
+func toEmails(records []storage.MessageRecord) []Email {
+	if records == nil {
+		return nil
+	}
+	emails := make([]Email, len(records))
+	for i, r := range records {
+		emails[i] = Email{Mailbox: r.Mailbox, UID: r.UID, From: r.From, Subject: r.Subject, Date: r.Date}
+	}
+	return emails
+}
@@ -0,0 +1,86 @@
+// Package notify shows desktop notifications the way n0tif does: as Windows
+// toast notifications, optionally with the mail sound and a longer display time.
+// Elsewhere they go through notify-send or, on macOS, Notification Center, which
+// show the text but not every option.
+//
+//	n := notify.New(notify.WithAppID("My Mail Watcher"))
+//	err := n.Notify(ctx, notify.Notification{Title: "New Email", Message: subject, Urgent: true})
+package notify
+
+import (
+	"context"
+
+	"github.com/byigitt/n0tif/internal/notify"
+)
+
+// DefaultAppID is the notification source shown when WithAppID isn't used
+const DefaultAppID = notify.DefaultAppID
+
+// Notification is one message to show
+type Notification struct {
+	Title   string
+	Message string
+	// Urgent plays the mail sound and keeps the toast on screen longer
+	Urgent bool
+	// Duration is DurationShort or DurationLong; empty leaves it to Urgent
+	Duration string
+	// Scenario is one of the Scenario constants; empty is ScenarioDefault
+	Scenario string
+	// SuppressPopup puts the notification in the Action Center without showing it
+	SuppressPopup bool
+}
+
+// Durations of a notification on screen
+const (
+	DurationShort = "short" // about 7 seconds
+	DurationLong  = "long"  // about 25 seconds
+)
+
+// Scenarios of a notification. All but ScenarioDefault keep it on screen until
+// it is clicked or dismissed.
+const (
+	ScenarioDefault      = "default"
+	ScenarioReminder     = "reminder"
+	ScenarioAlarm        = "alarm"        // also loops the sound
+	ScenarioIncomingCall = "incomingCall" // also loops the sound and shows the notification larger
+)
+
+// Notifier shows notifications
+type Notifier interface {
+	// Notify shows n. It returns ctx.Err() without showing anything once ctx is done.
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Option configures a Notifier
+type Option func(*notify.Identity)
+
+// WithAppID sets the source name shown on the notifications, which also groups them in the Action Center
+func WithAppID(appID string) Option {
+	return func(id *notify.Identity) { id.AppID = appID }
+}
+
+// WithIcon shows the image at path, which must be absolute, next to the text
+func WithIcon(path string) Option {
+	return func(id *notify.Identity) { id.Icon = path }
+}
+
+// New returns a Notifier that shows Windows toast notifications
+func New(opts ...Option) Notifier {
+	var id notify.Identity
+	for _, opt := range opts {
+		opt(&id)
+	}
+	return toastNotifier{id: id}
+}
+
+type toastNotifier struct {
+	id notify.Identity
+}
+
+func (t toastNotifier) Notify(ctx context.Context, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	style := notify.Style{Duration: n.Duration, Scenario: n.Scenario, SuppressPopup: n.SuppressPopup}
+	return notify.SendWindowsNotification(t.id, n.Title, n.Message, n.Urgent, notify.WithStyle(style))
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/byigitt/n0tif/internal/logging"
+	"github.com/byigitt/n0tif/pkg/checker"
+)
+
+func init() {
+	RegisterNotifier("log", newLogNotifier)
+	RegisterSource("imap", newIMAPSource)
+}
+
+// newLogNotifier writes each event to the n0tif log, which is handy to try a
+// pipeline out and to keep a record next to other notifiers
+func newLogNotifier(options json.RawMessage) (Notifier, error) {
+	if err := decodeOptions(options, &struct{}{}); err != nil {
+		return nil, err
+	}
+	log := logging.For("pipeline")
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		log.With("source", e.Source, "account", e.Account).Infof("%s: %s", e.Title, e.Message)
+		return nil
+	}), nil
+}
+
+// imapOptions configure the imap source
+type imapOptions struct {
+	Server   string `json:"server"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Interval int    `json:"interval"` // seconds between checks
+	DataDir  string `json:"data_dir"`
+}
+
+// imapSource turns the new email of a checker into events
+type imapSource struct {
+	username string
+	checker  checker.Checker
+}
+
+func newIMAPSource(options json.RawMessage) (Source, error) {
+	o := imapOptions{Port: 993, Interval: 60}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Server == "" || o.Username == "" {
+		return nil, errors.New("server and username are required")
+	}
+	opts := []checker.Option{checker.WithPort(o.Port), checker.WithInterval(time.Duration(o.Interval) * time.Second)}
+	if o.DataDir != "" {
+		opts = append(opts, checker.WithDataDir(o.DataDir))
+	}
+	c, err := checker.New(o.Server, o.Username, o.Password, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &imapSource{username: o.Username, checker: c}, nil
+}
+
+func (s *imapSource) Watch(ctx context.Context) (<-chan Event, error) {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		s.checker.Watch(ctx, func(ctx context.Context, emails []checker.Email) {
+			select {
+			case events <- NewEmailEvent("imap", s.username, emails):
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return events, nil
+}
+
+// NewEmailEvent describes a batch of new emails the way n0tif's toasts do
+func NewEmailEvent(source, account string, emails []checker.Email) Event {
+	e := Event{Time: time.Now(), Source: source, Account: account, Urgent: true, Emails: emails}
+	switch len(emails) {
+	case 0:
+	case 1:
+		e.Title = "New Email"
+		e.Message = "You have a new email: " + emails[0].Subject
+	default:
+		e.Title = "New Emails"
+		e.Message = fmt.Sprintf("You have %d new emails. Most recent: %s", len(emails), emails[0].Subject)
+	}
+	return e
+}
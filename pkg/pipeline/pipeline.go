@@ -0,0 +1,135 @@
+// Package pipeline connects sources of events, such as a watched mailbox, to
+// notifiers, such as Windows toasts, by name. Implementations register a factory
+// under a name, usually from an init function, and a pipeline is built from a
+// configuration that lists the names with their options:
+//
+//	p, err := pipeline.New(pipeline.Config{
+//		Sources:   []pipeline.Spec{{Type: "imap", Options: json.RawMessage(`{"server": "imap.example.com", ...}`)}},
+//		Notifiers: []pipeline.Spec{{Type: "toast"}, {Type: "log"}},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	return p.Run(ctx, nil)
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byigitt/n0tif/pkg/checker"
+)
+
+// Event is something a user is told about
+type Event struct {
+	Time    time.Time
+	Source  string // the type of the source that produced it, e.g. "imap"
+	Account string // the account it concerns, if any
+	Title   string
+	Message string
+	Urgent  bool            // new email, as opposed to news about n0tif itself
+	Emails  []checker.Email // the new emails, newest first, for email events
+}
+
+// Notifier delivers events to the user
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Source produces events until ctx is done, then closes the channel
+type Source interface {
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// NotifierFunc adapts a function to Notifier
+type NotifierFunc func(ctx context.Context, e Event) error
+
+// Notify calls f
+func (f NotifierFunc) Notify(ctx context.Context, e Event) error { return f(ctx, e) }
+
+// Spec names a registered implementation and carries its options as JSON
+type Spec struct {
+	Type    string          `json:"type"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// Config lists the sources and notifiers of a pipeline
+type Config struct {
+	Sources   []Spec `json:"sources"`
+	Notifiers []Spec `json:"notifiers"`
+}
+
+// Pipeline passes every event of its sources to all of its notifiers
+type Pipeline struct {
+	sources   []Source
+	notifiers []named
+}
+
+type named struct {
+	name string
+	Notifier
+}
+
+// New builds the sources and notifiers of cfg from the registry
+func New(cfg Config) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, spec := range cfg.Sources {
+		s, err := NewSource(spec)
+		if err != nil {
+			return nil, err
+		}
+		p.sources = append(p.sources, s)
+	}
+	for _, spec := range cfg.Notifiers {
+		n, err := NewNotifier(spec)
+		if err != nil {
+			return nil, err
+		}
+		p.notifiers = append(p.notifiers, named{name: spec.Type, Notifier: n})
+	}
+	return p, nil
+}
+
+// Notify passes e to every notifier. One failing notifier doesn't keep the
+// others from being told; their errors are returned together.
+func (p *Pipeline) Notify(ctx context.Context, e Event) error {
+	var errs []error
+	for _, n := range p.notifiers {
+		if err := n.Notify(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run watches all sources and notifies about their events until ctx is done.
+// Notification errors are passed to onError when it is set; Run returns the
+// first error starting a source, or ctx.Err().
+func (p *Pipeline) Run(ctx context.Context, onError func(error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, s := range p.sources {
+		events, err := s.Watch(ctx)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range events {
+				if err := p.Notify(ctx, e); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}()
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("push", newPushNotifier)
+}
+
+// Push services the push notifier delivers to
+const (
+	PushNtfy     = "ntfy"     // an ntfy topic URL, such as https://ntfy.sh/my-topic
+	PushPushover = "pushover" // the Pushover API, with an application token and a user key
+	PushWebhook  = "webhook"  // a bridge to FCM or APNs, e.g. of a companion app, that gets the event as JSON
+)
+
+const pushoverURL = "https://api.pushover.net/1/messages.json"
+
+// pushOptions configure the push notifier
+type pushOptions struct {
+	Service string `json:"service"`
+	URL     string `json:"url"`            // required but for pushover
+	Token   string `json:"token"`          // bearer token of ntfy or the webhook; application token of pushover
+	User    string `json:"user,omitempty"` // pushover user or group key
+}
+
+// pushPayload is the JSON a webhook receives
+type pushPayload struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Account string    `json:"account,omitempty"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Urgent  bool      `json:"urgent"`
+}
+
+// pushNotifier forwards events to a push service, so they reach a phone
+type pushNotifier struct {
+	options pushOptions
+	client  *http.Client
+}
+
+// newPushNotifier delivers events to the push service of its options
+func newPushNotifier(options json.RawMessage) (Notifier, error) {
+	var o pushOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	switch o.Service {
+	case PushNtfy, PushWebhook:
+		if u, err := url.Parse(o.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("url %q must be an http(s) URL", o.URL)
+		}
+	case PushPushover:
+		if o.Token == "" || o.User == "" {
+			return nil, errors.New("pushover needs the token of an application and a user key")
+		}
+		if o.URL == "" {
+			o.URL = pushoverURL
+		}
+	default:
+		return nil, fmt.Errorf("service %q is invalid: use %s, %s or %s", o.Service, PushNtfy, PushPushover, PushWebhook)
+	}
+	return &pushNotifier{options: o, client: &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+func (p *pushNotifier) Notify(ctx context.Context, e Event) error {
+	var req *http.Request
+	var err error
+	switch p.options.Service {
+	case PushNtfy:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.options.URL, strings.NewReader(e.Message))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Title", e.Title)
+		req.Header.Set("Tags", "email")
+		if e.Urgent {
+			req.Header.Set("Priority", "high")
+		}
+	case PushPushover:
+		form := url.Values{
+			"token":   {p.options.Token},
+			"user":    {p.options.User},
+			"title":   {e.Title},
+			"message": {e.Message},
+		}
+		if e.Urgent {
+			form.Set("priority", "1")
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.options.URL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	case PushWebhook:
+		body, err := json.Marshal(pushPayload{
+			Time:    e.Time,
+			Source:  e.Source,
+			Account: e.Account,
+			Title:   e.Title,
+			Message: e.Message,
+			Urgent:  e.Urgent,
+		})
+		if err != nil {
+			return err
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.options.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Pushover takes its token in the form
+	if p.options.Token != "" && p.options.Service != PushPushover {
+		req.Header.Set("Authorization", "Bearer "+p.options.Token)
+	}
+
+	return send(p.client, p.options.Service, req)
+}
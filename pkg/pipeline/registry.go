@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// NotifierFactory creates a notifier from its JSON options, which may be empty
+type NotifierFactory func(options json.RawMessage) (Notifier, error)
+
+// SourceFactory creates a source from its JSON options, which may be empty
+type SourceFactory func(options json.RawMessage) (Source, error)
+
+var (
+	registryMu sync.RWMutex
+	notifiers  = make(map[string]NotifierFactory)
+	sources    = make(map[string]SourceFactory)
+)
+
+// RegisterNotifier makes a notifier available under name. It panics if the
+// name is taken, like registering a database/sql driver twice.
+func RegisterNotifier(name string, factory NotifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := notifiers[name]; dup {
+		panic("pipeline: notifier " + name + " registered twice")
+	}
+	notifiers[name] = factory
+}
+
+// RegisterSource makes a source available under name. It panics if the name is taken.
+func RegisterSource(name string, factory SourceFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := sources[name]; dup {
+		panic("pipeline: source " + name + " registered twice")
+	}
+	sources[name] = factory
+}
+
+// NewNotifier creates the notifier spec names
+func NewNotifier(spec Spec) (Notifier, error) {
+	registryMu.RLock()
+	factory, ok := notifiers[spec.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier %q; available: %v", spec.Type, Notifiers())
+	}
+	n, err := factory(spec.Options)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %s: %w", spec.Type, err)
+	}
+	return n, nil
+}
+
+// NewSource creates the source spec names
+func NewSource(spec Spec) (Source, error) {
+	registryMu.RLock()
+	factory, ok := sources[spec.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q; available: %v", spec.Type, Sources())
+	}
+	s, err := factory(spec.Options)
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %w", spec.Type, err)
+	}
+	return s, nil
+}
+
+// Notifiers returns the names of the registered notifiers, sorted
+func Notifiers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(notifiers)
+}
+
+// Sources returns the names of the registered sources, sorted
+func Sources() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(sources)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeOptions strictly decodes the options of a spec into v; empty options leave v unchanged
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
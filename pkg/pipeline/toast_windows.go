@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/byigitt/n0tif/pkg/notify"
+)
+
+func init() {
+	RegisterNotifier("toast", newToastNotifier)
+}
+
+// toastOptions configure the toast notifier
+type toastOptions struct {
+	AppID string `json:"app_id"`
+	Icon  string `json:"icon"`
+}
+
+// newToastNotifier shows events as Windows toast notifications
+func newToastNotifier(options json.RawMessage) (Notifier, error) {
+	var o toastOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	var opts []notify.Option
+	if o.AppID != "" {
+		opts = append(opts, notify.WithAppID(o.AppID))
+	}
+	if o.Icon != "" {
+		opts = append(opts, notify.WithIcon(o.Icon))
+	}
+	n := notify.New(opts...)
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		return n.Notify(ctx, notify.Notification{Title: e.Title, Message: e.Message, Urgent: e.Urgent})
+	}), nil
+}
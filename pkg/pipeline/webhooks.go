@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("ifttt", newIFTTTNotifier)
+	RegisterNotifier("zapier", newZapierNotifier)
+}
+
+// webhookTimeout bounds one request to a web service
+const webhookTimeout = 15 * time.Second
+
+// defaultIFTTTEvent is the event name triggered when the options don't name one
+const defaultIFTTTEvent = "n0tif_email"
+
+// iftttOptions configure the ifttt notifier
+type iftttOptions struct {
+	Key   string `json:"key"`   // from the settings of the Webhooks service on ifttt.com
+	Event string `json:"event"` // the event name the applet listens for
+}
+
+// iftttPayload is what the Webhooks service passes to applets as Value1 to Value3
+type iftttPayload struct {
+	Value1 string `json:"value1"`
+	Value2 string `json:"value2"`
+	Value3 string `json:"value3"`
+}
+
+// newIFTTTNotifier triggers an IFTTT Webhooks event per notification, with the
+// title, the message and the sender of the newest email as Value1 to Value3
+func newIFTTTNotifier(options json.RawMessage) (Notifier, error) {
+	o := iftttOptions{Event: defaultIFTTTEvent}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Key == "" {
+		return nil, errors.New("key is required; find it in the settings of the Webhooks service on ifttt.com")
+	}
+	endpoint := fmt.Sprintf("https://maker.ifttt.com/trigger/%s/with/key/%s", url.PathEscape(o.Event), url.PathEscape(o.Key))
+	client := &http.Client{Timeout: webhookTimeout}
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		p := iftttPayload{Value1: e.Title, Value2: e.Message}
+		if len(e.Emails) > 0 {
+			p.Value3 = e.Emails[0].From
+		}
+		return postJSON(ctx, client, "IFTTT", endpoint, p)
+	}), nil
+}
+
+// zapierOptions configure the zapier notifier
+type zapierOptions struct {
+	URL string `json:"url"` // the address of a "Catch Hook" trigger
+}
+
+// zapierPayload is flat, as Zapier offers top-level fields most readily; the
+// emails are also listed for Zaps that loop over them
+type zapierPayload struct {
+	Time    time.Time     `json:"time"`
+	Account string        `json:"account"`
+	Title   string        `json:"title"`
+	Message string        `json:"message"`
+	Urgent  bool          `json:"urgent"`
+	Count   int           `json:"count"`             // number of new emails
+	From    string        `json:"from,omitempty"`    // of the newest email
+	Subject string        `json:"subject,omitempty"` // of the newest email
+	Mailbox string        `json:"mailbox,omitempty"` // of the newest email
+	Emails  []zapierEmail `json:"emails"`
+}
+
+type zapierEmail struct {
+	From    string    `json:"from"`
+	Subject string    `json:"subject"`
+	Mailbox string    `json:"mailbox"`
+	Date    time.Time `json:"date"`
+}
+
+// newZapierNotifier posts each notification to a Zapier Catch Hook
+func newZapierNotifier(options json.RawMessage) (Notifier, error) {
+	var o zapierOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(o.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("url %q must be the https address of a Catch Hook", o.URL)
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		p := zapierPayload{
+			Time:    e.Time,
+			Account: e.Account,
+			Title:   e.Title,
+			Message: e.Message,
+			Urgent:  e.Urgent,
+			Count:   len(e.Emails),
+			Emails:  []zapierEmail{},
+		}
+		for _, m := range e.Emails {
+			p.Emails = append(p.Emails, zapierEmail{From: m.From, Subject: m.Subject, Mailbox: m.Mailbox, Date: m.Date})
+		}
+		if len(e.Emails) > 0 {
+			p.From, p.Subject, p.Mailbox = e.Emails[0].From, e.Emails[0].Subject, e.Emails[0].Mailbox
+		}
+		return postJSON(ctx, client, "Zapier", o.URL, p)
+	}), nil
+}
+
+// postJSON posts v as JSON to endpoint of service
+func postJSON(ctx context.Context, client *http.Client, service, endpoint string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(client, service, req)
+}
+
+// send makes req to service, turning an unsuccessful status into an error
+func send(client *http.Client, service string, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL of some services carries their key; keep it out of the log
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s: %w", service, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(detail)); msg != "" {
+			return fmt.Errorf("%s answered %s: %s", service, resp.Status, msg)
+		}
+		return fmt.Errorf("%s answered %s", service, resp.Status)
+	}
+	return nil
+}